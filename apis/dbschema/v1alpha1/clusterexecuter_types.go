@@ -17,6 +17,49 @@ type NamespacedName struct {
 type ClusterTargets struct {
 	DBs     []string `json:"dbs,omitempty"`
 	Schemas []string `json:"schemas,omitempty"`
+	// SchemaTargets are the DB and schema of each of the `Schemas` by its target name
+	SchemaTargets map[string]SchemaTarget `json:"schemaTargets,omitempty"`
+	// Outputs contains values produced by the execution (e.g. registered schema IDs)
+	// to be published to the output `ConfigMap`
+	Outputs map[string]string `json:"outputs,omitempty"`
+	// Results contains the execution result per DB
+	Results []DBResult `json:"results,omitempty"`
+	// Skipped are the DBs matching the filter that the schema isn't executed on (e.g. read-only follower DBs)
+	Skipped []SkippedTarget `json:"skipped,omitempty"`
+}
+
+// SchemaTarget is a schema in a DB
+type SchemaTarget struct {
+	DB     string `json:"db"`
+	Schema string `json:"schema"`
+}
+
+// SkippedTarget is a DB matching the filter that the schema isn't executed on
+type SkippedTarget struct {
+	DB string `json:"db"`
+	// Reason is why the DB is skipped, e.g. `Follower` or `ReadOnly`
+	Reason  string `json:"reason"`
+	Message string `json:"message,omitempty"`
+}
+
+// DBResult is the execution result on a single DB
+type DBResult struct {
+	DB       string `json:"db"`
+	Executed bool   `json:"executed"`
+	// Schemas is the number of schemas executed in the DB
+	Schemas int    `json:"schemas,omitempty"`
+	Error   string `json:"error,omitempty"`
+}
+
+// ExecutionRun is a single execution run as a Kubernetes `Job`
+type ExecutionRun struct {
+	Job            string       `json:"job"`
+	Pod            string       `json:"pod,omitempty"`
+	StartTime      *metav1.Time `json:"startTime,omitempty"`
+	CompletionTime *metav1.Time `json:"completionTime,omitempty"`
+	Succeeded      bool         `json:"succeeded"`
+	// Logs is where the logs of the run are retained
+	Logs string `json:"logs,omitempty"`
 }
 
 // ExecutionConfiguration contains the required configuration for execution
@@ -41,22 +84,50 @@ type ClusterExecuterSpec struct {
 	ConfigMapName  NamespacedName `json:"configMapName"`
 	FailIfDataLoss bool           `json:"failIfDataLoss"`
 	Revision       int32          `json:"revision"`
+	// +kubebuilder:validation:Optional
+	OutputConfigMap *NamespacedName `json:"outputConfigMap,omitempty"`
+	// +kubebuilder:validation:Optional
+	ExecutionTimeout *metav1.Duration `json:"executionTimeout,omitempty"`
+	// +kubebuilder:validation:Optional
+	Runner *RunnerSpec `json:"runner,omitempty"`
+	// Paused stops starting new executions
+	// +kubebuilder:validation:Optional
+	Paused bool `json:"paused,omitempty"`
+	// Restarts counts the restart requests - every increment executes the revision again on all the targets
+	// +kubebuilder:validation:Optional
+	Restarts int32 `json:"restarts,omitempty"`
 }
 
 // ClusterExecuterStatus defines the observed state of ClusterExecuter
 type ClusterExecuterStatus struct {
 	// INSERT ADDITIONAL STATUS FIELD - define observed state of cluster
 	// Important: Run "make" to regenerate code after modifying this file
-	Executed     bool                   `json:"executed"`
-	Running      bool                   `json:"running"`
-	Failed       bool                   `json:"failed"`
-	Targets      ClusterTargets         `json:"targets"`
-	DoneTargets  ClusterTargets         `json:"done"`
-	Config       ExecutionConfiguration `json:"config,omitempty"`
-	NumFailures  int                    `json:"numFailures,omitempty"`
-	CompletedPCT int                    `json:"completedPct,omitempty"`
+	Executed    bool           `json:"executed"`
+	Running     bool           `json:"running"`
+	Failed      bool           `json:"failed"`
+	Targets     ClusterTargets `json:"targets"`
+	DoneTargets ClusterTargets `json:"done"`
+	// FailedTargets contains the targets that failed on the last execution
+	FailedTargets ClusterTargets         `json:"failedTargets,omitempty"`
+	Config        ExecutionConfiguration `json:"config,omitempty"`
+	// DBResults contains the result per DB of the last execution
+	DBResults []DBResult `json:"dbResults,omitempty"`
+	// Job is the `Job` of the current (or last) execution when running as jobs
+	Job string `json:"job,omitempty"`
+	// JobRuns is the number of execution jobs started for the executer
+	JobRuns int32 `json:"jobRuns,omitempty"`
+	// Runs are the retained execution job runs, newest first
+	Runs []ExecutionRun `json:"runs,omitempty"`
+	// Logs is where the captured output of the last execution is stored, e.g. `configmap/<executer>-logs`
+	Logs string `json:"logs,omitempty"`
+	// ObservedRestarts is the last restart request handled by the executer
+	ObservedRestarts int32 `json:"observedRestarts,omitempty"`
+	// StartTime is the start time of the last execution
+	StartTime    *metav1.Time `json:"startTime,omitempty"`
+	NumFailures  int          `json:"numFailures,omitempty"`
+	CompletedPCT int          `json:"completedPct,omitempty"`
 	// Conditions is an array of conditions.
-	// Known .status.conditions.type are: "Execution"
+	// Known .status.conditions.type are: "Execution", "Targets", "TimedOut", "Paused"
 	//+patchMergeKey=type
 	//+patchStrategy=merge
 	//+listType=map
@@ -95,3 +166,11 @@ func init() {
 func (t *ClusterExecuter) IsExecuted() bool {
 	return t.Status.Executed
 }
+
+// MaxExecutionFailures is the number of failed executions after which the executer stops retrying
+const MaxExecutionFailures = 3
+
+// IsExhausted checks if the cluster executer failed and exhausted its retries.
+func (t *ClusterExecuter) IsExhausted() bool {
+	return t.Status.Failed && t.Status.NumFailures > MaxExecutionFailures
+}
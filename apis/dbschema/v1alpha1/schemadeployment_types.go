@@ -4,6 +4,7 @@
 package v1alpha1
 
 import (
+	corev1 "k8s.io/api/core/v1"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 )
 
@@ -33,24 +34,84 @@ const (
 	DBTypeKusto DBTypeEnum = "kusto"
 	// DBTypeEventhub eventhub schema registry enum entry
 	DBTypeEventhub DBTypeEnum = "eventhub"
+	// DBTypePostgres PostgreSQL enum entry
+	DBTypePostgres DBTypeEnum = "postgres"
+	// DBTypeCosmos Cosmos DB enum entry
+	DBTypeCosmos DBTypeEnum = "cosmos"
 	// ConditionExecution execution condition status
 	ConditionExecution string = "Execution"
+	// ConditionTargets target discovery condition status
+	ConditionTargets string = "Targets"
+	// ConditionTimedOut is set when the last execution was stopped by the execution timeout
+	ConditionTimedOut string = "TimedOut"
+	// ConditionPaused is set while the deployment is paused
+	ConditionPaused string = "Paused"
 )
 
+// RunnerModeEnum Enum for where the executions run
+// +kubebuilder:validation:Enum=inProcess;job
+type RunnerModeEnum string
+
+const (
+	// RunnerModeInProcess runs the executions in the operator pod
+	RunnerModeInProcess RunnerModeEnum = "inProcess"
+	// RunnerModeJob runs each execution as a Kubernetes `Job`
+	RunnerModeJob RunnerModeEnum = "job"
+)
+
+// RunnerSpec configures where the executions of a deployment run
+type RunnerSpec struct {
+	// Mode is `inProcess` (default) or `job`
+	// +kubebuilder:validation:Optional
+	Mode RunnerModeEnum `json:"mode,omitempty"`
+	// Image of the execution jobs, defaults to the operator image
+	// +kubebuilder:validation:Optional
+	Image string `json:"image,omitempty"`
+	// ServiceAccountName of the execution jobs. Jobs with a service account are labeled for azure workload identity.
+	// +kubebuilder:validation:Optional
+	ServiceAccountName string `json:"serviceAccountName,omitempty"`
+	// +kubebuilder:validation:Optional
+	Resources corev1.ResourceRequirements `json:"resources,omitempty"`
+	// +kubebuilder:validation:Optional
+	NodeSelector map[string]string `json:"nodeSelector,omitempty"`
+	// +kubebuilder:validation:Optional
+	Tolerations []corev1.Toleration `json:"tolerations,omitempty"`
+	// Env are additional environment variables of the execution jobs
+	// +kubebuilder:validation:Optional
+	Env []corev1.EnvVar `json:"env,omitempty"`
+	// HistoryLimit is the number of finished jobs (and their logs) kept per executer
+	// +kubebuilder:validation:Optional
+	// +kubebuilder:validation:Minimum=1
+	HistoryLimit *int32 `json:"historyLimit,omitempty"`
+}
+
 // TargetFilter contains target filter configuration
 type TargetFilter struct {
 	// +kubebuilder:validation:MinItems:=1
 	ClusterUris []string `json:"clusterUris"`
-	Schema      string   `json:"schema,omitempty"`
-	DB          string   `json:"db"`
+	// Schema is a regexp selecting the schemas to run on (SQL Server)
+	Schema string `json:"schema,omitempty"`
+	// IncludeSchemas are additional regexps selecting the schemas to run on
+	// +kubebuilder:validation:Optional
+	IncludeSchemas []string `json:"includeSchemas,omitempty"`
+	// ExcludeSchemas are regexps of schemas to skip even if selected
+	// +kubebuilder:validation:Optional
+	ExcludeSchemas []string `json:"excludeSchemas,omitempty"`
+	// Schemas is an explicit list of schemas to run on
+	// +kubebuilder:validation:Optional
+	Schemas []string `json:"schemas,omitempty"`
+	// DB is the target DB (a regexp of DBs for Kusto, or for SQL Server when `regexp` is set)
+	DB string `json:"db"`
 	// +kubebuilder:validation:Optional
 	Webhook string `json:"webhook,omitempty"`
 	// +kubebuilder:validation:Optional
 	Label string `json:"label,omitempty"`
 	// +kubebuilder:validation:Optional
-	DBS    []string `json:"dbs,omitempty"`
-	Create bool     `json:"create,omitempty"`
-	Regexp bool     `json:"regexp,omitempty"`
+	DBS []string `json:"dbs,omitempty"`
+	// Create runs on explicitly listed (or discovered) schemas that don't exist yet, creating them
+	Create bool `json:"create,omitempty"`
+	// Regexp matches `db` as a regexp against the DBs on the server (SQL Server)
+	Regexp bool `json:"regexp,omitempty"`
 }
 
 // SchemaDeploymentSpec defines the desired state of SchemaDeployment
@@ -66,6 +127,24 @@ type SchemaDeploymentSpec struct {
 	FailurePolicy FailurePolicyEnum `json:"failurePolicy"`
 	// +kubebuilder:default:=true
 	FailIfDataLoss bool `json:"failIfDataLoss"`
+	// OutputConfigMap is the `ConfigMap` to publish execution outputs to,
+	// e.g. the registered eventhub schema IDs and versions keyed by schema name.
+	// +kubebuilder:validation:Optional
+	OutputConfigMap *NamespacedName `json:"outputConfigMap,omitempty"`
+	// ExecutionTimeout limits the execution time on each cluster, e.g. `30m`.
+	// Running sqlpackage/delta-kusto processes are killed once it passes.
+	// +kubebuilder:validation:Optional
+	ExecutionTimeout *metav1.Duration `json:"executionTimeout,omitempty"`
+	// Runner configures where the executions run, in the operator pod or as Kubernetes `Jobs`.
+	// +kubebuilder:validation:Optional
+	Runner *RunnerSpec `json:"runner,omitempty"`
+	// Paused stops starting new executions, running executions are completed.
+	// +kubebuilder:validation:Optional
+	Paused bool `json:"paused,omitempty"`
+	// Restarts counts the restart requests - every increment executes the current revision again on all the targets.
+	// +kubebuilder:validation:Optional
+	// +kubebuilder:validation:Minimum=0
+	Restarts int32 `json:"restarts,omitempty"`
 }
 
 // SchemaDeploymentStatus defines the observed state of SchemaDeployment
@@ -81,7 +160,7 @@ type SchemaDeploymentStatus struct {
 	CurrentVerDeployment   NamespacedName   `json:"currentVerDeployment"`
 	OldVerDeployment       []NamespacedName `json:"oldVerDeployment,omitempty"`
 	// Conditions is an array of conditions.
-	// Known .status.conditions.type are: "Execution"
+	// Known .status.conditions.type are: "Execution", "Paused"
 	//+patchMergeKey=type
 	//+patchStrategy=merge
 	//+listType=map
@@ -21,6 +21,16 @@ type VersionedDeplymentSpec struct {
 	ApplyTo        TargetFilter   `json:"applyTo"`
 	Type           DBTypeEnum     `json:"type"`
 	FailIfDataLoss bool           `json:"failIfDataLoss"`
+	// +kubebuilder:validation:Optional
+	OutputConfigMap *NamespacedName `json:"outputConfigMap,omitempty"`
+	// +kubebuilder:validation:Optional
+	ExecutionTimeout *metav1.Duration `json:"executionTimeout,omitempty"`
+	// +kubebuilder:validation:Optional
+	Runner *RunnerSpec `json:"runner,omitempty"`
+	// +kubebuilder:validation:Optional
+	Paused bool `json:"paused,omitempty"`
+	// +kubebuilder:validation:Optional
+	Restarts int32 `json:"restarts,omitempty"`
 }
 
 // VersionedDeplymentStatus defines the observed state of VersionedDeplyment
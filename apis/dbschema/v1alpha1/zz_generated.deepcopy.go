@@ -11,6 +11,7 @@ Licensed under the MIT license.
 package v1alpha1
 
 import (
+	corev1 "k8s.io/api/core/v1"
 	"k8s.io/apimachinery/pkg/apis/meta/v1"
 	runtime "k8s.io/apimachinery/pkg/runtime"
 )
@@ -79,6 +80,21 @@ func (in *ClusterExecuterSpec) DeepCopyInto(out *ClusterExecuterSpec) {
 	*out = *in
 	in.ApplyTo.DeepCopyInto(&out.ApplyTo)
 	out.ConfigMapName = in.ConfigMapName
+	if in.OutputConfigMap != nil {
+		in, out := &in.OutputConfigMap, &out.OutputConfigMap
+		*out = new(NamespacedName)
+		**out = **in
+	}
+	if in.ExecutionTimeout != nil {
+		in, out := &in.ExecutionTimeout, &out.ExecutionTimeout
+		*out = new(v1.Duration)
+		**out = **in
+	}
+	if in.Runner != nil {
+		in, out := &in.Runner, &out.Runner
+		*out = new(RunnerSpec)
+		(*in).DeepCopyInto(*out)
+	}
 }
 
 // DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new ClusterExecuterSpec.
@@ -96,7 +112,24 @@ func (in *ClusterExecuterStatus) DeepCopyInto(out *ClusterExecuterStatus) {
 	*out = *in
 	in.Targets.DeepCopyInto(&out.Targets)
 	in.DoneTargets.DeepCopyInto(&out.DoneTargets)
+	in.FailedTargets.DeepCopyInto(&out.FailedTargets)
 	in.Config.DeepCopyInto(&out.Config)
+	if in.DBResults != nil {
+		in, out := &in.DBResults, &out.DBResults
+		*out = make([]DBResult, len(*in))
+		copy(*out, *in)
+	}
+	if in.Runs != nil {
+		in, out := &in.Runs, &out.Runs
+		*out = make([]ExecutionRun, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
+	if in.StartTime != nil {
+		in, out := &in.StartTime, &out.StartTime
+		*out = (*in).DeepCopy()
+	}
 	if in.Conditions != nil {
 		in, out := &in.Conditions, &out.Conditions
 		*out = make([]v1.Condition, len(*in))
@@ -129,6 +162,30 @@ func (in *ClusterTargets) DeepCopyInto(out *ClusterTargets) {
 		*out = make([]string, len(*in))
 		copy(*out, *in)
 	}
+	if in.SchemaTargets != nil {
+		in, out := &in.SchemaTargets, &out.SchemaTargets
+		*out = make(map[string]SchemaTarget, len(*in))
+		for key, val := range *in {
+			(*out)[key] = val
+		}
+	}
+	if in.Outputs != nil {
+		in, out := &in.Outputs, &out.Outputs
+		*out = make(map[string]string, len(*in))
+		for key, val := range *in {
+			(*out)[key] = val
+		}
+	}
+	if in.Results != nil {
+		in, out := &in.Results, &out.Results
+		*out = make([]DBResult, len(*in))
+		copy(*out, *in)
+	}
+	if in.Skipped != nil {
+		in, out := &in.Skipped, &out.Skipped
+		*out = make([]SkippedTarget, len(*in))
+		copy(*out, *in)
+	}
 }
 
 // DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new ClusterTargets.
@@ -141,6 +198,21 @@ func (in *ClusterTargets) DeepCopy() *ClusterTargets {
 	return out
 }
 
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *DBResult) DeepCopyInto(out *DBResult) {
+	*out = *in
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new DBResult.
+func (in *DBResult) DeepCopy() *DBResult {
+	if in == nil {
+		return nil
+	}
+	out := new(DBResult)
+	in.DeepCopyInto(out)
+	return out
+}
+
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *ExecutionConfiguration) DeepCopyInto(out *ExecutionConfiguration) {
 	*out = *in
@@ -163,6 +235,29 @@ func (in *ExecutionConfiguration) DeepCopy() *ExecutionConfiguration {
 	return out
 }
 
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *ExecutionRun) DeepCopyInto(out *ExecutionRun) {
+	*out = *in
+	if in.StartTime != nil {
+		in, out := &in.StartTime, &out.StartTime
+		*out = (*in).DeepCopy()
+	}
+	if in.CompletionTime != nil {
+		in, out := &in.CompletionTime, &out.CompletionTime
+		*out = (*in).DeepCopy()
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new ExecutionRun.
+func (in *ExecutionRun) DeepCopy() *ExecutionRun {
+	if in == nil {
+		return nil
+	}
+	out := new(ExecutionRun)
+	in.DeepCopyInto(out)
+	return out
+}
+
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *NamespacedName) DeepCopyInto(out *NamespacedName) {
 	*out = *in
@@ -178,6 +273,48 @@ func (in *NamespacedName) DeepCopy() *NamespacedName {
 	return out
 }
 
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *RunnerSpec) DeepCopyInto(out *RunnerSpec) {
+	*out = *in
+	in.Resources.DeepCopyInto(&out.Resources)
+	if in.NodeSelector != nil {
+		in, out := &in.NodeSelector, &out.NodeSelector
+		*out = make(map[string]string, len(*in))
+		for key, val := range *in {
+			(*out)[key] = val
+		}
+	}
+	if in.Tolerations != nil {
+		in, out := &in.Tolerations, &out.Tolerations
+		*out = make([]corev1.Toleration, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
+	if in.Env != nil {
+		in, out := &in.Env, &out.Env
+		*out = make([]corev1.EnvVar, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
+	if in.HistoryLimit != nil {
+		in, out := &in.HistoryLimit, &out.HistoryLimit
+		*out = new(int32)
+		**out = **in
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new RunnerSpec.
+func (in *RunnerSpec) DeepCopy() *RunnerSpec {
+	if in == nil {
+		return nil
+	}
+	out := new(RunnerSpec)
+	in.DeepCopyInto(out)
+	return out
+}
+
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *SchemaDeployment) DeepCopyInto(out *SchemaDeployment) {
 	*out = *in
@@ -242,6 +379,21 @@ func (in *SchemaDeploymentSpec) DeepCopyInto(out *SchemaDeploymentSpec) {
 	*out = *in
 	in.ApplyTo.DeepCopyInto(&out.ApplyTo)
 	out.Source = in.Source
+	if in.OutputConfigMap != nil {
+		in, out := &in.OutputConfigMap, &out.OutputConfigMap
+		*out = new(NamespacedName)
+		**out = **in
+	}
+	if in.ExecutionTimeout != nil {
+		in, out := &in.ExecutionTimeout, &out.ExecutionTimeout
+		*out = new(v1.Duration)
+		**out = **in
+	}
+	if in.Runner != nil {
+		in, out := &in.Runner, &out.Runner
+		*out = new(RunnerSpec)
+		(*in).DeepCopyInto(*out)
+	}
 }
 
 // DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new SchemaDeploymentSpec.
@@ -283,6 +435,36 @@ func (in *SchemaDeploymentStatus) DeepCopy() *SchemaDeploymentStatus {
 	return out
 }
 
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *SchemaTarget) DeepCopyInto(out *SchemaTarget) {
+	*out = *in
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new SchemaTarget.
+func (in *SchemaTarget) DeepCopy() *SchemaTarget {
+	if in == nil {
+		return nil
+	}
+	out := new(SchemaTarget)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *SkippedTarget) DeepCopyInto(out *SkippedTarget) {
+	*out = *in
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new SkippedTarget.
+func (in *SkippedTarget) DeepCopy() *SkippedTarget {
+	if in == nil {
+		return nil
+	}
+	out := new(SkippedTarget)
+	in.DeepCopyInto(out)
+	return out
+}
+
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *TargetFilter) DeepCopyInto(out *TargetFilter) {
 	*out = *in
@@ -291,6 +473,21 @@ func (in *TargetFilter) DeepCopyInto(out *TargetFilter) {
 		*out = make([]string, len(*in))
 		copy(*out, *in)
 	}
+	if in.IncludeSchemas != nil {
+		in, out := &in.IncludeSchemas, &out.IncludeSchemas
+		*out = make([]string, len(*in))
+		copy(*out, *in)
+	}
+	if in.ExcludeSchemas != nil {
+		in, out := &in.ExcludeSchemas, &out.ExcludeSchemas
+		*out = make([]string, len(*in))
+		copy(*out, *in)
+	}
+	if in.Schemas != nil {
+		in, out := &in.Schemas, &out.Schemas
+		*out = make([]string, len(*in))
+		copy(*out, *in)
+	}
 	if in.DBS != nil {
 		in, out := &in.DBS, &out.DBS
 		*out = make([]string, len(*in))
@@ -372,6 +569,21 @@ func (in *VersionedDeplymentSpec) DeepCopyInto(out *VersionedDeplymentSpec) {
 	*out = *in
 	out.ConfigMapName = in.ConfigMapName
 	in.ApplyTo.DeepCopyInto(&out.ApplyTo)
+	if in.OutputConfigMap != nil {
+		in, out := &in.OutputConfigMap, &out.OutputConfigMap
+		*out = new(NamespacedName)
+		**out = **in
+	}
+	if in.ExecutionTimeout != nil {
+		in, out := &in.ExecutionTimeout, &out.ExecutionTimeout
+		*out = new(v1.Duration)
+		**out = **in
+	}
+	if in.Runner != nil {
+		in, out := &in.Runner, &out.Runner
+		*out = new(RunnerSpec)
+		(*in).DeepCopyInto(*out)
+	}
 }
 
 // DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new VersionedDeplymentSpec.
@@ -9,6 +9,7 @@ import (
 	schemav1alpha1 "github.com/microsoft/azure-schema-operator/apis/dbschema/v1alpha1"
 	"github.com/olekukonko/tablewriter"
 	"github.com/spf13/cobra"
+	"k8s.io/apimachinery/pkg/runtime"
 	"k8s.io/cli-runtime/pkg/genericclioptions"
 	"k8s.io/client-go/kubernetes"
 	"k8s.io/client-go/kubernetes/scheme"
@@ -100,6 +101,21 @@ func (o *CommonOptions) newTable(headers []string, out io.Writer) *tablewriter.T
 	return table
 }
 
+// setObjectKinds sets the type of the objects, as the printers expect
+func setObjectKinds(objects ...runtime.Object) error {
+	if err := schemav1alpha1.AddToScheme(scheme.Scheme); err != nil {
+		return err
+	}
+	for _, obj := range objects {
+		gvk, err := apiutil.GVKForObject(obj, scheme.Scheme)
+		if err != nil {
+			return err
+		}
+		obj.GetObjectKind().SetGroupVersionKind(gvk)
+	}
+	return nil
+}
+
 // NewClient returns a new controller-runtime client instance
 func NewClient(clientConfig clientcmd.ClientConfig) (client.Client, error) {
 	restConfig, err := clientConfig.ClientConfig()
@@ -0,0 +1,260 @@
+package schemaop
+
+// Copyright (c) Microsoft Corporation.
+// Licensed under the MIT License.
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/spf13/cobra"
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/cli-runtime/pkg/genericclioptions"
+	"k8s.io/cli-runtime/pkg/printers"
+
+	schemav1alpha1 "github.com/microsoft/azure-schema-operator/apis/dbschema/v1alpha1"
+	"github.com/microsoft/azure-schema-operator/pkg/cluster"
+	"github.com/microsoft/azure-schema-operator/pkg/schemafiles"
+)
+
+var (
+	createLong = `
+		Create a schema deployment and its source configMap.
+		The schema type is detected by the file extension (or set with --type) and the schema file is written
+		into the configMap key of the type. The target filter and the schema are validated before anything is created.`
+
+	createExample = `
+		# Deploy a KQL schema to all the DBs matching a regexp on two clusters
+		kubectl schemaop create tenants --from-file schema.kql --db '^tenant_' \
+			--cluster https://cluster1.westeurope.kusto.windows.net --cluster https://cluster2.westeurope.kusto.windows.net
+		# Deploy a KQL schema to the DBs returned by a webhook
+		kubectl schemaop create premium --from-file ./kql/ --cluster https://cluster1.westeurope.kusto.windows.net \
+			--webhook 'https://tenants.contoso.com/dbs?cluster={{.Cluster}}&tier={{.Label}}' --label premium
+		# Deploy a dacpac to the tenant schemas of a SQL Server DB
+		kubectl schemaop create sql-tenants --from-file db.dacpac --cluster server1.database.windows.net \
+			--db db1 --schema '^tenant_' --template-name dbo
+		# Print the objects instead of creating them
+		kubectl schemaop create tenants --from-file schema.kql --cluster https://cluster1.westeurope.kusto.windows.net --dry-run`
+)
+
+// SchemaCreateOptions holds the options for 'schema create' sub command
+type SchemaCreateOptions struct {
+	CommonOptions
+	PrintFlags *genericclioptions.PrintFlags
+	ToPrinter  func(string) (printers.ResourcePrinter, error)
+
+	Namespace        string
+	Name             string
+	Source           string
+	FromFile         string
+	Type             string
+	Filter           schemav1alpha1.TargetFilter
+	FailurePolicy    string
+	FailIfDataLoss   bool
+	ExecutionTimeout time.Duration
+	DryRun           bool
+	SourceKeyOptions
+
+	dbType schemav1alpha1.DBTypeEnum
+
+	genericclioptions.IOStreams
+}
+
+// NewSchemaCreateOptions returns an initialized SchemaCreateOptions instance
+func NewSchemaCreateOptions(streams genericclioptions.IOStreams) *SchemaCreateOptions {
+	o := &SchemaCreateOptions{
+		PrintFlags:     genericclioptions.NewPrintFlags("created").WithDefaultOutput("yaml"),
+		FailurePolicy:  string(schemav1alpha1.FailurePolicyRollback),
+		FailIfDataLoss: true,
+		IOStreams:      streams,
+	}
+	o.SetConfigFlags()
+	return o
+}
+
+// NewCmdSchemaCreate returns a Command instance for create sub command
+func NewCmdSchemaCreate(streams genericclioptions.IOStreams) *cobra.Command {
+	o := NewSchemaCreateOptions(streams)
+
+	cmd := &cobra.Command{
+		Use:                   "create NAME --from-file FILE --cluster URI [flags]",
+		DisableFlagsInUseLine: true,
+		Short:                 "Create a schema deployment",
+		Long:                  createLong,
+		Example:               createExample,
+		Args:                  cobra.MaximumNArgs(1),
+		RunE: func(c *cobra.Command, args []string) error {
+			if err := o.Complete(c, args); err != nil {
+				return err
+			}
+			if err := o.Validate(); err != nil {
+				return err
+			}
+			return o.Run()
+		},
+	}
+
+	cmd.Flags().StringVar(&o.Namespace, "namespace", o.Namespace, "namespace of the schema deployment")
+	cmd.Flags().StringVar(&o.Name, "name", o.Name, "name of the schema deployment")
+	cmd.Flags().StringVar(&o.Source, "source", o.Source, "name of the source configMap (default <name>-source)")
+	cmd.Flags().StringVar(&o.FromFile, "from-file", o.FromFile, "path to the schema file, or a directory of KQL files")
+	cmd.Flags().StringVar(&o.Type, "type", o.Type, "schema type (kusto, sqlServer, eventhub, postgres or cosmos), detected by the file extension by default")
+	cmd.Flags().StringSliceVar(&o.Filter.ClusterUris, "cluster", o.Filter.ClusterUris, "cluster (server or event hubs namespace) uri to deploy to (can be repeated)")
+	cmd.Flags().StringVar(&o.Filter.DB, "db", o.Filter.DB, "DB to deploy to - a regexp of DBs on kusto (and on SQL Server with --regexp)")
+	cmd.Flags().StringSliceVar(&o.Filter.DBS, "dbs", o.Filter.DBS, "explicit list of DBs to deploy to")
+	cmd.Flags().BoolVar(&o.Filter.Regexp, "regexp", o.Filter.Regexp, "match --db as a regexp (SQL Server)")
+	cmd.Flags().StringVar(&o.Filter.Schema, "schema", o.Filter.Schema, "regexp of the schemas to deploy to (SQL Server)")
+	cmd.Flags().StringSliceVar(&o.Filter.IncludeSchemas, "include-schema", o.Filter.IncludeSchemas, "additional regexp of schemas to deploy to (SQL Server, can be repeated)")
+	cmd.Flags().StringSliceVar(&o.Filter.ExcludeSchemas, "exclude-schema", o.Filter.ExcludeSchemas, "regexp of schemas to skip (SQL Server, can be repeated)")
+	cmd.Flags().StringSliceVar(&o.Filter.Schemas, "schemas", o.Filter.Schemas, "explicit list of schemas to deploy to (SQL Server)")
+	cmd.Flags().BoolVar(&o.Filter.Create, "create", o.Filter.Create, "create the listed schemas that don't exist yet (SQL Server)")
+	cmd.Flags().StringVar(&o.Filter.Webhook, "webhook", o.Filter.Webhook, "url template of a webhook returning the targets, e.g. https://tenants/dbs?cluster={{.Cluster}}&label={{.Label}}")
+	cmd.Flags().StringVar(&o.Filter.Label, "label", o.Filter.Label, "label passed to the webhook")
+	cmd.Flags().StringVar(&o.FailurePolicy, "failure-policy", o.FailurePolicy, "failure policy (rollback, abort or ignore)")
+	cmd.Flags().BoolVar(&o.FailIfDataLoss, "fail-if-data-loss", o.FailIfDataLoss, "fail executions that may lose data")
+	cmd.Flags().DurationVar(&o.ExecutionTimeout, "execution-timeout", o.ExecutionTimeout, "execution time limit on each cluster, zero means no limit")
+	cmd.Flags().BoolVar(&o.DryRun, "dry-run", o.DryRun, "dry-run - only print the objects")
+	o.SourceKeyOptions.AddFlags(cmd)
+	o.PrintFlags.AddFlags(cmd)
+
+	return cmd
+}
+
+// Complete completes al the required options
+func (o *SchemaCreateOptions) Complete(cmd *cobra.Command, args []string) error {
+	if len(args) > 0 {
+		o.Name = args[0]
+	}
+	if o.Source == "" && o.Name != "" {
+		o.Source = o.Name + "-source"
+	}
+
+	o.ToPrinter = func(operation string) (printers.ResourcePrinter, error) {
+		o.PrintFlags.NamePrintFlags.Operation = operation
+		return o.PrintFlags.ToPrinter()
+	}
+
+	// dry runs don't need a cluster connection
+	if !o.DryRun {
+		if err := o.Init(cmd); err != nil {
+			return err
+		}
+	}
+	if o.Namespace == "" {
+		namespace, _, err := o.GetClientConfig().Namespace()
+		if err != nil {
+			return err
+		}
+		o.Namespace = namespace
+	}
+
+	return o.SourceKeyOptions.Complete(cmd, o.Namespace)
+}
+
+// Validate makes sure all the provided values for command-line options are valid
+func (o *SchemaCreateOptions) Validate() error {
+	if o.Name == "" {
+		return errors.New("the schema deployment name is required")
+	}
+	if o.FromFile == "" {
+		return errors.New("the schema file is required (--from-file)")
+	}
+	o.dbType = schemav1alpha1.DBTypeEnum(o.Type)
+	if o.Type == "" {
+		dbType, err := schemafiles.DetectType(o.FromFile)
+		if err != nil {
+			return fmt.Errorf("%w - use --type to set it", err)
+		}
+		o.dbType = dbType
+	}
+	switch schemav1alpha1.FailurePolicyEnum(o.FailurePolicy) {
+	case schemav1alpha1.FailurePolicyRollback, schemav1alpha1.FailurePolicyAbort, schemav1alpha1.FailurePolicyIgnore:
+	default:
+		return fmt.Errorf("unknown failure policy %q", o.FailurePolicy)
+	}
+	if o.ExecutionTimeout < 0 {
+		return errors.New("--execution-timeout can't be negative")
+	}
+	if err := cluster.ValidateFilter(o.dbType, o.Filter); err != nil {
+		return err
+	}
+	return o.SourceKeyOptions.Validate(o.dbType)
+}
+
+// Run performs the execution of 'schema create' sub command
+func (o *SchemaCreateOptions) Run() error {
+	cfgMap, template, err := o.newObjects()
+	if err != nil {
+		return err
+	}
+
+	if o.DryRun {
+		printer, err := o.ToPrinter("created (dry run)")
+		if err != nil {
+			return err
+		}
+		for _, obj := range []runtime.Object{cfgMap, template} {
+			if err := printer.PrintObj(obj, o.Out); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+
+	ctx := context.Background()
+	if err := o.Client.Create(ctx, cfgMap); err != nil {
+		return fmt.Errorf("unable to create the source configMap: %w", err)
+	}
+	if err := o.Client.Create(ctx, template); err != nil {
+		// don't leave a source configMap without a deployment behind
+		if deleteErr := o.Client.Delete(ctx, cfgMap); deleteErr != nil {
+			fmt.Fprintf(o.ErrOut, "unable to delete the source configMap %s: %s\n", cfgMap.Name, deleteErr)
+		}
+		return fmt.Errorf("unable to create the schema deployment: %w", err)
+	}
+	fmt.Fprintf(o.Out, "configmap/%s created\n", cfgMap.Name)
+	fmt.Fprintf(o.Out, "schemadeployment/%s created\n", template.Name)
+	return nil
+}
+
+// newObjects returns the source configMap with the schema and the schema deployment
+func (o *SchemaCreateOptions) newObjects() (*v1.ConfigMap, *schemav1alpha1.SchemaDeployment, error) {
+	cfgMap := &v1.ConfigMap{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      o.Source,
+			Namespace: o.Namespace,
+		},
+	}
+	if err := schemafiles.Apply(cfgMap, o.FromFile, o.dbType); err != nil {
+		return nil, nil, err
+	}
+	o.SourceKeyOptions.Apply(cfgMap)
+
+	template := &schemav1alpha1.SchemaDeployment{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      o.Name,
+			Namespace: o.Namespace,
+		},
+		Spec: schemav1alpha1.SchemaDeploymentSpec{
+			ApplyTo: o.Filter,
+			Type:    o.dbType,
+			Source: schemav1alpha1.NamespacedName{
+				Name:      cfgMap.Name,
+				Namespace: cfgMap.Namespace,
+			},
+			FailurePolicy:  schemav1alpha1.FailurePolicyEnum(o.FailurePolicy),
+			FailIfDataLoss: o.FailIfDataLoss,
+		},
+	}
+	if o.ExecutionTimeout > 0 {
+		template.Spec.ExecutionTimeout = &metav1.Duration{Duration: o.ExecutionTimeout}
+	}
+
+	if err := setObjectKinds(cfgMap, template); err != nil {
+		return nil, nil, err
+	}
+	return cfgMap, template, nil
+}
@@ -0,0 +1,238 @@
+package schemaop
+
+// Copyright (c) Microsoft Corporation.
+// Licensed under the MIT License.
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+
+	"github.com/spf13/cobra"
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/cli-runtime/pkg/genericclioptions"
+
+	schemav1alpha1 "github.com/microsoft/azure-schema-operator/apis/dbschema/v1alpha1"
+	"github.com/microsoft/azure-schema-operator/pkg/cluster"
+	"github.com/microsoft/azure-schema-operator/pkg/kustoutils"
+	"github.com/microsoft/azure-schema-operator/pkg/schemadiff"
+	"github.com/microsoft/azure-schema-operator/pkg/sqlutils"
+	"github.com/microsoft/azure-schema-operator/pkg/utils/schemaversions"
+)
+
+var (
+	diffLong = `
+		Show what a schema revision changes.
+		Compares the versioned ConfigMaps of two revisions (KQL, scripts, Avro schemas and dacpac models),
+		or a revision with the live schema of a database on one of the clusters.`
+
+	diffExample = `
+		# Diff the current revision with the previous one
+		kubectl schemaop diff master-test-template
+		# Diff two revisions
+		kubectl schemaop diff master-test-template --from-revision=1 --to-revision=3
+		# Show what the current revision would change on a live database
+		kubectl schemaop diff master-test-template --against-live --cluster=mycluster --db=db1`
+)
+
+// SchemaDiffOptions holds the options for 'schema diff' sub command
+type SchemaDiffOptions struct {
+	CommonOptions
+
+	FromRevision int64
+	ToRevision   int64
+	AgainstLive  bool
+	Cluster      string
+	DB           string
+	Schema       string
+	Namespace    string
+	Name         string
+
+	genericclioptions.IOStreams
+}
+
+// NewSchemaDiffOptions returns an initialized SchemaDiffOptions instance
+func NewSchemaDiffOptions(streams genericclioptions.IOStreams) *SchemaDiffOptions {
+	o := &SchemaDiffOptions{
+		FromRevision: -1,
+		ToRevision:   -1,
+		IOStreams:    streams,
+	}
+	o.SetConfigFlags()
+	return o
+}
+
+// NewCmdSchemaDiff returns a Command instance for diff sub command
+func NewCmdSchemaDiff(streams genericclioptions.IOStreams) *cobra.Command {
+	o := NewSchemaDiffOptions(streams)
+
+	cmd := &cobra.Command{
+		Use:                   "diff [NAME] [flags]",
+		DisableFlagsInUseLine: true,
+		Short:                 "Show what a schema revision changes",
+		Long:                  diffLong,
+		Example:               diffExample,
+		Args:                  cobra.MaximumNArgs(1),
+		RunE: func(c *cobra.Command, args []string) error {
+			if err := o.Complete(c, args); err != nil {
+				return err
+			}
+			if err := o.Validate(); err != nil {
+				return err
+			}
+			return o.Run()
+		},
+	}
+
+	cmd.Flags().Int64Var(&o.FromRevision, "from-revision", o.FromRevision, "revision to diff from (default the revision before --to-revision)")
+	cmd.Flags().Int64Var(&o.ToRevision, "to-revision", o.ToRevision, "revision to diff to (default the current revision)")
+	cmd.Flags().BoolVar(&o.AgainstLive, "against-live", o.AgainstLive, "diff the revision (--to-revision) with the live schema of --db on --cluster")
+	cmd.Flags().StringVar(&o.Cluster, "cluster", o.Cluster, "cluster (name or uri) of the live database")
+	cmd.Flags().StringVar(&o.DB, "db", o.DB, "live database to diff with")
+	cmd.Flags().StringVar(&o.Schema, "schema", o.Schema, "schema of the live database to diff with (SQL Server schema per tenant deployments)")
+	cmd.Flags().StringVar(&o.Namespace, "namespace", "default", "namespace of schema")
+	cmd.Flags().StringVar(&o.Name, "name", o.Name, "name of schema template")
+
+	return cmd
+}
+
+// Complete completes al the required options
+func (o *SchemaDiffOptions) Complete(cmd *cobra.Command, args []string) error {
+	if len(args) > 0 {
+		o.Name = args[0]
+	}
+	return o.Init(cmd)
+}
+
+// Validate makes sure all the provided values for command-line options are valid
+func (o *SchemaDiffOptions) Validate() error {
+	if o.Name == "" {
+		return errors.New("the schema name is required")
+	}
+	if o.AgainstLive {
+		if o.Cluster == "" || o.DB == "" {
+			return errors.New("--cluster and --db are required with --against-live")
+		}
+		if o.FromRevision >= 0 {
+			return errors.New("--from-revision can't be used with --against-live")
+		}
+	}
+	return nil
+}
+
+// Run performs the execution of 'schema diff' sub command
+func (o *SchemaDiffOptions) Run() error {
+	ctx := context.TODO()
+	template := &schemav1alpha1.SchemaDeployment{}
+	key := types.NamespacedName{
+		Name:      o.Name,
+		Namespace: o.Namespace,
+	}
+	if err := o.Client.Get(ctx, key, template); err != nil {
+		return fmt.Errorf("unable to get template: %w", err)
+	}
+	toRevision := template.Status.CurrentRevision
+	if o.ToRevision >= 0 {
+		toRevision = int32(o.ToRevision)
+	}
+	to, err := o.getRevisionConfigMap(ctx, template, toRevision)
+	if err != nil {
+		return err
+	}
+
+	var diff string
+	if o.AgainstLive {
+		diff, err = o.diffLive(ctx, template, to, toRevision)
+	} else {
+		fromRevision := toRevision - 1
+		if o.FromRevision >= 0 {
+			fromRevision = int32(o.FromRevision)
+		}
+		var from *v1.ConfigMap
+		if fromRevision >= 0 {
+			from, err = o.getRevisionConfigMap(ctx, template, fromRevision)
+			if err != nil {
+				return err
+			}
+		}
+		diff, err = schemadiff.ConfigMaps(from, to, revisionLabel(fromRevision), revisionLabel(toRevision))
+	}
+	if err != nil {
+		return err
+	}
+	if diff == "" {
+		fmt.Fprintln(o.Out, "no differences")
+		return nil
+	}
+	fmt.Fprint(o.Out, diff)
+	return nil
+}
+
+func revisionLabel(revision int32) string {
+	return "revision-" + strconv.Itoa(int(revision))
+}
+
+// getRevisionConfigMap returns the immutable versioned `ConfigMap` of the revision
+func (o *SchemaDiffOptions) getRevisionConfigMap(ctx context.Context, template *schemav1alpha1.SchemaDeployment, revision int32) (*v1.ConfigMap, error) {
+	cfgMap := &v1.ConfigMap{}
+	key := types.NamespacedName{
+		Name:      schemaversions.NameForConfigMap(template.Spec.Source.Name, revision),
+		Namespace: template.Spec.Source.Namespace,
+	}
+	if err := o.Client.Get(ctx, key, cfgMap); err != nil {
+		return nil, fmt.Errorf("unable to get the configmap of revision %d: %w", revision, err)
+	}
+	return cfgMap, nil
+}
+
+// diffLive diffs the revision with the live database, showing the changes the revision would make
+func (o *SchemaDiffOptions) diffLive(ctx context.Context, template *schemav1alpha1.SchemaDeployment, cfgMap *v1.ConfigMap, revision int32) (string, error) {
+	uri := ""
+	for _, clusterURI := range template.Spec.ApplyTo.ClusterUris {
+		if clusterURI == o.Cluster || cluster.ClusterNameFromURI(clusterURI) == o.Cluster {
+			uri = clusterURI
+		}
+	}
+	if uri == "" {
+		return "", fmt.Errorf("cluster %s is not one of the deployment clusters", o.Cluster)
+	}
+	live := "live/" + cluster.ClusterNameFromURI(uri) + "/" + o.DB
+	engine, err := cluster.Lookup(template.Spec.Type)
+	if err != nil {
+		return "", err
+	}
+	if !engine.Capabilities.DryRun {
+		return "", fmt.Errorf("live diff isn't supported for %s deployments", template.Spec.Type)
+	}
+
+	switch template.Spec.Type {
+	case schemav1alpha1.DBTypeKusto:
+		kql, ok := cfgMap.Data["kql"]
+		if !ok {
+			return "", errors.New("no kql found in configmap")
+		}
+		script, err := kustoutils.NewKustoCluster(uri, nil).DeltaScript(ctx, o.DB, kql)
+		if err != nil {
+			return "", fmt.Errorf("unable to compute the delta script for %s: %w", live, err)
+		}
+		if script == "" {
+			return "", nil
+		}
+		return fmt.Sprintf("// changes %s would apply on %s\n%s", revisionLabel(revision), live, script), nil
+	case schemav1alpha1.DBTypeSQLServer:
+		if o.Schema != "" {
+			live = live + "." + o.Schema
+		}
+		script, err := sqlutils.DeploymentScript(ctx, o.Client, uri, o.DB, o.Schema, cfgMap)
+		if err != nil {
+			return "", fmt.Errorf("unable to create the deployment script for %s: %w", live, err)
+		}
+		if script == "" {
+			return "", nil
+		}
+		return fmt.Sprintf("-- changes %s would apply on %s\n%s", revisionLabel(revision), live, script), nil
+	default:
+		return "", fmt.Errorf("live diff isn't supported for %s deployments", template.Spec.Type)
+	}
+}
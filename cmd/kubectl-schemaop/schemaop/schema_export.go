@@ -0,0 +1,267 @@
+package schemaop
+
+// Copyright (c) Microsoft Corporation.
+// Licensed under the MIT License.
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+
+	"github.com/spf13/cobra"
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/util/validation"
+	"k8s.io/cli-runtime/pkg/genericclioptions"
+	"k8s.io/cli-runtime/pkg/printers"
+
+	schemav1alpha1 "github.com/microsoft/azure-schema-operator/apis/dbschema/v1alpha1"
+	"github.com/microsoft/azure-schema-operator/pkg/cluster"
+	"github.com/microsoft/azure-schema-operator/pkg/kustoutils"
+	"github.com/microsoft/azure-schema-operator/pkg/schemafiles"
+	"github.com/microsoft/azure-schema-operator/pkg/sqlutils"
+)
+
+var (
+	exportLong = `
+		Export the schema of a live database into a schema deployment and its source configMap.
+		Kusto databases are exported as a KQL script (tables, functions, mappings and policies),
+		SQL Server databases are extracted into a dacpac with sqlpackage.
+		The exported deployment targets only the exported database, so applying it doesn't change the database.`
+
+	exportExample = `
+		# Print the deployment of a kusto database
+		kubectl schemaop export --type kusto --cluster https://cluster1.westeurope.kusto.windows.net --db tenant1
+		# Create the deployment of a SQL Server database
+		kubectl schemaop export orders --type sqlServer --cluster server1.database.windows.net --db orders --apply`
+)
+
+// invalidNameChars are the characters replaced when deriving object names from DB names
+var invalidNameChars = regexp.MustCompile(`[^a-z0-9.-]+`)
+
+// SchemaExportOptions holds the options for 'schema export' sub command
+type SchemaExportOptions struct {
+	CommonOptions
+	PrintFlags *genericclioptions.PrintFlags
+	ToPrinter  func(string) (printers.ResourcePrinter, error)
+
+	Namespace string
+	Name      string
+	Source    string
+	Type      string
+	Cluster   string
+	DB        string
+	Apply     bool
+
+	genericclioptions.IOStreams
+}
+
+// NewSchemaExportOptions returns an initialized SchemaExportOptions instance
+func NewSchemaExportOptions(streams genericclioptions.IOStreams) *SchemaExportOptions {
+	o := &SchemaExportOptions{
+		PrintFlags: genericclioptions.NewPrintFlags("exported").WithDefaultOutput("yaml"),
+		IOStreams:  streams,
+	}
+	o.SetConfigFlags()
+	return o
+}
+
+// NewCmdSchemaExport returns a Command instance for export sub command
+func NewCmdSchemaExport(streams genericclioptions.IOStreams) *cobra.Command {
+	o := NewSchemaExportOptions(streams)
+
+	cmd := &cobra.Command{
+		Use:                   "export [NAME] --type TYPE --cluster URI --db DB [flags]",
+		DisableFlagsInUseLine: true,
+		Short:                 "Export a live database into a schema deployment",
+		Long:                  exportLong,
+		Example:               exportExample,
+		Args:                  cobra.MaximumNArgs(1),
+		RunE: func(c *cobra.Command, args []string) error {
+			if err := o.Complete(c, args); err != nil {
+				return err
+			}
+			if err := o.Validate(); err != nil {
+				return err
+			}
+			return o.Run()
+		},
+	}
+
+	cmd.Flags().StringVar(&o.Namespace, "namespace", o.Namespace, "namespace of the schema deployment")
+	cmd.Flags().StringVar(&o.Name, "name", o.Name, "name of the schema deployment (default derived from the DB name)")
+	cmd.Flags().StringVar(&o.Source, "source", o.Source, "name of the source configMap (default <name>-source)")
+	cmd.Flags().StringVar(&o.Type, "type", o.Type, "database type (kusto or sqlServer)")
+	cmd.Flags().StringVar(&o.Cluster, "cluster", o.Cluster, "cluster (or server) uri of the database")
+	cmd.Flags().StringVar(&o.DB, "db", o.DB, "database to export")
+	cmd.Flags().BoolVar(&o.Apply, "apply", o.Apply, "create the exported objects instead of printing them")
+	o.PrintFlags.AddFlags(cmd)
+
+	return cmd
+}
+
+// Complete completes al the required options
+func (o *SchemaExportOptions) Complete(cmd *cobra.Command, args []string) error {
+	if len(args) > 0 {
+		o.Name = args[0]
+	}
+	if o.Name == "" {
+		o.Name = strings.Trim(invalidNameChars.ReplaceAllString(strings.ToLower(o.DB), "-"), "-.")
+	}
+	if o.Source == "" && o.Name != "" {
+		o.Source = o.Name + "-source"
+	}
+
+	o.ToPrinter = func(operation string) (printers.ResourcePrinter, error) {
+		o.PrintFlags.NamePrintFlags.Operation = operation
+		return o.PrintFlags.ToPrinter()
+	}
+
+	// printing the objects doesn't need a cluster connection
+	if o.Apply {
+		if err := o.Init(cmd); err != nil {
+			return err
+		}
+	}
+	if o.Namespace == "" {
+		namespace, _, err := o.GetClientConfig().Namespace()
+		if err != nil {
+			return err
+		}
+		o.Namespace = namespace
+	}
+	return nil
+}
+
+// Validate makes sure all the provided values for command-line options are valid
+func (o *SchemaExportOptions) Validate() error {
+	if o.Cluster == "" || o.DB == "" {
+		return errors.New("--cluster and --db are required")
+	}
+	if o.Type == "" {
+		return errors.New("--type is required")
+	}
+	engine, err := cluster.Lookup(schemav1alpha1.DBTypeEnum(o.Type))
+	if err != nil {
+		return err
+	}
+	// exporting reads back the live schema
+	if !engine.Capabilities.Drift {
+		return fmt.Errorf("export isn't supported for %s", o.Type)
+	}
+	if errs := validation.IsDNS1123Subdomain(o.Name); len(errs) > 0 {
+		return fmt.Errorf("invalid name %q - set a valid one with --name: %s", o.Name, strings.Join(errs, ", "))
+	}
+	return nil
+}
+
+// Run performs the execution of 'schema export' sub command
+func (o *SchemaExportOptions) Run() error {
+	ctx := context.Background()
+	cfgMap := &v1.ConfigMap{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      o.Source,
+			Namespace: o.Namespace,
+		},
+	}
+	filter := schemav1alpha1.TargetFilter{ClusterUris: []string{o.Cluster}}
+	dbType := schemav1alpha1.DBTypeEnum(o.Type)
+	switch dbType {
+	case schemav1alpha1.DBTypeKusto:
+		kql, err := kustoutils.NewKustoCluster(o.Cluster, nil).ExportScript(ctx, o.DB)
+		if err != nil {
+			return fmt.Errorf("unable to export the schema of %s: %w", o.DB, err)
+		}
+		if err := schemafiles.ValidateKQL(kql); err != nil {
+			return fmt.Errorf("unable to export the schema of %s: %w", o.DB, err)
+		}
+		cfgMap.Data = map[string]string{schemafiles.KQLKey: kql}
+		// the kusto db filter is a regexp - match only the exported DB
+		filter.DB = "^" + regexp.QuoteMeta(o.DB) + "$"
+	case schemav1alpha1.DBTypeSQLServer:
+		dacpac, err := o.extractDacPac(ctx)
+		if err != nil {
+			return err
+		}
+		cfgMap.BinaryData = map[string][]byte{schemafiles.DacPacKey: dacpac}
+		filter.DB = o.DB
+	default:
+		return fmt.Errorf("export isn't implemented for %s", o.Type)
+	}
+	if err := cluster.ValidateFilter(dbType, filter); err != nil {
+		return err
+	}
+
+	template := &schemav1alpha1.SchemaDeployment{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      o.Name,
+			Namespace: o.Namespace,
+		},
+		Spec: schemav1alpha1.SchemaDeploymentSpec{
+			ApplyTo: filter,
+			Type:    dbType,
+			Source: schemav1alpha1.NamespacedName{
+				Name:      cfgMap.Name,
+				Namespace: cfgMap.Namespace,
+			},
+			FailurePolicy:  schemav1alpha1.FailurePolicyRollback,
+			FailIfDataLoss: true,
+		},
+	}
+	if err := setObjectKinds(cfgMap, template); err != nil {
+		return err
+	}
+
+	if !o.Apply {
+		printer, err := o.ToPrinter("exported")
+		if err != nil {
+			return err
+		}
+		for _, obj := range []runtime.Object{cfgMap, template} {
+			if err := printer.PrintObj(obj, o.Out); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+
+	if err := o.Client.Create(ctx, cfgMap); err != nil {
+		return fmt.Errorf("unable to create the source configMap: %w", err)
+	}
+	if err := o.Client.Create(ctx, template); err != nil {
+		// don't leave a source configMap without a deployment behind
+		if deleteErr := o.Client.Delete(ctx, cfgMap); deleteErr != nil {
+			fmt.Fprintf(o.ErrOut, "unable to delete the source configMap %s: %s\n", cfgMap.Name, deleteErr)
+		}
+		return fmt.Errorf("unable to create the schema deployment: %w", err)
+	}
+	fmt.Fprintf(o.Out, "configmap/%s created\n", cfgMap.Name)
+	fmt.Fprintf(o.Out, "schemadeployment/%s created\n", template.Name)
+	return nil
+}
+
+// extractDacPac extracts the SQL Server DB into a dacpac, the sqlpackage output is shown on stderr
+func (o *SchemaExportOptions) extractDacPac(ctx context.Context) ([]byte, error) {
+	dir, err := os.MkdirTemp("", "schemaop-export-*")
+	if err != nil {
+		return nil, err
+	}
+	defer os.RemoveAll(dir)
+
+	dacpacFile := filepath.Join(dir, o.DB+".dacpac")
+	if err := sqlutils.ExtractDacPac(ctx, o.Cluster, o.DB, dacpacFile, o.ErrOut); err != nil {
+		return nil, fmt.Errorf("unable to extract %s: %w", o.DB, err)
+	}
+	dacpac, err := os.ReadFile(dacpacFile)
+	if err != nil {
+		return nil, err
+	}
+	if err := schemafiles.ValidateDacPac(dacpac); err != nil {
+		return nil, fmt.Errorf("invalid dacpac extracted from %s: %w", o.DB, err)
+	}
+	return dacpac, nil
+}
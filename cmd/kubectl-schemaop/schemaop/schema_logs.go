@@ -0,0 +1,199 @@
+package schemaop
+
+// Copyright (c) Microsoft Corporation.
+// Licensed under the MIT License.
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/spf13/cobra"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/cli-runtime/pkg/genericclioptions"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	schemav1alpha1 "github.com/microsoft/azure-schema-operator/apis/dbschema/v1alpha1"
+	"github.com/microsoft/azure-schema-operator/pkg/runlogs"
+)
+
+var (
+	logsLong = `
+		View the captured output of the schema executions.
+		The logs of the last execution on every cluster of the revision are shown, one section per target (DB or DB schema).`
+
+	logsExample = `
+		# View the logs of the current revision on all the clusters
+		kubectl schemaop logs --name master-test-template
+		# View the logs of revision 3 on a single cluster and DB
+		kubectl schemaop logs --name master-test-template --revision=3 --cluster=mycluster.westeurope --db=tenant1`
+)
+
+// SchemaLogsOptions holds the options for 'schema logs' sub command
+type SchemaLogsOptions struct {
+	CommonOptions
+
+	Revision  int64
+	Namespace string
+	Name      string
+	Cluster   string
+	DB        string
+
+	genericclioptions.IOStreams
+}
+
+// NewSchemaLogsOptions returns an initialized SchemaLogsOptions instance
+func NewSchemaLogsOptions(streams genericclioptions.IOStreams) *SchemaLogsOptions {
+	o := &SchemaLogsOptions{
+		Revision:  -1,
+		IOStreams: streams,
+	}
+	o.SetConfigFlags()
+	return o
+}
+
+// NewCmdSchemaLogs returns a Command instance for logs sub command
+func NewCmdSchemaLogs(streams genericclioptions.IOStreams) *cobra.Command {
+	o := NewSchemaLogsOptions(streams)
+
+	cmd := &cobra.Command{
+		Use:                   "logs [flags]",
+		DisableFlagsInUseLine: true,
+		Short:                 "View schema execution logs",
+		Long:                  logsLong,
+		Example:               logsExample,
+		RunE: func(c *cobra.Command, args []string) error {
+			if err := o.Complete(c, args); err != nil {
+				return err
+			}
+			if err := o.Validate(); err != nil {
+				return err
+			}
+			return o.Run()
+		},
+	}
+
+	cmd.Flags().Int64Var(&o.Revision, "revision", o.Revision, "revision to show the logs of (default the current revision)")
+	cmd.Flags().StringVar(&o.Namespace, "namespace", "default", "namespace of schema")
+	cmd.Flags().StringVar(&o.Name, "name", o.Name, "name of schema template")
+	cmd.Flags().StringVar(&o.Cluster, "cluster", o.Cluster, "only show the logs of the cluster (name or uri)")
+	cmd.Flags().StringVar(&o.DB, "db", o.DB, "only show the logs of the DB (and its schemas)")
+
+	return cmd
+}
+
+// Complete completes al the required options
+func (o *SchemaLogsOptions) Complete(cmd *cobra.Command, args []string) error {
+	return o.Init(cmd)
+}
+
+// Validate makes sure all the provided values for command-line options are valid
+func (o *SchemaLogsOptions) Validate() error {
+	if o.Name == "" {
+		return errors.New("the schema name is required (--name)")
+	}
+	return nil
+}
+
+// Run performs the execution of 'schema logs' sub command
+func (o *SchemaLogsOptions) Run() error {
+	ctx := context.TODO()
+	template := &schemav1alpha1.SchemaDeployment{}
+	key := types.NamespacedName{
+		Name:      o.Name,
+		Namespace: o.Namespace,
+	}
+	if err := o.Client.Get(ctx, key, template); err != nil {
+		return fmt.Errorf("unable to get template: %w", err)
+	}
+	revision := int64(template.Status.CurrentRevision)
+	if o.Revision >= 0 {
+		revision = o.Revision
+	}
+	vd := &schemav1alpha1.VersionedDeplyment{}
+	vdKey := types.NamespacedName{
+		Name:      template.Name + "-" + strconv.Itoa(int(revision)),
+		Namespace: o.Namespace,
+	}
+	if err := o.Client.Get(ctx, vdKey, vd); err != nil {
+		return fmt.Errorf("unable to get revision %d: %w", revision, err)
+	}
+
+	executers, err := o.getClusterExecuters(ctx, vd)
+	if err != nil {
+		return err
+	}
+	if len(executers) == 0 {
+		fmt.Fprintf(o.Out, "no cluster executions found for revision %d\n", revision)
+		return nil
+	}
+	store := runlogs.NewConfigMapStore(o.Client)
+	for i := range executers {
+		if err := o.printLogs(ctx, store, vd, &executers[i]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// getClusterExecuters returns the executers of the revision matching the cluster filter
+func (o *SchemaLogsOptions) getClusterExecuters(ctx context.Context, vd *schemav1alpha1.VersionedDeplyment) ([]schemav1alpha1.ClusterExecuter, error) {
+	list := &schemav1alpha1.ClusterExecuterList{}
+	if err := o.Client.List(ctx, list, &client.ListOptions{Namespace: o.Namespace}); err != nil {
+		return nil, fmt.Errorf("unable to list cluster executers: %w", err)
+	}
+	executers := make([]schemav1alpha1.ClusterExecuter, 0, len(list.Items))
+	for _, executer := range list.Items {
+		if !metav1.IsControlledBy(&executer, vd) {
+			continue
+		}
+		// executers are named `<revision>-<cluster name>`
+		clusterName := strings.TrimPrefix(executer.Name, vd.Name+"-")
+		if o.Cluster != "" && o.Cluster != clusterName && o.Cluster != executer.Spec.ClusterUri {
+			continue
+		}
+		executers = append(executers, executer)
+	}
+	return executers, nil
+}
+
+// printLogs prints the logs of the executer targets matching the DB filter
+func (o *SchemaLogsOptions) printLogs(ctx context.Context, store runlogs.Store, vd *schemav1alpha1.VersionedDeplyment, executer *schemav1alpha1.ClusterExecuter) error {
+	clusterName := strings.TrimPrefix(executer.Name, vd.Name+"-")
+	if strings.HasPrefix(executer.Status.Logs, "file://") {
+		fmt.Fprintf(o.Out, "==> %s: logs are stored on the operator filesystem at %s\n", clusterName, strings.TrimPrefix(executer.Status.Logs, "file://"))
+		return nil
+	}
+	keys, err := store.List(ctx, executer.Namespace, executer.Name)
+	if err != nil {
+		return fmt.Errorf("unable to list the logs of %s: %w", clusterName, err)
+	}
+	printed := 0
+	for _, key := range keys {
+		_, _, target, err := runlogs.ParseKey(key)
+		if err != nil {
+			return err
+		}
+		if !o.matchDB(target) {
+			continue
+		}
+		data, err := store.Get(ctx, key)
+		if err != nil {
+			return fmt.Errorf("unable to get the logs of %s on %s: %w", target, clusterName, err)
+		}
+		fmt.Fprintf(o.Out, "==> %s/%s <==\n", clusterName, target)
+		fmt.Fprintln(o.Out, strings.TrimRight(string(data), "\n"))
+		printed++
+	}
+	if printed == 0 {
+		fmt.Fprintf(o.Out, "==> %s: no logs found\n", clusterName)
+	}
+	return nil
+}
+
+// matchDB checks if the target matches the DB filter - the DB itself, its schemas (`db.schema`) or the whole cluster
+func (o *SchemaLogsOptions) matchDB(target string) bool {
+	return o.DB == "" || target == o.DB || strings.HasPrefix(target, o.DB+".") || target == runlogs.ClusterTarget
+}
@@ -0,0 +1,145 @@
+package schemaop
+
+// Copyright (c) Microsoft Corporation.
+// Licensed under the MIT License.
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/spf13/cobra"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/cli-runtime/pkg/genericclioptions"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	schemav1alpha1 "github.com/microsoft/azure-schema-operator/apis/dbschema/v1alpha1"
+)
+
+var (
+	pauseExample = `
+		# Pause the rollout - running executions complete but no new ones are started
+		kubectl schemaop pause master-test-template`
+
+	resumeExample = `
+		# Resume a paused rollout
+		kubectl schemaop resume master-test-template`
+
+	restartExample = `
+		# Execute the current revision again on all the targets
+		kubectl schemaop restart master-test-template`
+)
+
+// SchemaRolloutOptions holds the options for the 'pause', 'resume' and 'restart' sub commands
+type SchemaRolloutOptions struct {
+	CommonOptions
+
+	Namespace string
+	Name      string
+	// change applies the rollout change to the deployment spec
+	change func(spec *schemav1alpha1.SchemaDeploymentSpec) string
+
+	genericclioptions.IOStreams
+}
+
+// NewSchemaRolloutOptions returns an initialized SchemaRolloutOptions instance
+func NewSchemaRolloutOptions(streams genericclioptions.IOStreams, change func(spec *schemav1alpha1.SchemaDeploymentSpec) string) *SchemaRolloutOptions {
+	o := &SchemaRolloutOptions{
+		change:    change,
+		IOStreams: streams,
+	}
+	o.SetConfigFlags()
+	return o
+}
+
+// NewCmdSchemaPause returns a Command instance for pause sub command
+func NewCmdSchemaPause(streams genericclioptions.IOStreams) *cobra.Command {
+	o := NewSchemaRolloutOptions(streams, func(spec *schemav1alpha1.SchemaDeploymentSpec) string {
+		if spec.Paused {
+			return "already paused"
+		}
+		spec.Paused = true
+		return "paused"
+	})
+	return newRolloutCommand(o, "pause", "Pause the schema rollout", pauseExample)
+}
+
+// NewCmdSchemaResume returns a Command instance for resume sub command
+func NewCmdSchemaResume(streams genericclioptions.IOStreams) *cobra.Command {
+	o := NewSchemaRolloutOptions(streams, func(spec *schemav1alpha1.SchemaDeploymentSpec) string {
+		if !spec.Paused {
+			return "not paused"
+		}
+		spec.Paused = false
+		return "resumed"
+	})
+	return newRolloutCommand(o, "resume", "Resume a paused schema rollout", resumeExample)
+}
+
+// NewCmdSchemaRestart returns a Command instance for restart sub command
+func NewCmdSchemaRestart(streams genericclioptions.IOStreams) *cobra.Command {
+	o := NewSchemaRolloutOptions(streams, func(spec *schemav1alpha1.SchemaDeploymentSpec) string {
+		spec.Restarts++
+		return "restarted"
+	})
+	return newRolloutCommand(o, "restart", "Execute the current schema revision again", restartExample)
+}
+
+func newRolloutCommand(o *SchemaRolloutOptions, use, short, example string) *cobra.Command {
+	cmd := &cobra.Command{
+		Use:                   use + " [NAME] [flags]",
+		DisableFlagsInUseLine: true,
+		Short:                 short,
+		Long:                  short + ".",
+		Example:               example,
+		Args:                  cobra.MaximumNArgs(1),
+		RunE: func(c *cobra.Command, args []string) error {
+			if err := o.Complete(c, args); err != nil {
+				return err
+			}
+			if err := o.Validate(); err != nil {
+				return err
+			}
+			return o.Run()
+		},
+	}
+
+	cmd.Flags().StringVar(&o.Namespace, "namespace", "default", "namespace of schema")
+	cmd.Flags().StringVar(&o.Name, "name", o.Name, "name of schema template")
+
+	return cmd
+}
+
+// Complete completes al the required options
+func (o *SchemaRolloutOptions) Complete(cmd *cobra.Command, args []string) error {
+	if len(args) > 0 {
+		o.Name = args[0]
+	}
+	return o.Init(cmd)
+}
+
+// Validate makes sure all the provided values for command-line options are valid
+func (o *SchemaRolloutOptions) Validate() error {
+	if o.Name == "" {
+		return errors.New("the schema name is required")
+	}
+	return nil
+}
+
+// Run patches the deployment spec with the rollout change
+func (o *SchemaRolloutOptions) Run() error {
+	template := &schemav1alpha1.SchemaDeployment{}
+	key := types.NamespacedName{
+		Name:      o.Name,
+		Namespace: o.Namespace,
+	}
+	if err := o.Client.Get(context.TODO(), key, template); err != nil {
+		return fmt.Errorf("unable to get template: %w", err)
+	}
+	patch := client.MergeFrom(template.DeepCopy())
+	result := o.change(&template.Spec)
+	if err := o.Client.Patch(context.TODO(), template, patch); err != nil {
+		return fmt.Errorf("unable to update template: %w", err)
+	}
+	fmt.Fprintf(o.Out, "schemadeployment %s/%s %s\n", template.Namespace, template.Name, result)
+	return nil
+}
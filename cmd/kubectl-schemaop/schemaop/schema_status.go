@@ -3,53 +3,78 @@ package schemaop
 // Copyright (c) Microsoft Corporation.
 // Licensed under the MIT License.
 import (
+	"bytes"
 	"context"
+	"errors"
 	"fmt"
+	"io"
 	"strconv"
+	"strings"
+	"time"
 
 	"github.com/spf13/cobra"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
 	"k8s.io/apimachinery/pkg/types"
 	"k8s.io/cli-runtime/pkg/genericclioptions"
 	"k8s.io/cli-runtime/pkg/printers"
-	"k8s.io/cli-runtime/pkg/resource"
 
 	schemav1alpha1 "github.com/microsoft/azure-schema-operator/apis/dbschema/v1alpha1"
 )
 
+// statusPollInterval is the interval the status is polled at with --watch
+const statusPollInterval = 5 * time.Second
+
+// maxErrorLength is the length the last error is truncated to in the cluster rows (-o wide shows the full error)
+const maxErrorLength = 60
+
 var (
 	statusLong = `
-		View schema rollout status.`
+		View schema rollout status.
+		The status of the current revision is shown, --clusters expands it to the status of every cluster
+		and --dbs to the result of every DB (and DB schema).`
 
 	statusExample = `
 		# View the schema rollout status
-		kubectl schemaop status --name master-test-template`
+		kubectl schemaop status --name master-test-template
+		# View the status of every cluster and DB
+		kubectl schemaop status master-test-template --dbs -o wide
+		# Watch the rollout until it is done
+		kubectl schemaop status master-test-template --clusters --watch
+		# Get the deployment, the current revision and its cluster executers as json
+		kubectl schemaop status master-test-template --clusters -o json`
 )
 
-// SchemaStatusOptions holds the options for 'schema history' sub command
+// SchemaStatusOptions holds the options for 'schema status' sub command
 type SchemaStatusOptions struct {
 	CommonOptions
-	configFlags *genericclioptions.ConfigFlags
-	PrintFlags  *genericclioptions.PrintFlags
-	ToPrinter   func(string) (printers.ResourcePrinter, error)
-
-	Builder          *resource.Builder
-	Resources        []string
-	Namespace        string
-	Name             string
-	EnforceNamespace bool
-	RESTClientGetter genericclioptions.RESTClientGetter
-	// userSpecifiedNamespace string
-
-	resource.FilenameOptions
+	PrintFlags *genericclioptions.PrintFlags
+	ToPrinter  func(string) (printers.ResourcePrinter, error)
+
+	Namespace string
+	Name      string
+	Clusters  bool
+	DBs       bool
+	Watch     bool
+	Timeout   time.Duration
+
 	genericclioptions.IOStreams
 }
 
+// rolloutStatus is a snapshot of the rollout of the current revision
+type rolloutStatus struct {
+	template  *schemav1alpha1.SchemaDeployment
+	revision  *schemav1alpha1.VersionedDeplyment
+	executers []schemav1alpha1.ClusterExecuter
+}
+
 // NewSchemaStatusOptions returns an initialized SchemaStatusOptions instance
 func NewSchemaStatusOptions(streams genericclioptions.IOStreams) *SchemaStatusOptions {
 	o := &SchemaStatusOptions{
-		PrintFlags:  genericclioptions.NewPrintFlags(""),
-		configFlags: genericclioptions.NewConfigFlags(true),
-		IOStreams:   streams,
+		PrintFlags: genericclioptions.NewPrintFlags(""),
+		IOStreams:  streams,
 	}
 	o.SetConfigFlags()
 	return o
@@ -60,11 +85,12 @@ func NewCmdSchemaStatus(streams genericclioptions.IOStreams) *cobra.Command {
 	o := NewSchemaStatusOptions(streams)
 
 	cmd := &cobra.Command{
-		Use:                   "status (TYPE NAME | TYPE/NAME) [flags]",
+		Use:                   "status [NAME] [flags]",
 		DisableFlagsInUseLine: true,
 		Short:                 "View schema rollout status",
 		Long:                  statusLong,
 		Example:               statusExample,
+		Args:                  cobra.MaximumNArgs(1),
 		RunE: func(c *cobra.Command, args []string) error {
 			if err := o.Complete(c, args); err != nil {
 				return err
@@ -82,6 +108,10 @@ func NewCmdSchemaStatus(streams genericclioptions.IOStreams) *cobra.Command {
 
 	cmd.Flags().StringVar(&o.Namespace, "namespace", o.Namespace, "namespace of schema")
 	cmd.Flags().StringVar(&o.Name, "name", o.Name, "name of schema template")
+	cmd.Flags().BoolVar(&o.Clusters, "clusters", o.Clusters, "show the status of every cluster")
+	cmd.Flags().BoolVar(&o.DBs, "dbs", o.DBs, "show the result of every DB (implies --clusters)")
+	cmd.Flags().BoolVarP(&o.Watch, "watch", "w", o.Watch, "watch the status until the rollout is done")
+	cmd.Flags().DurationVar(&o.Timeout, "timeout", o.Timeout, "the time to wait with --watch before giving up, zero means never")
 	o.PrintFlags.AddFlags(cmd)
 
 	return cmd
@@ -89,17 +119,11 @@ func NewCmdSchemaStatus(streams genericclioptions.IOStreams) *cobra.Command {
 
 // Complete completes al the required options
 func (o *SchemaStatusOptions) Complete(cmd *cobra.Command, args []string) error {
-	o.Resources = args
-
-	var err error
-	o.Namespace, err = cmd.Flags().GetString("namespace")
-	if err != nil {
-		return err
+	if len(args) > 0 {
+		o.Name = args[0]
 	}
-
-	o.Name, err = cmd.Flags().GetString("name")
-	if err != nil {
-		return err
+	if o.DBs {
+		o.Clusters = true
 	}
 
 	o.ToPrinter = func(operation string) (printers.ResourcePrinter, error) {
@@ -107,50 +131,304 @@ func (o *SchemaStatusOptions) Complete(cmd *cobra.Command, args []string) error
 		return o.PrintFlags.ToPrinter()
 	}
 
-	return o.Init(cmd)
-
+	if err := o.Init(cmd); err != nil {
+		return err
+	}
+	if o.Namespace == "" {
+		o.Namespace = o.UserNamespace
+	}
+	return nil
 }
 
 // Validate makes sure all the provided values for command-line options are valid
 func (o *SchemaStatusOptions) Validate() error {
-
+	if o.Name == "" {
+		return errors.New("the schema name is required")
+	}
+	if o.Timeout < 0 {
+		return errors.New("--timeout can't be negative")
+	}
 	return nil
 }
 
-// Run performs the execution of 'rollout history' sub command
+// Run performs the execution of 'schema status' sub command
 func (o *SchemaStatusOptions) Run() error {
+	ctx := context.Background()
+	if !o.Watch {
+		status, err := o.getStatus(ctx)
+		if err != nil {
+			return err
+		}
+		return o.print(o.Out, status)
+	}
 
+	if o.Timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, o.Timeout)
+		defer cancel()
+	}
+	ticker := time.NewTicker(statusPollInterval)
+	defer ticker.Stop()
+	var last []byte
+	for {
+		status, err := o.getStatus(ctx)
+		if err != nil {
+			return err
+		}
+		// only changes are printed
+		buf := &bytes.Buffer{}
+		if err := o.print(buf, status); err != nil {
+			return err
+		}
+		if !bytes.Equal(buf.Bytes(), last) {
+			if last != nil {
+				fmt.Fprintln(o.Out)
+			}
+			if _, err := o.Out.Write(buf.Bytes()); err != nil {
+				return err
+			}
+			last = buf.Bytes()
+		}
+		if done, err := status.done(); done {
+			return err
+		}
+
+		select {
+		case <-ctx.Done():
+			return fmt.Errorf("timed out waiting for the rollout of %s", status.revision.Name)
+		case <-ticker.C:
+		}
+	}
+}
+
+// getStatus returns the status of the current revision rollout
+func (o *SchemaStatusOptions) getStatus(ctx context.Context) (*rolloutStatus, error) {
 	template := &schemav1alpha1.SchemaDeployment{}
 	key := types.NamespacedName{
 		Name:      o.Name,
 		Namespace: o.Namespace,
 	}
-	if err := o.Client.Get(context.TODO(), key, template); err != nil {
-		return fmt.Errorf("unable to get template: %w", err)
+	if err := o.Client.Get(ctx, key, template); err != nil {
+		return nil, fmt.Errorf("unable to get template: %w", err)
+	}
+	revision, err := o.getCurrentRevision(ctx, template)
+	if err != nil {
+		return nil, err
+	}
+	status := &rolloutStatus{template: template, revision: revision}
+	// the cluster executers are needed to tell if a watched rollout failed
+	if !o.Clusters && !o.Watch {
+		return status, nil
+	}
+	for _, name := range revision.Status.Executers {
+		// executers are missing from the status while they weren't created yet (e.g. the deployment is paused)
+		if name.Name == "" {
+			continue
+		}
+		executer := schemav1alpha1.ClusterExecuter{}
+		if err := o.Client.Get(ctx, types.NamespacedName(name), &executer); err != nil {
+			return nil, fmt.Errorf("unable to get cluster executer %s: %w", name.Name, err)
+		}
+		status.executers = append(status.executers, executer)
+	}
+	return status, nil
+}
+
+func (o *SchemaStatusOptions) getCurrentRevision(ctx context.Context, template *schemav1alpha1.SchemaDeployment) (*schemav1alpha1.VersionedDeplyment, error) {
+	if template.Status.CurrentVerDeployment.Name == "" {
+		return nil, fmt.Errorf("no revision was deployed for %s yet", template.Name)
+	}
+	revisionDeployment := &schemav1alpha1.VersionedDeplyment{}
+	key := types.NamespacedName{
+		Name:      template.Status.CurrentVerDeployment.Name,
+		Namespace: template.Status.CurrentVerDeployment.Namespace,
+	}
+	if err := o.Client.Get(ctx, key, revisionDeployment); err != nil {
+		return nil, fmt.Errorf("unable to get the current versioned deployment: %w", err)
+	}
+
+	return revisionDeployment, nil
+}
+
+// done checks if the rollout is done - an error is returned if it failed.
+// A paused rollout is considered done, as it won't progress until it is resumed.
+func (s *rolloutStatus) done() (bool, error) {
+	if s.revision.IsExecuted() {
+		return true, nil
+	}
+	if s.template.Spec.Paused {
+		return true, nil
+	}
+	// the status of the clusters is only known when expanded
+	if len(s.executers) == 0 || s.revision.IsRunning() {
+		return false, nil
+	}
+	failed := 0
+	for i := range s.executers {
+		executer := &s.executers[i]
+		if executer.IsExhausted() {
+			failed++
+		} else if !executer.IsExecuted() {
+			return false, nil
+		}
+	}
+	if failed > 0 {
+		return true, fmt.Errorf("rollout of %s failed on %d clusters", s.revision.Name, failed)
 	}
-	revision, _ := o.getCurrentRevision(template)
-	table := o.newTable([]string{"Namespace", "Name", "Revision", "Executed", "Failed", "Running", "Succeeded"}, o.Out)
+	return false, nil
+}
+
+// print prints the status as tables, or with the printer of the output format
+func (o *SchemaStatusOptions) print(out io.Writer, status *rolloutStatus) error {
+	format := *o.PrintFlags.OutputFormat
+	if format != "" && format != "wide" {
+		return o.printObjects(out, status)
+	}
+	wide := format == "wide"
+
+	headers := []string{"Namespace", "Name", "Revision", "Executed", "Failed", "Running", "Succeeded"}
+	if wide {
+		headers = append(headers, "Completed", "Paused")
+	}
+	table := o.newTable(headers, out)
+	revision := status.revision
 	data := []string{revision.Namespace, revision.Name,
 		strconv.Itoa(int(revision.Spec.Revision)),
 		fmt.Sprintf("%t", revision.Status.Executed),
 		strconv.Itoa(int(revision.Status.Failed)),
 		strconv.Itoa(int(revision.Status.Running)),
 		strconv.Itoa(int(revision.Status.Succeeded))}
+	if wide {
+		data = append(data, strconv.Itoa(revision.Status.CompletedPCT)+"%", fmt.Sprintf("%t", status.template.Spec.Paused))
+	}
 	table.Append(data)
 	table.Render()
 
+	if o.Clusters {
+		fmt.Fprintln(out)
+		o.printClusters(out, status, wide)
+	}
+	if o.DBs {
+		fmt.Fprintln(out)
+		o.printDBs(out, status)
+	}
 	return nil
 }
 
-func (o *SchemaStatusOptions) getCurrentRevision(template *schemav1alpha1.SchemaDeployment) (*schemav1alpha1.VersionedDeplyment, error) {
-	revisionDeployment := &schemav1alpha1.VersionedDeplyment{}
-	key := types.NamespacedName{
-		Name:      template.Status.CurrentVerDeployment.Name,
-		Namespace: template.Status.CurrentVerDeployment.Namespace,
+// printClusters prints a row per cluster executer
+func (o *SchemaStatusOptions) printClusters(out io.Writer, status *rolloutStatus, wide bool) {
+	headers := []string{"Cluster", "State", "Completed", "Failures", "Last Error"}
+	if wide {
+		headers = append(headers, "DBs", "Schemas", "Done", "Logs")
 	}
-	if err := o.Client.Get(context.TODO(), key, revisionDeployment); err != nil {
-		return nil, fmt.Errorf("unable to list versioned deployments: %w", err)
+	table := o.newTable(headers, out)
+	table.SetAutoWrapText(!wide)
+	for i := range status.executers {
+		executer := &status.executers[i]
+		lastError := executerError(executer)
+		if !wide && len(lastError) > maxErrorLength {
+			lastError = lastError[:maxErrorLength-3] + "..."
+		}
+		data := []string{clusterName(status.revision, executer), executerState(executer),
+			strconv.Itoa(executer.Status.CompletedPCT) + "%",
+			strconv.Itoa(executer.Status.NumFailures),
+			lastError}
+		if wide {
+			done := len(executer.Status.DoneTargets.DBs) + len(executer.Status.DoneTargets.Schemas)
+			data = append(data,
+				strconv.Itoa(len(executer.Status.Targets.DBs)),
+				strconv.Itoa(len(executer.Status.Targets.Schemas)),
+				strconv.Itoa(done),
+				executer.Status.Logs)
+		}
+		table.Append(data)
 	}
+	table.Render()
+}
 
-	return revisionDeployment, nil
+// printDBs prints the result of every DB on every cluster, followed by the skipped DBs
+func (o *SchemaStatusOptions) printDBs(out io.Writer, status *rolloutStatus) {
+	table := o.newTable([]string{"Cluster", "DB", "Executed", "Schemas", "Error"}, out)
+	for i := range status.executers {
+		executer := &status.executers[i]
+		for _, result := range executer.Status.DBResults {
+			table.Append([]string{clusterName(status.revision, executer), result.DB,
+				fmt.Sprintf("%t", result.Executed),
+				strconv.Itoa(result.Schemas),
+				result.Error})
+		}
+		for _, skipped := range executer.Status.Targets.Skipped {
+			table.Append([]string{clusterName(status.revision, executer), skipped.DB,
+				"skipped (" + skipped.Reason + ")", "", skipped.Message})
+		}
+	}
+	table.Render()
+}
+
+// printObjects prints the deployment, its current revision and the cluster executers as a list
+func (o *SchemaStatusOptions) printObjects(out io.Writer, status *rolloutStatus) error {
+	printer, err := o.ToPrinter("")
+	if err != nil {
+		return err
+	}
+	objects := []runtime.Object{status.template, status.revision}
+	for i := range status.executers {
+		objects = append(objects, &status.executers[i])
+	}
+	// objects read with the client don't have their type set
+	if err := setObjectKinds(objects...); err != nil {
+		return err
+	}
+	// only the json and yaml printers support lists
+	format := *o.PrintFlags.OutputFormat
+	if format != "json" && format != "yaml" {
+		for _, obj := range objects {
+			if err := printer.PrintObj(obj, out); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+	list := &corev1.List{
+		TypeMeta: metav1.TypeMeta{Kind: "List", APIVersion: "v1"},
+	}
+	for _, obj := range objects {
+		list.Items = append(list.Items, runtime.RawExtension{Object: obj})
+	}
+	return printer.PrintObj(list, out)
+}
+
+// clusterName returns the cluster name of the executer - executers are named `<revision>-<cluster name>`
+func clusterName(revision *schemav1alpha1.VersionedDeplyment, executer *schemav1alpha1.ClusterExecuter) string {
+	return strings.TrimPrefix(executer.Name, revision.Name+"-")
+}
+
+// executerState returns a short description of the executer state
+func executerState(executer *schemav1alpha1.ClusterExecuter) string {
+	switch {
+	case meta.IsStatusConditionTrue(executer.Status.Conditions, schemav1alpha1.ConditionPaused):
+		return "Paused"
+	case executer.Status.Running:
+		return "Running"
+	case executer.IsExecuted():
+		return "Succeeded"
+	case executer.IsExhausted():
+		return "Failed"
+	case executer.Status.Failed:
+		return "Retrying"
+	default:
+		return "Pending"
+	}
+}
+
+// executerError returns the error of the last execution, if it failed
+func executerError(executer *schemav1alpha1.ClusterExecuter) string {
+	if !executer.Status.Failed {
+		return ""
+	}
+	cond := meta.FindStatusCondition(executer.Status.Conditions, schemav1alpha1.ConditionExecution)
+	if cond == nil || cond.Status != metav1.ConditionFalse {
+		return ""
+	}
+	return strings.ReplaceAll(cond.Message, "\n", " ")
 }
@@ -8,39 +8,50 @@ import (
 	"os"
 
 	"github.com/spf13/cobra"
-	"gopkg.in/yaml.v3"
 	v1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
 	"k8s.io/apimachinery/pkg/types"
 	"k8s.io/cli-runtime/pkg/genericclioptions"
 	"k8s.io/cli-runtime/pkg/printers"
 	"k8s.io/cli-runtime/pkg/resource"
+
+	schemav1alpha1 "github.com/microsoft/azure-schema-operator/apis/dbschema/v1alpha1"
+	"github.com/microsoft/azure-schema-operator/pkg/schemafiles"
 )
 
 var (
 	updateLong = `
-		update the schema configMap.`
+		update the schema configMap.
+		The schema type is detected by the file extension (or set with --type):
+		KQL files (.kql, .csl) or directories of KQL files for kusto, dacpacs for SQL Server
+		and avro schemas (.avsc, .json) for event hubs. The files are validated before the configMap is written.`
 
 	updateExample = `
-		# View the schema rollout status
-		kubectl schemaop update --name master-test-template --schema-file /path/to/schema/file`
+		# Update the kusto schema
+		kubectl schemaop update --name master-test-template --schema-file /path/to/schema/file
+		# Update the kusto schema from a directory of KQL files
+		kubectl schemaop update --name master-test-template --schema-file /path/to/kql/dir
+		# Update the SQL Server schema with a dacpac referencing another dacpac
+		kubectl schemaop update --name sql-template --schema-file db.dacpac --template-name dbo --external-dacpac common.dacpac=default/common-dacpac
+		# Update the event hubs avro schema
+		kubectl schemaop update --name orders-schema --schema-file order.avsc --group orders --template-name order`
 )
 
-// SchemaUpdateOptions holds the options for 'schema history' sub command
+// SchemaUpdateOptions holds the options for 'schema update' sub command
 type SchemaUpdateOptions struct {
 	CommonOptions
-	configFlags *genericclioptions.ConfigFlags
-	PrintFlags  *genericclioptions.PrintFlags
-	ToPrinter   func(string) (printers.ResourcePrinter, error)
-
-	Builder          *resource.Builder
-	Resources        []string
-	Namespace        string
-	Name             string
-	SchemaFile       string
-	EnforceNamespace bool
-	DryRun           bool
-	RESTClientGetter genericclioptions.RESTClientGetter
-	// userSpecifiedNamespace string
+	PrintFlags *genericclioptions.PrintFlags
+	ToPrinter  func(string) (printers.ResourcePrinter, error)
+
+	Resources  []string
+	Namespace  string
+	Name       string
+	SchemaFile string
+	Type       string
+	DryRun     bool
+	SourceKeyOptions
+
+	dbType schemav1alpha1.DBTypeEnum
 
 	resource.FilenameOptions
 	genericclioptions.IOStreams
@@ -49,9 +60,8 @@ type SchemaUpdateOptions struct {
 // NewSchemaUpdateOptions returns an initialized SchemaUpdateOptions instance
 func NewSchemaUpdateOptions(streams genericclioptions.IOStreams) *SchemaUpdateOptions {
 	o := &SchemaUpdateOptions{
-		PrintFlags:  genericclioptions.NewPrintFlags(""),
-		configFlags: genericclioptions.NewConfigFlags(true),
-		IOStreams:   streams,
+		PrintFlags: genericclioptions.NewPrintFlags("").WithDefaultOutput("yaml"),
+		IOStreams:  streams,
 	}
 	o.SetConfigFlags()
 	return o
@@ -62,11 +72,12 @@ func NewCmdSchemaUpdate(streams genericclioptions.IOStreams) *cobra.Command {
 	o := NewSchemaUpdateOptions(streams)
 
 	cmd := &cobra.Command{
-		Use:                   "update (TYPE NAME | TYPE/NAME) [flags]",
+		Use:                   "update [NAME] [flags]",
 		DisableFlagsInUseLine: true,
 		Short:                 "update schema configMap",
 		Long:                  updateLong,
 		Example:               updateExample,
+		Args:                  cobra.MaximumNArgs(1),
 		RunE: func(c *cobra.Command, args []string) error {
 			if err := o.Complete(c, args); err != nil {
 				return err
@@ -84,7 +95,9 @@ func NewCmdSchemaUpdate(streams genericclioptions.IOStreams) *cobra.Command {
 
 	cmd.Flags().StringVar(&o.Namespace, "namespace", o.Namespace, "namespace of schema")
 	cmd.Flags().StringVar(&o.Name, "name", o.Name, "name of schema configMap")
-	cmd.Flags().StringVar(&o.SchemaFile, "schema-file", o.SchemaFile, "path to the schema file")
+	cmd.Flags().StringVar(&o.SchemaFile, "schema-file", o.SchemaFile, "path to the schema file, or a directory of KQL files")
+	cmd.Flags().StringVar(&o.Type, "type", o.Type, "schema type (kusto, sqlServer, eventhub, postgres or cosmos), detected by the file extension by default")
+	o.SourceKeyOptions.AddFlags(cmd)
 	cmd.Flags().BoolVar(&o.DryRun, "dry-run", o.DryRun, "dry-run - only print")
 	o.PrintFlags.AddFlags(cmd)
 
@@ -94,21 +107,8 @@ func NewCmdSchemaUpdate(streams genericclioptions.IOStreams) *cobra.Command {
 // Complete completes al the required options
 func (o *SchemaUpdateOptions) Complete(cmd *cobra.Command, args []string) error {
 	o.Resources = args
-
-	var err error
-	o.Namespace, err = cmd.Flags().GetString("namespace")
-	if err != nil {
-		return err
-	}
-
-	o.Name, err = cmd.Flags().GetString("name")
-	if err != nil {
-		return err
-	}
-
-	o.SchemaFile, err = cmd.Flags().GetString("schema-file")
-	if err != nil {
-		return err
+	if len(args) > 0 {
+		o.Name = args[0]
 	}
 
 	o.ToPrinter = func(operation string) (printers.ResourcePrinter, error) {
@@ -116,59 +116,79 @@ func (o *SchemaUpdateOptions) Complete(cmd *cobra.Command, args []string) error
 		return o.PrintFlags.ToPrinter()
 	}
 
-	return o.Init(cmd)
+	if err := o.Init(cmd); err != nil {
+		return err
+	}
+	if o.Namespace == "" {
+		o.Namespace = o.UserNamespace
+	}
 
+	return o.SourceKeyOptions.Complete(cmd, o.Namespace)
 }
 
 // Validate makes sure all the provided values for command-line options are valid
 func (o *SchemaUpdateOptions) Validate() error {
+	if o.Name == "" {
+		return fmt.Errorf("the schema configMap name is required")
+	}
 	// check that the given schema file path exists
-	_, err := os.Stat(o.SchemaFile)
-	return err
+	if _, err := os.Stat(o.SchemaFile); err != nil {
+		return err
+	}
+	o.dbType = schemav1alpha1.DBTypeEnum(o.Type)
+	if o.Type == "" {
+		dbType, err := schemafiles.DetectType(o.SchemaFile)
+		if err != nil {
+			return fmt.Errorf("%w - use --type to set it", err)
+		}
+		o.dbType = dbType
+	}
+
+	return o.SourceKeyOptions.Validate(o.dbType)
 }
 
-// Run performs the execution of 'rollout history' sub command
+// Run performs the execution of 'schema update' sub command
 func (o *SchemaUpdateOptions) Run() error {
-
-	found := false
+	ctx := context.Background()
+	found := true
 	sourceCfgMap := &v1.ConfigMap{}
 	key := types.NamespacedName{
 		Name:      o.Name,
 		Namespace: o.Namespace,
 	}
-	if err := o.Client.Get(context.TODO(), key, sourceCfgMap); err != nil {
-		fmt.Println("unable to find schema config map - will create")
-
+	if err := o.Client.Get(ctx, key, sourceCfgMap); err != nil {
+		if !errors.IsNotFound(err) {
+			return fmt.Errorf("unable to get schema config map: %w", err)
+		}
+		fmt.Fprintln(o.ErrOut, "unable to find schema config map - will create")
+		found = false
 		sourceCfgMap.ObjectMeta.Name = o.Name
 		sourceCfgMap.ObjectMeta.Namespace = o.Namespace
-		sourceCfgMap.Data = make(map[string]string)
-	} else {
-		found = true
 	}
-	b, err := os.ReadFile(o.SchemaFile) // just pass the file name
-	if err != nil {
-		return fmt.Errorf("unable to read schema file: %w", err)
+	// the schema is validated before anything is written
+	if err := schemafiles.Apply(sourceCfgMap, o.SchemaFile, o.dbType); err != nil {
+		return err
 	}
-	sourceCfgMap.Data["kql"] = string(b)
+	o.SourceKeyOptions.Apply(sourceCfgMap)
 
 	if o.DryRun {
-		out, err := yaml.Marshal(sourceCfgMap)
+		sourceCfgMap.SetGroupVersionKind(v1.SchemeGroupVersion.WithKind("ConfigMap"))
+		printer, err := o.ToPrinter("updated (dry run)")
 		if err != nil {
-			return fmt.Errorf("failed to unmarshel configMap: %w", err)
-		}
-		fmt.Print(string(out))
-	} else {
-		if found {
-			err = o.Client.Update(context.Background(), sourceCfgMap)
-		} else {
-			err = o.Client.Create(context.Background(), sourceCfgMap)
-		}
-
-		if err != nil {
-			return fmt.Errorf("unable to update source configMap: %w", err)
+			return err
 		}
+		return printer.PrintObj(sourceCfgMap, o.Out)
+	}
 
+	var err error
+	if found {
+		err = o.Client.Update(ctx, sourceCfgMap)
+	} else {
+		err = o.Client.Create(ctx, sourceCfgMap)
+	}
+	if err != nil {
+		return fmt.Errorf("unable to update source configMap: %w", err)
 	}
-	fmt.Println("schema config map updated with file content")
+	fmt.Fprintf(o.Out, "schema config map updated with the %s schema\n", o.dbType)
 	return nil
 }
@@ -35,14 +35,18 @@ func NewCmd(streams genericclioptions.IOStreams) *cobra.Command {
 		Example:               rolloutExample,
 	}
 	// subcommands
+	cmd.AddCommand(NewCmdSchemaCreate(streams))
+	cmd.AddCommand(NewCmdSchemaDiff(streams))
+	cmd.AddCommand(NewCmdSchemaExport(streams))
 	cmd.AddCommand(NewCmdSchemaHistory(streams))
+	cmd.AddCommand(NewCmdSchemaLogs(streams))
 	cmd.AddCommand(NewCmdSchemaStatus(streams))
-	// cmd.AddCommand(NewCmdRolloutPause(f, streams))
-	// cmd.AddCommand(NewCmdRolloutResume(f, streams))
+	cmd.AddCommand(NewCmdSchemaPause(streams))
+	cmd.AddCommand(NewCmdSchemaResume(streams))
 	cmd.AddCommand(NewCmdSchemaUndo(streams))
 	cmd.AddCommand(NewCmdSchemaUpdate(streams))
 	// cmd.AddCommand(NewCmdRolloutStatus(f, streams))
-	// cmd.AddCommand(NewCmdRolloutRestart(f, streams))
+	cmd.AddCommand(NewCmdSchemaRestart(streams))
 
 	return cmd
 }
@@ -0,0 +1,111 @@
+package schemaop
+
+// Copyright (c) Microsoft Corporation.
+// Licensed under the MIT License.
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"github.com/spf13/cobra"
+	v1 "k8s.io/api/core/v1"
+
+	schemav1alpha1 "github.com/microsoft/azure-schema-operator/apis/dbschema/v1alpha1"
+)
+
+// sourceKeysByType are the additional source `ConfigMap` keys supported by each type
+var sourceKeysByType = map[schemav1alpha1.DBTypeEnum][]string{
+	schemav1alpha1.DBTypeKusto:     {},
+	schemav1alpha1.DBTypeSQLServer: {"templateName", "sqlpackageOptions", "externalDacpacs"},
+	schemav1alpha1.DBTypeEventhub:  {"templateName", "group"},
+	schemav1alpha1.DBTypePostgres:  {"templateName"},
+	schemav1alpha1.DBTypeCosmos:    {},
+}
+
+// SourceKeyOptions holds the additional source `ConfigMap` keys set from flags
+type SourceKeyOptions struct {
+	TemplateName      string
+	Group             string
+	SQLPackageOptions string
+	ExternalDacPacs   map[string]string
+
+	// keys are the source keys of the flags that were set
+	keys map[string]string
+}
+
+// AddFlags adds the source key flags to the command
+func (o *SourceKeyOptions) AddFlags(cmd *cobra.Command) {
+	cmd.Flags().StringVar(&o.TemplateName, "template-name", o.TemplateName, "template name - the template schema of SQL Server and PostgreSQL or the schema name of event hubs")
+	cmd.Flags().StringVar(&o.Group, "group", o.Group, "event hubs schema group")
+	cmd.Flags().StringVar(&o.SQLPackageOptions, "sqlpackage-options", o.SQLPackageOptions, "additional sqlpackage options")
+	cmd.Flags().StringToStringVar(&o.ExternalDacPacs, "external-dacpac", o.ExternalDacPacs, "dacpac referenced by the schema, as <file name>=[namespace/]<configMap> (can be repeated)")
+}
+
+// Complete collects the keys of the flags that were set, external dacpacs default to the namespace
+func (o *SourceKeyOptions) Complete(cmd *cobra.Command, namespace string) error {
+	o.keys = make(map[string]string)
+	if cmd.Flags().Changed("template-name") {
+		o.keys["templateName"] = o.TemplateName
+	}
+	if cmd.Flags().Changed("group") {
+		o.keys["group"] = o.Group
+	}
+	if cmd.Flags().Changed("sqlpackage-options") {
+		o.keys["sqlpackageOptions"] = o.SQLPackageOptions
+	}
+	if len(o.ExternalDacPacs) > 0 {
+		externals := make(map[string]schemav1alpha1.NamespacedName)
+		for fileName, ref := range o.ExternalDacPacs {
+			name := schemav1alpha1.NamespacedName{Namespace: namespace, Name: ref}
+			if i := strings.Index(ref, "/"); i >= 0 {
+				name.Namespace, name.Name = ref[:i], ref[i+1:]
+			}
+			if name.Name == "" || name.Namespace == "" {
+				return fmt.Errorf("invalid external dacpac reference %q", ref)
+			}
+			externals[fileName] = name
+		}
+		data, err := json.Marshal(externals)
+		if err != nil {
+			return err
+		}
+		o.keys["externalDacpacs"] = string(data)
+	}
+	return nil
+}
+
+// Validate makes sure the keys are supported by the type
+func (o *SourceKeyOptions) Validate(dbType schemav1alpha1.DBTypeEnum) error {
+	allowed, ok := sourceKeysByType[dbType]
+	if !ok {
+		return fmt.Errorf("unknown schema type %q", dbType)
+	}
+	for key := range o.keys {
+		if !contains(allowed, key) {
+			return fmt.Errorf("%s isn't supported for %s schemas", key, dbType)
+		}
+	}
+	return nil
+}
+
+// Apply writes the keys into the source `ConfigMap`
+func (o *SourceKeyOptions) Apply(cfgMap *v1.ConfigMap) {
+	if len(o.keys) == 0 {
+		return
+	}
+	if cfgMap.Data == nil {
+		cfgMap.Data = make(map[string]string)
+	}
+	for k, v := range o.keys {
+		cfgMap.Data[k] = v
+	}
+}
+
+func contains(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,251 @@
+package main
+
+// Copyright (c) Microsoft Corporation.
+// Licensed under the MIT License.
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"os/signal"
+	"sort"
+	"strings"
+	"syscall"
+	"text/tabwriter"
+	"time"
+
+	"github.com/rs/zerolog"
+	"github.com/rs/zerolog/log"
+	"github.com/spf13/cobra"
+	"k8s.io/cli-runtime/pkg/genericclioptions"
+
+	"github.com/microsoft/azure-schema-operator/pkg/clients"
+	"github.com/microsoft/azure-schema-operator/pkg/cluster"
+	"github.com/microsoft/azure-schema-operator/pkg/localrun"
+	"github.com/microsoft/azure-schema-operator/pkg/runlogs"
+)
+
+var (
+	applyLong = `
+	Apply the schema deployments of the manifest files to their clusters.
+	The manifests hold the schema deployments and their source configMaps, a schema file (or directory of KQL files)
+	can be set with --from-file instead of the source configMap data. Each cluster is executed after the other and
+	the result of each target is printed. The command fails if any target failed.`
+
+	applyExample = `
+	# Apply a deployment and its source
+	schemaop apply -f deploy.yaml
+	# Validate a KQL schema on a test cluster before merging it
+	schemaop apply -f deploy.yaml --from-file ./kql/ --cluster https://test.westeurope.kusto.windows.net
+	# Only list the matching targets
+	schemaop apply -f deploy.yaml --dry-run`
+)
+
+// ApplyOptions holds the options for the 'apply' command
+type ApplyOptions struct {
+	Files     []string
+	FromFile  string
+	Namespace string
+	Clusters  []string
+	DryRun    bool
+	LogDir    string
+	Verbose   bool
+
+	deployments []localrun.Deployment
+	manifests   *localrun.Manifests
+	// newCluster replaces the operator `Cluster` implementations when set
+	newCluster localrun.NewClusterFunc
+
+	genericclioptions.IOStreams
+}
+
+// NewCmdApply returns a Command instance for the 'apply' command
+func NewCmdApply(streams genericclioptions.IOStreams) *cobra.Command {
+	o := &ApplyOptions{Namespace: "default", IOStreams: streams}
+
+	cmd := &cobra.Command{
+		Use:                   "apply -f FILE [flags]",
+		DisableFlagsInUseLine: true,
+		Short:                 "Apply schema deployments from the manifest files",
+		Long:                  applyLong,
+		Example:               applyExample,
+		Args:                  cobra.NoArgs,
+		RunE: func(c *cobra.Command, args []string) error {
+			if err := o.Complete(); err != nil {
+				return err
+			}
+			if err := o.Validate(); err != nil {
+				return err
+			}
+			// interrupting the command stops the running executions (and the processes they started)
+			ctx, stop := signal.NotifyContext(c.Context(), os.Interrupt, syscall.SIGTERM)
+			defer stop()
+			return o.Run(ctx)
+		},
+	}
+
+	cmd.Flags().StringSliceVarP(&o.Files, "filename", "f", o.Files, "manifest file with schema deployments and configMaps (can be repeated)")
+	cmd.Flags().StringVar(&o.FromFile, "from-file", o.FromFile, "schema file, or a directory of KQL files, written into the deployment source")
+	cmd.Flags().StringVarP(&o.Namespace, "namespace", "n", o.Namespace, "namespace of the objects without one")
+	cmd.Flags().StringSliceVar(&o.Clusters, "cluster", o.Clusters, "cluster uri to run on instead of the deployment clusters (can be repeated)")
+	cmd.Flags().BoolVar(&o.DryRun, "dry-run", o.DryRun, "only list the matching targets")
+	cmd.Flags().StringVar(&o.LogDir, "log-dir", o.LogDir, "directory to store the execution output of each target")
+	cmd.Flags().BoolVarP(&o.Verbose, "verbose", "v", o.Verbose, "show the execution logs")
+
+	return cmd
+}
+
+// Complete reads the manifests
+func (o *ApplyOptions) Complete() error {
+	// the errors are printed with the results
+	level := zerolog.Disabled
+	if o.Verbose {
+		level = zerolog.DebugLevel
+	}
+	log.Logger = zerolog.New(zerolog.ConsoleWriter{Out: o.ErrOut, TimeFormat: time.Kitchen}).Level(level).With().Timestamp().Logger()
+
+	if len(o.Files) == 0 {
+		return errors.New("at least one manifest file is required (-f)")
+	}
+	manifests, err := localrun.LoadFiles(o.Files, o.Namespace)
+	if err != nil {
+		return err
+	}
+	o.manifests = manifests
+	o.deployments, err = manifests.Resolve(o.FromFile)
+	return err
+}
+
+// Validate makes sure the deployments can run
+func (o *ApplyOptions) Validate() error {
+	for _, d := range o.deployments {
+		filter := d.Template.Spec.ApplyTo
+		if len(o.Clusters) > 0 {
+			filter.ClusterUris = o.Clusters
+		}
+		if err := cluster.ValidateFilter(d.Template.Spec.Type, filter); err != nil {
+			return fmt.Errorf("invalid schema deployment %s: %w", d.Template.Name, err)
+		}
+	}
+	return nil
+}
+
+// Run runs the deployments and prints the results, cancelling the context stops the executions
+func (o *ApplyOptions) Run(ctx context.Context) error {
+	cache := clients.NewCache(time.Minute, time.Minute)
+	defer cache.Close()
+
+	// the source configMaps are served from the manifests, e.g. the external dacpacs
+	runner := localrun.NewRunner(o.manifests.Reader(), cache)
+	if o.newCluster != nil {
+		runner.NewCluster = o.newCluster
+	}
+	runner.Clusters = o.Clusters
+	runner.DryRun = o.DryRun
+	if o.LogDir != "" {
+		runner.Logs = runlogs.NewFileStore(o.LogDir)
+	}
+
+	w := tabwriter.NewWriter(o.Out, 0, 8, 2, ' ', 0)
+	fmt.Fprintln(w, "DEPLOYMENT\tCLUSTER\tTARGET\tRESULT\tERROR")
+	failed := 0
+	for _, d := range o.deployments {
+		for _, result := range runner.Run(ctx, d) {
+			for _, row := range o.rows(result) {
+				if row[3] == "Failed" {
+					failed++
+				}
+				fmt.Fprintln(w, strings.Join(row, "\t"))
+			}
+		}
+	}
+	if err := w.Flush(); err != nil {
+		return err
+	}
+	if failed > 0 {
+		return fmt.Errorf("%d targets failed", failed)
+	}
+	return nil
+}
+
+// rows returns a row for each target of the result
+func (o *ApplyOptions) rows(result localrun.Result) [][]string {
+	name := cluster.ClusterNameFromURI(result.Cluster)
+	row := func(target, state string, err error) []string {
+		return []string{result.Deployment, name, target, state, errorMessage(err)}
+	}
+
+	if result.Targets.DBs == nil && result.Err != nil {
+		return [][]string{row("-", "Failed", result.Err)}
+	}
+	var rows [][]string
+	switch {
+	case o.DryRun:
+		for _, db := range result.Targets.DBs {
+			rows = append(rows, row(db, "Matched", nil))
+		}
+		for _, schema := range result.Targets.Schemas {
+			rows = append(rows, row(schema, "Matched", nil))
+		}
+		if result.Err != nil {
+			rows = append(rows, row("-", "Failed", result.Err))
+		}
+	case len(result.Done.Results) > 0:
+		for _, r := range result.Done.Results {
+			state, err := "Executed", error(nil)
+			if !r.Executed {
+				state, err = "Failed", result.Err
+				if r.Error != "" {
+					err = errors.New(r.Error)
+				}
+			}
+			rows = append(rows, row(r.DB, state, err))
+		}
+	default:
+		done := make(map[string]bool, len(result.Done.DBs))
+		for _, db := range result.Done.DBs {
+			done[db] = true
+		}
+		if result.Err == nil && len(result.Done.DBs) == 0 {
+			// engines that don't report the executed DBs ran on all the targets
+			for _, db := range result.Targets.DBs {
+				done[db] = true
+			}
+		}
+		for _, db := range result.Targets.DBs {
+			if done[db] {
+				rows = append(rows, row(db, "Executed", nil))
+			} else {
+				rows = append(rows, row(db, "Failed", result.Err))
+			}
+		}
+		if len(result.Targets.DBs) == 0 && result.Err != nil {
+			rows = append(rows, row("-", "Failed", result.Err))
+		}
+	}
+
+	for _, skipped := range result.Targets.Skipped {
+		rows = append(rows, []string{result.Deployment, name, skipped.DB, "Skipped", skipped.Reason + ": " + skipped.Message})
+	}
+
+	keys := make([]string, 0, len(result.Done.Outputs))
+	for key := range result.Done.Outputs {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		rows = append(rows, []string{result.Deployment, name, key, "Output", result.Done.Outputs[key]})
+	}
+	if result.Logs != "" {
+		fmt.Fprintf(o.ErrOut, "logs of %s on %s: %s\n", result.Deployment, name, result.Logs)
+	}
+	return rows
+}
+
+// errorMessage returns the error on a single line
+func errorMessage(err error) string {
+	if err == nil {
+		return ""
+	}
+	return strings.ReplaceAll(err.Error(), "\n", " ")
+}
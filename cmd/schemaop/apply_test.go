@@ -0,0 +1,98 @@
+package main
+
+// Copyright (c) Microsoft Corporation.
+// Licensed under the MIT License.
+import (
+	"bytes"
+	"context"
+	"os"
+	"path/filepath"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	"github.com/spf13/viper"
+	"k8s.io/cli-runtime/pkg/genericclioptions"
+
+	schemav1alpha1 "github.com/microsoft/azure-schema-operator/apis/dbschema/v1alpha1"
+	"github.com/microsoft/azure-schema-operator/pkg/cluster"
+	"github.com/microsoft/azure-schema-operator/pkg/config"
+	"github.com/microsoft/azure-schema-operator/pkg/kustoutils"
+	"github.com/microsoft/azure-schema-operator/pkg/kustoutils/kustofake"
+)
+
+const manifest = `
+apiVersion: dbschema.microsoft.com/v1alpha1
+kind: SchemaDeployment
+metadata:
+  name: tenants
+spec:
+  type: kusto
+  applyTo:
+    clusterUris:
+      - https://fake.westeurope.kusto.windows.net
+    db: "^tenant"
+  source:
+    name: tenants-source
+---
+apiVersion: v1
+kind: ConfigMap
+metadata:
+  name: tenants-source
+data:
+  kql: ".create-merge table T (a:string)"
+`
+
+var _ = Describe("Apply", func() {
+	var (
+		dir  string
+		fake *kustofake.Cluster
+		out  *bytes.Buffer
+	)
+
+	// deltaKusto replaces delta-kusto with a script exiting with the code
+	deltaKusto := func(exitCode string) {
+		script := filepath.Join(dir, "delta-kusto")
+		Expect(os.WriteFile(script, []byte("#!/bin/sh\nexit "+exitCode+"\n"), 0o700)).To(Succeed())
+		viper.Set(config.DeltaCMDKey, script)
+	}
+
+	apply := func() error {
+		path := filepath.Join(dir, "deploy.yaml")
+		Expect(os.WriteFile(path, []byte(manifest), 0o600)).To(Succeed())
+		var streams genericclioptions.IOStreams
+		streams, _, out, _ = genericclioptions.NewTestIOStreams()
+		o := &ApplyOptions{Files: []string{path}, Namespace: "default", IOStreams: streams}
+		o.newCluster = func(dbType schemav1alpha1.DBTypeEnum, uri string) (cluster.Cluster, error) {
+			Expect(dbType).To(Equal(schemav1alpha1.DBTypeKusto))
+			k := kustoutils.NewKustoCluster(uri, nil)
+			k.Client = fake
+			return k, nil
+		}
+		Expect(o.Complete()).To(Succeed())
+		Expect(o.Validate()).To(Succeed())
+		return o.Run(context.Background())
+	}
+
+	BeforeEach(func() {
+		dir = GinkgoT().TempDir()
+		fake = kustofake.NewCluster("https://fake.westeurope.kusto.windows.net")
+		fake.AddDatabase("tenant1")
+		fake.AddDatabase("tenant2")
+		fake.AddDatabase("other")
+		DeferCleanup(viper.Set, config.DeltaCMDKey, viper.GetString(config.DeltaCMDKey))
+	})
+
+	It("reports the kusto targets as executed", func() {
+		deltaKusto("0")
+		Expect(apply()).To(Succeed())
+		Expect(out.String()).To(MatchRegexp(`tenants\s+fake\s+tenant1\s+Executed`))
+		Expect(out.String()).To(MatchRegexp(`tenants\s+fake\s+tenant2\s+Executed`))
+		Expect(out.String()).NotTo(ContainSubstring("other"))
+	})
+
+	It("fails when the execution failed", func() {
+		deltaKusto("3")
+		Expect(apply()).To(MatchError("2 targets failed"))
+		Expect(out.String()).To(MatchRegexp(`tenant1\s+Failed\s+delta-kusto failed with exit code 3`))
+	})
+})
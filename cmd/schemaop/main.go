@@ -0,0 +1,25 @@
+package main
+
+// Copyright (c) Microsoft Corporation.
+// Licensed under the MIT License.
+import (
+	"os"
+
+	"github.com/spf13/cobra"
+	"k8s.io/cli-runtime/pkg/genericclioptions"
+)
+
+func main() {
+	streams := genericclioptions.IOStreams{In: os.Stdin, Out: os.Stdout, ErrOut: os.Stderr}
+	root := &cobra.Command{
+		Use:   "schemaop SUBCOMMAND",
+		Short: "Run schema deployments without a Kubernetes cluster",
+		Long: `Run schema deployments directly from the manifests on disk, with the same execution the operator does.
+Useful to validate schema changes against a test cluster (or an emulator) before they are merged.`,
+		SilenceUsage: true,
+	}
+	root.AddCommand(NewCmdApply(streams))
+	if err := root.Execute(); err != nil {
+		os.Exit(1)
+	}
+}
@@ -0,0 +1,15 @@
+package main
+
+// Copyright (c) Microsoft Corporation.
+// Licensed under the MIT License.
+import (
+	"testing"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+func TestSchemaop(t *testing.T) {
+	RegisterFailHandler(Fail)
+	RunSpecs(t, "Schemaop Suite")
+}
@@ -5,13 +5,16 @@ package dbschema
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"reflect"
 	"strconv"
 	"strings"
 	"time"
 
+	batchv1 "k8s.io/api/batch/v1"
 	v1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
 	"k8s.io/apimachinery/pkg/api/meta"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/runtime"
@@ -22,11 +25,23 @@ import (
 
 	"github.com/go-logr/logr"
 	schemav1alpha1 "github.com/microsoft/azure-schema-operator/apis/dbschema/v1alpha1"
+	"github.com/microsoft/azure-schema-operator/pkg/clients"
 	clusterUtils "github.com/microsoft/azure-schema-operator/pkg/cluster"
+	"github.com/microsoft/azure-schema-operator/pkg/runlogs"
+	"github.com/microsoft/azure-schema-operator/pkg/runner"
+	"github.com/microsoft/azure-schema-operator/pkg/utils"
+	"github.com/microsoft/azure-schema-operator/pkg/utils/schemaversions"
 	"github.com/prometheus/client_golang/prometheus"
 	"sigs.k8s.io/controller-runtime/pkg/metrics"
 )
 
+const (
+	// noTargetsRequeueDelay is the delay before looking for targets again when none matched the filter
+	noTargetsRequeueDelay = 5 * time.Minute
+	// runPollInterval is the interval of polling a running execution
+	runPollInterval = 30 * time.Second
+)
+
 var (
 	clusterStatusGauge = prometheus.NewGaugeVec(prometheus.GaugeOpts{
 		Namespace: "schemaop",
@@ -57,13 +72,21 @@ type ClusterExecuterReconciler struct {
 	Log      logr.Logger
 	Scheme   *runtime.Scheme
 	recorder record.EventRecorder
+	// Clients is the DB client cache shared by the controllers
+	Clients *clients.Cache
+	// Runner runs the executions in the background
+	Runner *runner.Runner
+	// Logs stores the captured execution output
+	Logs runlogs.Store
 }
 
 //+kubebuilder:rbac:groups=dbschema.microsoft.com,resources=clusterexecuters,verbs=get;list;watch;create;update;patch;delete
 //+kubebuilder:rbac:groups=dbschema.microsoft.com,resources=clusterexecuters/status,verbs=get;update;patch
 //+kubebuilder:rbac:groups=dbschema.microsoft.com,resources=clusterexecuters/finalizers,verbs=update
-//+kubebuilder:rbac:groups=core,resources=configmaps,verbs=get;list
+//+kubebuilder:rbac:groups=core,resources=configmaps,verbs=get;list;create;update
 //+kubebuilder:rbac:groups="",resources=events,verbs=create;patch
+//+kubebuilder:rbac:groups=batch,resources=jobs,verbs=get;list;watch;create;delete
+//+kubebuilder:rbac:groups=core,resources=pods,verbs=get;list
 
 // Reconcile is part of the main kubernetes reconciliation loop which aims to
 // move the current state of the cluster closer to the desired state.
@@ -77,14 +100,20 @@ type ClusterExecuterReconciler struct {
 func (r *ClusterExecuterReconciler) Reconcile(ctx context.Context, req ctrl.Request) (ctrl.Result, error) {
 	log := r.Log.WithValues("ClusterExecuter", req.NamespacedName)
 
-	// TODO: change to parameter
-	maxFailures := 3
-
 	executer := &schemav1alpha1.ClusterExecuter{}
 	err := r.Get(ctx, req.NamespacedName, executer)
+	if apierrors.IsNotFound(err) {
+		// the executer was deleted - stop its execution, if any
+		r.Runner.Cancel(req.NamespacedName.String())
+		return ctrl.Result{}, nil
+	}
 	if err != nil {
 		// r.Telemetry.LogInfoByInstance("ignorable error", "error during fetch from api server", req.String())
-		return ctrl.Result{}, client.IgnoreNotFound(err)
+		return ctrl.Result{}, err
+	}
+
+	if run, ok := r.Runner.Get(req.NamespacedName.String()); ok {
+		return r.checkRun(ctx, executer, run)
 	}
 
 	annotations := executer.GetAnnotations()
@@ -95,30 +124,66 @@ func (r *ClusterExecuterReconciler) Reconcile(ctx context.Context, req ctrl.Requ
 		}
 	}
 
+	if executer.Status.Running && executer.Status.Job != "" {
+		return r.checkJob(ctx, executer)
+	}
 	if executer.Status.Running {
-		log.Info("executer already Running - wait patiently")
-		return ctrl.Result{RequeueAfter: 1 * time.Minute}, nil
+		log.Info("executer marked as running but no execution is tracked - it was interrupted")
+		return r.recoverInterruptedRun(ctx, executer)
 	}
 
-	if executer.Status.Failed && executer.Status.NumFailures > maxFailures {
+	if firstSeen(executer) && executer.Spec.Restarts > 0 {
+		return r.observeRestarts(ctx, executer)
+	}
+	if restartRequested(executer) {
+		return r.restart(ctx, executer)
+	}
+	if executer.Spec.Paused {
+		return r.pause(ctx, executer)
+	}
+	if meta.FindStatusCondition(executer.Status.Conditions, schemav1alpha1.ConditionPaused) != nil {
+		log.Info("executer resumed")
+		meta.RemoveStatusCondition(&executer.Status.Conditions, schemav1alpha1.ConditionPaused)
+		err = r.Status().Update(ctx, executer)
+		if err != nil {
+			log.Error(err, "failed updating the resumed executer status", "request", req.String())
+			return ctrl.Result{}, err
+		}
+	}
+
+	if executer.IsExhausted() {
 		log.Info("executer max failure retries exhosted")
 		return ctrl.Result{Requeue: false}, fmt.Errorf("max retries exhosted")
 	}
 
-	notifier := func(pct int) {
-		executer.Status.CompletedPCT = pct
+	cluster, err := clusterUtils.NewCluster(executer.Spec.Type, executer.Spec.ClusterUri, r.Client, r.Clients, nil)
+	if err != nil {
+		return r.unknownType(ctx, executer, err)
+	}
+	targets, err := cluster.AquireTargets(ctx, executer.Spec.ApplyTo)
+	if errors.Is(err, utils.ErrNoMatchingTargets) {
+		log.Info("no targets matched the filter - will check again later", "request", req.String())
+		if !meta.IsStatusConditionFalse(executer.Status.Conditions, schemav1alpha1.ConditionTargets) {
+			r.recorder.Event(executer, v1.EventTypeWarning, "NoMatchingTargets", err.Error())
+		}
+		meta.SetStatusCondition(&executer.Status.Conditions, metav1.Condition{
+			Type:    schemav1alpha1.ConditionTargets,
+			Status:  metav1.ConditionFalse,
+			Reason:  "NoMatchingTargets",
+			Message: err.Error(),
+		})
 		err = r.Status().Update(ctx, executer)
 		if err != nil {
-			log.Error(err, "Failed to update execution PCT ", "completed", pct, "cluster", executer.Spec.ClusterUri)
+			log.Error(err, "failed updating executer status", "request", req.String())
+			return ctrl.Result{}, err
 		}
+		return ctrl.Result{RequeueAfter: noTargetsRequeueDelay}, nil
 	}
-
-	cluster := clusterUtils.NewCluster(executer.Spec.Type, executer.Spec.ClusterUri, r.Client, notifier)
-	targets, err := cluster.AquireTargets(executer.Spec.ApplyTo)
 	if err != nil {
 		log.Error(err, "failed retriving targets from cluster", "request", req.String())
 		return ctrl.Result{}, err
 	}
+	r.reportSkipped(executer, targets.Skipped)
 
 	if executer.Status.Executed {
 		log.Info("executer already done - comparing db list")
@@ -128,7 +193,6 @@ func (r *ClusterExecuterReconciler) Reconcile(ctx context.Context, req ctrl.Requ
 		}
 		log.Info("targets changed - re-running")
 		executer.Status.Targets = targets
-		executer.Status.Running = true
 		executer.Status.Executed = false
 		executer.Status.Failed = false
 		err = r.Status().Update(ctx, executer)
@@ -146,9 +210,15 @@ func (r *ClusterExecuterReconciler) Reconcile(ctx context.Context, req ctrl.Requ
 		return ctrl.Result{}, err
 	}
 
+	if runner.IsJobMode(executer.Spec) {
+		// the job creates the execution configuration itself
+		return r.startJob(ctx, executer, targets)
+	}
+
 	// Filter out targers already executed
 	targetsToRun := clusterUtils.Difference(targets, executer.Status.DoneTargets)
-	execConfiguration, err := cluster.CreateExecConfiguration(targetsToRun, cfgMap, executer.Spec.FailIfDataLoss)
+	targetsToRun.Skipped = targets.Skipped
+	execConfiguration, err := cluster.CreateExecConfiguration(ctx, targetsToRun, cfgMap, executer.Spec.FailIfDataLoss)
 	if err != nil {
 		log.Error(err, "failed creating delta-kusto configuration", "request", req.String())
 		return ctrl.Result{}, err
@@ -156,38 +226,304 @@ func (r *ClusterExecuterReconciler) Reconcile(ctx context.Context, req ctrl.Requ
 	// log.Info("Config file generated: ", "file-name", deltaCfgFile)
 	executer.Status.Targets = targets
 	executer.Status.Running = true
+	executer.Status.CompletedPCT = 0
 	executer.Status.Config = execConfiguration
+	executer.Status.Job = ""
+	executer.Status.Logs = r.Logs.Location(executer.Namespace, executer.Name)
+	now := metav1.Now()
+	executer.Status.StartTime = &now
 	err = r.Status().Update(ctx, executer)
 	if err != nil {
 		log.Error(err, "failed updating executer status", "request", req.String())
 		return ctrl.Result{}, err
 	}
 
-	// your logic here
 	r.recorder.Event(executer, v1.EventTypeNormal, "Started", "cluster executer started")
-	// log.Info("running : ", "file-name", deltaCfgFile)
-	_, err = cluster.Execute(targetsToRun, execConfiguration)
+	spec := executer.Spec
+	owner := executer.DeepCopy()
+	recorder := runlogs.NewRecorder(r.Logs, executer.Namespace, executer.Name, runlogs.MaxBytes())
+	r.Runner.Submit(req.NamespacedName.String(), func(ctx context.Context, progress func(pct int)) (schemav1alpha1.ClusterTargets, error) {
+		execCtx, cancel := runner.ExecutionContext(ctx, spec)
+		defer cancel()
+		// the logs are stored even if the execution timed out
+		defer func() { _ = recorder.Flush(ctx) }()
+		execCtx = runlogs.WithRecorder(execCtx, recorder)
+		cluster, err := clusterUtils.NewCluster(spec.Type, spec.ClusterUri, r.Client, r.Clients, progress)
+		if err != nil {
+			return schemav1alpha1.ClusterTargets{}, err
+		}
+		done, err := cluster.Execute(execCtx, targetsToRun, execConfiguration)
+		if err == nil && spec.OutputConfigMap != nil {
+			err = schemaversions.PublishOutputs(execCtx, r.Client, owner, *spec.OutputConfigMap, done.Outputs)
+		}
+		if err != nil && errors.Is(execCtx.Err(), context.DeadlineExceeded) && !errors.Is(err, context.DeadlineExceeded) {
+			err = fmt.Errorf("%s: %w", err, execCtx.Err())
+		}
+		return done, err
+	})
+	return ctrl.Result{RequeueAfter: runPollInterval}, nil
+}
+
+// reportSkipped sets the `Targets` condition, listing the skipped targets (e.g. follower DBs) in its message.
+// A `SkippedTargets` event is reported when the skipped targets change.
+func (r *ClusterExecuterReconciler) reportSkipped(executer *schemav1alpha1.ClusterExecuter, skipped []schemav1alpha1.SkippedTarget) {
+	condition := metav1.Condition{
+		Type:   schemav1alpha1.ConditionTargets,
+		Status: metav1.ConditionTrue,
+		Reason: "TargetsFound",
+	}
+	if len(skipped) > 0 {
+		dbs := make([]string, 0, len(skipped))
+		for _, target := range skipped {
+			dbs = append(dbs, fmt.Sprintf("%s (%s)", target.DB, target.Reason))
+		}
+		condition.Reason = "TargetsSkipped"
+		condition.Message = fmt.Sprintf("skipped %d dbs: %s", len(skipped), strings.Join(dbs, ", "))
+		current := meta.FindStatusCondition(executer.Status.Conditions, schemav1alpha1.ConditionTargets)
+		if current == nil || current.Message != condition.Message {
+			r.recorder.Event(executer, v1.EventTypeWarning, "SkippedTargets", condition.Message)
+		}
+	}
+	meta.SetStatusCondition(&executer.Status.Conditions, condition)
+}
+
+// unknownType marks the executer as failed since no engine is registered for its type.
+// It isn't retried - a change of the type triggers a new reconcile.
+func (r *ClusterExecuterReconciler) unknownType(ctx context.Context, executer *schemav1alpha1.ClusterExecuter, typeErr error) (ctrl.Result, error) {
+	log := r.Log.WithValues("ClusterExecuter", executer.Namespace+"/"+executer.Name)
+	log.Error(typeErr, "no engine is registered for the executer type", "supported", clusterUtils.Types())
+	if !meta.IsStatusConditionFalse(executer.Status.Conditions, schemav1alpha1.ConditionExecution) {
+		r.recorder.Event(executer, v1.EventTypeWarning, "UnknownType", typeErr.Error())
+	}
+	meta.SetStatusCondition(&executer.Status.Conditions, metav1.Condition{
+		Type:    schemav1alpha1.ConditionExecution,
+		Status:  metav1.ConditionFalse,
+		Reason:  "UnknownType",
+		Message: typeErr.Error(),
+	})
+	executer.Status.Executed = false
+	executer.Status.Failed = true
+	err := r.Status().Update(ctx, executer)
+	if err != nil {
+		log.Error(err, "failed updating executer status")
+		return ctrl.Result{}, err
+	}
+	return ctrl.Result{}, nil
+}
+
+// checkRun polls the background execution of the executer - updating the progress while it runs
+// and recording its result once it finished.
+func (r *ClusterExecuterReconciler) checkRun(ctx context.Context, executer *schemav1alpha1.ClusterExecuter, run runner.Run) (ctrl.Result, error) {
+	log := r.Log.WithValues("ClusterExecuter", run.Key)
+	if !run.Finished {
+		if run.CompletedPCT != executer.Status.CompletedPCT {
+			executer.Status.CompletedPCT = run.CompletedPCT
+			if err := r.Status().Update(ctx, executer); err != nil {
+				log.Error(err, "Failed to update execution PCT ", "completed", run.CompletedPCT, "cluster", executer.Spec.ClusterUri)
+			}
+		}
+		log.Info("execution running - wait patiently", "completed", run.CompletedPCT)
+		return ctrl.Result{RequeueAfter: runPollInterval}, nil
+	}
+
+	if err := r.recordResult(ctx, executer, run.Done, run.Err); err != nil {
+		// the run is kept so the result is recorded on the next attempt
+		return ctrl.Result{}, err
+	}
+	r.Runner.Forget(run.Key)
+	// a failed execution is retried with the controller backoff
+	return ctrl.Result{}, run.Err
+}
+
+// startJob starts the execution of the targets as a Kubernetes `Job`.
+// The status (targets and job) is persisted before the job is created, as the job executes the targets of the stored status.
+// Job names are derived from the run number, which is kept if the job can't be created so the next attempt uses a new name.
+func (r *ClusterExecuterReconciler) startJob(ctx context.Context, executer *schemav1alpha1.ClusterExecuter, targets schemav1alpha1.ClusterTargets) (ctrl.Result, error) {
+	log := r.Log.WithValues("ClusterExecuter", executer.Namespace+"/"+executer.Name)
+	name := runner.JobName(executer, executer.Status.JobRuns+1)
+	job, err := runner.NewJob(executer, name)
+	if err != nil {
+		log.Error(err, "failed to create the execution job spec")
+		return ctrl.Result{}, err
+	}
+	err = ctrl.SetControllerReference(executer, job, r.Scheme)
+	if err != nil {
+		log.Error(err, "failed to set the controller reference of the execution job", "job", name)
+		return ctrl.Result{}, err
+	}
+
+	executer.Status.Targets = targets
+	executer.Status.Running = true
+	executer.Status.CompletedPCT = 0
+	executer.Status.Config = schemav1alpha1.ExecutionConfiguration{}
+	executer.Status.JobRuns = executer.Status.JobRuns + 1
+	executer.Status.Job = name
+	// the jobs store their logs in the executer logs configmap
+	executer.Status.Logs = runlogs.NewConfigMapStore(r.Client).Location(executer.Namespace, executer.Name)
+	now := metav1.Now()
+	executer.Status.StartTime = &now
+	err = r.Status().Update(ctx, executer)
+	if err != nil {
+		log.Error(err, "failed updating executer status", "job", name)
+		return ctrl.Result{}, err
+	}
+
+	err = r.Create(ctx, job)
+	if apierrors.IsAlreadyExists(err) {
+		// a leftover job of a previous executer with the same name - it didn't run on these targets
+		err = fmt.Errorf("the execution job %s already exists", name)
+	}
+	if err != nil {
+		log.Error(err, "failed to create the execution job", "job", name)
+		executer.Status.Running = false
+		executer.Status.Job = ""
+		if updateErr := r.Status().Update(ctx, executer); updateErr != nil {
+			// the missing job is handled as an interrupted execution
+			log.Error(updateErr, "failed updating executer status", "job", name)
+		}
+		return ctrl.Result{}, err
+	}
+	r.recorder.Eventf(executer, v1.EventTypeNormal, "Started", "cluster executer started as job %s", name)
+	return ctrl.Result{RequeueAfter: runPollInterval}, nil
+}
+
+// checkJob polls the execution job of the executer and records its result once it finished.
+// A deleted job is handled as an interrupted execution.
+func (r *ClusterExecuterReconciler) checkJob(ctx context.Context, executer *schemav1alpha1.ClusterExecuter) (ctrl.Result, error) {
+	log := r.Log.WithValues("ClusterExecuter", executer.Namespace+"/"+executer.Name, "job", executer.Status.Job)
+	job := &batchv1.Job{}
+	err := r.Get(ctx, types.NamespacedName{Namespace: executer.Namespace, Name: executer.Status.Job}, job)
+	if apierrors.IsNotFound(err) {
+		log.Info("execution job not found - it was interrupted")
+		return r.recoverInterruptedRun(ctx, executer)
+	}
+	if err != nil {
+		return ctrl.Result{}, err
+	}
+	finished, succeeded, reason, message := runner.JobFinished(job)
+	if !finished {
+		log.Info("execution job running - wait patiently")
+		return ctrl.Result{RequeueAfter: runPollInterval}, nil
+	}
+
+	result, published, err := runner.GetJobResult(ctx, r.Client, job.Namespace, job.Name)
+	if err != nil {
+		log.Error(err, "failed to get the execution job result")
+		return ctrl.Result{}, err
+	}
+	pod := r.jobPod(ctx, job)
+	var execErr error
+	switch {
+	case published && result.TimedOut:
+		execErr = fmt.Errorf("%s: %w", result.Error, context.DeadlineExceeded)
+	case published && result.Error != "":
+		execErr = errors.New(result.Error)
+	case published:
+	case reason == "DeadlineExceeded":
+		execErr = fmt.Errorf("job %s: %s: %w", job.Name, message, context.DeadlineExceeded)
+	case !succeeded:
+		execErr = fmt.Errorf("job %s failed (%s): %s%s", job.Name, reason, message, podTermination(pod))
+	default:
+		execErr = fmt.Errorf("job %s finished without a result", job.Name)
+	}
+
+	run := schemav1alpha1.ExecutionRun{
+		Job:            job.Name,
+		StartTime:      job.Status.StartTime,
+		CompletionTime: job.Status.CompletionTime,
+		Succeeded:      execErr == nil,
+	}
+	if pod != nil {
+		run.Pod = pod.Name
+		run.Logs = "pod/" + pod.Name
+	}
+	runs := append([]schemav1alpha1.ExecutionRun{run}, executer.Status.Runs...)
+	var expired []schemav1alpha1.ExecutionRun
+	if limit := runner.HistoryLimit(executer.Spec); len(runs) > limit {
+		runs, expired = runs[:limit], runs[limit:]
+	}
+	executer.Status.Runs = runs
+	if err := r.recordResult(ctx, executer, result.Done, execErr); err != nil {
+		return ctrl.Result{}, err
+	}
+	for _, old := range expired {
+		r.deleteJob(ctx, executer.Namespace, old.Job)
+	}
+	// a failed execution is retried with the controller backoff
+	return ctrl.Result{}, execErr
+}
+
+// jobPod returns the pod of the job, nil if it wasn't found.
+func (r *ClusterExecuterReconciler) jobPod(ctx context.Context, job *batchv1.Job) *v1.Pod {
+	pods := &v1.PodList{}
+	err := r.List(ctx, pods, client.InNamespace(job.Namespace), client.MatchingLabels{"job-name": job.Name})
+	if err != nil || len(pods.Items) == 0 {
+		r.Log.Info("execution job pod not found", "job", job.Name)
+		return nil
+	}
+	return &pods.Items[0]
+}
 
+// podTermination describes why the job pod was terminated, e.g. `OOMKilled`.
+func podTermination(pod *v1.Pod) string {
+	if pod == nil {
+		return ""
+	}
+	for _, status := range pod.Status.ContainerStatuses {
+		if status.State.Terminated != nil && status.State.Terminated.Reason != "" {
+			return fmt.Sprintf(" - container %s %s", status.Name, status.State.Terminated.Reason)
+		}
+	}
+	return ""
+}
+
+// deleteJob deletes an expired execution job along with its pod and result.
+func (r *ClusterExecuterReconciler) deleteJob(ctx context.Context, namespace, name string) {
+	job := &batchv1.Job{ObjectMeta: metav1.ObjectMeta{Namespace: namespace, Name: name}}
+	err := r.Delete(ctx, job, client.PropagationPolicy(metav1.DeletePropagationBackground))
+	if client.IgnoreNotFound(err) != nil {
+		r.Log.Error(err, "failed to delete the expired execution job", "job", name)
+	}
+}
+
+// recordResult updates the executer status with the result of the execution.
+func (r *ClusterExecuterReconciler) recordResult(ctx context.Context, executer *schemav1alpha1.ClusterExecuter, done schemav1alpha1.ClusterTargets, err error) error {
+	log := r.Log.WithValues("ClusterExecuter", executer.Namespace+"/"+executer.Name)
+	targetsToRun := clusterUtils.Difference(executer.Status.Targets, executer.Status.DoneTargets)
+	executer.Status.Running = false
 	if err != nil {
 		log.Error(err, "failed executing the schema on the cluster")
 		clusterStatusGauge.WithLabelValues(clusterUtils.ClusterNameFromURI(executer.Spec.ClusterUri), strconv.Itoa(int(executer.Spec.Revision))).Set(0)
 		r.recorder.Eventf(executer, v1.EventTypeWarning, "Failed", "failed to execute cluster: %s ", executer.Spec.ClusterUri)
+		reason := "Failed"
+		if errors.Is(err, context.DeadlineExceeded) {
+			reason = "TimedOut"
+			r.recorder.Eventf(executer, v1.EventTypeWarning, "TimedOut", "execution timed out after %s", runner.ExecutionTimeout(executer.Spec))
+			meta.SetStatusCondition(&executer.Status.Conditions, metav1.Condition{
+				Type:    schemav1alpha1.ConditionTimedOut,
+				Status:  metav1.ConditionTrue,
+				Reason:  "ExecutionTimeout",
+				Message: fmt.Sprintf("execution stopped after %s", runner.ExecutionTimeout(executer.Spec)),
+			})
+		}
 		meta.SetStatusCondition(&executer.Status.Conditions, metav1.Condition{
 			Type:    schemav1alpha1.ConditionExecution,
 			Status:  metav1.ConditionFalse,
-			Reason:  "Failed",
+			Reason:  reason,
 			Message: err.Error(),
 		})
 		executer.Status.Executed = false
-		executer.Status.Running = false
 		executer.Status.Failed = true
 		executer.Status.NumFailures = executer.Status.NumFailures + 1
-		err = r.Status().Update(ctx, executer)
-		if err != nil {
-			log.Error(err, "failed updating executer status", "request", req.String())
-			return ctrl.Result{}, err
+		// keep the partially executed targets so a retry only runs the failed ones
+		executer.Status.DoneTargets = clusterUtils.Union(executer.Status.DoneTargets, schemav1alpha1.ClusterTargets{DBs: done.DBs, Schemas: done.Schemas})
+		executer.Status.FailedTargets = clusterUtils.Difference(targetsToRun, done)
+		executer.Status.DBResults = done.Results
+		updateErr := r.Status().Update(ctx, executer)
+		if updateErr != nil {
+			log.Error(updateErr, "failed updating executer status")
 		}
-		return ctrl.Result{}, err
+		return updateErr
 	}
 	clusterStatusGauge.WithLabelValues(clusterUtils.ClusterNameFromURI(executer.Spec.ClusterUri), strconv.Itoa(int(executer.Spec.Revision))).Set(1)
 	clusterSuccessTime.WithLabelValues(clusterUtils.ClusterNameFromURI(executer.Spec.ClusterUri), strconv.Itoa(int(executer.Spec.Revision))).SetToCurrentTime()
@@ -197,23 +533,125 @@ func (r *ClusterExecuterReconciler) Reconcile(ctx context.Context, req ctrl.Requ
 		Status: metav1.ConditionTrue,
 		Reason: "Executed",
 	})
-	executer.Status.Running = false
+	meta.RemoveStatusCondition(&executer.Status.Conditions, schemav1alpha1.ConditionTimedOut)
 	executer.Status.Executed = true
+	executer.Status.Failed = false
+	executer.Status.CompletedPCT = 100
 	executer.Status.DoneTargets = executer.Status.Targets
+	executer.Status.FailedTargets = schemav1alpha1.ClusterTargets{}
+	executer.Status.DBResults = done.Results
 
 	err = r.Status().Update(ctx, executer)
 	if err != nil {
-		log.Error(err, "failed updating executer status", "request", req.String())
+		log.Error(err, "failed updating executer status")
+	}
+	return err
+}
+
+// firstSeen checks if the executer wasn't handled yet - it has never run, failed or reported a condition.
+func firstSeen(executer *schemav1alpha1.ClusterExecuter) bool {
+	status := executer.Status
+	return status.ObservedRestarts == 0 && status.JobRuns == 0 && status.StartTime == nil &&
+		!status.Executed && !status.Failed && len(status.Conditions) == 0
+}
+
+// observeRestarts marks the restarts a new executer was created with as handled -
+// they were requested for the previous revisions, the new executer runs anyway.
+func (r *ClusterExecuterReconciler) observeRestarts(ctx context.Context, executer *schemav1alpha1.ClusterExecuter) (ctrl.Result, error) {
+	executer.Status.ObservedRestarts = executer.Spec.Restarts
+	err := r.Status().Update(ctx, executer)
+	if err != nil {
+		r.Log.Error(err, "failed updating the new executer status", "executer", executer.Name)
 		return ctrl.Result{}, err
 	}
+	return ctrl.Result{Requeue: true}, nil
+}
 
-	return ctrl.Result{}, nil
+// restartRequested checks if a restart was requested since the last one the executer handled
+func restartRequested(executer *schemav1alpha1.ClusterExecuter) bool {
+	return executer.Spec.Restarts > executer.Status.ObservedRestarts
+}
+
+// restart resets the execution state, so the revision is executed again on all the targets (including the retries count).
+func (r *ClusterExecuterReconciler) restart(ctx context.Context, executer *schemav1alpha1.ClusterExecuter) (ctrl.Result, error) {
+	r.recorder.Eventf(executer, v1.EventTypeNormal, "Restarted", "restart %d requested", executer.Spec.Restarts)
+	executer.Status.ObservedRestarts = executer.Spec.Restarts
+	executer.Status.Executed = false
+	executer.Status.Failed = false
+	executer.Status.NumFailures = 0
+	executer.Status.CompletedPCT = 0
+	executer.Status.DoneTargets = schemav1alpha1.ClusterTargets{}
+	executer.Status.FailedTargets = schemav1alpha1.ClusterTargets{}
+	executer.Status.DBResults = nil
+	meta.RemoveStatusCondition(&executer.Status.Conditions, schemav1alpha1.ConditionTimedOut)
+	err := r.Status().Update(ctx, executer)
+	if err != nil {
+		r.Log.Error(err, "failed updating the restarted executer status", "executer", executer.Name)
+		return ctrl.Result{}, err
+	}
+	return ctrl.Result{Requeue: true}, nil
+}
+
+// pause marks the executer as paused, no new execution is started until it is resumed.
+func (r *ClusterExecuterReconciler) pause(ctx context.Context, executer *schemav1alpha1.ClusterExecuter) (ctrl.Result, error) {
+	if meta.IsStatusConditionTrue(executer.Status.Conditions, schemav1alpha1.ConditionPaused) {
+		return ctrl.Result{}, nil
+	}
+	r.recorder.Event(executer, v1.EventTypeNormal, "Paused", "executer paused")
+	meta.SetStatusCondition(&executer.Status.Conditions, metav1.Condition{
+		Type:    schemav1alpha1.ConditionPaused,
+		Status:  metav1.ConditionTrue,
+		Reason:  "Paused",
+		Message: "no new executions are started until the deployment is resumed",
+	})
+	err := r.Status().Update(ctx, executer)
+	if err != nil {
+		r.Log.Error(err, "failed updating the paused executer status", "executer", executer.Name)
+	}
+	return ctrl.Result{}, err
+}
+
+// recoverInterruptedRun fails an execution that is marked as running but isn't tracked by the runner,
+// i.e. the operator restarted (or lost the leadership) in the middle of it.
+// The interruption counts as a failure, so the execution is retried on the targets that weren't done (up to the max failures).
+func (r *ClusterExecuterReconciler) recoverInterruptedRun(ctx context.Context, executer *schemav1alpha1.ClusterExecuter) (ctrl.Result, error) {
+	message := "execution was interrupted"
+	if executer.Status.StartTime != nil {
+		message = fmt.Sprintf("execution started at %s was interrupted", executer.Status.StartTime.UTC().Format(time.RFC3339))
+	}
+	r.recorder.Event(executer, v1.EventTypeWarning, "Interrupted", message)
+	meta.SetStatusCondition(&executer.Status.Conditions, metav1.Condition{
+		Type:    schemav1alpha1.ConditionExecution,
+		Status:  metav1.ConditionFalse,
+		Reason:  "Interrupted",
+		Message: message,
+	})
+	executer.Status.Running = false
+	executer.Status.Executed = false
+	executer.Status.Failed = true
+	executer.Status.NumFailures = executer.Status.NumFailures + 1
+	err := r.Status().Update(ctx, executer)
+	if err != nil {
+		r.Log.Error(err, "failed updating the interrupted executer status", "executer", executer.Name)
+		return ctrl.Result{}, err
+	}
+	return ctrl.Result{Requeue: true}, nil
 }
 
 // SetupWithManager sets up the controller with the Manager.
 func (r *ClusterExecuterReconciler) SetupWithManager(mgr ctrl.Manager) error {
 	r.recorder = mgr.GetEventRecorderFor("ClusterExecuter")
+	if r.Runner == nil {
+		r.Runner = runner.NewRunner()
+		if err := mgr.Add(r.Runner); err != nil {
+			return err
+		}
+	}
+	if r.Logs == nil {
+		r.Logs = runlogs.NewConfigMapStore(mgr.GetClient())
+	}
 	return ctrl.NewControllerManagedBy(mgr).
 		For(&schemav1alpha1.ClusterExecuter{}).
+		Owns(&batchv1.Job{}).
 		Complete(r)
 }
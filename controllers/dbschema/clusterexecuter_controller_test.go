@@ -8,14 +8,92 @@ import (
 
 	. "github.com/onsi/ginkgo/v2"
 	. "github.com/onsi/gomega"
+	"github.com/spf13/viper"
+	batchv1 "k8s.io/api/batch/v1"
 	v1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/meta"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/kubernetes/scheme"
+	"k8s.io/client-go/tools/record"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
 
 	kutoschemav1 "github.com/microsoft/azure-schema-operator/apis/dbschema/v1alpha1"
 	schemav1alpha1 "github.com/microsoft/azure-schema-operator/apis/dbschema/v1alpha1"
+	clusterUtils "github.com/microsoft/azure-schema-operator/pkg/cluster"
+	"github.com/microsoft/azure-schema-operator/pkg/config"
+	"github.com/microsoft/azure-schema-operator/pkg/runlogs"
+	"github.com/microsoft/azure-schema-operator/pkg/runner"
 )
 
+// dbTypeSkipping is the type of the test engine skipping some of its targets
+const dbTypeSkipping schemav1alpha1.DBTypeEnum = "skipping"
+
+// skippingCluster targets db1 and skips the follower db2
+type skippingCluster struct{}
+
+func (skippingCluster) AquireTargets(ctx context.Context, filter schemav1alpha1.TargetFilter) (schemav1alpha1.ClusterTargets, error) {
+	return schemav1alpha1.ClusterTargets{
+		DBs:     []string{"db1"},
+		Skipped: []schemav1alpha1.SkippedTarget{{DB: "db2", Reason: "Follower", Message: "follower databases are read-only"}},
+	}, nil
+}
+
+func (skippingCluster) Execute(ctx context.Context, targets schemav1alpha1.ClusterTargets, config schemav1alpha1.ExecutionConfiguration) (schemav1alpha1.ClusterTargets, error) {
+	return schemav1alpha1.ClusterTargets{DBs: targets.DBs}, nil
+}
+
+func (skippingCluster) CreateExecConfiguration(ctx context.Context, targets schemav1alpha1.ClusterTargets, cfgMap *v1.ConfigMap, failIfDataLoss bool) (schemav1alpha1.ExecutionConfiguration, error) {
+	return schemav1alpha1.ExecutionConfiguration{}, nil
+}
+
+func init() {
+	clusterUtils.Register(clusterUtils.Engine{
+		Type: dbTypeSkipping,
+		New: func(uri string, opts clusterUtils.Options) (clusterUtils.Cluster, error) {
+			return skippingCluster{}, nil
+		},
+	})
+}
+
+// newTestExecuterReconciler returns a reconciler to call the executer flows directly.
+// The executers it works on are locked, so the reconciler of the test manager leaves them alone.
+func newTestExecuterReconciler() *ClusterExecuterReconciler {
+	return &ClusterExecuterReconciler{
+		Client:   k8sClient,
+		Scheme:   scheme.Scheme,
+		Log:      ctrl.Log.WithName("controllers").WithName("ClusterExecuterFlows"),
+		recorder: record.NewFakeRecorder(100),
+		Runner:   runner.NewRunner(),
+		Logs:     runlogs.NewConfigMapStore(k8sClient),
+	}
+}
+
+// newLockedExecuter creates a locked executer with the given runner
+func newLockedExecuter(ctx context.Context, name string, runnerSpec *schemav1alpha1.RunnerSpec) *schemav1alpha1.ClusterExecuter {
+	executer := &schemav1alpha1.ClusterExecuter{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:        name,
+			Namespace:   "default",
+			Annotations: map[string]string{"lock": "true"},
+		},
+		Spec: schemav1alpha1.ClusterExecuterSpec{
+			ClusterUri:    "https://cluster1.westeurope.kusto.windows.net",
+			Type:          schemav1alpha1.DBTypeKusto,
+			Revision:      1,
+			ConfigMapName: schemav1alpha1.NamespacedName{Namespace: "default", Name: name},
+			ApplyTo: schemav1alpha1.TargetFilter{
+				ClusterUris: []string{"https://cluster1.westeurope.kusto.windows.net"},
+				DB:          "db1",
+			},
+			Runner: runnerSpec,
+		},
+	}
+	Expect(k8sClient.Create(ctx, executer)).To(Succeed())
+	return executer
+}
+
 var _ = Describe("ClusterexecuterController", func() {
 	// const timeout = time.Second * 30
 	// const interval = time.Second * 10
@@ -79,5 +157,311 @@ var _ = Describe("ClusterexecuterController", func() {
 			// 	return ce.Status.Executed
 			// }, timeout, interval).Should(BeTrue())
 		})
+
+		It("Should fail executers of an unknown type with a condition", func() {
+			key := types.NamespacedName{Name: "cluster-exec-unknown-type", Namespace: "default"}
+			toCreate := &kutoschemav1.ClusterExecuter{
+				ObjectMeta: metav1.ObjectMeta{Name: key.Name, Namespace: key.Namespace},
+				Spec: kutoschemav1.ClusterExecuterSpec{
+					ClusterUri: "https://cluster1.westeurope.kusto.windows.net",
+					Type:       "mongo",
+					Revision:   1,
+					ConfigMapName: schemav1alpha1.NamespacedName{
+						Name:      kqlCfgName,
+						Namespace: kqlCfgNamespace,
+					},
+					ApplyTo: kutoschemav1.TargetFilter{
+						ClusterUris: []string{"https://cluster1.westeurope.kusto.windows.net"},
+					},
+				},
+			}
+			Expect(k8sClient.Create(context.Background(), toCreate)).Should(Succeed())
+
+			fetched := &kutoschemav1.ClusterExecuter{}
+			Eventually(func() *metav1.Condition {
+				Expect(k8sClient.Get(context.Background(), key, fetched)).To(Succeed())
+				return meta.FindStatusCondition(fetched.Status.Conditions, schemav1alpha1.ConditionExecution)
+			}, time.Second*30, time.Millisecond*250).ShouldNot(BeNil())
+			condition := meta.FindStatusCondition(fetched.Status.Conditions, schemav1alpha1.ConditionExecution)
+			Expect(condition.Status).To(Equal(metav1.ConditionFalse))
+			Expect(condition.Reason).To(Equal("UnknownType"))
+			Expect(fetched.Status.Failed).To(BeTrue())
+		})
+	})
+
+	Context("with execution jobs", func() {
+		ctx := context.Background()
+		targets := schemav1alpha1.ClusterTargets{DBs: []string{"db1", "db2"}}
+
+		BeforeEach(func() {
+			viper.Set(config.JobImage, "schemaop:test")
+		})
+		AfterEach(func() {
+			viper.Set(config.JobImage, "")
+		})
+
+		finishJob := func(name string, condition batchv1.JobConditionType, reason string) {
+			job := &batchv1.Job{}
+			Expect(k8sClient.Get(ctx, types.NamespacedName{Namespace: "default", Name: name}, job)).To(Succeed())
+			now := metav1.Now()
+			job.Status.StartTime = &now
+			if condition == batchv1.JobComplete {
+				job.Status.CompletionTime = &now
+				job.Status.Succeeded = 1
+			} else {
+				job.Status.Failed = 1
+			}
+			job.Status.Conditions = []batchv1.JobCondition{{Type: condition, Status: v1.ConditionTrue, Reason: reason, Message: "job " + reason}}
+			Expect(k8sClient.Status().Update(ctx, job)).To(Succeed())
+		}
+
+		It("Should start the execution job and record its result", func() {
+			r := newTestExecuterReconciler()
+			executer := newLockedExecuter(ctx, "exec-job-success", &schemav1alpha1.RunnerSpec{Mode: schemav1alpha1.RunnerModeJob})
+
+			_, err := r.startJob(ctx, executer, targets)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(executer.Status.Running).To(BeTrue())
+			Expect(executer.Status.JobRuns).To(Equal(int32(1)))
+			Expect(executer.Status.Job).To(Equal("exec-job-success-run-1"))
+			job := &batchv1.Job{}
+			Expect(k8sClient.Get(ctx, types.NamespacedName{Namespace: "default", Name: executer.Status.Job}, job)).To(Succeed())
+			Expect(job.Spec.Template.Spec.Containers[0].Image).To(Equal("schemaop:test"))
+			Expect(metav1.IsControlledBy(job, executer)).To(BeTrue())
+
+			By("polling the running job")
+			res, err := r.checkJob(ctx, executer)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(res.RequeueAfter).To(Equal(runPollInterval))
+			Expect(executer.Status.Running).To(BeTrue())
+
+			By("recording the published result of the finished job")
+			result := &v1.ConfigMap{
+				ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: job.Name},
+				Data:       map[string]string{"result": `{"done":{"dbs":["db1","db2"]}}`},
+			}
+			Expect(k8sClient.Create(ctx, result)).To(Succeed())
+			finishJob(job.Name, batchv1.JobComplete, "")
+			_, err = r.checkJob(ctx, executer)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(executer.Status.Running).To(BeFalse())
+			Expect(executer.Status.Executed).To(BeTrue())
+			Expect(executer.Status.DoneTargets.DBs).To(ConsistOf("db1", "db2"))
+			Expect(executer.Status.Runs).To(HaveLen(1))
+			Expect(executer.Status.Runs[0].Job).To(Equal(job.Name))
+			Expect(executer.Status.Runs[0].Succeeded).To(BeTrue())
+		})
+
+		It("Should persist the targets before creating the job and undo the start if it can't be created", func() {
+			r := newTestExecuterReconciler()
+			executer := newLockedExecuter(ctx, "exec-job-exists", &schemav1alpha1.RunnerSpec{Mode: schemav1alpha1.RunnerModeJob})
+			leftover, err := runner.NewJob(executer, runner.JobName(executer, 1))
+			Expect(err).NotTo(HaveOccurred())
+			Expect(k8sClient.Create(ctx, leftover)).To(Succeed())
+
+			_, err = r.startJob(ctx, executer, targets)
+			Expect(err).To(MatchError(ContainSubstring("already exists")))
+			stored := &schemav1alpha1.ClusterExecuter{}
+			Expect(k8sClient.Get(ctx, client.ObjectKeyFromObject(executer), stored)).To(Succeed())
+			Expect(stored.Status.Running).To(BeFalse())
+			Expect(stored.Status.Job).To(BeEmpty())
+			Expect(stored.Status.JobRuns).To(Equal(int32(1)))
+			Expect(stored.Status.Targets).To(Equal(targets))
+
+			By("starting the next attempt as a new job")
+			_, err = r.startJob(ctx, stored, targets)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(stored.Status.Job).To(Equal(runner.JobName(executer, 2)))
+			Expect(k8sClient.Get(ctx, client.ObjectKeyFromObject(executer), stored)).To(Succeed())
+			Expect(stored.Status.Running).To(BeTrue())
+			Expect(stored.Status.Job).To(Equal(runner.JobName(executer, 2)))
+		})
+
+		It("Should fail the execution of a job that failed without a result", func() {
+			r := newTestExecuterReconciler()
+			executer := newLockedExecuter(ctx, "exec-job-failed", &schemav1alpha1.RunnerSpec{Mode: schemav1alpha1.RunnerModeJob})
+
+			_, err := r.startJob(ctx, executer, targets)
+			Expect(err).NotTo(HaveOccurred())
+			finishJob(executer.Status.Job, batchv1.JobFailed, "BackoffLimitExceeded")
+
+			_, err = r.checkJob(ctx, executer)
+			Expect(err).To(MatchError(ContainSubstring("BackoffLimitExceeded")))
+			Expect(executer.Status.Running).To(BeFalse())
+			Expect(executer.Status.Failed).To(BeTrue())
+			Expect(executer.Status.NumFailures).To(Equal(1))
+			Expect(executer.Status.FailedTargets.DBs).To(ConsistOf("db1", "db2"))
+			Expect(executer.Status.Runs).To(HaveLen(1))
+			Expect(executer.Status.Runs[0].Succeeded).To(BeFalse())
+
+			By("starting the retry as the next run")
+			_, err = r.startJob(ctx, executer, targets)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(executer.Status.Job).To(Equal("exec-job-failed-run-2"))
+		})
+
+		It("Should handle a deleted job as an interrupted execution", func() {
+			r := newTestExecuterReconciler()
+			executer := newLockedExecuter(ctx, "exec-job-deleted", &schemav1alpha1.RunnerSpec{Mode: schemav1alpha1.RunnerModeJob})
+
+			_, err := r.startJob(ctx, executer, targets)
+			Expect(err).NotTo(HaveOccurred())
+			r.deleteJob(ctx, "default", executer.Status.Job)
+
+			_, err = r.checkJob(ctx, executer)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(executer.Status.Running).To(BeFalse())
+			Expect(executer.Status.Failed).To(BeTrue())
+			condition := meta.FindStatusCondition(executer.Status.Conditions, schemav1alpha1.ConditionExecution)
+			Expect(condition).NotTo(BeNil())
+			Expect(condition.Reason).To(Equal("Interrupted"))
+		})
+
+		It("Should not start jobs with an image the operator doesn't allow", func() {
+			r := newTestExecuterReconciler()
+			executer := newLockedExecuter(ctx, "exec-job-image", &schemav1alpha1.RunnerSpec{Mode: schemav1alpha1.RunnerModeJob, Image: "attacker/image:latest"})
+
+			_, err := r.startJob(ctx, executer, targets)
+			Expect(err).To(HaveOccurred())
+			Expect(executer.Status.Running).To(BeFalse())
+			jobs := &batchv1.JobList{}
+			Expect(k8sClient.List(ctx, jobs, client.InNamespace("default"), client.MatchingLabels{runner.ExecuterLabel: executer.Name})).To(Succeed())
+			Expect(jobs.Items).To(BeEmpty())
+		})
+	})
+
+	Context("with interrupted executions", func() {
+		ctx := context.Background()
+
+		It("Should fail a stale running execution as interrupted", func() {
+			key := types.NamespacedName{Name: "cluster-exec-interrupted", Namespace: "default"}
+			executer := &kutoschemav1.ClusterExecuter{
+				ObjectMeta: metav1.ObjectMeta{Name: key.Name, Namespace: key.Namespace},
+				Spec: kutoschemav1.ClusterExecuterSpec{
+					ClusterUri:    "https://cluster1.westeurope.kusto.windows.net",
+					Type:          schemav1alpha1.DBTypeKusto,
+					Revision:      1,
+					ConfigMapName: schemav1alpha1.NamespacedName{Name: kqlCfgName, Namespace: kqlCfgNamespace},
+					ApplyTo: kutoschemav1.TargetFilter{
+						ClusterUris: []string{"https://cluster1.westeurope.kusto.windows.net"},
+						DB:          "db1",
+					},
+				},
+			}
+			Expect(k8sClient.Create(ctx, executer)).To(Succeed())
+
+			By("seeding a running status no execution tracks, as left by an operator restart")
+			Eventually(func() error {
+				Expect(k8sClient.Get(ctx, key, executer)).To(Succeed())
+				started := metav1.NewTime(time.Now().Add(-time.Hour))
+				executer.Status.Running = true
+				executer.Status.StartTime = &started
+				executer.Status.Targets = schemav1alpha1.ClusterTargets{DBs: []string{"db1"}}
+				return k8sClient.Status().Update(ctx, executer)
+			}, time.Second*10, time.Millisecond*250).Should(Succeed())
+
+			fetched := &kutoschemav1.ClusterExecuter{}
+			Eventually(func() *metav1.Condition {
+				Expect(k8sClient.Get(ctx, key, fetched)).To(Succeed())
+				return meta.FindStatusCondition(fetched.Status.Conditions, schemav1alpha1.ConditionExecution)
+			}, time.Second*30, time.Millisecond*250).ShouldNot(BeNil())
+			condition := meta.FindStatusCondition(fetched.Status.Conditions, schemav1alpha1.ConditionExecution)
+			Expect(condition.Reason).To(Equal("Interrupted"))
+			Expect(fetched.Status.Running).To(BeFalse())
+			Expect(fetched.Status.Failed).To(BeTrue())
+			Expect(fetched.Status.NumFailures).To(Equal(1))
+		})
+
+		It("Should cancel the execution of a deleted executer", func() {
+			r := newTestExecuterReconciler()
+			key := types.NamespacedName{Name: "cluster-exec-deleted", Namespace: "default"}
+			cancelled := make(chan struct{})
+			r.Runner.Submit(key.String(), func(ctx context.Context, progress func(pct int)) (schemav1alpha1.ClusterTargets, error) {
+				<-ctx.Done()
+				close(cancelled)
+				return schemav1alpha1.ClusterTargets{}, ctx.Err()
+			})
+
+			_, err := r.Reconcile(ctx, ctrl.Request{NamespacedName: key})
+			Expect(err).NotTo(HaveOccurred())
+			Eventually(cancelled).Should(BeClosed())
+			Eventually(func() bool {
+				_, ok := r.Runner.Get(key.String())
+				return ok
+			}).Should(BeFalse())
+		})
+	})
+
+	Context("with skipped targets", func() {
+		ctx := context.Background()
+
+		It("Should list the skipped targets in the targets condition and report them", func() {
+			key := types.NamespacedName{Name: "cluster-exec-skipped", Namespace: "default"}
+			cfgMap := &v1.ConfigMap{
+				ObjectMeta: metav1.ObjectMeta{Name: key.Name, Namespace: key.Namespace},
+				Data:       map[string]string{"kql": ".create table T (a:string)"},
+			}
+			Expect(k8sClient.Create(ctx, cfgMap)).To(Succeed())
+			executer := &kutoschemav1.ClusterExecuter{
+				ObjectMeta: metav1.ObjectMeta{Name: key.Name, Namespace: key.Namespace},
+				Spec: kutoschemav1.ClusterExecuterSpec{
+					ClusterUri:    "https://cluster1.westeurope.kusto.windows.net",
+					Type:          dbTypeSkipping,
+					Revision:      1,
+					ConfigMapName: schemav1alpha1.NamespacedName{Name: key.Name, Namespace: key.Namespace},
+					ApplyTo: kutoschemav1.TargetFilter{
+						ClusterUris: []string{"https://cluster1.westeurope.kusto.windows.net"},
+						DB:          "db",
+					},
+				},
+			}
+			Expect(k8sClient.Create(ctx, executer)).To(Succeed())
+
+			fetched := &kutoschemav1.ClusterExecuter{}
+			Eventually(func() bool {
+				Expect(k8sClient.Get(ctx, key, fetched)).To(Succeed())
+				return fetched.Status.Executed
+			}, time.Second*30, time.Millisecond*250).Should(BeTrue())
+			Expect(fetched.Status.Targets.DBs).To(Equal([]string{"db1"}))
+			Expect(fetched.Status.Targets.Skipped).To(HaveLen(1))
+			condition := meta.FindStatusCondition(fetched.Status.Conditions, schemav1alpha1.ConditionTargets)
+			Expect(condition).NotTo(BeNil())
+			Expect(condition.Status).To(Equal(metav1.ConditionTrue))
+			Expect(condition.Reason).To(Equal("TargetsSkipped"))
+			Expect(condition.Message).To(Equal("skipped 1 dbs: db2 (Follower)"))
+
+			Eventually(func() []string {
+				events := &v1.EventList{}
+				Expect(k8sClient.List(ctx, events, client.InNamespace(key.Namespace))).To(Succeed())
+				var messages []string
+				for _, event := range events.Items {
+					if event.InvolvedObject.Name == key.Name && event.Reason == "SkippedTargets" {
+						messages = append(messages, event.Message)
+					}
+				}
+				return messages
+			}, time.Second*10, time.Millisecond*250).Should(ConsistOf("skipped 1 dbs: db2 (Follower)"))
+		})
+
+		It("Should report the skipped targets only when they change", func() {
+			r := newTestExecuterReconciler()
+			recorder := r.recorder.(*record.FakeRecorder)
+			executer := &kutoschemav1.ClusterExecuter{}
+			skipped := []schemav1alpha1.SkippedTarget{{DB: "db2", Reason: "Follower"}}
+
+			r.reportSkipped(executer, skipped)
+			Expect(recorder.Events).To(Receive(Equal("Warning SkippedTargets skipped 1 dbs: db2 (Follower)")))
+			r.reportSkipped(executer, skipped)
+			Expect(recorder.Events).NotTo(Receive())
+
+			r.reportSkipped(executer, append(skipped, schemav1alpha1.SkippedTarget{DB: "db3", Reason: "ReadOnly"}))
+			Expect(recorder.Events).To(Receive(Equal("Warning SkippedTargets skipped 2 dbs: db2 (Follower), db3 (ReadOnly)")))
+
+			r.reportSkipped(executer, nil)
+			Expect(recorder.Events).NotTo(Receive())
+			condition := meta.FindStatusCondition(executer.Status.Conditions, schemav1alpha1.ConditionTargets)
+			Expect(condition.Reason).To(Equal("TargetsFound"))
+			Expect(condition.Message).To(BeEmpty())
+		})
 	})
 })
@@ -23,6 +23,7 @@ import (
 	// telemetry "github.com/Azure/azure-service-operator/pkg/telemetry"
 	"github.com/go-logr/logr"
 	schemav1alpha1 "github.com/microsoft/azure-schema-operator/apis/dbschema/v1alpha1"
+	clusterUtils "github.com/microsoft/azure-schema-operator/pkg/cluster"
 	"github.com/microsoft/azure-schema-operator/pkg/utils/schemaversions"
 	"github.com/rs/zerolog/log"
 )
@@ -131,9 +132,14 @@ func (r *SchemaDeploymentReconciler) Reconcile(ctx context.Context, req ctrl.Req
 					Name:      schemaversions.NameForConfigMap(template.Spec.Source.Name, template.Status.CurrentRevision),
 					Namespace: template.Namespace,
 				},
-				ApplyTo:        template.Spec.ApplyTo,
-				Type:           template.Spec.Type,
-				FailIfDataLoss: template.Spec.FailIfDataLoss,
+				ApplyTo:          template.Spec.ApplyTo,
+				Type:             template.Spec.Type,
+				FailIfDataLoss:   template.Spec.FailIfDataLoss,
+				OutputConfigMap:  template.Spec.OutputConfigMap,
+				ExecutionTimeout: template.Spec.ExecutionTimeout,
+				Runner:           template.Spec.Runner,
+				Paused:           template.Spec.Paused,
+				Restarts:         template.Spec.Restarts,
 			},
 		}
 		// Set template instance as the owner and controller
@@ -184,6 +190,14 @@ func (r *SchemaDeploymentReconciler) Reconcile(ctx context.Context, req ctrl.Req
 		return ctrl.Result{}, err
 	}
 
+	if r.syncPausedCondition(template) {
+		err = r.Status().Update(ctx, template)
+		if err != nil {
+			log.Error(err, "failed updating the paused status", "request", req.String())
+			return ctrl.Result{}, err
+		}
+	}
+
 	log.Info("Checking if template needs to update versioned deployment")
 	changed, err := r.compareAndUpdateVersionedDeployment(ctx, template, versionedDeployment)
 	if err != nil {
@@ -237,13 +251,34 @@ func (r *SchemaDeploymentReconciler) Reconcile(ctx context.Context, req ctrl.Req
 			log.Error(err, "failed updating status ", "request", req.String())
 			return ctrl.Result{}, err
 		}
-		return r.handleFailure(template)
+		return r.handleFailure(ctx, template)
 	}
 
 	log.Info("exiting reconciliation")
 	return ctrl.Result{}, err
 }
 
+// syncPausedCondition sets the `Paused` condition while the deployment is paused, it returns true if the condition changed.
+func (r *SchemaDeploymentReconciler) syncPausedCondition(template *schemav1alpha1.SchemaDeployment) bool {
+	paused := meta.FindStatusCondition(template.Status.Conditions, schemav1alpha1.ConditionPaused) != nil
+	if template.Spec.Paused == paused {
+		return false
+	}
+	if template.Spec.Paused {
+		r.recorder.Event(template, corev1.EventTypeNormal, "Paused", "deployment paused - no new executions are started")
+		meta.SetStatusCondition(&template.Status.Conditions, metav1.Condition{
+			Type:    schemav1alpha1.ConditionPaused,
+			Status:  metav1.ConditionTrue,
+			Reason:  "Paused",
+			Message: "no new executions are started until the deployment is resumed",
+		})
+		return true
+	}
+	r.recorder.Event(template, corev1.EventTypeNormal, "Resumed", "deployment resumed")
+	meta.RemoveStatusCondition(&template.Status.Conditions, schemav1alpha1.ConditionPaused)
+	return true
+}
+
 func (r *SchemaDeploymentReconciler) compareConfigMap(ctx context.Context, currentConfigMap schemav1alpha1.NamespacedName, cfgMap *corev1.ConfigMap) bool {
 	if currentConfigMap.Name == "" {
 		log.Info().Msg("current Map is empty - new template.")
@@ -272,6 +307,26 @@ func (r *SchemaDeploymentReconciler) compareAndUpdateVersionedDeployment(ctx con
 		deployment.Spec.FailIfDataLoss = template.Spec.FailIfDataLoss
 		changed = true
 	}
+	if !reflect.DeepEqual(template.Spec.OutputConfigMap, deployment.Spec.OutputConfigMap) {
+		deployment.Spec.OutputConfigMap = template.Spec.OutputConfigMap
+		changed = true
+	}
+	if !reflect.DeepEqual(template.Spec.ExecutionTimeout, deployment.Spec.ExecutionTimeout) {
+		deployment.Spec.ExecutionTimeout = template.Spec.ExecutionTimeout
+		changed = true
+	}
+	if !reflect.DeepEqual(template.Spec.Runner, deployment.Spec.Runner) {
+		deployment.Spec.Runner = template.Spec.Runner
+		changed = true
+	}
+	if template.Spec.Paused != deployment.Spec.Paused {
+		deployment.Spec.Paused = template.Spec.Paused
+		changed = true
+	}
+	if template.Spec.Restarts != deployment.Spec.Restarts {
+		deployment.Spec.Restarts = template.Spec.Restarts
+		changed = true
+	}
 
 	if changed {
 		err = r.Update(ctx, deployment)
@@ -286,12 +341,26 @@ func (r *SchemaDeploymentReconciler) compareAndUpdateVersionedDeployment(ctx con
 // 	return deployment.IsExecuted(), nil
 // }
 
-func (r *SchemaDeploymentReconciler) handleFailure(template *schemav1alpha1.SchemaDeployment) (ctrl.Result, error) {
+// handleFailure applies the failure policy of the failed deployment.
+// The rollback policy of engines that can't roll back is flagged on the `Execution` condition and handled as abort.
+func (r *SchemaDeploymentReconciler) handleFailure(ctx context.Context, template *schemav1alpha1.SchemaDeployment) (ctrl.Result, error) {
 	switch policy := template.Spec.FailurePolicy; policy {
 	case schemav1alpha1.FailurePolicyAbort:
 		log.Info().Msg("handling failure - abort policy.")
 	case schemav1alpha1.FailurePolicyRollback:
 		log.Info().Msg("handling failure - rollback policy.")
+		if engine, err := clusterUtils.Lookup(template.Spec.Type); err == nil && !engine.Capabilities.Rollback {
+			message := fmt.Sprintf("%s doesn't support rollback - the failed revision is kept as with the abort policy", template.Spec.Type)
+			log.Info().Msg(message)
+			r.recorder.Event(template, corev1.EventTypeWarning, "RollbackUnsupported", message)
+			meta.SetStatusCondition(&template.Status.Conditions, metav1.Condition{
+				Type:    schemav1alpha1.ConditionExecution,
+				Status:  metav1.ConditionFalse,
+				Reason:  "RollbackUnsupported",
+				Message: message,
+			})
+			return ctrl.Result{}, r.Status().Update(ctx, template)
+		}
 		if template.Status.CurrentRevision == 0 {
 			return ctrl.Result{}, fmt.Errorf("on first revision - no where back to go")
 		}
@@ -11,8 +11,14 @@ import (
 	. "github.com/onsi/gomega"
 
 	v1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/kubernetes/scheme"
+	"k8s.io/client-go/tools/record"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
 
 	kutoschemav1 "github.com/microsoft/azure-schema-operator/apis/dbschema/v1alpha1"
 	schemav1alpha1 "github.com/microsoft/azure-schema-operator/apis/dbschema/v1alpha1"
@@ -110,4 +116,211 @@ var _ = Describe("SchemaDeploymentController", func() {
 			// TODO: define execution verification
 		})
 	})
+
+	Context("rollout pause, resume and restart", func() {
+		const rolloutTimeout = time.Second * 30
+		const rolloutInterval = time.Millisecond * 250
+		ctx := context.Background()
+		// the executers have an unknown type, so they stop right after handling the rollout changes
+		const clusterUri = "https://rollout.westeurope.kusto.windows.net"
+
+		createDeployment := func(name string, paused bool) types.NamespacedName {
+			cfg := &v1.ConfigMap{
+				ObjectMeta: metav1.ObjectMeta{Name: name + "-kql", Namespace: "default"},
+				Data:       map[string]string{"kql": ".create-or-alter function Add(a:real,b:real) {a+b}"},
+			}
+			Expect(k8sClient.Create(ctx, cfg)).To(Succeed())
+			deployment := &kutoschemav1.SchemaDeployment{
+				ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: "default"},
+				Spec: kutoschemav1.SchemaDeploymentSpec{
+					ApplyTo:       kutoschemav1.TargetFilter{ClusterUris: []string{clusterUri}, DB: "db1"},
+					Type:          "mongo",
+					FailurePolicy: "abort",
+					Source:        schemav1alpha1.NamespacedName{Name: cfg.Name, Namespace: cfg.Namespace},
+					Paused:        paused,
+				},
+			}
+			Expect(k8sClient.Create(ctx, deployment)).To(Succeed())
+			return types.NamespacedName{Name: name, Namespace: "default"}
+		}
+		versioned := func(key types.NamespacedName) *kutoschemav1.VersionedDeplyment {
+			vd := &kutoschemav1.VersionedDeplyment{}
+			Eventually(func() error {
+				deployment := &kutoschemav1.SchemaDeployment{}
+				Expect(k8sClient.Get(ctx, key, deployment)).To(Succeed())
+				return k8sClient.Get(ctx, types.NamespacedName(deployment.Status.CurrentVerDeployment), vd)
+			}, rolloutTimeout, rolloutInterval).Should(Succeed())
+			return vd
+		}
+		executerKey := func(vd *kutoschemav1.VersionedDeplyment) types.NamespacedName {
+			return types.NamespacedName{Name: vd.Name + "-rollout", Namespace: vd.Namespace}
+		}
+		update := func(key types.NamespacedName, change func(spec *kutoschemav1.SchemaDeploymentSpec)) {
+			Eventually(func() error {
+				deployment := &kutoschemav1.SchemaDeployment{}
+				Expect(k8sClient.Get(ctx, key, deployment)).To(Succeed())
+				change(&deployment.Spec)
+				return k8sClient.Update(ctx, deployment)
+			}, rolloutTimeout, rolloutInterval).Should(Succeed())
+		}
+
+		It("should not create executers while paused and continue once resumed", func() {
+			key := createDeployment("rollout-paused", true)
+
+			By("setting the paused condition on the deployment")
+			Eventually(func() bool {
+				deployment := &kutoschemav1.SchemaDeployment{}
+				Expect(k8sClient.Get(ctx, key, deployment)).To(Succeed())
+				return meta.IsStatusConditionTrue(deployment.Status.Conditions, schemav1alpha1.ConditionPaused)
+			}, rolloutTimeout, rolloutInterval).Should(BeTrue())
+			vd := versioned(key)
+			Expect(vd.Spec.Paused).To(BeTrue())
+
+			By("not creating the executer of the paused versioned deployment")
+			Consistently(func() bool {
+				err := k8sClient.Get(ctx, executerKey(vd), &kutoschemav1.ClusterExecuter{})
+				return errors.IsNotFound(err)
+			}, time.Second*5, rolloutInterval).Should(BeTrue())
+
+			By("creating the executer once resumed")
+			update(key, func(spec *kutoschemav1.SchemaDeploymentSpec) { spec.Paused = false })
+			Eventually(func() error {
+				return k8sClient.Get(ctx, executerKey(vd), &kutoschemav1.ClusterExecuter{})
+			}, rolloutTimeout, rolloutInterval).Should(Succeed())
+			Eventually(func() bool {
+				deployment := &kutoschemav1.SchemaDeployment{}
+				Expect(k8sClient.Get(ctx, key, deployment)).To(Succeed())
+				return meta.FindStatusCondition(deployment.Status.Conditions, schemav1alpha1.ConditionPaused) == nil
+			}, rolloutTimeout, rolloutInterval).Should(BeTrue())
+		})
+
+		It("should pause and resume the existing executers", func() {
+			key := createDeployment("rollout-running", false)
+			vd := versioned(key)
+			executer := &kutoschemav1.ClusterExecuter{}
+			Eventually(func() error {
+				return k8sClient.Get(ctx, executerKey(vd), executer)
+			}, rolloutTimeout, rolloutInterval).Should(Succeed())
+
+			update(key, func(spec *kutoschemav1.SchemaDeploymentSpec) { spec.Paused = true })
+			Eventually(func() bool {
+				Expect(k8sClient.Get(ctx, executerKey(vd), executer)).To(Succeed())
+				return executer.Spec.Paused && meta.IsStatusConditionTrue(executer.Status.Conditions, schemav1alpha1.ConditionPaused)
+			}, rolloutTimeout, rolloutInterval).Should(BeTrue())
+
+			update(key, func(spec *kutoschemav1.SchemaDeploymentSpec) { spec.Paused = false })
+			Eventually(func() bool {
+				Expect(k8sClient.Get(ctx, executerKey(vd), executer)).To(Succeed())
+				return !executer.Spec.Paused && meta.FindStatusCondition(executer.Status.Conditions, schemav1alpha1.ConditionPaused) == nil
+			}, rolloutTimeout, rolloutInterval).Should(BeTrue())
+		})
+
+		It("should execute the revision again on restart", func() {
+			key := createDeployment("rollout-restart", false)
+			vd := versioned(key)
+			executer := &kutoschemav1.ClusterExecuter{}
+			Eventually(func() error {
+				return k8sClient.Get(ctx, executerKey(vd), executer)
+			}, rolloutTimeout, rolloutInterval).Should(Succeed())
+
+			By("seeding a done execution")
+			Eventually(func() error {
+				Expect(k8sClient.Get(ctx, executerKey(vd), executer)).To(Succeed())
+				executer.Status.DoneTargets = schemav1alpha1.ClusterTargets{DBs: []string{"db1"}}
+				executer.Status.NumFailures = 2
+				return k8sClient.Status().Update(ctx, executer)
+			}, rolloutTimeout, rolloutInterval).Should(Succeed())
+
+			By("restarting twice in the same second")
+			update(key, func(spec *kutoschemav1.SchemaDeploymentSpec) { spec.Restarts++ })
+			update(key, func(spec *kutoschemav1.SchemaDeploymentSpec) { spec.Restarts++ })
+			Eventually(func() int32 {
+				Expect(k8sClient.Get(ctx, executerKey(vd), executer)).To(Succeed())
+				return executer.Status.ObservedRestarts
+			}, rolloutTimeout, rolloutInterval).Should(Equal(int32(2)))
+			Expect(executer.Spec.Restarts).To(Equal(int32(2)))
+			Expect(executer.Status.DoneTargets.DBs).To(BeEmpty())
+			Expect(executer.Status.NumFailures).To(BeZero())
+		})
+
+		It("should not restart the executer of a new revision after a restart", func() {
+			key := createDeployment("rollout-revision", false)
+			vd := versioned(key)
+			executer := &kutoschemav1.ClusterExecuter{}
+			update(key, func(spec *kutoschemav1.SchemaDeploymentSpec) { spec.Restarts++ })
+			Eventually(func() int32 {
+				Expect(k8sClient.Get(ctx, executerKey(vd), executer)).To(Succeed())
+				return executer.Status.ObservedRestarts
+			}, rolloutTimeout, rolloutInterval).Should(Equal(int32(1)))
+
+			By("deploying a new revision")
+			cfg := &v1.ConfigMap{}
+			Expect(k8sClient.Get(ctx, types.NamespacedName{Name: key.Name + "-kql", Namespace: key.Namespace}, cfg)).To(Succeed())
+			cfg.Data["kql"] = ".create-or-alter function Sub(a:real,b:real) {a-b}"
+			Expect(k8sClient.Update(ctx, cfg)).To(Succeed())
+			next := &kutoschemav1.VersionedDeplyment{}
+			Eventually(func() string {
+				next = versioned(key)
+				return next.Name
+			}, rolloutTimeout, rolloutInterval).ShouldNot(Equal(vd.Name))
+
+			By("observing the restart it was created with")
+			Eventually(func() int32 {
+				if err := k8sClient.Get(ctx, executerKey(next), executer); err != nil {
+					return 0
+				}
+				return executer.Status.ObservedRestarts
+			}, rolloutTimeout, rolloutInterval).Should(Equal(int32(1)))
+			Expect(executer.Spec.Restarts).To(Equal(int32(1)))
+			Consistently(func() []v1.Event {
+				events := &v1.EventList{}
+				Expect(k8sClient.List(ctx, events, client.InNamespace(key.Namespace),
+					client.MatchingFields{"involvedObject.name": executer.Name, "reason": "Restarted"})).To(Succeed())
+				return events.Items
+			}, time.Second*5, rolloutInterval).Should(BeEmpty())
+		})
+	})
+
+	Context("rollback policy of an engine without rollback", func() {
+		ctx := context.Background()
+
+		It("should flag the rollback as unsupported on the execution condition", func() {
+			deployment := &kutoschemav1.SchemaDeployment{
+				ObjectMeta: metav1.ObjectMeta{Name: "rollback-unsupported", Namespace: "default"},
+				Spec: kutoschemav1.SchemaDeploymentSpec{
+					ApplyTo:       kutoschemav1.TargetFilter{ClusterUris: []string{"postgres://rollback.example.com"}, DB: "db1"},
+					Type:          "postgres",
+					FailurePolicy: schemav1alpha1.FailurePolicyRollback,
+					Source:        schemav1alpha1.NamespacedName{Name: "rollback-unsupported-sql", Namespace: "default"},
+					Paused:        true,
+				},
+			}
+			Expect(k8sClient.Create(ctx, deployment)).To(Succeed())
+			key := types.NamespacedName{Name: deployment.Name, Namespace: deployment.Namespace}
+			recorder := record.NewFakeRecorder(10)
+			r := &SchemaDeploymentReconciler{
+				Client:   k8sClient,
+				Log:      ctrl.Log.WithName("controllers").WithName("SchemaDeploymentTest"),
+				Scheme:   scheme.Scheme,
+				recorder: recorder,
+			}
+
+			Eventually(func() error {
+				template := &kutoschemav1.SchemaDeployment{}
+				if err := k8sClient.Get(ctx, key, template); err != nil {
+					return err
+				}
+				_, err := r.handleFailure(ctx, template)
+				return err
+			}, timeout, interval).Should(Succeed())
+
+			template := &kutoschemav1.SchemaDeployment{}
+			Expect(k8sClient.Get(ctx, key, template)).To(Succeed())
+			condition := meta.FindStatusCondition(template.Status.Conditions, schemav1alpha1.ConditionExecution)
+			Expect(condition).NotTo(BeNil())
+			Expect(condition.Status).To(Equal(metav1.ConditionFalse))
+			Expect(condition.Reason).To(Equal("RollbackUnsupported"))
+			Expect(recorder.Events).To(Receive(ContainSubstring("RollbackUnsupported")))
+		})
+	})
 })
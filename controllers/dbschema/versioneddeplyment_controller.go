@@ -5,6 +5,7 @@ package dbschema
 
 import (
 	"context"
+	"reflect"
 	"strings"
 	"time"
 
@@ -120,7 +121,10 @@ func (r *VersionedDeplymentReconciler) Reconcile(ctx context.Context, req ctrl.R
 		}
 		found := &schemav1alpha1.ClusterExecuter{}
 		err = r.Get(ctx, execKey, found)
-		if err != nil && errors.IsNotFound(err) {
+		if err != nil && errors.IsNotFound(err) && versionedDeplyment.Spec.Paused {
+			log.Info("deployment paused - not creating the cluster executer", "cluster-uri", uri)
+			continue
+		} else if err != nil && errors.IsNotFound(err) {
 
 			// Create cluster executer objects
 			ce, err := r.executerForCluster(uri, versionedDeplyment)
@@ -205,8 +209,13 @@ func (r *VersionedDeplymentReconciler) executerForCluster(uri string, versionedD
 				Namespace: versionedDeplyment.Spec.ConfigMapName.Namespace,
 				Name:      versionedDeplyment.Spec.ConfigMapName.Name,
 			},
-			FailIfDataLoss: versionedDeplyment.Spec.FailIfDataLoss,
-			Revision:       versionedDeplyment.Spec.Revision,
+			FailIfDataLoss:   versionedDeplyment.Spec.FailIfDataLoss,
+			Revision:         versionedDeplyment.Spec.Revision,
+			OutputConfigMap:  versionedDeplyment.Spec.OutputConfigMap,
+			ExecutionTimeout: versionedDeplyment.Spec.ExecutionTimeout,
+			Runner:           versionedDeplyment.Spec.Runner,
+			Paused:           versionedDeplyment.Spec.Paused,
+			Restarts:         versionedDeplyment.Spec.Restarts,
 		},
 		Status: schemav1alpha1.ClusterExecuterStatus{},
 	}
@@ -254,6 +263,26 @@ func (r *VersionedDeplymentReconciler) compareAndUpdateExecuter(ctx context.Cont
 		executer.Spec.FailIfDataLoss = versionedDeplyment.Spec.FailIfDataLoss
 		changed = true
 	}
+	if !reflect.DeepEqual(versionedDeplyment.Spec.OutputConfigMap, executer.Spec.OutputConfigMap) {
+		executer.Spec.OutputConfigMap = versionedDeplyment.Spec.OutputConfigMap
+		changed = true
+	}
+	if !reflect.DeepEqual(versionedDeplyment.Spec.ExecutionTimeout, executer.Spec.ExecutionTimeout) {
+		executer.Spec.ExecutionTimeout = versionedDeplyment.Spec.ExecutionTimeout
+		changed = true
+	}
+	if !reflect.DeepEqual(versionedDeplyment.Spec.Runner, executer.Spec.Runner) {
+		executer.Spec.Runner = versionedDeplyment.Spec.Runner
+		changed = true
+	}
+	if versionedDeplyment.Spec.Paused != executer.Spec.Paused {
+		executer.Spec.Paused = versionedDeplyment.Spec.Paused
+		changed = true
+	}
+	if versionedDeplyment.Spec.Restarts != executer.Spec.Restarts {
+		executer.Spec.Restarts = versionedDeplyment.Spec.Restarts
+		changed = true
+	}
 
 	if changed {
 		err = r.Update(ctx, executer)
@@ -274,6 +303,10 @@ func (r *VersionedDeplymentReconciler) statusCheck(ctx context.Context, versione
 	for i, exec := range versionedDeplyment.Status.Executers {
 		// TODO: check if all executers finished successfully
 		log.Info("Checking executer", "i", i, "exec", exec)
+		if exec.Name == "" {
+			// not created yet, e.g. while the deployment is paused
+			continue
+		}
 		found := &schemav1alpha1.ClusterExecuter{}
 		err := r.Get(ctx, types.NamespacedName{Namespace: exec.Namespace, Name: exec.Name}, found)
 		if err != nil {
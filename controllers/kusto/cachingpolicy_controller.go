@@ -16,9 +16,9 @@ import (
 	ctrl "sigs.k8s.io/controller-runtime"
 	"sigs.k8s.io/controller-runtime/pkg/client"
 
-	"github.com/Azure/azure-kusto-go/kusto"
 	"github.com/go-logr/logr"
 	kustov1alpha1 "github.com/microsoft/azure-schema-operator/apis/kusto/v1alpha1"
+	"github.com/microsoft/azure-schema-operator/pkg/clients"
 	"github.com/microsoft/azure-schema-operator/pkg/kustoutils"
 	corev1 "k8s.io/api/core/v1"
 )
@@ -29,6 +29,10 @@ type CachingPolicyReconciler struct {
 	Scheme   *runtime.Scheme
 	Log      logr.Logger
 	recorder record.EventRecorder
+	// Clients is the kusto client cache shared by the controllers
+	Clients *clients.Cache
+	// Connect returns the kusto client of a cluster, set to the client cache when empty (tests set a fake cluster)
+	Connect kustoutils.ConnectFunc
 }
 
 //+kubebuilder:rbac:groups=kusto.microsoft.com,resources=cachingpolicies,verbs=get;list;watch;create;update;patch;delete
@@ -58,15 +62,14 @@ func (r *CachingPolicyReconciler) Reconcile(ctx context.Context, req ctrl.Reques
 	clustersDone := make([]string, 0)
 	var executionError error
 	for _, cluster := range cachingPolicy.Spec.ClusterUris {
-		kcsb := kusto.NewConnectionStringBuilder(cluster).WithDefaultAzureCredential()
-		client, err := kusto.New(kcsb)
+		client, release, err := r.Connect(ctx, cluster)
 		if err != nil {
 			log.Error(err, "Failed to create Kusto Client")
 			r.recorder.Eventf(cachingPolicy, corev1.EventTypeWarning, "Failed", "Failed to set table policy in cluster  %s", cluster)
 			executionError = multierror.Append(executionError, err)
 			continue
 		}
-		defer client.Close()
+		defer release()
 		tablePolicy, err := kustoutils.GetTableCachingPolicy(ctx, client, cachingPolicy.Spec.DB, cachingPolicy.Spec.Table)
 		if err != nil {
 			r.recorder.Eventf(cachingPolicy, corev1.EventTypeWarning, "Failed", "Failed to set table policy in cluster  %s", cluster)
@@ -109,6 +112,9 @@ func (r *CachingPolicyReconciler) Reconcile(ctx context.Context, req ctrl.Reques
 // SetupWithManager sets up the controller with the Manager.
 func (r *CachingPolicyReconciler) SetupWithManager(mgr ctrl.Manager) error {
 	r.recorder = mgr.GetEventRecorderFor("CachingPolicy")
+	if r.Connect == nil {
+		r.Connect = kustoutils.CachedConnect(r.Clients)
+	}
 	return ctrl.NewControllerManagedBy(mgr).
 		For(&kustov1alpha1.CachingPolicy{}).
 		Complete(r)
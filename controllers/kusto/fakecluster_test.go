@@ -0,0 +1,99 @@
+package kusto
+
+// Copyright (c) Microsoft Corporation.
+// Licensed under the MIT License.
+
+import (
+	"context"
+	"time"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+
+	kustov1alpha1 "github.com/microsoft/azure-schema-operator/apis/kusto/v1alpha1"
+	kustotypes "github.com/microsoft/azure-schema-operator/pkg/kustoutils/types"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+)
+
+var _ = Describe("Kusto controllers on a fake cluster", Label("fake"), func() {
+	const timeout = time.Second * 30
+	const interval = time.Millisecond * 250
+
+	BeforeEach(func() {
+		fakeCluster.AddDatabase("fakedb", "events")
+	})
+
+	It("should set the table retention policy", func() {
+		key := types.NamespacedName{Name: "fake-retention-policy", Namespace: "default"}
+		toCreate := &kustov1alpha1.RetentionPolicy{
+			ObjectMeta: metav1.ObjectMeta{Name: key.Name, Namespace: key.Namespace},
+			Spec: kustov1alpha1.RetentionPolicySpec{
+				PolicySpec: kustov1alpha1.PolicySpec{
+					ClusterUris: []string{fakeCluster.URI},
+					DB:          "fakedb",
+					Table:       "events",
+				},
+				RetentionPolicy: kustotypes.RetentionPolicy{SoftDeletePeriod: "15.00:00:00", Recoverability: "Enabled"},
+			},
+		}
+		Expect(k8sClient.Create(context.Background(), toCreate)).Should(Succeed())
+
+		fetched := &kustov1alpha1.RetentionPolicy{}
+		Eventually(func() []string {
+			Expect(k8sClient.Get(context.Background(), key, fetched)).To(Succeed())
+			return fetched.Status.ClustersDone
+		}, timeout, interval).Should(Equal([]string{fakeCluster.URI}))
+		Expect(fetched.Status.Status).To(Equal("Success"))
+		Expect(fakeCluster.Policy("fakedb", "events", "retention")).To(ContainSubstring("15.00:00:00"))
+	})
+
+	It("should set the table caching policy", func() {
+		key := types.NamespacedName{Name: "fake-caching-policy", Namespace: "default"}
+		toCreate := &kustov1alpha1.CachingPolicy{
+			ObjectMeta: metav1.ObjectMeta{Name: key.Name, Namespace: key.Namespace},
+			Spec: kustov1alpha1.CachingPolicySpec{
+				PolicySpec: kustov1alpha1.PolicySpec{
+					ClusterUris: []string{fakeCluster.URI},
+					DB:          "fakedb",
+					Table:       "events",
+				},
+				CachingPolicy: "7d",
+			},
+		}
+		Expect(k8sClient.Create(context.Background(), toCreate)).Should(Succeed())
+
+		fetched := &kustov1alpha1.CachingPolicy{}
+		Eventually(func() []string {
+			Expect(k8sClient.Get(context.Background(), key, fetched)).To(Succeed())
+			return fetched.Status.ClustersDone
+		}, timeout, interval).Should(Equal([]string{fakeCluster.URI}))
+		Expect(fakeCluster.Policy("fakedb", "events", "caching")).To(ContainSubstring("7.00:00:00"))
+	})
+
+	It("should create the stored function", func() {
+		key := types.NamespacedName{Name: "fake-stored-function", Namespace: "default"}
+		toCreate := &kustov1alpha1.StoredFunction{
+			ObjectMeta: metav1.ObjectMeta{Name: key.Name, Namespace: key.Namespace},
+			Spec: kustov1alpha1.StoredFunctionSpec{
+				ClusterUris: []string{fakeCluster.URI},
+				DB:          "fakedb",
+				Name:        "AddTwo",
+				Parameters:  "(x:int)",
+				Body:        "{ x + 2 }",
+				Folder:      "math",
+			},
+		}
+		Expect(k8sClient.Create(context.Background(), toCreate)).Should(Succeed())
+
+		fetched := &kustov1alpha1.StoredFunction{}
+		Eventually(func() []string {
+			Expect(k8sClient.Get(context.Background(), key, fetched)).To(Succeed())
+			return fetched.Status.ClustersDone
+		}, timeout, interval).Should(Equal([]string{fakeCluster.URI}))
+		function, found := fakeCluster.Function("fakedb", "AddTwo")
+		Expect(found).To(BeTrue())
+		Expect(function.Body).To(Equal("{ x + 2 }"))
+		Expect(function.Folder).To(Equal("math"))
+	})
+})
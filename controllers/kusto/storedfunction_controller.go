@@ -16,9 +16,9 @@ import (
 	ctrl "sigs.k8s.io/controller-runtime"
 	"sigs.k8s.io/controller-runtime/pkg/client"
 
-	"github.com/Azure/azure-kusto-go/kusto"
 	"github.com/go-logr/logr"
 	kustov1alpha1 "github.com/microsoft/azure-schema-operator/apis/kusto/v1alpha1"
+	"github.com/microsoft/azure-schema-operator/pkg/clients"
 	"github.com/microsoft/azure-schema-operator/pkg/kustoutils"
 	"github.com/microsoft/azure-schema-operator/pkg/kustoutils/types"
 	corev1 "k8s.io/api/core/v1"
@@ -30,6 +30,10 @@ type StoredFunctionReconciler struct {
 	Scheme   *runtime.Scheme
 	Log      logr.Logger
 	recorder record.EventRecorder
+	// Clients is the kusto client cache shared by the controllers
+	Clients *clients.Cache
+	// Connect returns the kusto client of a cluster, set to the client cache when empty (tests set a fake cluster)
+	Connect kustoutils.ConnectFunc
 }
 
 //+kubebuilder:rbac:groups=kusto.microsoft.com,resources=storedfunctions,verbs=get;list;watch;create;update;patch;delete
@@ -67,15 +71,14 @@ func (r *StoredFunctionReconciler) Reconcile(ctx context.Context, req ctrl.Reque
 	clustersDone := make([]string, 0)
 	var executionError error
 	for _, cluster := range storedFunction.Spec.ClusterUris {
-		kcsb := kusto.NewConnectionStringBuilder(cluster).WithDefaultAzureCredential()
-		client, err := kusto.New(kcsb)
+		client, release, err := r.Connect(ctx, cluster)
 		if err != nil {
 			log.Error(err, "Failed to create Kusto Client")
 			r.recorder.Eventf(storedFunction, corev1.EventTypeWarning, "Failed", "Failed to create function in cluster  %s", cluster)
 			executionError = multierror.Append(executionError, err)
 			continue
 		}
-		defer client.Close()
+		defer release()
 
 		funcInDB, err := kustoutils.GetFunction(ctx, client, storedFunction.Spec.DB, kustoFunc, false)
 		if err != nil || !kustoFunc.Equals(funcInDB) {
@@ -115,6 +118,9 @@ func (r *StoredFunctionReconciler) Reconcile(ctx context.Context, req ctrl.Reque
 // SetupWithManager sets up the controller with the Manager.
 func (r *StoredFunctionReconciler) SetupWithManager(mgr ctrl.Manager) error {
 	r.recorder = mgr.GetEventRecorderFor("StoredFunction")
+	if r.Connect == nil {
+		r.Connect = kustoutils.CachedConnect(r.Clients)
+	}
 	return ctrl.NewControllerManagedBy(mgr).
 		For(&kustov1alpha1.StoredFunction{}).
 		Complete(r)
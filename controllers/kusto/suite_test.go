@@ -6,6 +6,7 @@ Licensed under the MIT license.
 package kusto
 
 import (
+	"context"
 	"path/filepath"
 	"strings"
 	"testing"
@@ -25,6 +26,9 @@ import (
 	"sigs.k8s.io/controller-runtime/pkg/log/zap"
 
 	kustov1alpha1 "github.com/microsoft/azure-schema-operator/apis/kusto/v1alpha1"
+	"github.com/microsoft/azure-schema-operator/pkg/clients"
+	"github.com/microsoft/azure-schema-operator/pkg/kustoutils"
+	"github.com/microsoft/azure-schema-operator/pkg/kustoutils/kustofake"
 	//+kubebuilder:scaffold:imports
 )
 
@@ -37,8 +41,21 @@ var testEnv *envtest.Environment
 
 var (
 	testCluster = strings.TrimSpace(viper.GetString("schemaop_test_kusto_cluster_name"))
+	// fakeCluster is served to the controllers instead of a live cluster
+	fakeCluster = kustofake.NewCluster("https://fake.westeurope.kusto.windows.net")
 )
 
+// connect returns the fake cluster for its uri and a cached client for any other cluster
+func connect(cache *clients.Cache) kustoutils.ConnectFunc {
+	cached := kustoutils.CachedConnect(cache)
+	return func(ctx context.Context, uri string) (kustoutils.QueryClient, func(), error) {
+		if uri == fakeCluster.URI {
+			return fakeCluster, func() {}, nil
+		}
+		return cached(ctx, uri)
+	}
+}
+
 func TestAPIs(t *testing.T) {
 	RegisterFailHandler(Fail)
 
@@ -74,10 +91,31 @@ var _ = BeforeSuite(func() {
 	})
 	Expect(err).ToNot(HaveOccurred())
 
+	cache := clients.NewCache(time.Minute, time.Minute)
 	err = (&RetentionPolicyReconciler{
-		Client: k8sManager.GetClient(),
-		Scheme: k8sManager.GetScheme(),
-		Log:    ctrl.Log.WithName("controllers").WithName("RetentionPolicyTest"),
+		Client:  k8sManager.GetClient(),
+		Scheme:  k8sManager.GetScheme(),
+		Log:     ctrl.Log.WithName("controllers").WithName("RetentionPolicyTest"),
+		Clients: cache,
+		Connect: connect(cache),
+	}).SetupWithManager(k8sManager)
+	Expect(err).ToNot(HaveOccurred())
+
+	err = (&CachingPolicyReconciler{
+		Client:  k8sManager.GetClient(),
+		Scheme:  k8sManager.GetScheme(),
+		Log:     ctrl.Log.WithName("controllers").WithName("CachingPolicyTest"),
+		Clients: cache,
+		Connect: connect(cache),
+	}).SetupWithManager(k8sManager)
+	Expect(err).ToNot(HaveOccurred())
+
+	err = (&StoredFunctionReconciler{
+		Client:  k8sManager.GetClient(),
+		Scheme:  k8sManager.GetScheme(),
+		Log:     ctrl.Log.WithName("controllers").WithName("StoredFunctionTest"),
+		Clients: cache,
+		Connect: connect(cache),
 	}).SetupWithManager(k8sManager)
 	Expect(err).ToNot(HaveOccurred())
 
@@ -6,15 +6,19 @@ package main
 import (
 	"flag"
 	"os"
+	"strings"
 
 	// Import all Kubernetes client auth plugins (e.g. Azure, GCP, OIDC, etc.)
 	// to ensure that exec-entrypoint and run can make use of them.
 	_ "k8s.io/client-go/plugin/pkg/client/auth"
 
+	corev1 "k8s.io/api/core/v1"
 	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
 	utilruntime "k8s.io/apimachinery/pkg/util/runtime"
 	clientgoscheme "k8s.io/client-go/kubernetes/scheme"
 	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
 	"sigs.k8s.io/controller-runtime/pkg/healthz"
 	"sigs.k8s.io/controller-runtime/pkg/log/zap"
 
@@ -22,6 +26,11 @@ import (
 	kustov1alpha1 "github.com/microsoft/azure-schema-operator/apis/kusto/v1alpha1"
 	"github.com/microsoft/azure-schema-operator/controllers/dbschema"
 	kustocontrollers "github.com/microsoft/azure-schema-operator/controllers/kusto"
+	"github.com/microsoft/azure-schema-operator/pkg/clients"
+	"github.com/microsoft/azure-schema-operator/pkg/config"
+	"github.com/microsoft/azure-schema-operator/pkg/runlogs"
+	"github.com/microsoft/azure-schema-operator/pkg/runner"
+	"github.com/spf13/viper"
 	//+kubebuilder:scaffold:imports
 )
 
@@ -42,6 +51,8 @@ func main() {
 	var enableLeaderElection bool
 	var probeAddr string
 	var configFile string
+	var execute string
+	var jobName string
 	flag.StringVar(&configFile, "config", "",
 		"The controller will load its initial configuration from this file. "+
 			"Omit this flag to use the default configuration values. "+
@@ -52,6 +63,9 @@ func main() {
 	flag.BoolVar(&enableLeaderElection, "leader-elect", false,
 		"Enable leader election for controller manager. "+
 			"Enabling this will ensure there is only one active controller manager.")
+	flag.StringVar(&execute, "execute", "",
+		"Execute the ClusterExecuter (namespace/name) and exit, instead of running the manager. Used by the execution jobs.")
+	flag.StringVar(&jobName, "job", "", "The name of the execution job, the execution result is published under it.")
 	opts := zap.Options{
 		Development: true,
 	}
@@ -59,6 +73,9 @@ func main() {
 	flag.Parse()
 
 	ctrl.SetLogger(zap.New(zap.UseFlagOptions(&opts)))
+	if execute != "" {
+		os.Exit(runExecutionJob(execute, jobName))
+	}
 	var err error
 	options := ctrl.Options{
 		Scheme:                 scheme,
@@ -67,6 +84,8 @@ func main() {
 		HealthProbeBindAddress: probeAddr,
 		LeaderElection:         enableLeaderElection,
 		LeaderElectionID:       "3864b4b4.dbschema.microsoft.com",
+		// execution job pods are looked up rarely, no need to cache all the pods in the cluster
+		ClientDisableCacheFor: []client.Object{&corev1.Pod{}},
 	}
 	if configFile != "" {
 		options, err = options.AndFrom(ctrl.ConfigFile().AtPath(configFile))
@@ -82,6 +101,15 @@ func main() {
 		os.Exit(1)
 	}
 
+	// DB clients are cached and shared by the controllers, idle and unhealthy clients are evicted.
+	viper.SetDefault(config.ClientIdleTimeout, clients.DefaultIdleTimeout)
+	viper.SetDefault(config.ClientCheckInterval, clients.DefaultCheckInterval)
+	clientCache := clients.NewCache(viper.GetDuration(config.ClientIdleTimeout), viper.GetDuration(config.ClientCheckInterval))
+	if err = mgr.Add(clientCache); err != nil {
+		setupLog.Error(err, "unable to set up the client cache")
+		os.Exit(1)
+	}
+
 	if err = (&dbschema.SchemaDeploymentReconciler{
 		Client: mgr.GetClient(),
 		Log:    ctrl.Log.WithName("controllers").WithName("SchemaDeployment"),
@@ -90,10 +118,17 @@ func main() {
 		setupLog.Error(err, "unable to create controller", "controller", "SchemaDeployment")
 		os.Exit(1)
 	}
+	logStore, err := runlogs.NewStore(mgr.GetClient())
+	if err != nil {
+		setupLog.Error(err, "unable to set up the execution logs store")
+		os.Exit(1)
+	}
 	if err = (&dbschema.ClusterExecuterReconciler{
-		Client: mgr.GetClient(),
-		Log:    ctrl.Log.WithName("controllers").WithName("ClusterExecuter"),
-		Scheme: mgr.GetScheme(),
+		Client:  mgr.GetClient(),
+		Log:     ctrl.Log.WithName("controllers").WithName("ClusterExecuter"),
+		Scheme:  mgr.GetScheme(),
+		Clients: clientCache,
+		Logs:    logStore,
 	}).SetupWithManager(mgr); err != nil {
 		setupLog.Error(err, "unable to create controller", "controller", "ClusterExecuter")
 		os.Exit(1)
@@ -107,25 +142,28 @@ func main() {
 		os.Exit(1)
 	}
 	if err = (&kustocontrollers.RetentionPolicyReconciler{
-		Client: mgr.GetClient(),
-		Log:    ctrl.Log.WithName("controllers").WithName("RetentionPolicy"),
-		Scheme: mgr.GetScheme(),
+		Client:  mgr.GetClient(),
+		Log:     ctrl.Log.WithName("controllers").WithName("RetentionPolicy"),
+		Scheme:  mgr.GetScheme(),
+		Clients: clientCache,
 	}).SetupWithManager(mgr); err != nil {
 		setupLog.Error(err, "unable to create controller", "controller", "RetentionPolicy")
 		os.Exit(1)
 	}
 	if err = (&kustocontrollers.CachingPolicyReconciler{
-		Client: mgr.GetClient(),
-		Log:    ctrl.Log.WithName("controllers").WithName("CachingPolicy"),
-		Scheme: mgr.GetScheme(),
+		Client:  mgr.GetClient(),
+		Log:     ctrl.Log.WithName("controllers").WithName("CachingPolicy"),
+		Scheme:  mgr.GetScheme(),
+		Clients: clientCache,
 	}).SetupWithManager(mgr); err != nil {
 		setupLog.Error(err, "unable to create controller", "controller", "CachingPolicy")
 		os.Exit(1)
 	}
 	if err = (&kustocontrollers.StoredFunctionReconciler{
-		Client: mgr.GetClient(),
-		Log:    ctrl.Log.WithName("controllers").WithName("StoredFunction"),
-		Scheme: mgr.GetScheme(),
+		Client:  mgr.GetClient(),
+		Log:     ctrl.Log.WithName("controllers").WithName("StoredFunction"),
+		Scheme:  mgr.GetScheme(),
+		Clients: clientCache,
 	}).SetupWithManager(mgr); err != nil {
 		setupLog.Error(err, "unable to create controller", "controller", "StoredFunction")
 		os.Exit(1)
@@ -147,3 +185,23 @@ func main() {
 		os.Exit(1)
 	}
 }
+
+// runExecutionJob executes a single ClusterExecuter, it is the entry point of the execution jobs.
+func runExecutionJob(execute string, jobName string) int {
+	namespace, name, found := strings.Cut(execute, "/")
+	if !found || jobName == "" {
+		setupLog.Error(nil, "--execute must be set to namespace/name along with --job", "execute", execute, "job", jobName)
+		return 1
+	}
+	c, err := client.New(ctrl.GetConfigOrDie(), client.Options{Scheme: scheme})
+	if err != nil {
+		setupLog.Error(err, "unable to create the client")
+		return 1
+	}
+	err = runner.RunJob(ctrl.SetupSignalHandler(), c, types.NamespacedName{Namespace: namespace, Name: name}, jobName)
+	if err != nil {
+		setupLog.Error(err, "execution failed", "executer", execute)
+		return 1
+	}
+	return 0
+}
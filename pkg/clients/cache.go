@@ -0,0 +1,173 @@
+package clients
+
+// Copyright (c) Microsoft Corporation.
+// Licensed under the MIT License.
+import (
+	"context"
+	"io"
+	"sync"
+	"time"
+
+	"github.com/rs/zerolog/log"
+)
+
+const (
+	// DefaultIdleTimeout is the time an unused client is kept in the cache
+	DefaultIdleTimeout = 15 * time.Minute
+	// DefaultCheckInterval is the interval of the idle eviction and health checks
+	DefaultCheckInterval = time.Minute
+)
+
+// Pinger is implemented by clients that support health checks (e.g. `*sql.DB`)
+type Pinger interface {
+	PingContext(ctx context.Context) error
+}
+
+// CreateFunc creates a new client for the cache
+type CreateFunc func(ctx context.Context) (io.Closer, error)
+
+type entry struct {
+	client   io.Closer
+	lastUsed time.Time
+	inUse    int
+}
+
+// Cache is a keyed cache of DB clients shared by the controllers of the manager.
+// Clients that weren't used for `IdleTimeout` are closed and evicted and clients failing
+// their health check (see `Pinger`) are evicted so they are recreated on the next use.
+// A nil `*Cache` is valid and doesn't cache - the clients are closed once released.
+type Cache struct {
+	IdleTimeout   time.Duration
+	CheckInterval time.Duration
+
+	mu      sync.Mutex
+	entries map[string]*entry
+}
+
+// NewCache returns a new client `Cache`
+func NewCache(idleTimeout, checkInterval time.Duration) *Cache {
+	return &Cache{
+		IdleTimeout:   idleTimeout,
+		CheckInterval: checkInterval,
+		entries:       make(map[string]*entry),
+	}
+}
+
+// Get returns the client cached under `key`, creating it with `create` if needed.
+// The returned release func must be called once the client is no longer used.
+func (c *Cache) Get(ctx context.Context, key string, create CreateFunc) (io.Closer, func(), error) {
+	if c == nil {
+		client, err := create(ctx)
+		if err != nil {
+			return nil, nil, err
+		}
+		return client, func() { closeClient(key, client) }, nil
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	e, ok := c.entries[key]
+	if !ok {
+		log.Debug().Msgf("creating a new client for %s", key)
+		client, err := create(ctx)
+		if err != nil {
+			return nil, nil, err
+		}
+		e = &entry{client: client}
+		c.entries[key] = e
+	}
+	e.inUse++
+	e.lastUsed = time.Now()
+	released := false
+	return e.client, func() {
+		c.mu.Lock()
+		defer c.mu.Unlock()
+		if released {
+			return
+		}
+		released = true
+		e.inUse--
+		e.lastUsed = time.Now()
+	}, nil
+}
+
+// Len returns the number of cached clients
+func (c *Cache) Len() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return len(c.entries)
+}
+
+// Sweep closes the idle clients and evicts the unhealthy ones.
+// Clients in use are left alone.
+func (c *Cache) Sweep(ctx context.Context) {
+	c.mu.Lock()
+	toCheck := make(map[string]*entry)
+	for key, e := range c.entries {
+		if e.inUse > 0 {
+			continue
+		}
+		if time.Since(e.lastUsed) > c.IdleTimeout {
+			log.Debug().Msgf("evicting idle client for %s", key)
+			delete(c.entries, key)
+			closeClient(key, e.client)
+			continue
+		}
+		if _, ok := e.client.(Pinger); ok {
+			toCheck[key] = e
+		}
+	}
+	c.mu.Unlock()
+
+	// health checks are done without holding the lock so they don't block the reconcilers
+	for key, e := range toCheck {
+		err := e.client.(Pinger).PingContext(ctx)
+		if err == nil {
+			continue
+		}
+		log.Error().Err(err).Msgf("health check failed for %s - evicting the client", key)
+		c.mu.Lock()
+		if c.entries[key] == e && e.inUse == 0 {
+			delete(c.entries, key)
+			closeClient(key, e.client)
+		}
+		c.mu.Unlock()
+	}
+}
+
+// Start runs the idle eviction and health checks until the context is done and closes all the clients.
+// It implements the controller-runtime `manager.Runnable` interface so the cache can be added to the manager.
+func (c *Cache) Start(ctx context.Context) error {
+	ticker := time.NewTicker(c.CheckInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			c.Close()
+			return nil
+		case <-ticker.C:
+			c.Sweep(ctx)
+		}
+	}
+}
+
+// NeedLeaderElection returns false - the cache is used by all the manager replicas.
+func (c *Cache) NeedLeaderElection() bool {
+	return false
+}
+
+// Close closes and evicts all the cached clients
+func (c *Cache) Close() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for key, e := range c.entries {
+		closeClient(key, e.client)
+	}
+	c.entries = make(map[string]*entry)
+}
+
+func closeClient(key string, client io.Closer) {
+	if err := client.Close(); err != nil {
+		log.Error().Err(err).Msgf("failed to close the client for %s", key)
+	}
+}
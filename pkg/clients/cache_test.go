@@ -0,0 +1,144 @@
+package clients_test
+
+// Copyright (c) Microsoft Corporation.
+// Licensed under the MIT License.
+import (
+	"context"
+	"errors"
+	"io"
+	"sync/atomic"
+	"time"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+
+	"github.com/microsoft/azure-schema-operator/pkg/clients"
+)
+
+type fakeClient struct {
+	closed  atomic.Bool
+	healthy atomic.Bool
+}
+
+func (f *fakeClient) Close() error {
+	f.closed.Store(true)
+	return nil
+}
+
+func (f *fakeClient) PingContext(ctx context.Context) error {
+	if !f.healthy.Load() {
+		return errors.New("connection lost")
+	}
+	return nil
+}
+
+var _ = Describe("Cache", func() {
+	var (
+		created int
+		client  *fakeClient
+		create  clients.CreateFunc
+		ctx     context.Context
+	)
+
+	BeforeEach(func() {
+		ctx = context.Background()
+		created = 0
+		create = func(ctx context.Context) (io.Closer, error) {
+			created++
+			client = &fakeClient{}
+			client.healthy.Store(true)
+			return client, nil
+		}
+	})
+
+	It("Should share the client by key", func() {
+		cache := clients.NewCache(time.Hour, time.Minute)
+		first, release1, err := cache.Get(ctx, "sql:server/db1", create)
+		Expect(err).NotTo(HaveOccurred())
+		second, release2, err := cache.Get(ctx, "sql:server/db1", create)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(second).To(BeIdenticalTo(first))
+		_, release3, err := cache.Get(ctx, "sql:server/db2", create)
+		Expect(err).NotTo(HaveOccurred())
+		release1()
+		release2()
+		release3()
+		Expect(created).To(Equal(2))
+		Expect(cache.Len()).To(Equal(2))
+
+		cache.Close()
+		Expect(cache.Len()).To(Equal(0))
+		Expect(client.closed.Load()).To(BeTrue())
+	})
+
+	It("Should close the client on release without a cache", func() {
+		var cache *clients.Cache
+		_, release, err := cache.Get(ctx, "kusto:https://cluster", create)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(client.closed.Load()).To(BeFalse())
+		release()
+		Expect(client.closed.Load()).To(BeTrue())
+	})
+
+	It("Should not cache failed clients", func() {
+		cache := clients.NewCache(time.Hour, time.Minute)
+		_, _, err := cache.Get(ctx, "sql:server/db1", func(ctx context.Context) (io.Closer, error) {
+			return nil, errors.New("login failed")
+		})
+		Expect(err).To(HaveOccurred())
+		Expect(cache.Len()).To(Equal(0))
+	})
+
+	It("Should evict idle clients that are not in use", func() {
+		cache := clients.NewCache(10*time.Millisecond, time.Minute)
+		_, release, err := cache.Get(ctx, "sql:server/db1", create)
+		Expect(err).NotTo(HaveOccurred())
+		time.Sleep(20 * time.Millisecond)
+		cache.Sweep(ctx)
+		Expect(cache.Len()).To(Equal(1))
+
+		release()
+		time.Sleep(20 * time.Millisecond)
+		cache.Sweep(ctx)
+		Expect(cache.Len()).To(Equal(0))
+		Expect(client.closed.Load()).To(BeTrue())
+	})
+
+	It("Should evict unhealthy clients and recreate them", func() {
+		cache := clients.NewCache(time.Hour, time.Minute)
+		_, release, err := cache.Get(ctx, "sql:server/db1", create)
+		Expect(err).NotTo(HaveOccurred())
+		release()
+		cache.Sweep(ctx)
+		Expect(cache.Len()).To(Equal(1))
+
+		unhealthy := client
+		unhealthy.healthy.Store(false)
+		cache.Sweep(ctx)
+		Expect(cache.Len()).To(Equal(0))
+		Expect(unhealthy.closed.Load()).To(BeTrue())
+
+		recreated, release, err := cache.Get(ctx, "sql:server/db1", create)
+		Expect(err).NotTo(HaveOccurred())
+		defer release()
+		Expect(recreated).NotTo(BeIdenticalTo(unhealthy))
+		Expect(created).To(Equal(2))
+	})
+
+	It("Should close the clients when the manager stops", func() {
+		cache := clients.NewCache(time.Hour, time.Millisecond)
+		_, release, err := cache.Get(ctx, "sql:server/db1", create)
+		Expect(err).NotTo(HaveOccurred())
+		release()
+
+		runCtx, cancel := context.WithCancel(ctx)
+		done := make(chan error)
+		go func() {
+			done <- cache.Start(runCtx)
+		}()
+		cancel()
+		Eventually(done).Should(Receive(BeNil()))
+		Expect(client.closed.Load()).To(BeTrue())
+		Expect(cache.NeedLeaderElection()).To(BeFalse())
+	})
+})
@@ -3,45 +3,43 @@ package cluster
 // Copyright (c) Microsoft Corporation.
 // Licensed under the MIT License.
 import (
+	"context"
 	"strings"
 
 	schemav1alpha1 "github.com/microsoft/azure-schema-operator/apis/dbschema/v1alpha1"
-	"github.com/microsoft/azure-schema-operator/pkg/eventhubs"
-	"github.com/microsoft/azure-schema-operator/pkg/kustoutils"
-	"github.com/microsoft/azure-schema-operator/pkg/sqlutils"
+	"github.com/microsoft/azure-schema-operator/pkg/clients"
 	"github.com/microsoft/azure-schema-operator/pkg/utils"
 	v1 "k8s.io/api/core/v1"
 	"sigs.k8s.io/controller-runtime/pkg/client"
 )
 
 // Cluster interaface represents a DB cluster type that we can execute upon
+// The context is the reconcile context - cancelling it stops the work in progress.
 type Cluster interface {
-	AquireTargets(filter schemav1alpha1.TargetFilter) (schemav1alpha1.ClusterTargets, error)
-	Execute(targets schemav1alpha1.ClusterTargets, config schemav1alpha1.ExecutionConfiguration) (schemav1alpha1.ClusterTargets, error)
-	CreateExecConfiguration(targets schemav1alpha1.ClusterTargets, cfgMap *v1.ConfigMap, failIfDataLoss bool) (schemav1alpha1.ExecutionConfiguration, error)
+	AquireTargets(ctx context.Context, filter schemav1alpha1.TargetFilter) (schemav1alpha1.ClusterTargets, error)
+	Execute(ctx context.Context, targets schemav1alpha1.ClusterTargets, config schemav1alpha1.ExecutionConfiguration) (schemav1alpha1.ClusterTargets, error)
+	CreateExecConfiguration(ctx context.Context, targets schemav1alpha1.ClusterTargets, cfgMap *v1.ConfigMap, failIfDataLoss bool) (schemav1alpha1.ExecutionConfiguration, error)
 }
 
-// NewCluster will create an appropriate cluster implementation for the given type.
-func NewCluster(clusterType schemav1alpha1.DBTypeEnum, uri string, c client.Client, notifier utils.NotifyProgressFunc) Cluster {
-	switch clusterType {
-	case schemav1alpha1.DBTypeKusto:
-		return kustoutils.NewKustoCluster(uri)
-	case schemav1alpha1.DBTypeSQLServer:
-		return sqlutils.NewSQLCluster(uri, c, notifier)
-	case schemav1alpha1.DBTypeEventhub:
-		return eventhubs.NewRegistry(uri)
+// NewCluster will create the cluster implementation of the engine registered for the given type.
+// The DB clients are taken from the shared client cache. An `ErrUnknownType` error is returned for unregistered types,
+// and the engine error if it can't be built.
+func NewCluster(clusterType schemav1alpha1.DBTypeEnum, uri string, c client.Reader, cache *clients.Cache, notifier utils.NotifyProgressFunc) (Cluster, error) {
+	engine, err := Lookup(clusterType)
+	if err != nil {
+		return nil, err
 	}
-	return nil
+	return engine.New(uri, Options{Client: c, Clients: cache, Notifier: notifier})
 }
 
 // Difference returns the difference of the DB & Schema slices
-// i.e. elemnts in a not found in b.
-// in the case of multiple Schemas we only diff them.
+// in the case of multiple Schemas we only diff them (keeping the DB and schema of the targets of `a`).
 func Difference(a, b schemav1alpha1.ClusterTargets) schemav1alpha1.ClusterTargets {
 	if len(a.Schemas) > 0 {
 		return schemav1alpha1.ClusterTargets{
-			DBs:     a.DBs,
-			Schemas: difference(a.Schemas, b.Schemas),
+			DBs:           a.DBs,
+			Schemas:       difference(a.Schemas, b.Schemas),
+			SchemaTargets: a.SchemaTargets,
 		}
 	}
 	return schemav1alpha1.ClusterTargets{
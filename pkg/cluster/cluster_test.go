@@ -26,4 +26,52 @@ var _ = Describe("Cluster", func() {
 		Expect(u.DBs).To(HaveLen(3))
 
 	})
+	Context("When retrying a partially failed per schema execution", func() {
+		It("Should only run the schemas that failed", func() {
+			targets := schemav1alpha1.ClusterTargets{
+				DBs:     []string{"db1"},
+				Schemas: []string{"tenant_1", "tenant_2", "tenant_3"},
+			}
+			done := cluster.Union(schemav1alpha1.ClusterTargets{}, schemav1alpha1.ClusterTargets{Schemas: []string{"tenant_1", "tenant_3"}})
+			retry := cluster.Difference(targets, done)
+			Expect(retry.DBs).To(Equal([]string{"db1"}))
+			Expect(retry.Schemas).To(Equal([]string{"tenant_2"}))
+		})
+	})
+})
+
+var _ = Describe("ValidateFilter", func() {
+	clusters := []string{"https://cluster1.westeurope.kusto.windows.net"}
+
+	It("Should accept valid filters", func() {
+		for dbType, filter := range map[schemav1alpha1.DBTypeEnum]schemav1alpha1.TargetFilter{
+			schemav1alpha1.DBTypeKusto:     {ClusterUris: clusters, Webhook: "https://tenants.contoso.com/dbs?cluster={{.Cluster}}&tier={{.Label}}", Label: "premium"},
+			schemav1alpha1.DBTypeSQLServer: {ClusterUris: []string{"server1.database.windows.net"}, DB: "db1", Schema: "^tenant_", ExcludeSchemas: []string{"_old$"}},
+			schemav1alpha1.DBTypeEventhub:  {ClusterUris: []string{"https://ns1.servicebus.windows.net"}, DB: "registry"},
+		} {
+			Expect(cluster.ValidateFilter(dbType, filter)).To(Succeed(), string(dbType))
+		}
+	})
+
+	It("Should reject invalid filters", func() {
+		for name, c := range map[string]struct {
+			dbType schemav1alpha1.DBTypeEnum
+			filter schemav1alpha1.TargetFilter
+		}{
+			"no clusters":       {schemav1alpha1.DBTypeKusto, schemav1alpha1.TargetFilter{DB: "db"}},
+			"bad cluster":       {schemav1alpha1.DBTypeKusto, schemav1alpha1.TargetFilter{ClusterUris: []string{"ftp://cluster1"}}},
+			"bad regexp":        {schemav1alpha1.DBTypeKusto, schemav1alpha1.TargetFilter{ClusterUris: clusters, DB: "tenant_("}},
+			"db and dbs":        {schemav1alpha1.DBTypeKusto, schemav1alpha1.TargetFilter{ClusterUris: clusters, DB: "tenant_", DBS: []string{"db1"}}},
+			"kusto schemas":     {schemav1alpha1.DBTypeKusto, schemav1alpha1.TargetFilter{ClusterUris: clusters, Schema: "tenant_"}},
+			"label only":        {schemav1alpha1.DBTypeKusto, schemav1alpha1.TargetFilter{ClusterUris: clusters, Label: "premium"}},
+			"bad webhook":       {schemav1alpha1.DBTypeKusto, schemav1alpha1.TargetFilter{ClusterUris: clusters, Webhook: "https://tenants/{{.Cluster"}},
+			"relative webhook":  {schemav1alpha1.DBTypeKusto, schemav1alpha1.TargetFilter{ClusterUris: clusters, Webhook: "/dbs?cluster={{.Cluster}}"}},
+			"sql no db":         {schemav1alpha1.DBTypeSQLServer, schemav1alpha1.TargetFilter{ClusterUris: clusters}},
+			"sql schema regexp": {schemav1alpha1.DBTypeSQLServer, schemav1alpha1.TargetFilter{ClusterUris: clusters, DB: "db1", IncludeSchemas: []string{"("}}},
+			"eventhub webhook":  {schemav1alpha1.DBTypeEventhub, schemav1alpha1.TargetFilter{ClusterUris: clusters, Webhook: "https://tenants"}},
+			"unknown type":      {"mongo", schemav1alpha1.TargetFilter{ClusterUris: clusters}},
+		} {
+			Expect(cluster.ValidateFilter(c.dbType, c.filter)).NotTo(Succeed(), name)
+		}
+	})
 })
@@ -0,0 +1,141 @@
+package cluster
+
+// Copyright (c) Microsoft Corporation.
+// Licensed under the MIT License.
+import (
+	"errors"
+	"fmt"
+	"regexp"
+
+	schemav1alpha1 "github.com/microsoft/azure-schema-operator/apis/dbschema/v1alpha1"
+	"github.com/microsoft/azure-schema-operator/pkg/cosmos"
+	"github.com/microsoft/azure-schema-operator/pkg/eventhubs"
+	"github.com/microsoft/azure-schema-operator/pkg/kustoutils"
+	"github.com/microsoft/azure-schema-operator/pkg/sqlutils"
+)
+
+// the engines built into the operator
+func init() {
+	Register(Engine{
+		Type: schemav1alpha1.DBTypeKusto,
+		New: func(uri string, opts Options) (Cluster, error) {
+			return kustoutils.NewKustoCluster(uri, opts.Clients), nil
+		},
+		Capabilities:   Capabilities{DryRun: true, Rollback: true, Drift: true},
+		ValidateFilter: validateKustoFilter,
+	})
+	Register(Engine{
+		Type: schemav1alpha1.DBTypeSQLServer,
+		New: func(uri string, opts Options) (Cluster, error) {
+			return sqlutils.NewSQLCluster(uri, opts.Client, opts.Clients, opts.Notifier), nil
+		},
+		Capabilities:   Capabilities{DryRun: true, SchemaTargets: true, Rollback: true, Drift: true},
+		ValidateFilter: validateSQLFilter,
+	})
+	Register(Engine{
+		Type: schemav1alpha1.DBTypePostgres,
+		New: func(uri string, opts Options) (Cluster, error) {
+			return sqlutils.NewPostgresCluster(uri, opts.Clients, opts.Notifier), nil
+		},
+		Capabilities:   Capabilities{SchemaTargets: true},
+		ValidateFilter: validatePostgresFilter,
+	})
+	Register(Engine{
+		Type: schemav1alpha1.DBTypeCosmos,
+		New: func(uri string, opts Options) (Cluster, error) {
+			account, err := cosmos.NewAccount(uri, opts.Notifier)
+			if err != nil {
+				return nil, err
+			}
+			return account, nil
+		},
+		Capabilities:   Capabilities{Rollback: true},
+		ValidateFilter: validateCosmosFilter,
+	})
+	Register(Engine{
+		Type: schemav1alpha1.DBTypeEventhub,
+		New: func(uri string, opts Options) (Cluster, error) {
+			return eventhubs.NewRegistry(uri), nil
+		},
+		Capabilities:   Capabilities{Rollback: true},
+		ValidateFilter: validateEventhubFilter,
+	})
+}
+
+func validateKustoFilter(filter schemav1alpha1.TargetFilter) error {
+	// the first of db, dbs and webhook is used - setting more is likely a mistake
+	set := 0
+	for _, isSet := range []bool{filter.DB != "", len(filter.DBS) > 0, filter.Webhook != ""} {
+		if isSet {
+			set++
+		}
+	}
+	if set > 1 {
+		return errors.New("only one of db, dbs and webhook can be set on kusto")
+	}
+	if _, err := regexp.Compile(filter.DB); err != nil {
+		return fmt.Errorf("invalid db regexp: %w", err)
+	}
+	return nil
+}
+
+func validateSQLFilter(filter schemav1alpha1.TargetFilter) error {
+	if filter.DB == "" && len(filter.DBS) == 0 {
+		return errors.New("a db or dbs are required on sql server")
+	}
+	if filter.DB != "" && len(filter.DBS) > 0 {
+		return errors.New("only one of db and dbs can be set on sql server")
+	}
+	if filter.Regexp {
+		if _, err := regexp.Compile(filter.DB); err != nil {
+			return fmt.Errorf("invalid db regexp: %w", err)
+		}
+	}
+	if _, err := sqlutils.NewSchemaFilter(filter); err != nil {
+		return fmt.Errorf("invalid schema regexp: %w", err)
+	}
+	return nil
+}
+
+func validatePostgresFilter(filter schemav1alpha1.TargetFilter) error {
+	if filter.DB == "" && len(filter.DBS) == 0 {
+		return errors.New("a db or dbs are required on postgres")
+	}
+	if filter.DB != "" && len(filter.DBS) > 0 {
+		return errors.New("only one of db and dbs can be set on postgres")
+	}
+	if filter.Regexp {
+		if _, err := regexp.Compile(filter.DB); err != nil {
+			return fmt.Errorf("invalid db regexp: %w", err)
+		}
+	}
+	if _, err := sqlutils.NewSchemaFilter(filter); err != nil {
+		return fmt.Errorf("invalid schema regexp: %w", err)
+	}
+	return nil
+}
+
+func validateCosmosFilter(filter schemav1alpha1.TargetFilter) error {
+	if filter.DB == "" && len(filter.DBS) == 0 {
+		return errors.New("a db or dbs are required on cosmos")
+	}
+	if filter.DB != "" && len(filter.DBS) > 0 {
+		return errors.New("only one of db and dbs can be set on cosmos")
+	}
+	if filter.Webhook != "" {
+		return errors.New("webhook can't be set on cosmos")
+	}
+	if filter.Regexp {
+		if _, err := regexp.Compile(filter.DB); err != nil {
+			return fmt.Errorf("invalid db regexp: %w", err)
+		}
+	}
+	return nil
+}
+
+func validateEventhubFilter(filter schemav1alpha1.TargetFilter) error {
+	if filter.Webhook != "" || len(filter.DBS) > 0 {
+		return errors.New("only the db (schema registry) can be set on eventhub")
+	}
+	return nil
+}
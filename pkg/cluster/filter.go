@@ -0,0 +1,87 @@
+package cluster
+
+// Copyright (c) Microsoft Corporation.
+// Licensed under the MIT License.
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"net/url"
+	"strings"
+	"text/template"
+
+	schemav1alpha1 "github.com/microsoft/azure-schema-operator/apis/dbschema/v1alpha1"
+	"github.com/microsoft/azure-schema-operator/pkg/kustoutils"
+)
+
+// ValidateFilter checks the target filter is valid for the DB type -
+// the regexps compile, the webhook template renders a URL and only the options the engine of the type supports are set.
+func ValidateFilter(dbType schemav1alpha1.DBTypeEnum, filter schemav1alpha1.TargetFilter) error {
+	if len(filter.ClusterUris) == 0 {
+		return errors.New("at least one cluster is required")
+	}
+	for _, uri := range filter.ClusterUris {
+		if err := validateURI(uri); err != nil {
+			return fmt.Errorf("invalid cluster %q: %w", uri, err)
+		}
+	}
+	if filter.Label != "" && filter.Webhook == "" {
+		return errors.New("a label can only be used with a webhook")
+	}
+	if filter.Webhook != "" {
+		if err := validateWebhook(filter.Webhook, filter.Label); err != nil {
+			return fmt.Errorf("invalid webhook: %w", err)
+		}
+	}
+	engine, err := Lookup(dbType)
+	if err != nil {
+		return err
+	}
+	schemaTargeting := filter.Schema != "" || len(filter.IncludeSchemas) > 0 || len(filter.Schemas) > 0 || len(filter.ExcludeSchemas) > 0
+	if schemaTargeting && !engine.Capabilities.SchemaTargets {
+		return fmt.Errorf("schemas can't be selected on %s", dbType)
+	}
+	if engine.ValidateFilter != nil {
+		return engine.ValidateFilter(filter)
+	}
+	return nil
+}
+
+// validateURI checks the cluster is a URL or a host name
+func validateURI(uri string) error {
+	if !strings.Contains(uri, "://") {
+		if uri == "" || strings.ContainsAny(uri, " /") {
+			return errors.New("expected a url or a host name")
+		}
+		return nil
+	}
+	u, err := url.Parse(uri)
+	if err != nil {
+		return err
+	}
+	if (u.Scheme != "https" && u.Scheme != "http") || u.Host == "" {
+		return errors.New("expected an http(s) url")
+	}
+	return nil
+}
+
+// validateWebhook checks the webhook URL template renders a URL, as done by the webhook client.
+func validateWebhook(webhook, label string) error {
+	t, err := template.New("webhook").Parse(webhook)
+	if err != nil {
+		return err
+	}
+	buf := &bytes.Buffer{}
+	err = t.Execute(buf, kustoutils.Query{Cluster: "cluster", DB: "db", Label: label})
+	if err != nil {
+		return err
+	}
+	u, err := url.Parse(buf.String())
+	if err != nil {
+		return err
+	}
+	if !u.IsAbs() || u.Host == "" {
+		return fmt.Errorf("%q isn't an absolute url", buf.String())
+	}
+	return nil
+}
@@ -0,0 +1,95 @@
+package cluster
+
+// Copyright (c) Microsoft Corporation.
+// Licensed under the MIT License.
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"sync"
+
+	schemav1alpha1 "github.com/microsoft/azure-schema-operator/apis/dbschema/v1alpha1"
+	"github.com/microsoft/azure-schema-operator/pkg/clients"
+	"github.com/microsoft/azure-schema-operator/pkg/utils"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+// ErrUnknownType is returned for DB types without a registered engine
+var ErrUnknownType = errors.New("unknown type")
+
+// Capabilities describes what a database engine supports
+type Capabilities struct {
+	// DryRun is set if the changes can be computed without applying them (`kubectl schemaop diff --against-live`)
+	DryRun bool
+	// SchemaTargets is set if schemas inside the DBs can be targeted
+	SchemaTargets bool
+	// Rollback is set if a previous revision can be re-applied by the rollback failure policy
+	Rollback bool
+	// Drift is set if the live schema can be read back (`kubectl schemaop export`) to detect drift from the deployed one
+	Drift bool
+}
+
+// Options are the dependencies passed to the engine factories
+type Options struct {
+	// Client serves the Kubernetes objects referenced by the sources (e.g. external dacpacs)
+	Client client.Reader
+	// Clients is the shared DB client cache, nil when the clients aren't shared
+	Clients *clients.Cache
+	// Notifier reports the progress of the execution, may be nil
+	Notifier utils.NotifyProgressFunc
+}
+
+// Factory returns the `Cluster` implementation of the engine for the cluster uri,
+// or an error if it can't be built (e.g. its credentials are missing)
+type Factory func(uri string, opts Options) (Cluster, error)
+
+// Engine is a database engine the operator can execute schemas on
+type Engine struct {
+	Type         schemav1alpha1.DBTypeEnum
+	New          Factory
+	Capabilities Capabilities
+	// ValidateFilter checks the engine specific options of the target filter, may be nil
+	ValidateFilter func(filter schemav1alpha1.TargetFilter) error
+}
+
+var (
+	enginesMu sync.RWMutex
+	engines   = make(map[schemav1alpha1.DBTypeEnum]Engine)
+)
+
+// Register makes the engine available by its type.
+// It panics if the engine has no type or factory, or if its type is already registered.
+func Register(engine Engine) {
+	enginesMu.Lock()
+	defer enginesMu.Unlock()
+	if engine.Type == "" || engine.New == nil {
+		panic("cluster: an engine requires a type and a factory")
+	}
+	if _, found := engines[engine.Type]; found {
+		panic(fmt.Sprintf("cluster: engine %q is already registered", engine.Type))
+	}
+	engines[engine.Type] = engine
+}
+
+// Lookup returns the engine registered for the type
+func Lookup(dbType schemav1alpha1.DBTypeEnum) (Engine, error) {
+	enginesMu.RLock()
+	defer enginesMu.RUnlock()
+	engine, found := engines[dbType]
+	if !found {
+		return Engine{}, fmt.Errorf("%w %q", ErrUnknownType, dbType)
+	}
+	return engine, nil
+}
+
+// Types returns the registered types, sorted
+func Types() []schemav1alpha1.DBTypeEnum {
+	enginesMu.RLock()
+	defer enginesMu.RUnlock()
+	types := make([]schemav1alpha1.DBTypeEnum, 0, len(engines))
+	for dbType := range engines {
+		types = append(types, dbType)
+	}
+	sort.Slice(types, func(i, j int) bool { return types[i] < types[j] })
+	return types
+}
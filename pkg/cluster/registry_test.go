@@ -0,0 +1,100 @@
+package cluster_test
+
+// Copyright (c) Microsoft Corporation.
+// Licensed under the MIT License.
+import (
+	"context"
+	"errors"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	v1 "k8s.io/api/core/v1"
+
+	schemav1alpha1 "github.com/microsoft/azure-schema-operator/apis/dbschema/v1alpha1"
+	"github.com/microsoft/azure-schema-operator/pkg/cluster"
+)
+
+// testEngine is a cluster of the engine registered by the tests
+type testEngine struct {
+	uri string
+}
+
+func (t *testEngine) AquireTargets(ctx context.Context, filter schemav1alpha1.TargetFilter) (schemav1alpha1.ClusterTargets, error) {
+	return schemav1alpha1.ClusterTargets{DBs: []string{"db1"}}, nil
+}
+
+func (t *testEngine) Execute(ctx context.Context, targets schemav1alpha1.ClusterTargets, config schemav1alpha1.ExecutionConfiguration) (schemav1alpha1.ClusterTargets, error) {
+	return targets, nil
+}
+
+func (t *testEngine) CreateExecConfiguration(ctx context.Context, targets schemav1alpha1.ClusterTargets, cfgMap *v1.ConfigMap, failIfDataLoss bool) (schemav1alpha1.ExecutionConfiguration, error) {
+	return schemav1alpha1.ExecutionConfiguration{}, nil
+}
+
+const testEngineType schemav1alpha1.DBTypeEnum = "testEngine"
+
+func init() {
+	cluster.Register(cluster.Engine{
+		Type: testEngineType,
+		New: func(uri string, opts cluster.Options) (cluster.Cluster, error) {
+			return &testEngine{uri: uri}, nil
+		},
+		Capabilities: cluster.Capabilities{SchemaTargets: true},
+		ValidateFilter: func(filter schemav1alpha1.TargetFilter) error {
+			if filter.DB == "" {
+				return errors.New("a db is required")
+			}
+			return nil
+		},
+	})
+}
+
+var _ = Describe("Registry", func() {
+	clusters := []string{"https://cluster1.westeurope.kusto.windows.net"}
+
+	It("Should register the built in engines", func() {
+		Expect(cluster.Types()).To(ContainElements(schemav1alpha1.DBTypeCosmos, schemav1alpha1.DBTypeEventhub, schemav1alpha1.DBTypeKusto, schemav1alpha1.DBTypePostgres, schemav1alpha1.DBTypeSQLServer, testEngineType))
+		engine, err := cluster.Lookup(schemav1alpha1.DBTypeSQLServer)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(engine.Capabilities.SchemaTargets).To(BeTrue())
+		engine, err = cluster.Lookup(schemav1alpha1.DBTypeKusto)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(engine.Capabilities.SchemaTargets).To(BeFalse())
+		Expect(engine.Capabilities.DryRun).To(BeTrue())
+		Expect(engine.Capabilities.Drift).To(BeTrue())
+		engine, err = cluster.Lookup(schemav1alpha1.DBTypePostgres)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(engine.Capabilities.DryRun).To(BeFalse())
+		Expect(engine.Capabilities.Drift).To(BeFalse())
+		Expect(engine.Capabilities.Rollback).To(BeFalse())
+		engine, err = cluster.Lookup(schemav1alpha1.DBTypeEventhub)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(engine.Capabilities.Rollback).To(BeTrue())
+	})
+
+	It("Should create the cluster of a registered engine", func() {
+		c, err := cluster.NewCluster(testEngineType, clusters[0], nil, nil, nil)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(c).To(Equal(&testEngine{uri: clusters[0]}))
+	})
+
+	It("Should fail on unknown types", func() {
+		c, err := cluster.NewCluster("mongo", clusters[0], nil, nil, nil)
+		Expect(err).To(MatchError(cluster.ErrUnknownType))
+		Expect(c).To(BeNil())
+	})
+
+	It("Should reject engines registered twice", func() {
+		Expect(func() {
+			cluster.Register(cluster.Engine{
+				Type: testEngineType,
+				New:  func(uri string, opts cluster.Options) (cluster.Cluster, error) { return nil, nil },
+			})
+		}).To(Panic())
+	})
+
+	It("Should validate filters with the engine capabilities", func() {
+		Expect(cluster.ValidateFilter(testEngineType, schemav1alpha1.TargetFilter{ClusterUris: clusters, DB: "db1", Schema: "^tenant_"})).To(Succeed())
+		Expect(cluster.ValidateFilter(testEngineType, schemav1alpha1.TargetFilter{ClusterUris: clusters})).NotTo(Succeed())
+	})
+})
@@ -22,10 +22,36 @@ const (
 	SQLPackageUser = "schemaop_sqlpackage_user"
 	// SQLPackagePass password to authenticate against SQL servers
 	SQLPackagePass = "schemaop_sqlpackage_pass"
+	// PostgresUser user to access PostgreSQL servers (the AAD principal name when using MSI)
+	PostgresUser = "schemaop_postgres_user"
+	// PostgresPass password to authenticate against PostgreSQL servers
+	PostgresPass = "schemaop_postgres_pass"
+	// PostgresSSLMode sslmode of the PostgreSQL connections (default `require`)
+	PostgresSSLMode = "schemaop_postgres_sslmode"
+	// CosmosKeyPrefix prefix of the master key settings of the Cosmos DB accounts - `schemaop_cosmos_key_<account>`
+	CosmosKeyPrefix = "schemaop_cosmos_key_"
 	// ParallelWorkers Number of parallel worker groups
 	ParallelWorkers = "schemaop_parallel_workers"
 	// AllowLocalDacPac adds support for local dacpac files
 	AllowLocalDacPac = "schemaop_allow_local_dacpac"
+	// ClientIdleTimeout time an unused DB client is kept in the client cache
+	ClientIdleTimeout = "schemaop_client_idle_timeout"
+	// ClientCheckInterval interval of the client cache health checks and idle eviction
+	ClientCheckInterval = "schemaop_client_check_interval"
+	// ExecutionTimeout default timeout of a cluster execution, used when the deployment doesn't set one (0 - no timeout)
+	ExecutionTimeout = "schemaop_execution_timeout"
+	// JobImage default image of the execution jobs
+	JobImage = "schemaop_job_image"
+	// JobImages comma separated images the deployments may set as their execution job image
+	JobImages = "schemaop_job_images"
+	// JobServiceAccounts comma separated service accounts (`name` or `namespace/name`) the deployments may run their execution jobs with
+	JobServiceAccounts = "schemaop_job_service_accounts"
+	// LogStore where the execution logs are stored - `configmap` (default) or `file`
+	LogStore = "schemaop_log_store"
+	// LogDir root directory of the `file` execution logs store
+	LogDir = "schemaop_log_dir"
+	// LogMaxBytes size cap of the execution logs kept per target
+	LogMaxBytes = "schemaop_log_max_bytes"
 )
 
 func init() {
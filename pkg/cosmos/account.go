@@ -0,0 +1,375 @@
+package cosmos
+
+// Copyright (c) Microsoft Corporation.
+// Licensed under the MIT License.
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/url"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/hashicorp/go-multierror"
+	schemav1alpha1 "github.com/microsoft/azure-schema-operator/apis/dbschema/v1alpha1"
+	"github.com/microsoft/azure-schema-operator/pkg/config"
+	"github.com/microsoft/azure-schema-operator/pkg/runlogs"
+	"github.com/microsoft/azure-schema-operator/pkg/utils"
+	"github.com/rs/zerolog/log"
+	"github.com/spf13/viper"
+	v1 "k8s.io/api/core/v1"
+	"sigs.k8s.io/yaml"
+)
+
+// ContainersKey is the source `ConfigMap` key of the container definitions
+const ContainersKey = "containers"
+
+// scriptKinds names the script resource types in the execution logs
+var scriptKinds = map[string]string{
+	ResourceStoredProcedures:     "stored procedure",
+	ResourceUserDefinedFunctions: "user defined function",
+}
+
+// Account represents a Cosmos DB account whose databases are the targets
+type Account struct {
+	Endpoint       string
+	Client         *Client
+	notifyProgress utils.NotifyProgressFunc
+}
+
+// NewAccount returns a new `Account` with a client authorized by the master key of the account.
+// The key is taken from the account setting (`SCHEMAOP_COSMOS_KEY_<ACCOUNT>`, e.g. from the operator settings secret),
+// an error is returned if it isn't set.
+func NewAccount(uri string, notifier utils.NotifyProgressFunc) (*Account, error) {
+	setting := KeySetting(uri)
+	key := strings.TrimSpace(viper.GetString(setting))
+	if key == "" {
+		return nil, fmt.Errorf("no cosmos key configured for %s (%s)", uri, strings.ToUpper(setting))
+	}
+	client, err := NewClient(uri, key, nil)
+	if err != nil {
+		log.Error().Err(err).Msg("Authentication failure")
+		return nil, fmt.Errorf("%s: %w", strings.ToUpper(setting), err)
+	}
+	return &Account{
+		Endpoint:       uri,
+		Client:         client,
+		notifyProgress: notifier,
+	}, nil
+}
+
+// KeySetting returns the setting of the account master key - `schemaop_cosmos_key_<account>`
+// where the account is the first label of the endpoint host (dashes replaced by underscores).
+func KeySetting(uri string) string {
+	host := uri
+	if u, err := url.Parse(uri); err == nil && u.Host != "" {
+		host = u.Hostname()
+	}
+	account := strings.SplitN(host, ".", 2)[0]
+	return config.CosmosKeyPrefix + strings.ToLower(strings.ReplaceAll(account, "-", "_"))
+}
+
+// ParseContainers parses and validates the container definitions (a YAML or JSON list)
+func ParseContainers(data string) ([]ContainerDefinition, error) {
+	definitions := []ContainerDefinition{}
+	if err := yaml.UnmarshalStrict([]byte(data), &definitions); err != nil {
+		return nil, fmt.Errorf("invalid container definitions: %w", err)
+	}
+	if len(definitions) == 0 {
+		return nil, errors.New("no container definitions found")
+	}
+	ids := make(map[string]bool)
+	for _, definition := range definitions {
+		if definition.ID == "" {
+			return nil, errors.New("a container id is required")
+		}
+		if ids[definition.ID] {
+			return nil, fmt.Errorf("duplicate container %s", definition.ID)
+		}
+		ids[definition.ID] = true
+		if len(definition.PartitionKey.Paths) == 0 {
+			return nil, fmt.Errorf("the partition key of container %s is required", definition.ID)
+		}
+		for _, path := range definition.PartitionKey.Paths {
+			if !strings.HasPrefix(path, "/") {
+				return nil, fmt.Errorf("invalid partition key path %q of container %s", path, definition.ID)
+			}
+		}
+		if definition.DefaultTTL != nil && (*definition.DefaultTTL == 0 || *definition.DefaultTTL < -1) {
+			return nil, fmt.Errorf("invalid default ttl %d of container %s - -1 or a positive number of seconds", *definition.DefaultTTL, definition.ID)
+		}
+		for id, body := range definition.StoredProcedures {
+			if id == "" || strings.TrimSpace(body) == "" {
+				return nil, fmt.Errorf("stored procedure %q of container %s requires an id and a body", id, definition.ID)
+			}
+		}
+		for id, body := range definition.UserDefinedFunctions {
+			if id == "" || strings.TrimSpace(body) == "" {
+				return nil, fmt.Errorf("user defined function %q of container %s requires an id and a body", id, definition.ID)
+			}
+		}
+	}
+	return definitions, nil
+}
+
+// AquireTargets returns the target databases of the account - the databases matching the `db` regexp (if `regexp` is set),
+// or the `dbs` (or single `db`) that exist unless `create` is set.
+func (a *Account) AquireTargets(ctx context.Context, filter schemav1alpha1.TargetFilter) (schemav1alpha1.ClusterTargets, error) {
+	targets := schemav1alpha1.ClusterTargets{}
+	existing, err := a.Client.ListDatabases(ctx)
+	if err != nil {
+		log.Error().Err(err).Msg("failed retriving list of dbs from the account")
+		return targets, err
+	}
+	switch {
+	case filter.Regexp:
+		nameFilter, err := regexp.Compile(filter.DB)
+		if err != nil {
+			log.Error().Err(err).Msgf("parameter proveded is not a valid regexp: %s", filter.DB)
+			return targets, err
+		}
+		for _, db := range existing {
+			if nameFilter.MatchString(db) {
+				targets.DBs = append(targets.DBs, db)
+			}
+		}
+	case len(filter.DBS) > 0:
+		targets.DBs = filter.DBS
+	default:
+		targets.DBs = []string{filter.DB}
+	}
+	if !filter.Regexp && !filter.Create {
+		targets.DBs = intersect(targets.DBs, existing)
+	}
+	if len(targets.DBs) == 0 {
+		log.Info().Msg("no dbs matched the filter")
+		return targets, fmt.Errorf("%w: no dbs on %s matched the filter", utils.ErrNoMatchingTargets, a.Endpoint)
+	}
+	log.Info().Msgf("Found the following targets: %+v", targets)
+	return targets, nil
+}
+
+// CreateExecConfiguration validates the container definitions in the `ConfigMap` and stores them in the configuration
+func (a *Account) CreateExecConfiguration(ctx context.Context, targets schemav1alpha1.ClusterTargets, cfgMap *v1.ConfigMap, failIfDataLoss bool) (schemav1alpha1.ExecutionConfiguration, error) {
+	ec := schemav1alpha1.ExecutionConfiguration{}
+	ec.Properties = make(map[string]string)
+	definitions, err := ParseContainers(cfgMap.Data[ContainersKey])
+	if err != nil {
+		log.Error().Err(err).Msg("invalid container definitions")
+		return ec, err
+	}
+	content, err := json.Marshal(definitions)
+	if err != nil {
+		log.Error().Err(err).Msg("failed json marsheling")
+		return ec, err
+	}
+	ec.Schema = string(content)
+	ec.Properties["failIfDataLoss"] = strconv.FormatBool(failIfDataLoss)
+	return ec, nil
+}
+
+// Execute reconciles the defined containers on each target DB, a failure on one DB doesn't stop the execution on the others.
+// Missing databases and containers are created, the indexing policy and default ttl of existing containers are updated
+// and the defined stored procedures and user defined functions are created or updated (others are left as is).
+func (a *Account) Execute(ctx context.Context, targets schemav1alpha1.ClusterTargets, config schemav1alpha1.ExecutionConfiguration) (schemav1alpha1.ClusterTargets, error) {
+	executed := schemav1alpha1.ClusterTargets{}
+	definitions := []ContainerDefinition{}
+	if err := json.Unmarshal([]byte(config.Schema), &definitions); err != nil {
+		log.Error().Err(err).Msg("failed json unmarsheling the container definitions")
+		return executed, err
+	}
+	failIfDataLoss := config.Properties["failIfDataLoss"] == "true"
+	existing, err := a.Client.ListDatabases(ctx)
+	if err != nil {
+		log.Error().Err(err).Msg("failed retriving list of dbs from the account")
+		return executed, err
+	}
+
+	failedDBs := make([]string, 0)
+	var executionErr *multierror.Error
+	for i, db := range targets.DBs {
+		if ctx.Err() != nil {
+			log.Info().Msgf("execution stopped before running on %s", db)
+			failedDBs = append(failedDBs, db)
+			executionErr = multierror.Append(executionErr, fmt.Errorf("db %s: %w", db, ctx.Err()))
+			continue
+		}
+		done, err := a.reconcileDB(ctx, db, !contains(existing, db), definitions, failIfDataLoss)
+		result := schemav1alpha1.DBResult{DB: db, Schemas: done}
+		if err != nil {
+			log.Error().Err(err).Msgf("Failed to execute on %s", db)
+			result.Error = err.Error()
+			failedDBs = append(failedDBs, db)
+			executionErr = multierror.Append(executionErr, fmt.Errorf("db %s: %w", db, err))
+		} else {
+			result.Executed = true
+			executed.DBs = append(executed.DBs, db)
+		}
+		executed.Results = append(executed.Results, result)
+		if a.notifyProgress != nil {
+			a.notifyProgress((i + 1) * 100 / len(targets.DBs))
+		}
+	}
+	if executionErr != nil {
+		sort.Strings(failedDBs)
+		return executed, fmt.Errorf("failed to execute on %d/%d dbs [%s]: %w", len(failedDBs), len(targets.DBs), strings.Join(failedDBs, ","), executionErr.ErrorOrNil())
+	}
+	log.Info().Msgf("Done with cosmos execution on %+v", executed)
+	return executed, nil
+}
+
+// reconcileDB reconciles the containers of the DB (creating it if missing), it returns the number of containers reconciled.
+func (a *Account) reconcileDB(ctx context.Context, db string, create bool, definitions []ContainerDefinition, failIfDataLoss bool) (int, error) {
+	output := runlogs.FromContext(ctx).Output(db)
+	if create {
+		if err := a.Client.CreateDatabase(ctx, db); err != nil {
+			fmt.Fprintf(output, "failed to create the database: %s\n", err)
+			return 0, err
+		}
+		fmt.Fprintf(output, "created database %s\n", db)
+	}
+	done := 0
+	var dbErr *multierror.Error
+	for _, definition := range definitions {
+		if err := a.reconcileContainer(ctx, db, definition, failIfDataLoss, output); err != nil {
+			fmt.Fprintf(output, "failed to reconcile container %s: %s\n", definition.ID, err)
+			dbErr = multierror.Append(dbErr, fmt.Errorf("container %s: %w", definition.ID, err))
+			continue
+		}
+		done = done + 1
+	}
+	return done, dbErr.ErrorOrNil()
+}
+
+func (a *Account) reconcileContainer(ctx context.Context, db string, definition ContainerDefinition, failIfDataLoss bool, output io.Writer) error {
+	desired := definition.Container()
+	live, err := a.Client.GetContainer(ctx, db, definition.ID)
+	switch {
+	case IsNotFound(err):
+		if err = a.Client.CreateContainer(ctx, db, desired); err != nil {
+			return err
+		}
+		fmt.Fprintf(output, "created container %s\n", definition.ID)
+	case err != nil:
+		return err
+	default:
+		if !samePartitionKey(definition.PartitionKey, live.PartitionKey) {
+			return fmt.Errorf("the partition key can't be changed from %v to %v", live.PartitionKey.Paths, definition.PartitionKey.Paths)
+		}
+		changes := []string{}
+		if definition.IndexingPolicy != nil && !applied(definition.IndexingPolicy, live.IndexingPolicy) {
+			live.IndexingPolicy = definition.IndexingPolicy
+			changes = append(changes, "indexing policy")
+		}
+		if !sameTTL(definition.DefaultTTL, live.DefaultTTL) {
+			if failIfDataLoss && expiresSooner(live.DefaultTTL, definition.DefaultTTL) {
+				return fmt.Errorf("changing the default ttl from %s to %s may delete items (failIfDataLoss is set)", ttlString(live.DefaultTTL), ttlString(definition.DefaultTTL))
+			}
+			live.DefaultTTL = definition.DefaultTTL
+			changes = append(changes, "default ttl")
+		}
+		if len(changes) > 0 {
+			if err = a.Client.ReplaceContainer(ctx, db, live); err != nil {
+				return err
+			}
+			fmt.Fprintf(output, "updated the %s of container %s\n", strings.Join(changes, " and "), definition.ID)
+		}
+	}
+	if err = a.reconcileScripts(ctx, db, definition.ID, ResourceStoredProcedures, definition.StoredProcedures, output); err != nil {
+		return err
+	}
+	return a.reconcileScripts(ctx, db, definition.ID, ResourceUserDefinedFunctions, definition.UserDefinedFunctions, output)
+}
+
+// reconcileScripts creates or updates the defined scripts of the container, scripts that aren't defined are left as is.
+func (a *Account) reconcileScripts(ctx context.Context, db, container, resourceType string, scripts map[string]string, output io.Writer) error {
+	if len(scripts) == 0 {
+		return nil
+	}
+	live, err := a.Client.ListScripts(ctx, db, container, resourceType)
+	if err != nil {
+		return err
+	}
+	ids := make([]string, 0, len(scripts))
+	for id := range scripts {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+	for _, id := range ids {
+		script := Script{ID: id, Body: scripts[id]}
+		body, found := live[id]
+		switch {
+		case !found:
+			err = a.Client.CreateScript(ctx, db, container, resourceType, script)
+			if err == nil {
+				fmt.Fprintf(output, "created %s %s of container %s\n", scriptKinds[resourceType], id, container)
+			}
+		case body != script.Body:
+			err = a.Client.ReplaceScript(ctx, db, container, resourceType, script)
+			if err == nil {
+				fmt.Fprintf(output, "updated %s %s of container %s\n", scriptKinds[resourceType], id, container)
+			}
+		}
+		if err != nil {
+			return fmt.Errorf("%s %s: %w", scriptKinds[resourceType], id, err)
+		}
+	}
+	return nil
+}
+
+// samePartitionKey compares the paths and kind (and the version when defined) of the partition keys
+func samePartitionKey(defined PartitionKey, live *PartitionKey) bool {
+	if live == nil || len(defined.Paths) != len(live.Paths) {
+		return false
+	}
+	for i, path := range defined.Paths {
+		if path != live.Paths[i] {
+			return false
+		}
+	}
+	kind := defined.Kind
+	if kind == "" {
+		kind = "Hash"
+	}
+	if !strings.EqualFold(kind, live.Kind) {
+		return false
+	}
+	return defined.Version == 0 || defined.Version == live.Version
+}
+
+func sameTTL(a, b *int) bool {
+	if a == nil || b == nil {
+		return a == b
+	}
+	return *a == *b
+}
+
+// expiresSooner returns true if items may expire earlier with the new default ttl than with the current one
+func expiresSooner(current, next *int) bool {
+	if next == nil || *next == -1 {
+		return false
+	}
+	return current == nil || *current == -1 || *next < *current
+}
+
+func ttlString(ttl *int) string {
+	if ttl == nil {
+		return "off"
+	}
+	return strconv.Itoa(*ttl)
+}
+
+// intersect returns the elements of `a` found in `b` (keeping the order of `a`).
+func intersect(a, b []string) []string {
+	res := []string{}
+	for _, x := range a {
+		if contains(b, x) {
+			res = append(res, x)
+		}
+	}
+	return res
+}
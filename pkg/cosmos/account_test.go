@@ -0,0 +1,220 @@
+package cosmos_test
+
+// Copyright (c) Microsoft Corporation.
+// Licensed under the MIT License.
+import (
+	"context"
+	"encoding/base64"
+	"strings"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	"github.com/spf13/viper"
+	v1 "k8s.io/api/core/v1"
+
+	schemav1alpha1 "github.com/microsoft/azure-schema-operator/apis/dbschema/v1alpha1"
+	"github.com/microsoft/azure-schema-operator/pkg/cosmos"
+	"github.com/microsoft/azure-schema-operator/pkg/utils"
+)
+
+const containers = `
+- id: events
+  partitionKey:
+    paths: ["/tenantId"]
+  defaultTtl: 604800
+  indexingPolicy:
+    indexingMode: Consistent
+    includedPaths:
+    - path: /tenantId/?
+    - path: /type/?
+    excludedPaths:
+    - path: /*
+  storedProcedures:
+    bulkDelete: "function bulkDelete(query) { }"
+  userDefinedFunctions:
+    toUpper: "function toUpper(s) { return s.toUpperCase(); }"
+- id: leases
+  partitionKey:
+    paths: ["/id"]
+`
+
+var _ = Describe("Cosmos", func() {
+	var (
+		fake    *fakeAccount
+		account *cosmos.Account
+	)
+
+	BeforeEach(func() {
+		fake = newFakeAccount()
+		client, err := cosmos.NewClient(fake.URL, fakeKey, nil)
+		Expect(err).NotTo(HaveOccurred())
+		account = &cosmos.Account{Endpoint: fake.URL, Client: client}
+	})
+
+	AfterEach(func() {
+		fake.Close()
+	})
+
+	execute := func(definitions string, failIfDataLoss bool, dbs ...string) (schemav1alpha1.ClusterTargets, error) {
+		config, err := account.CreateExecConfiguration(context.Background(), schemav1alpha1.ClusterTargets{}, &v1.ConfigMap{Data: map[string]string{cosmos.ContainersKey: definitions}}, failIfDataLoss)
+		Expect(err).NotTo(HaveOccurred())
+		return account.Execute(context.Background(), schemav1alpha1.ClusterTargets{DBs: dbs}, config)
+	}
+
+	It("Should validate the container definitions", func() {
+		definitions, err := cosmos.ParseContainers(containers)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(definitions).To(HaveLen(2))
+		Expect(*definitions[0].DefaultTTL).To(Equal(604800))
+		Expect(definitions[0].StoredProcedures).To(HaveKey("bulkDelete"))
+
+		for _, invalid := range []string{
+			``,
+			`[{"partitionKey": {"paths": ["/id"]}}]`,
+			`[{"id": "a"}]`,
+			`[{"id": "a", "partitionKey": {"paths": ["id"]}}]`,
+			`[{"id": "a", "partitionKey": {"paths": ["/id"]}, "defaultTtl": 0}]`,
+			`[{"id": "a", "partitionKey": {"paths": ["/id"]}}, {"id": "a", "partitionKey": {"paths": ["/id"]}}]`,
+			`[{"id": "a", "partitionKey": {"paths": ["/id"]}, "storedProcedures": {"sp": ""}}]`,
+			`[{"id": "a", "partitionKey": {"paths": ["/id"]}, "uniqueKeys": []}]`,
+		} {
+			_, err := cosmos.ParseContainers(invalid)
+			Expect(err).To(HaveOccurred(), invalid)
+		}
+	})
+
+	It("Should select the target databases", func() {
+		fake.AddDatabase("events1", "events2", "events3", "other")
+		targets, err := account.AquireTargets(context.Background(), schemav1alpha1.TargetFilter{DB: "^events", Regexp: true})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(targets.DBs).To(Equal([]string{"events1", "events2", "events3"}))
+
+		targets, err = account.AquireTargets(context.Background(), schemav1alpha1.TargetFilter{DBS: []string{"events2", "missing"}})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(targets.DBs).To(Equal([]string{"events2"}))
+
+		targets, err = account.AquireTargets(context.Background(), schemav1alpha1.TargetFilter{DBS: []string{"events2", "missing"}, Create: true})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(targets.DBs).To(Equal([]string{"events2", "missing"}))
+
+		_, err = account.AquireTargets(context.Background(), schemav1alpha1.TargetFilter{DB: "missing"})
+		Expect(err).To(MatchError(utils.ErrNoMatchingTargets))
+	})
+
+	It("Should create the databases, containers and scripts", func() {
+		done, err := execute(containers, true, "events1")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(done.DBs).To(Equal([]string{"events1"}))
+		Expect(done.Results).To(Equal([]schemav1alpha1.DBResult{{DB: "events1", Executed: true, Schemas: 2}}))
+
+		events := fake.Container("events1", "events")
+		Expect(events["partitionKey"]).To(Equal(map[string]interface{}{"paths": []interface{}{"/tenantId"}, "kind": "Hash", "version": float64(2)}))
+		Expect(events["defaultTtl"]).To(Equal(float64(604800)))
+		Expect(events["indexingPolicy"]).To(HaveKeyWithValue("indexingMode", "Consistent"))
+		Expect(fake.Container("events1", "leases")).NotTo(BeNil())
+		Expect(fake.Scripts("events1", "events", cosmos.ResourceStoredProcedures)).To(HaveKey("bulkDelete"))
+		Expect(fake.Scripts("events1", "events", cosmos.ResourceUserDefinedFunctions)).To(HaveKey("toUpper"))
+	})
+
+	It("Should not change containers that are up to date", func() {
+		_, err := execute(containers, true, "events1")
+		Expect(err).NotTo(HaveOccurred())
+		fake.ResetRequests()
+
+		_, err = execute(containers, true, "events1")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(fake.Changes()).To(BeEmpty())
+	})
+
+	It("Should update the indexing policy, ttl and scripts of existing containers", func() {
+		_, err := execute(containers, true, "events1")
+		Expect(err).NotTo(HaveOccurred())
+		fake.ResetRequests()
+
+		updated := `
+- id: events
+  partitionKey:
+    paths: ["/tenantId"]
+  defaultTtl: 1209600
+  indexingPolicy:
+    indexingMode: consistent
+    includedPaths:
+    - path: /tenantId/?
+    excludedPaths:
+    - path: /*
+  storedProcedures:
+    bulkDelete: "function bulkDelete(query, batch) { }"
+    archive: "function archive() { }"
+`
+		_, err = execute(updated, true, "events1")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(fake.Changes()).To(Equal([]string{
+			"PUT /dbs/events1/colls/events",
+			"POST /dbs/events1/colls/events/sprocs",
+			"PUT /dbs/events1/colls/events/sprocs/bulkDelete",
+		}))
+		events := fake.Container("events1", "events")
+		Expect(events["defaultTtl"]).To(Equal(float64(1209600)))
+		Expect(events["indexingPolicy"].(map[string]interface{})["includedPaths"]).To(HaveLen(1))
+		Expect(events["conflictResolutionPolicy"]).To(HaveKeyWithValue("mode", "LastWriterWins"))
+		Expect(fake.Scripts("events1", "events", cosmos.ResourceStoredProcedures)).To(HaveKeyWithValue("bulkDelete", "function bulkDelete(query, batch) { }"))
+		Expect(fake.Scripts("events1", "events", cosmos.ResourceUserDefinedFunctions)).To(HaveKey("toUpper"))
+	})
+
+	It("Should fail on changes that can't be applied and report them per database", func() {
+		fake.AddDatabase("events2")
+		_, err := execute(containers, true, "events1", "events2")
+		Expect(err).NotTo(HaveOccurred())
+
+		repartitioned := `[{"id": "events", "partitionKey": {"paths": ["/deviceId"]}, "defaultTtl": 604800}, {"id": "leases", "partitionKey": {"paths": ["/id"]}, "defaultTtl": 3600}]`
+		done, err := execute(repartitioned, true, "events1", "events2")
+		Expect(err).To(MatchError(ContainSubstring("failed to execute on 2/2 dbs [events1,events2]")))
+		Expect(err).To(MatchError(ContainSubstring("the partition key can't be changed")))
+		Expect(err).To(MatchError(ContainSubstring("may delete items")))
+		Expect(done.DBs).To(BeEmpty())
+		Expect(done.Results).To(HaveLen(2))
+		Expect(done.Results[0].Executed).To(BeFalse())
+		Expect(done.Results[0].Schemas).To(Equal(0))
+
+		// without failIfDataLoss the ttl is lowered
+		done, err = execute(`[{"id": "leases", "partitionKey": {"paths": ["/id"]}, "defaultTtl": 3600}]`, false, "events1")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(done.Results[0].Schemas).To(Equal(1))
+		Expect(fake.Container("events1", "leases")["defaultTtl"]).To(Equal(float64(3600)))
+	})
+
+	It("Should fail on requests signed with another key", func() {
+		client, err := cosmos.NewClient(fake.URL, base64.StdEncoding.EncodeToString([]byte("other key")), nil)
+		Expect(err).NotTo(HaveOccurred())
+		account = &cosmos.Account{Endpoint: fake.URL, Client: client}
+		_, err = account.AquireTargets(context.Background(), schemav1alpha1.TargetFilter{DB: "events1"})
+		Expect(err).To(MatchError(ContainSubstring("401")))
+
+		_, err = cosmos.NewClient(fake.URL, "not base64!", nil)
+		Expect(err).To(HaveOccurred())
+	})
+
+	It("Should sign the documented master key request", func() {
+		// the example of https://learn.microsoft.com/rest/api/cosmos-db/access-control-on-cosmosdb-resources
+		key, err := base64.StdEncoding.DecodeString("dsZQi3KtZmCv1ljt3VNWNm7sQUF1y5rJfC6kv5JiwvW0EndXdDku/dkKBp8/ufDToSxLzR4y+O/0H/t4bQtVNw==")
+		Expect(err).NotTo(HaveOccurred())
+		payload := cosmos.Payload("GET", "/dbs/ToDoList", "Thu, 27 Apr 2017 00:51:12 GMT")
+		Expect(payload).To(Equal("get\ndbs\ndbs/ToDoList\nthu, 27 apr 2017 00:51:12 gmt\n\n"))
+		Expect(strings.EqualFold(cosmos.Signature(key, payload), "type%3dmaster%26ver%3d1.0%26sig%3dc09PEVJrgp2uQRkr934kFbTqhByc7TVr3OHyqlu%2bc%2bc%3d")).To(BeTrue())
+	})
+
+	It("Should take the master key of the account from its setting", func() {
+		_, err := cosmos.NewAccount("https://events-prod.documents.azure.com:443/", nil)
+		Expect(err).To(MatchError(ContainSubstring("SCHEMAOP_COSMOS_KEY_EVENTS_PROD")))
+
+		viper.Set("schemaop_cosmos_key_events_prod", fakeKey)
+		defer viper.Set("schemaop_cosmos_key_events_prod", "")
+		account, err := cosmos.NewAccount("https://events-prod.documents.azure.com:443/", nil)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(account.Client).NotTo(BeNil())
+
+		By("not using the key of another account")
+		_, err = cosmos.NewAccount("https://events-dev.documents.azure.com:443/", nil)
+		Expect(err).To(MatchError(ContainSubstring("SCHEMAOP_COSMOS_KEY_EVENTS_DEV")))
+	})
+})
@@ -0,0 +1,263 @@
+// Package cosmos manages the containers of Azure Cosmos DB (SQL API) accounts.
+//
+// The client implements the subset of the Cosmos DB REST API used to reconcile the containers -
+// databases, containers and their stored procedures and user defined functions.
+// It is built on top of the azcore pipeline which takes care of retries (including throttling responses) and request logging.
+package cosmos
+
+// Copyright (c) Microsoft Corporation.
+// Licensed under the MIT License.
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore"
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore/policy"
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore/runtime"
+)
+
+const (
+	moduleName    = "cosmos"
+	moduleVersion = "v1.0.0"
+	// APIVersion is the Cosmos DB REST API version used by the client.
+	APIVersion = "2018-12-31"
+	// continuationHeader holds the continuation token of paged lists
+	continuationHeader = "x-ms-continuation"
+)
+
+const (
+	// ResourceStoredProcedures is the resource type of the stored procedures
+	ResourceStoredProcedures = "sprocs"
+	// ResourceUserDefinedFunctions is the resource type of the user defined functions
+	ResourceUserDefinedFunctions = "udfs"
+)
+
+// ClientOptions contains the optional parameters when creating a Cosmos DB client.
+type ClientOptions struct {
+	azcore.ClientOptions
+}
+
+// Client is a Cosmos DB account client authorized with the account master key.
+type Client struct {
+	Endpoint string
+	pl       runtime.Pipeline
+}
+
+// NewClient creates a client of the account.
+// endpoint - the account endpoint, e.g. myaccount.documents.azure.com
+// key - the (base64) master key of the account, used to sign the requests.
+// options - pass nil to accept the default values.
+func NewClient(endpoint string, key string, options *ClientOptions) (*Client, error) {
+	decoded, err := base64.StdEncoding.DecodeString(key)
+	if err != nil {
+		return nil, fmt.Errorf("invalid cosmos key: %w", err)
+	}
+	if options == nil {
+		options = &ClientOptions{}
+	}
+	pl := runtime.NewPipeline(moduleName, moduleVersion, runtime.PipelineOptions{
+		AllowedHeaders: []string{continuationHeader, "x-ms-activity-id", "x-ms-request-charge", "x-ms-retry-after-ms"},
+		PerRetry:       []policy.Policy{&masterKeyPolicy{key: decoded}},
+	}, &options.ClientOptions)
+	return &Client{Endpoint: endpoint, pl: pl}, nil
+}
+
+// masterKeyPolicy signs each request (and each of its retries) with the account master key.
+type masterKeyPolicy struct {
+	key []byte
+}
+
+func (p *masterKeyPolicy) Do(req *policy.Request) (*http.Response, error) {
+	date := time.Now().UTC().Format(http.TimeFormat)
+	req.Raw().Header.Set("x-ms-date", date)
+	req.Raw().Header.Set("Authorization", Signature(p.key, Payload(req.Raw().Method, req.Raw().URL.Path, date)))
+	return req.Next()
+}
+
+// Payload returns the string to sign of a request on the resource path, sent at `date` (the `x-ms-date` header).
+func Payload(method, path, date string) string {
+	resourceType, resourceLink := resourceOf(path)
+	return strings.ToLower(method) + "\n" + resourceType + "\n" + resourceLink + "\n" + strings.ToLower(date) + "\n\n"
+}
+
+// Signature returns the authorization header of the request payload signed with the master key.
+func Signature(key []byte, payload string) string {
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(payload))
+	sig := base64.StdEncoding.EncodeToString(mac.Sum(nil))
+	return url.QueryEscape("type=master&ver=1.0&sig=" + sig)
+}
+
+// resourceOf returns the resource type and link of a request path - `/dbs/db1/colls` is the `colls` feed of `dbs/db1`,
+// `/dbs/db1/colls/c1` is the `colls` resource `dbs/db1/colls/c1`.
+func resourceOf(path string) (string, string) {
+	segments := strings.Split(strings.Trim(path, "/"), "/")
+	if len(segments)%2 == 1 {
+		return segments[len(segments)-1], strings.Join(segments[:len(segments)-1], "/")
+	}
+	return segments[len(segments)-2], strings.Join(segments, "/")
+}
+
+// endpointURL returns the base url of the account (adding the https scheme if missing)
+func (c *Client) endpointURL() string {
+	if strings.HasPrefix(c.Endpoint, "http://") || strings.HasPrefix(c.Endpoint, "https://") {
+		return c.Endpoint
+	}
+	return "https://" + c.Endpoint
+}
+
+// do sends a request on the resource path, with the body encoded as JSON if set, and decodes the response into `result`.
+func (c *Client) do(ctx context.Context, method string, headers map[string]string, body interface{}, result interface{}, statusCodes []int, path ...string) (*http.Response, error) {
+	escaped := make([]string, len(path))
+	for i, segment := range path {
+		escaped[i] = url.PathEscape(segment)
+	}
+	req, err := runtime.NewRequest(ctx, method, runtime.JoinPaths(c.endpointURL(), escaped...))
+	if err != nil {
+		return nil, err
+	}
+	req.Raw().Header.Set("x-ms-version", APIVersion)
+	req.Raw().Header.Set("Accept", "application/json")
+	for k, v := range headers {
+		req.Raw().Header.Set(k, v)
+	}
+	if body != nil {
+		if err = runtime.MarshalAsJSON(req, body); err != nil {
+			return nil, err
+		}
+	}
+	resp, err := c.pl.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	if !runtime.HasStatusCode(resp, statusCodes...) {
+		return nil, runtime.NewResponseError(resp)
+	}
+	if result != nil {
+		if err = runtime.UnmarshalAsJSON(resp, result); err != nil {
+			return nil, err
+		}
+	}
+	return resp, nil
+}
+
+// list reads all the pages of a feed, `add` decodes a page
+func (c *Client) list(ctx context.Context, add func(page []byte) error, path ...string) error {
+	continuation := ""
+	for {
+		headers := map[string]string{}
+		if continuation != "" {
+			headers[continuationHeader] = continuation
+		}
+		var page json.RawMessage
+		resp, err := c.do(ctx, http.MethodGet, headers, nil, &page, []int{http.StatusOK}, path...)
+		if err != nil {
+			return err
+		}
+		if err = add(page); err != nil {
+			return err
+		}
+		continuation = resp.Header.Get(continuationHeader)
+		if continuation == "" {
+			return nil
+		}
+	}
+}
+
+// IsNotFound returns true if the error is a not found response
+func IsNotFound(err error) bool {
+	var respErr *azcore.ResponseError
+	return errors.As(err, &respErr) && respErr.StatusCode == http.StatusNotFound
+}
+
+// ListDatabases returns the ids of the databases of the account
+func (c *Client) ListDatabases(ctx context.Context) ([]string, error) {
+	ids := []string{}
+	err := c.list(ctx, func(page []byte) error {
+		feed := struct {
+			Databases []struct {
+				ID string `json:"id"`
+			} `json:"Databases"`
+		}{}
+		if err := json.Unmarshal(page, &feed); err != nil {
+			return err
+		}
+		for _, db := range feed.Databases {
+			ids = append(ids, db.ID)
+		}
+		return nil
+	}, "dbs")
+	return ids, err
+}
+
+// CreateDatabase creates the database
+func (c *Client) CreateDatabase(ctx context.Context, db string) error {
+	_, err := c.do(ctx, http.MethodPost, nil, map[string]string{"id": db}, nil, []int{http.StatusCreated}, "dbs")
+	return err
+}
+
+// GetContainer returns the container, a not found error (see `IsNotFound`) is returned if it doesn't exist.
+func (c *Client) GetContainer(ctx context.Context, db, id string) (Container, error) {
+	container := Container{}
+	_, err := c.do(ctx, http.MethodGet, nil, nil, &container, []int{http.StatusOK}, "dbs", db, "colls", id)
+	return container, err
+}
+
+// CreateContainer creates the container in the database
+func (c *Client) CreateContainer(ctx context.Context, db string, container Container) error {
+	_, err := c.do(ctx, http.MethodPost, nil, container, nil, []int{http.StatusCreated}, "dbs", db, "colls")
+	return err
+}
+
+// ReplaceContainer replaces the container properties - the partition key can't be changed.
+func (c *Client) ReplaceContainer(ctx context.Context, db string, container Container) error {
+	_, err := c.do(ctx, http.MethodPut, nil, container, nil, []int{http.StatusOK}, "dbs", db, "colls", container.ID)
+	return err
+}
+
+// ListScripts returns the scripts (stored procedures or user defined functions, see `resourceType`) of the container by id
+func (c *Client) ListScripts(ctx context.Context, db, container, resourceType string) (map[string]string, error) {
+	scripts := make(map[string]string)
+	err := c.list(ctx, func(page []byte) error {
+		feed := make(map[string]json.RawMessage)
+		if err := json.Unmarshal(page, &feed); err != nil {
+			return err
+		}
+		for key, value := range feed {
+			if strings.HasPrefix(key, "_") {
+				continue
+			}
+			list := []Script{}
+			if err := json.Unmarshal(value, &list); err != nil {
+				return err
+			}
+			for _, script := range list {
+				scripts[script.ID] = script.Body
+			}
+		}
+		return nil
+	}, "dbs", db, "colls", container, resourceType)
+	return scripts, err
+}
+
+// CreateScript creates the script (stored procedure or user defined function, see `resourceType`) in the container
+func (c *Client) CreateScript(ctx context.Context, db, container, resourceType string, script Script) error {
+	_, err := c.do(ctx, http.MethodPost, nil, script, nil, []int{http.StatusCreated}, "dbs", db, "colls", container, resourceType)
+	return err
+}
+
+// ReplaceScript replaces the body of the script (stored procedure or user defined function, see `resourceType`)
+func (c *Client) ReplaceScript(ctx context.Context, db, container, resourceType string, script Script) error {
+	_, err := c.do(ctx, http.MethodPut, nil, script, nil, []int{http.StatusOK}, "dbs", db, "colls", container, resourceType, script.ID)
+	return err
+}
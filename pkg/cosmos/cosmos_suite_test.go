@@ -0,0 +1,16 @@
+package cosmos_test
+
+// Copyright (c) Microsoft Corporation.
+// Licensed under the MIT License.
+
+import (
+	"testing"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+func TestCosmos(t *testing.T) {
+	RegisterFailHandler(Fail)
+	RunSpecs(t, "Cosmos Suite")
+}
@@ -0,0 +1,274 @@
+package cosmos_test
+
+// Copyright (c) Microsoft Corporation.
+// Licensed under the MIT License.
+import (
+	"encoding/base64"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/microsoft/azure-schema-operator/pkg/cosmos"
+)
+
+// fakeKey is the master key accepted by the fake account
+var fakeKey = base64.StdEncoding.EncodeToString([]byte("schemaop-fake-cosmos-key"))
+
+// fakeDB is a database of the fake account
+type fakeDB struct {
+	containers map[string]map[string]interface{}
+	scripts    map[string]map[string]map[string]string
+}
+
+// fakeAccount is a local HTTP stand-in for a Cosmos DB account.
+// It verifies the request signatures, keeps the databases, containers (filling in the service defaults) and scripts
+// in memory and pages the database list.
+type fakeAccount struct {
+	sync.Mutex
+	*httptest.Server
+	dbs      map[string]*fakeDB
+	requests []string
+}
+
+func newFakeAccount() *fakeAccount {
+	f := &fakeAccount{dbs: make(map[string]*fakeDB)}
+	f.Server = httptest.NewServer(http.HandlerFunc(f.serve))
+	return f
+}
+
+// AddDatabase adds an empty database
+func (f *fakeAccount) AddDatabase(names ...string) {
+	f.Lock()
+	defer f.Unlock()
+	for _, name := range names {
+		f.dbs[name] = &fakeDB{
+			containers: make(map[string]map[string]interface{}),
+			scripts:    make(map[string]map[string]map[string]string),
+		}
+	}
+}
+
+// Container returns the properties of the container
+func (f *fakeAccount) Container(db, id string) map[string]interface{} {
+	f.Lock()
+	defer f.Unlock()
+	if f.dbs[db] == nil {
+		return nil
+	}
+	return f.dbs[db].containers[id]
+}
+
+// Scripts returns the scripts of the container by id
+func (f *fakeAccount) Scripts(db, container, resourceType string) map[string]string {
+	f.Lock()
+	defer f.Unlock()
+	scripts := make(map[string]string)
+	for id, script := range f.dbs[db].scripts[container+"/"+resourceType] {
+		scripts[id] = script["body"]
+	}
+	return scripts
+}
+
+// Changes returns the requests that changed the account
+func (f *fakeAccount) Changes() []string {
+	f.Lock()
+	defer f.Unlock()
+	changes := []string{}
+	for _, request := range f.requests {
+		if !strings.HasPrefix(request, http.MethodGet) {
+			changes = append(changes, request)
+		}
+	}
+	return changes
+}
+
+// ResetRequests clears the recorded requests
+func (f *fakeAccount) ResetRequests() {
+	f.Lock()
+	defer f.Unlock()
+	f.requests = nil
+}
+
+// authorized accepts requests signed with the fake master key
+func (f *fakeAccount) authorized(r *http.Request) bool {
+	if r.Header.Get("x-ms-version") != cosmos.APIVersion || r.Header.Get("x-ms-date") == "" {
+		return false
+	}
+	key, _ := base64.StdEncoding.DecodeString(fakeKey)
+	return r.Header.Get("Authorization") == cosmos.Signature(key, cosmos.Payload(r.Method, r.URL.Path, r.Header.Get("x-ms-date")))
+}
+
+func reply(w http.ResponseWriter, status int, body interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	if body != nil {
+		_ = json.NewEncoder(w).Encode(body)
+	}
+}
+
+func (f *fakeAccount) serve(w http.ResponseWriter, r *http.Request) {
+	f.Lock()
+	defer f.Unlock()
+	f.requests = append(f.requests, r.Method+" "+r.URL.Path)
+	if !f.authorized(r) {
+		reply(w, http.StatusUnauthorized, map[string]string{"code": "Unauthorized"})
+		return
+	}
+	body := make(map[string]interface{})
+	if r.Body != nil && r.ContentLength > 0 {
+		if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+			reply(w, http.StatusBadRequest, map[string]string{"code": "BadRequest"})
+			return
+		}
+	}
+	segments := strings.Split(strings.Trim(r.URL.Path, "/"), "/")
+	if len(segments) == 1 {
+		f.serveDatabases(w, r, body)
+		return
+	}
+	db := f.dbs[segments[1]]
+	if db == nil {
+		reply(w, http.StatusNotFound, map[string]string{"code": "NotFound"})
+		return
+	}
+	switch len(segments) {
+	case 3:
+		f.createContainer(w, db, body)
+	case 4:
+		f.serveContainer(w, r, db, segments[3], body)
+	default:
+		f.serveScripts(w, r, db, segments[3], segments[4:], body)
+	}
+}
+
+// serveDatabases lists the databases - a page per database, or creates one
+func (f *fakeAccount) serveDatabases(w http.ResponseWriter, r *http.Request, body map[string]interface{}) {
+	if r.Method == http.MethodPost {
+		id := body["id"].(string)
+		if f.dbs[id] != nil {
+			reply(w, http.StatusConflict, nil)
+			return
+		}
+		f.dbs[id] = &fakeDB{
+			containers: make(map[string]map[string]interface{}),
+			scripts:    make(map[string]map[string]map[string]string),
+		}
+		reply(w, http.StatusCreated, body)
+		return
+	}
+	names := make([]string, 0, len(f.dbs))
+	for name := range f.dbs {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	page, _ := strconv.Atoi(r.Header.Get("x-ms-continuation"))
+	databases := []map[string]string{}
+	if page < len(names) {
+		databases = append(databases, map[string]string{"id": names[page]})
+	}
+	if page+1 < len(names) {
+		w.Header().Set("x-ms-continuation", strconv.Itoa(page+1))
+	}
+	reply(w, http.StatusOK, map[string]interface{}{"Databases": databases, "_count": len(databases)})
+}
+
+func (f *fakeAccount) createContainer(w http.ResponseWriter, db *fakeDB, body map[string]interface{}) {
+	id := body["id"].(string)
+	if db.containers[id] != nil {
+		reply(w, http.StatusConflict, nil)
+		return
+	}
+	body["_rid"] = "rid-" + id
+	body["conflictResolutionPolicy"] = map[string]interface{}{"mode": "LastWriterWins", "conflictResolutionPath": "/_ts"}
+	body["indexingPolicy"] = withDefaults(body["indexingPolicy"])
+	db.containers[id] = body
+	reply(w, http.StatusCreated, body)
+}
+
+func (f *fakeAccount) serveContainer(w http.ResponseWriter, r *http.Request, db *fakeDB, id string, body map[string]interface{}) {
+	container := db.containers[id]
+	if container == nil {
+		reply(w, http.StatusNotFound, map[string]string{"code": "NotFound"})
+		return
+	}
+	if r.Method == http.MethodGet {
+		reply(w, http.StatusOK, container)
+		return
+	}
+	// the partition key can't be changed
+	current, _ := json.Marshal(container["partitionKey"])
+	replaced, _ := json.Marshal(body["partitionKey"])
+	if string(current) != string(replaced) {
+		reply(w, http.StatusBadRequest, map[string]string{"code": "BadRequest"})
+		return
+	}
+	body["indexingPolicy"] = withDefaults(body["indexingPolicy"])
+	db.containers[id] = body
+	reply(w, http.StatusOK, body)
+}
+
+func (f *fakeAccount) serveScripts(w http.ResponseWriter, r *http.Request, db *fakeDB, container string, path []string, body map[string]interface{}) {
+	if db.containers[container] == nil {
+		reply(w, http.StatusNotFound, map[string]string{"code": "NotFound"})
+		return
+	}
+	key := container + "/" + path[0]
+	if db.scripts[key] == nil {
+		db.scripts[key] = make(map[string]map[string]string)
+	}
+	scripts := db.scripts[key]
+	switch r.Method {
+	case http.MethodGet:
+		list := []map[string]string{}
+		for id, body := range scripts {
+			list = append(list, map[string]string{"id": id, "body": body["body"], "_rid": "rid-" + id})
+		}
+		feed := "StoredProcedures"
+		if path[0] == cosmos.ResourceUserDefinedFunctions {
+			feed = "UserDefinedFunctions"
+		}
+		reply(w, http.StatusOK, map[string]interface{}{feed: list, "_count": len(list)})
+	case http.MethodPost:
+		id := body["id"].(string)
+		if scripts[id] != nil {
+			reply(w, http.StatusConflict, nil)
+			return
+		}
+		scripts[id] = map[string]string{"body": body["body"].(string)}
+		reply(w, http.StatusCreated, body)
+	case http.MethodPut:
+		if scripts[path[1]] == nil {
+			reply(w, http.StatusNotFound, nil)
+			return
+		}
+		scripts[path[1]] = map[string]string{"body": body["body"].(string)}
+		reply(w, http.StatusOK, body)
+	}
+}
+
+// withDefaults fills in the indexing policy defaults as the service does
+func withDefaults(policy interface{}) map[string]interface{} {
+	defaults := map[string]interface{}{
+		"indexingMode":  "consistent",
+		"automatic":     true,
+		"includedPaths": []interface{}{map[string]interface{}{"path": "/*"}},
+		"excludedPaths": []interface{}{},
+	}
+	if p, ok := policy.(map[string]interface{}); ok {
+		for k, v := range p {
+			defaults[k] = v
+		}
+	}
+	excluded, _ := defaults["excludedPaths"].([]interface{})
+	for _, path := range excluded {
+		if path.(map[string]interface{})["path"] == `/"_etag"/?` {
+			return defaults
+		}
+	}
+	defaults["excludedPaths"] = append(excluded, map[string]interface{}{"path": `/"_etag"/?`})
+	return defaults
+}
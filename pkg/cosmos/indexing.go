@@ -0,0 +1,74 @@
+package cosmos
+
+// Copyright (c) Microsoft Corporation.
+// Licensed under the MIT License.
+import (
+	"fmt"
+	"strings"
+)
+
+// applied returns true if the live indexing policy has all the settings of the defined one.
+// The service fills in the defaults and adds the system `_etag` excluded path, so only the defined settings are compared
+// (strings are compared case insensitive). Lists must match, other than the system paths.
+func applied(defined, live interface{}) bool {
+	switch d := defined.(type) {
+	case map[string]interface{}:
+		l, ok := live.(map[string]interface{})
+		if !ok {
+			return false
+		}
+		for key, value := range d {
+			liveValue, found := l[key]
+			if !found || !applied(value, liveValue) {
+				return false
+			}
+		}
+		return true
+	case []interface{}:
+		l, ok := live.([]interface{})
+		if !ok {
+			return false
+		}
+		return sameElements(d, withoutSystemPaths(l))
+	case string:
+		l, ok := live.(string)
+		return ok && strings.EqualFold(d, l)
+	default:
+		return fmt.Sprint(defined) == fmt.Sprint(live)
+	}
+}
+
+// sameElements matches each defined element with a distinct live element, with no live elements left
+func sameElements(defined, live []interface{}) bool {
+	if len(defined) != len(live) {
+		return false
+	}
+	used := make([]bool, len(live))
+	for _, d := range defined {
+		matched := false
+		for i, l := range live {
+			if !used[i] && applied(d, l) {
+				used[i], matched = true, true
+				break
+			}
+		}
+		if !matched {
+			return false
+		}
+	}
+	return true
+}
+
+// withoutSystemPaths drops the paths added by the service (i.e. `/"_etag"/?`)
+func withoutSystemPaths(elements []interface{}) []interface{} {
+	filtered := make([]interface{}, 0, len(elements))
+	for _, element := range elements {
+		if path, ok := element.(map[string]interface{}); ok {
+			if p, ok := path["path"].(string); ok && strings.HasPrefix(p, `/"_`) {
+				continue
+			}
+		}
+		filtered = append(filtered, element)
+	}
+	return filtered
+}
@@ -0,0 +1,108 @@
+package cosmos
+
+// Copyright (c) Microsoft Corporation.
+// Licensed under the MIT License.
+import "encoding/json"
+
+// PartitionKey is the partition key definition of a container
+type PartitionKey struct {
+	Paths   []string `json:"paths"`
+	Kind    string   `json:"kind,omitempty"`
+	Version int      `json:"version,omitempty"`
+}
+
+// Container are the properties of a container
+type Container struct {
+	ID           string        `json:"id"`
+	PartitionKey *PartitionKey `json:"partitionKey,omitempty"`
+	// IndexingPolicy is kept as is, see https://learn.microsoft.com/azure/cosmos-db/index-policy
+	IndexingPolicy map[string]interface{} `json:"indexingPolicy,omitempty"`
+	// DefaultTTL is the default time to live of the items in seconds (-1 - no expiry unless set on the item), nil - disabled
+	DefaultTTL *int `json:"defaultTtl,omitempty"`
+	// Properties are the other properties of the container (e.g. the unique key and conflict resolution policies),
+	// kept so that replacing the container doesn't reset them.
+	Properties map[string]interface{} `json:"-"`
+}
+
+// containerFields are the properties modeled by `Container`
+var containerFields = []string{"id", "partitionKey", "indexingPolicy", "defaultTtl"}
+
+// UnmarshalJSON keeps the properties not modeled by `Container` in `Properties`
+func (c *Container) UnmarshalJSON(data []byte) error {
+	type container Container
+	if err := json.Unmarshal(data, (*container)(c)); err != nil {
+		return err
+	}
+	properties := make(map[string]interface{})
+	if err := json.Unmarshal(data, &properties); err != nil {
+		return err
+	}
+	for _, field := range containerFields {
+		delete(properties, field)
+	}
+	c.Properties = properties
+	return nil
+}
+
+// MarshalJSON adds the `Properties` to the modeled properties
+func (c Container) MarshalJSON() ([]byte, error) {
+	type container Container
+	data, err := json.Marshal(container(c))
+	if err != nil || len(c.Properties) == 0 {
+		return data, err
+	}
+	merged := make(map[string]interface{})
+	if err = json.Unmarshal(data, &merged); err != nil {
+		return nil, err
+	}
+	for key, value := range c.Properties {
+		if _, modeled := merged[key]; !modeled && !contains(containerFields, key) {
+			merged[key] = value
+		}
+	}
+	return json.Marshal(merged)
+}
+
+// Script is a stored procedure or a user defined function
+type Script struct {
+	ID   string `json:"id"`
+	Body string `json:"body"`
+}
+
+// ContainerDefinition is the desired state of a container as defined in the source `ConfigMap`
+type ContainerDefinition struct {
+	ID             string                 `json:"id"`
+	PartitionKey   PartitionKey           `json:"partitionKey"`
+	IndexingPolicy map[string]interface{} `json:"indexingPolicy,omitempty"`
+	DefaultTTL     *int                   `json:"defaultTtl,omitempty"`
+	// StoredProcedures are the stored procedure bodies by id
+	StoredProcedures map[string]string `json:"storedProcedures,omitempty"`
+	// UserDefinedFunctions are the user defined function bodies by id
+	UserDefinedFunctions map[string]string `json:"userDefinedFunctions,omitempty"`
+}
+
+// Container returns the container properties of the definition
+func (d ContainerDefinition) Container() Container {
+	partitionKey := d.PartitionKey
+	if partitionKey.Kind == "" {
+		partitionKey.Kind = "Hash"
+	}
+	if partitionKey.Version == 0 {
+		partitionKey.Version = 2
+	}
+	return Container{
+		ID:             d.ID,
+		PartitionKey:   &partitionKey,
+		IndexingPolicy: d.IndexingPolicy,
+		DefaultTTL:     d.DefaultTTL,
+	}
+}
+
+func contains(list []string, s string) bool {
+	for _, x := range list {
+		if x == s {
+			return true
+		}
+	}
+	return false
+}
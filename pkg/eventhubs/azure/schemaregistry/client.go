@@ -1,34 +1,108 @@
-// Package schemaregistry implements the Azure ARM Schemaregistry service API version 2021-10.
+// Package schemaregistry implements the Azure Schemaregistry service API version 2021-10.
 //
 // Azure Schema Registry is as a central schema repository, with support for versioning, management, compatibility
 // checking, and RBAC.
+// The clients are built on top of the azcore pipeline which takes care of token refresh, retries (including
+// throttling responses honoring Retry-After) and request logging.
 package schemaregistry
 
 // Copyright (c) Microsoft Corporation.
 // Licensed under the MIT License.
-//
-// Code generated by Microsoft (R) AutoRest Code Generator.
-// Changes may cause incorrect behavior and will be lost if the code is regenerated.
 
 import (
-	"github.com/Azure/go-autorest/autorest"
+	"context"
+	"fmt"
+	"net/http"
+	"regexp"
+	"strings"
+
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore"
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore/policy"
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore/runtime"
+)
+
+const (
+	moduleName    = "schemaregistry"
+	moduleVersion = "v1.1.0"
+	// APIVersion is the schema registry data plane API version used by the clients.
+	APIVersion = "2021-10"
+	// DefaultScope is the token scope required to access the eventhubs schema registry.
+	DefaultScope = "https://eventhubs.azure.net/.default"
+	// avroContentType is the content type for Avro schemas
+	avroContentType = "application/json; serialization=Avro"
 )
 
+var schemaNamePattern = regexp.MustCompile(`^[A-Za-z0-9][^\\/$:]*$`)
+
+// ClientOptions contains the optional parameters when creating a schema registry client.
+type ClientOptions struct {
+	azcore.ClientOptions
+}
+
 // BaseClient is the base client for Schemaregistry.
 type BaseClient struct {
-	autorest.Client
 	Endpoint string
+	pl       runtime.Pipeline
 }
 
 // New creates an instance of the BaseClient client.
-func New(endpoint string) BaseClient {
-	return NewWithoutDefaults(endpoint)
-}
-
-// NewWithoutDefaults creates an instance of the BaseClient client.
-func NewWithoutDefaults(endpoint string) BaseClient {
+// endpoint - the schema registry namespace, e.g. mynamespace.servicebus.windows.net
+// credential - used to authorize the requests (tokens are refreshed by the pipeline).
+// options - pass nil to accept the default values.
+func New(endpoint string, credential azcore.TokenCredential, options *ClientOptions) BaseClient {
+	if options == nil {
+		options = &ClientOptions{}
+	}
+	authPolicy := runtime.NewBearerTokenPolicy(credential, []string{DefaultScope}, nil)
+	pl := runtime.NewPipeline(moduleName, moduleVersion, runtime.PipelineOptions{
+		AllowedHeaders: []string{"Schema-Id", "Schema-Id-Location", "Schema-Group-Name", "Schema-Name", "Schema-Version", "Location", "Retry-After"},
+		PerRetry:       []policy.Policy{authPolicy},
+	}, &options.ClientOptions)
 	return BaseClient{
-		Client:   autorest.NewClientWithUserAgent(UserAgent()),
 		Endpoint: endpoint,
+		pl:       pl,
+	}
+}
+
+// endpointURL returns the base url of the registry (adding the https scheme if missing)
+func (client BaseClient) endpointURL() string {
+	if strings.HasPrefix(client.Endpoint, "http://") || strings.HasPrefix(client.Endpoint, "https://") {
+		return client.Endpoint
+	}
+	return "https://" + client.Endpoint
+}
+
+// newRequest creates a request for the given path with the api-version query parameter set.
+func (client BaseClient) newRequest(ctx context.Context, method string, urlPath string) (*policy.Request, error) {
+	req, err := runtime.NewRequest(ctx, method, runtime.JoinPaths(client.endpointURL(), urlPath))
+	if err != nil {
+		return nil, err
+	}
+	reqQP := req.Raw().URL.Query()
+	reqQP.Set("api-version", APIVersion)
+	req.Raw().URL.RawQuery = reqQP.Encode()
+	return req, nil
+}
+
+// do sends the request through the pipeline and verifies the response status code.
+func (client BaseClient) do(req *policy.Request, statusCodes ...int) (*http.Response, error) {
+	resp, err := client.pl.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	if !runtime.HasStatusCode(resp, statusCodes...) {
+		return nil, runtime.NewResponseError(resp)
+	}
+	return resp, nil
+}
+
+// validateSchemaName verifies the schema name matches the service constraints.
+func validateSchemaName(schemaName string) error {
+	if len(schemaName) > 50 {
+		return fmt.Errorf("schemaName %q exceeds the max length of 50", schemaName)
+	}
+	if !schemaNamePattern.MatchString(schemaName) {
+		return fmt.Errorf("schemaName %q does not match pattern %s", schemaName, schemaNamePattern.String())
 	}
+	return nil
 }
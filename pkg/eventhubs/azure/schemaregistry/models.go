@@ -2,66 +2,63 @@ package schemaregistry
 
 // Copyright (c) Microsoft Corporation.
 // Licensed under the MIT License.
-//
-// Code generated by Microsoft (R) AutoRest Code Generator.
-// Changes may cause incorrect behavior and will be lost if the code is regenerated.
 
 import (
-	"io"
-
-	"github.com/Azure/go-autorest/autorest"
+	"net/http"
+	"strconv"
 )
 
-// The package's fully qualified name.
-const fqdn = "./azure/schemaregistry"
-
-// Error an error response returned from Azure Schema Registry service.
-type Error struct {
-	Error *ErrorDetail `json:"error,omitempty"`
-}
-
-// ErrorDetail error response returned from Azure Schema Registry service.
-type ErrorDetail struct {
-	// Code - Type of error.
-	Code *string `json:"code,omitempty"`
-	// Message - Brief description of error.
-	Message *string `json:"message,omitempty"`
-	// Details - Error message details to help user understand/debug failure.
-	Details *[]ErrorDetail `json:"details,omitempty"`
-}
-
-// ReadCloser ...
-type ReadCloser struct {
-	autorest.Response `json:"-"`
-	Value             *io.ReadCloser `json:"value,omitempty"`
-}
-
 // SchemaGroups array received from the registry containing the list of schema groups.
 type SchemaGroups struct {
-	autorest.Response `json:"-"`
 	// SchemaGroups - Array of schema groups.
-	SchemaGroups *[]string `json:"schemaGroups,omitempty"`
+	SchemaGroups []string `json:"schemaGroups,omitempty"`
 }
 
-// SchemaID object received from the registry containing schema identifiers.
-type SchemaID struct {
+// SchemaVersions array received from the registry containing the list of versions for specific schema.
+type SchemaVersions struct {
+	// Versions - Array of schema versions.
+	Versions []int32 `json:"Value,omitempty"`
+}
+
+// SchemaProperties meta-data of a registered schema as returned in the response headers of the registry.
+type SchemaProperties struct {
 	// ID - Schema ID that uniquely identifies a schema in the registry namespace.
-	ID *string `json:"id,omitempty"`
+	ID string `json:"id,omitempty"`
+	// GroupName - schema group under which the schema is registered.
+	GroupName string `json:"groupName,omitempty"`
+	// Name - name of the schema.
+	Name string `json:"name,omitempty"`
+	// Version - version of the schema.
+	Version int32 `json:"version,omitempty"`
+	// Location - URL location of the registered schema.
+	Location string `json:"location,omitempty"`
 }
 
-// SchemaVersions array received from the registry containing the list of versions for specific schema.
-type SchemaVersions struct {
-	autorest.Response `json:"-"`
-	// SchemaVersions - Array of schema groups.
-	SchemaVersions *[]int32 `json:"schemaVersions,omitempty"`
-	Versions       *[]int32 `json:"Value,omitempty"`
+// SchemaContent is a registered schema with its properties
+type SchemaContent struct {
+	SchemaProperties
+	// Content - the schema content as stored in the registry.
+	Content string `json:"content,omitempty"`
 }
 
 // Schema object represents the schema entry in the eventhub schema registry
 type Schema struct {
-	autorest.Response `json:"-"`
-	Name              string        `json:"name"`
-	Namespace         string        `json:"namespace"`
-	Type              string        `json:"type"`
-	Fields            []interface{} `json:"fields"`
+	Name      string        `json:"name"`
+	Namespace string        `json:"namespace"`
+	Type      string        `json:"type"`
+	Fields    []interface{} `json:"fields"`
+}
+
+// propertiesFromHeaders extracts the schema properties from the response headers.
+func propertiesFromHeaders(header http.Header) SchemaProperties {
+	props := SchemaProperties{
+		ID:        header.Get("Schema-Id"),
+		GroupName: header.Get("Schema-Group-Name"),
+		Name:      header.Get("Schema-Name"),
+		Location:  header.Get("Location"),
+	}
+	if version, err := strconv.ParseInt(header.Get("Schema-Version"), 10, 32); err == nil {
+		props.Version = int32(version)
+	}
+	return props
 }
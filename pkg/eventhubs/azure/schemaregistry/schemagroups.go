@@ -2,17 +2,13 @@ package schemaregistry
 
 // Copyright (c) Microsoft Corporation.
 // Licensed under the MIT License.
-//
-// Code generated by Microsoft (R) AutoRest Code Generator.
-// Changes may cause incorrect behavior and will be lost if the code is regenerated.
 
 import (
 	"context"
 	"net/http"
 
-	"github.com/Azure/go-autorest/autorest"
-	"github.com/Azure/go-autorest/autorest/azure"
-	"github.com/Azure/go-autorest/tracing"
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore"
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore/runtime"
 )
 
 // SchemaGroupsClient is the azure Schema Registry is as a central schema repository, with support for versioning,
@@ -22,77 +18,21 @@ type SchemaGroupsClient struct {
 }
 
 // NewSchemaGroupsClient creates an instance of the SchemaGroupsClient client.
-func NewSchemaGroupsClient(endpoint string) SchemaGroupsClient {
-	return SchemaGroupsClient{New(endpoint)}
+func NewSchemaGroupsClient(endpoint string, credential azcore.TokenCredential, options *ClientOptions) *SchemaGroupsClient {
+	return &SchemaGroupsClient{New(endpoint, credential, options)}
 }
 
 // List gets the list of schema groups user is authorized to access.
-func (client SchemaGroupsClient) List(ctx context.Context) (result SchemaGroups, err error) {
-	if tracing.IsEnabled() {
-		ctx = tracing.StartSpan(ctx, fqdn+"/SchemaGroupsClient.List")
-		defer func() {
-			sc := -1
-			if result.Response.Response != nil {
-				sc = result.Response.Response.StatusCode
-			}
-			tracing.EndSpan(ctx, sc, err)
-		}()
-	}
-	req, err := client.ListPreparer(ctx)
-	if err != nil {
-		err = autorest.NewErrorWithError(err, "schemaregistry.SchemaGroupsClient", "List", nil, "Failure preparing request")
-		return
-	}
-
-	resp, err := client.ListSender(req)
+func (client *SchemaGroupsClient) List(ctx context.Context) (SchemaGroups, error) {
+	result := SchemaGroups{}
+	req, err := client.newRequest(ctx, http.MethodGet, "/$schemaGroups")
 	if err != nil {
-		result.Response = autorest.Response{Response: resp}
-		err = autorest.NewErrorWithError(err, "schemaregistry.SchemaGroupsClient", "List", resp, "Failure sending request")
-		return
+		return result, err
 	}
-
-	result, err = client.ListResponder(resp)
+	resp, err := client.do(req, http.StatusOK)
 	if err != nil {
-		err = autorest.NewErrorWithError(err, "schemaregistry.SchemaGroupsClient", "List", resp, "Failure responding to request")
-		return
-	}
-
-	return
-}
-
-// ListPreparer prepares the List request.
-func (client SchemaGroupsClient) ListPreparer(ctx context.Context) (*http.Request, error) {
-	urlParameters := map[string]interface{}{
-		"endpoint": client.Endpoint,
-	}
-
-	const APIVersion = "2021-10"
-	queryParameters := map[string]interface{}{
-		"api-version": APIVersion,
+		return result, err
 	}
-
-	preparer := autorest.CreatePreparer(
-		autorest.AsGet(),
-		autorest.WithCustomBaseURL("https://{endpoint}", urlParameters),
-		autorest.WithPath("/$schemaGroups"),
-		autorest.WithQueryParameters(queryParameters))
-	return preparer.Prepare((&http.Request{}).WithContext(ctx))
-}
-
-// ListSender sends the List request. The method will close the
-// http.Response Body if it receives an error.
-func (client SchemaGroupsClient) ListSender(req *http.Request) (*http.Response, error) {
-	return client.Send(req, autorest.DoRetryForStatusCodes(client.RetryAttempts, client.RetryDuration, autorest.StatusCodesForRetry...))
-}
-
-// ListResponder handles the response to the List request. The method always
-// closes the http.Response Body.
-func (client SchemaGroupsClient) ListResponder(resp *http.Response) (result SchemaGroups, err error) {
-	err = autorest.Respond(
-		resp,
-		azure.WithErrorUnlessStatusCode(http.StatusOK),
-		autorest.ByUnmarshallingJSON(&result),
-		autorest.ByClosing())
-	result.Response = autorest.Response{Response: resp}
-	return
+	err = runtime.UnmarshalAsJSON(resp, &result)
+	return result, err
 }
@@ -5,21 +5,31 @@ package eventhubs
 import (
 	"context"
 	"encoding/json"
+	"fmt"
+	"strconv"
 
 	schemav1alpha1 "github.com/microsoft/azure-schema-operator/apis/dbschema/v1alpha1"
 	v1 "k8s.io/api/core/v1"
 
-	"github.com/Azure/azure-sdk-for-go/sdk/azcore/policy"
+	azlog "github.com/Azure/azure-sdk-for-go/sdk/azcore/log"
 	"github.com/Azure/azure-sdk-for-go/sdk/azidentity"
-	"github.com/Azure/go-autorest/autorest"
-	"github.com/Azure/go-autorest/autorest/adal"
 	"github.com/microsoft/azure-schema-operator/pkg/eventhubs/azure/schemaregistry"
+	"github.com/microsoft/azure-schema-operator/pkg/eventhubs/azure/schemaregistry/schemaregistryapi"
+	"github.com/microsoft/azure-schema-operator/pkg/utils/schemaversions"
 	"github.com/rs/zerolog/log"
 )
 
+func init() {
+	// route the azure sdk pipeline logging (requests, responses and retries) to our logger.
+	azlog.SetListener(func(event azlog.Event, msg string) {
+		log.Debug().Str("event", string(event)).Msg(msg)
+	})
+}
+
 // Registry represents eventhub schema `Registry` object
 type Registry struct {
 	Endpoint string
+	Client   schemaregistryapi.SchemaClientAPI
 }
 
 // NewRegistry returns a new eventhub schema `Registry` object
@@ -27,49 +37,47 @@ func NewRegistry(uri string) *Registry {
 	cls := &Registry{
 		Endpoint: uri,
 	}
+	cred, err := azidentity.NewDefaultAzureCredential(nil)
+	if err != nil {
+		log.Error().Err(err).Msg("Authentication failure")
+		return cls
+	}
+	cls.Client = schemaregistry.NewSchemaClient(uri, cred, nil)
 
 	return cls
 }
 
 // AquireTargets for eventhubs is a no-op function (required by the interface)
-func (r *Registry) AquireTargets(filter schemav1alpha1.TargetFilter) (schemav1alpha1.ClusterTargets, error) {
+func (r *Registry) AquireTargets(ctx context.Context, filter schemav1alpha1.TargetFilter) (schemav1alpha1.ClusterTargets, error) {
 	targets := schemav1alpha1.ClusterTargets{}
 	return targets, nil
 }
 
 // Execute registers the given schema in the schema registry
-func (r *Registry) Execute(targets schemav1alpha1.ClusterTargets, config schemav1alpha1.ExecutionConfiguration) (schemav1alpha1.ClusterTargets, error) {
+func (r *Registry) Execute(ctx context.Context, targets schemav1alpha1.ClusterTargets, config schemav1alpha1.ExecutionConfiguration) (schemav1alpha1.ClusterTargets, error) {
 	done := schemav1alpha1.ClusterTargets{}
-	cred, err := azidentity.NewDefaultAzureCredential(nil)
-	if err != nil {
+	if r.Client == nil {
+		err := fmt.Errorf("no schema registry client for %s", r.Endpoint)
 		log.Error().Err(err).Msg("Authentication failure")
 		return done, err
 	}
-	t, _ := cred.GetToken(context.Background(), policy.TokenRequestOptions{Scopes: []string{"https://eventhubs.azure.net/.default"}})
-	// log.Printf("got token: %s", t.Token)
-
-	adalToken := adal.Token{
-		AccessToken: t.Token,
-	}
-	authorizer := autorest.NewBearerAuthorizer(&adalToken)
-
-	client := schemaregistry.NewSchemaClient(r.Endpoint)
-	client.Authorizer = authorizer
-	ctx := context.Background()
 
-	resp, err := client.Register(ctx, config.Group, config.TemplateName, config.Schema)
+	props, err := r.Client.Register(ctx, config.Group, config.TemplateName, config.Schema)
 	if err != nil {
 		log.Error().Err(err).Msg("failed to register")
 		return done, err
 	}
-	schemaId := resp.Header.Get("Schema-Id")
-	log.Info().Msgf("registered the schema: %s", schemaId)
-	done.Schemas = append(done.Schemas, schemaId)
+	log.Info().Msgf("registered the schema: %s (version %d)", props.ID, props.Version)
+	done.Schemas = append(done.Schemas, props.ID)
+	done.Outputs = map[string]string{
+		config.TemplateName: props.ID,
+		config.TemplateName + schemaversions.OutputVersionSuffix: strconv.Itoa(int(props.Version)),
+	}
 	return done, nil
 }
 
 // CreateExecConfiguration creates `ExecutionConfiguration` from the schema in the `ConfigMap`
-func (r *Registry) CreateExecConfiguration(targets schemav1alpha1.ClusterTargets, cfgMap *v1.ConfigMap, failIfDataLoss bool) (schemav1alpha1.ExecutionConfiguration, error) {
+func (r *Registry) CreateExecConfiguration(ctx context.Context, targets schemav1alpha1.ClusterTargets, cfgMap *v1.ConfigMap, failIfDataLoss bool) (schemav1alpha1.ExecutionConfiguration, error) {
 	config := schemav1alpha1.ExecutionConfiguration{}
 	if templateName, ok := cfgMap.Data["templateName"]; ok {
 		config.TemplateName = templateName
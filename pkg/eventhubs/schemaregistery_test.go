@@ -3,8 +3,16 @@ package eventhubs_test
 // Copyright (c) Microsoft Corporation.
 // Licensed under the MIT License.
 import (
+	"context"
 	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"time"
 
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore"
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore/policy"
 	. "github.com/onsi/ginkgo/v2"
 	. "github.com/onsi/gomega"
 	v1 "k8s.io/api/core/v1"
@@ -14,6 +22,37 @@ import (
 	"github.com/microsoft/azure-schema-operator/pkg/eventhubs/azure/schemaregistry"
 )
 
+type fakeSchemaClient struct {
+	registered map[string]string
+	err        error
+}
+
+func (f *fakeSchemaClient) GetByID(ctx context.Context, ID string) (schemaregistry.SchemaContent, error) {
+	return schemaregistry.SchemaContent{}, f.err
+}
+
+func (f *fakeSchemaClient) GetVersions(ctx context.Context, groupName string, schemaName string) (schemaregistry.SchemaVersions, error) {
+	return schemaregistry.SchemaVersions{}, f.err
+}
+
+func (f *fakeSchemaClient) QueryIDByContent(ctx context.Context, groupName string, schemaName string, schemaContent string) (schemaregistry.SchemaProperties, error) {
+	return schemaregistry.SchemaProperties{}, f.err
+}
+
+func (f *fakeSchemaClient) Register(ctx context.Context, groupName string, schemaName string, schemaContent string) (schemaregistry.SchemaProperties, error) {
+	if f.err != nil {
+		return schemaregistry.SchemaProperties{}, f.err
+	}
+	f.registered[groupName+"/"+schemaName] = schemaContent
+	return schemaregistry.SchemaProperties{ID: "schema-id-1", GroupName: groupName, Name: schemaName, Version: 1}, nil
+}
+
+type fakeCredential struct{}
+
+func (c fakeCredential) GetToken(ctx context.Context, options policy.TokenRequestOptions) (azcore.AccessToken, error) {
+	return azcore.AccessToken{Token: "fake-token", ExpiresOn: time.Now().Add(time.Hour)}, nil
+}
+
 var _ = Describe("Schemaregistery", func() {
 	Context("when creating configMap", func() {
 		targets := schemav1alpha1.ClusterTargets{}
@@ -48,17 +87,84 @@ var _ = Describe("Schemaregistery", func() {
 		if liveTest {
 			It("Should parse and extract configuration from configMap", func() {
 				registry := eventhubs.NewRegistry("jonytest.servicebus.windows.net")
-				ec, err := registry.CreateExecConfiguration(targets, cfgMap, false)
+				ec, err := registry.CreateExecConfiguration(context.Background(), targets, cfgMap, false)
 				Expect(err).NotTo(HaveOccurred())
 				Expect(ec).To(Equal(config))
 			})
 			It("It Should register the schema", func() {
 				registry := eventhubs.NewRegistry("jonytest.servicebus.windows.net")
-				_, err = registry.Execute(targets, config)
+				_, err = registry.Execute(context.Background(), targets, config)
 				Expect(err).NotTo(HaveOccurred())
 			})
 		}
-
+		It("Should register the schema using the registry client", func() {
+			client := &fakeSchemaClient{registered: make(map[string]string)}
+			registry := &eventhubs.Registry{Endpoint: "test.servicebus.windows.net", Client: client}
+			done, err := registry.Execute(context.Background(), targets, config)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(done.Schemas).To(Equal([]string{"schema-id-1"}))
+			Expect(done.Outputs).To(HaveKeyWithValue("schemaop", "schema-id-1"))
+			Expect(done.Outputs).To(HaveKeyWithValue("schemaop.version", "1"))
+			Expect(client.registered).To(HaveKeyWithValue("testsgr/schemaop", config.Schema))
+		})
+		It("Should fail when the registry client fails", func() {
+			client := &fakeSchemaClient{err: errors.New("registry unavailable")}
+			registry := &eventhubs.Registry{Endpoint: "test.servicebus.windows.net", Client: client}
+			_, err := registry.Execute(context.Background(), targets, config)
+			Expect(err).To(HaveOccurred())
+		})
+		It("Should fail when there is no registry client", func() {
+			registry := &eventhubs.Registry{Endpoint: "test.servicebus.windows.net"}
+			_, err := registry.Execute(context.Background(), targets, config)
+			Expect(err).To(HaveOccurred())
+		})
 	})
 
+	Context("when talking to the schema registry service", func() {
+		var attempts int
+		var server *httptest.Server
+
+		BeforeEach(func() {
+			attempts = 0
+			server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				attempts++
+				if attempts == 1 {
+					w.Header().Set("Retry-After", "0")
+					w.WriteHeader(http.StatusTooManyRequests)
+					return
+				}
+				defer GinkgoRecover()
+				Expect(r.Method).To(Equal(http.MethodPut))
+				Expect(r.URL.Path).To(Equal("/$schemaGroups/testsgr/schemas/schemaop"))
+				Expect(r.URL.Query().Get("api-version")).To(Equal(schemaregistry.APIVersion))
+				Expect(r.Header.Get("Authorization")).To(Equal("Bearer fake-token"))
+				body, err := io.ReadAll(r.Body)
+				Expect(err).NotTo(HaveOccurred())
+				Expect(string(body)).To(Equal(`{"type":"record"}`))
+				w.Header().Set("Schema-Id", "abc123")
+				w.Header().Set("Schema-Version", "3")
+				w.WriteHeader(http.StatusNoContent)
+			}))
+		})
+		AfterEach(func() {
+			server.Close()
+		})
+
+		It("Should retry throttled requests and parse the schema properties", func() {
+			options := &schemaregistry.ClientOptions{}
+			options.Retry = policy.RetryOptions{RetryDelay: time.Millisecond, MaxRetryDelay: 10 * time.Millisecond}
+			client := schemaregistry.NewSchemaClient(server.URL, fakeCredential{}, options)
+			props, err := client.Register(context.Background(), "testsgr", "schemaop", `{"type":"record"}`)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(attempts).To(Equal(2))
+			Expect(props.ID).To(Equal("abc123"))
+			Expect(props.Version).To(Equal(int32(3)))
+		})
+		It("Should reject invalid schema names", func() {
+			client := schemaregistry.NewSchemaClient(server.URL, fakeCredential{}, nil)
+			_, err := client.Register(context.Background(), "testsgr", "bad/name", `{}`)
+			Expect(err).To(HaveOccurred())
+			Expect(attempts).To(Equal(0))
+		})
+	})
 })
@@ -3,22 +3,29 @@ package kustoutils
 // Copyright (c) Microsoft Corporation.
 // Licensed under the MIT License.
 import (
+	"context"
+	"fmt"
 	"html/template"
+	"io"
 	"os"
 	"os/exec"
 	"strings"
 
 	"github.com/microsoft/azure-schema-operator/pkg/config"
+	"github.com/microsoft/azure-schema-operator/pkg/runlogs"
+	"github.com/microsoft/azure-schema-operator/pkg/utils"
 	"github.com/rs/zerolog"
 	"github.com/rs/zerolog/log"
 	"github.com/spf13/viper"
 )
 
+// errorTailBytes is the size of the output tail logged on failures
+const errorTailBytes = 2048
+
 var (
 	tenantID     string
 	clientSecret string
 	clientID     string
-	deltaCmd     string
 	useMSI       bool
 )
 
@@ -34,6 +41,13 @@ type execConfig struct {
 	FailIfDataLoss bool
 }
 
+type scriptConfig struct {
+	Uri        string
+	DB         string
+	KqlFile    string
+	ScriptFile string
+}
+
 const cfgSchemaDeployment = `
 sendErrorOptIn: false
 failIfDataLoss: {{ $.FailIfDataLoss }}
@@ -50,6 +64,23 @@ jobs:{{range $db := .DBs}}
       # filePath: prod-update.kql
       pushToCurrent: true{{end}}`
 
+// cfgDeltaScript computes the delta between the database (current) and the kql (target) into a script, without applying it
+const cfgDeltaScript = `
+sendErrorOptIn: false
+failIfDataLoss: false
+jobs:
+  delta-{{.DB}}:
+    current:
+      adx:
+        clusterUri:  {{.Uri}} 
+        database: {{.DB}}
+    target:
+      scripts:
+        - filePath: {{.KqlFile}} 
+    action:
+      filePath: {{.ScriptFile}}
+      pushToCurrent: false`
+
 const secretToken = `
 tokenProvider:
   login:
@@ -68,7 +99,11 @@ func init() {
 	tenantID = strings.TrimSpace(viper.GetString(config.AzureTenantIDKey))
 	clientSecret = strings.TrimSpace(viper.GetString(config.AzureClientSecretKey))
 	clientID = strings.TrimSpace(viper.GetString(config.AzureClientIDKey))
-	deltaCmd = strings.TrimSpace(viper.GetString(config.DeltaCMDKey))
+}
+
+// deltaCommand returns the path of the delta-kusto binary, it is read on each run so it can be replaced (e.g. by tests)
+func deltaCommand() string {
+	return strings.TrimSpace(viper.GetString(config.DeltaCMDKey))
 }
 
 // NewDeltaWrapper returns a `Wrapper` for delta-kusto
@@ -80,10 +115,31 @@ func NewDeltaWrapper() *Wrapper {
 
 // CreateExecConfiguration returns a job configuration file for delta-kusto
 func (w *Wrapper) CreateExecConfiguration(uri string, dbs []string, kqlFile string, failIfDataLoss bool) (string, error) {
+	log.Debug().Strs("dbs", dbs).Str("kql", kqlFile).Msg("define config")
+	return writeConfiguration(cfgSchemaDeployment, execConfig{
+		Uri:            uri,
+		DBs:            dbs,
+		KqlFile:        kqlFile,
+		FailIfDataLoss: failIfDataLoss,
+	})
+}
+
+// CreateScriptConfiguration returns a job configuration file for delta-kusto writing the commands
+// that bring the database to the kql schema to `scriptFile` (the database isn't changed)
+func (w *Wrapper) CreateScriptConfiguration(uri, db, kqlFile, scriptFile string) (string, error) {
+	return writeConfiguration(cfgDeltaScript, scriptConfig{
+		Uri:        uri,
+		DB:         db,
+		KqlFile:    kqlFile,
+		ScriptFile: scriptFile,
+	})
+}
 
+// writeConfiguration writes the job configuration from the template along with the token provider
+func writeConfiguration(cfgTemplate string, data interface{}) (string, error) {
 	log.Debug().Msg("open template file")
 
-	t, err := template.New("cfgTempalte").Parse(cfgSchemaDeployment)
+	t, err := template.New("cfgTempalte").Parse(cfgTemplate)
 	if err != nil {
 		log.Error().Err(err).Msg("failed to parse template")
 		return "", err
@@ -99,15 +155,8 @@ func (w *Wrapper) CreateExecConfiguration(uri string, dbs []string, kqlFile stri
 	}
 	defer f.Close()
 
-	log.Debug().Strs("dbs", dbs).Str("kql", kqlFile).Msg("define config")
-	exConfig := execConfig{
-		Uri:            uri,
-		DBs:            dbs,
-		KqlFile:        kqlFile,
-		FailIfDataLoss: failIfDataLoss,
-	}
 	log.Debug().Msgf("execute template config onto: %s", f.Name())
-	err = t.Execute(f, exConfig)
+	err = t.Execute(f, data)
 	if err != nil {
 		log.Error().Err(err).Msg("failed to execute template")
 		return f.Name(), err
@@ -122,8 +171,9 @@ func (w *Wrapper) CreateExecConfiguration(uri string, dbs []string, kqlFile stri
 	return f.Name(), err
 }
 
-// RunDeltaKusto runs delta-kusto on the provided job configuration file.
-func RunDeltaKusto(deltaCfgfile string) error {
+// RunDeltaKusto runs delta-kusto on the provided job configuration file, its output is written to `output` as well as the log.
+// The process and its children are killed if the context is done.
+func RunDeltaKusto(ctx context.Context, deltaCfgfile string, output io.Writer) error {
 	log.Debug().Str("tenant", tenantID).Str("client", clientID).Str("sec", clientSecret).Msgf("about to run delta-kusto on: %s", deltaCfgfile)
 	args := []string{"-p", deltaCfgfile}
 
@@ -132,21 +182,23 @@ func RunDeltaKusto(deltaCfgfile string) error {
 	} else {
 		args = append(args, "-o", "tokenProvider.login.tenantId="+tenantID, "tokenProvider.login.clientId="+clientID, "tokenProvider.login.secret="+clientSecret)
 	}
-	cmd := exec.Command(deltaCmd, args...)
+	cmd := exec.Command(deltaCommand(), args...)
 	cmd.Env = append(os.Environ(),
 		"PATH=/bin/",
 		"DOTNET_SYSTEM_GLOBALIZATION_INVARIANT=1",
 	)
-	cmd.Stdout = log.Level(zerolog.InfoLevel).With().Str("delta-kusto", deltaCfgfile).Logger()
-	cmd.Stderr = log.Level(zerolog.ErrorLevel).With().Str("delta-kusto", deltaCfgfile).Logger()
-	err := cmd.Run()
+	tail := runlogs.NewCapture(errorTailBytes)
+	cmd.Stdout = io.MultiWriter(log.Level(zerolog.InfoLevel).With().Str("delta-kusto", deltaCfgfile).Logger(), output, tail)
+	cmd.Stderr = io.MultiWriter(log.Level(zerolog.ErrorLevel).With().Str("delta-kusto", deltaCfgfile).Logger(), output, tail)
+	err := utils.RunCommand(ctx, cmd)
 	if err != nil {
+		fmt.Fprintf(output, "delta-kusto failed: %s\n", err)
 		eerr, ok := err.(*exec.ExitError)
 		if ok {
-			log.Error().Err(eerr).Msgf("cmd.Run() failed with exit code: %d, error: %s ", eerr.ExitCode(), string(eerr.Stderr))
-			return err
+			log.Error().Err(eerr).Msgf("delta-kusto failed with exit code: %d, output: %s", eerr.ExitCode(), tail.Tail(errorTailBytes))
+			return fmt.Errorf("delta-kusto failed with exit code %d: %w", eerr.ExitCode(), err)
 		}
-		log.Error().Err(err).Msg("cmd.Run() failed ")
+		log.Error().Err(err).Msg("delta-kusto failed")
 		return err
 	}
 	log.Info().Msgf("Execution of %s done", deltaCfgfile)
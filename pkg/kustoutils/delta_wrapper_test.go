@@ -3,13 +3,17 @@ package kustoutils_test
 // Copyright (c) Microsoft Corporation.
 // Licensed under the MIT License.
 import (
+	"context"
 	"fmt"
 	"os"
+	"path/filepath"
 
 	schemav1alpha1 "github.com/microsoft/azure-schema-operator/apis/dbschema/v1alpha1"
+	"github.com/microsoft/azure-schema-operator/pkg/config"
 	"github.com/microsoft/azure-schema-operator/pkg/kustoutils"
 	. "github.com/onsi/ginkgo/v2"
 	. "github.com/onsi/gomega"
+	"github.com/spf13/viper"
 	v1 "k8s.io/api/core/v1"
 )
 
@@ -90,7 +94,7 @@ var _ = Describe("DeltaWrapper", func() {
 				Data: map[string]string{"kql": "add tables and stuff"},
 			}
 			failIfDataLoss := false
-			exeCfg, err := mockClient.CreateExecConfiguration(targets, cfgMap, failIfDataLoss)
+			exeCfg, err := mockClient.CreateExecConfiguration(context.Background(), targets, cfgMap, failIfDataLoss)
 			Expect(err).NotTo(HaveOccurred())
 			fmt.Fprintf(GinkgoWriter, "generated config: %v\n", exeCfg)
 
@@ -105,9 +109,54 @@ var _ = Describe("DeltaWrapper", func() {
 			}
 			cfgMap := &v1.ConfigMap{}
 			failIfDataLoss := false
-			_, err := mockClient.CreateExecConfiguration(targets, cfgMap, failIfDataLoss)
+			_, err := mockClient.CreateExecConfiguration(context.Background(), targets, cfgMap, failIfDataLoss)
 			Expect(err).To(HaveOccurred())
 		})
 
 	})
+	Context("when computing the delta script", func() {
+		uri := "https://testcluster.westeurope.kusto.windows.net"
+
+		// deltaKusto replaces delta-kusto with a script writing `commands` to the action file of the job
+		deltaKusto := func(commands string, exitCode string) {
+			script := filepath.Join(GinkgoT().TempDir(), "delta-kusto")
+			content := "#!/bin/sh\n" +
+				"out=$(sed -n 's/^      filePath: //p' \"$2\")\n" +
+				"printf '%s' '" + commands + "' > \"$out\"\n" +
+				"exit " + exitCode + "\n"
+			Expect(os.WriteFile(script, []byte(content), 0o700)).To(Succeed())
+			DeferCleanup(viper.Set, config.DeltaCMDKey, viper.GetString(config.DeltaCMDKey))
+			viper.Set(config.DeltaCMDKey, script)
+		}
+
+		It("Should generate a script job that doesn't push to the database", func() {
+			w := kustoutils.NewDeltaWrapper()
+			fileName, err := w.CreateScriptConfiguration(uri, "db1", "/path/to/schema.kql", "/path/to/delta.kql")
+			Expect(err).NotTo(HaveOccurred())
+			DeferCleanup(os.Remove, fileName)
+			b, err := os.ReadFile(fileName)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(string(b)).To(ContainSubstring("database: db1"))
+			Expect(string(b)).To(ContainSubstring("- filePath: /path/to/schema.kql"))
+			Expect(string(b)).To(MatchRegexp(`action:\s+filePath: /path/to/delta.kql\s+pushToCurrent: false`))
+			Expect(string(b)).NotTo(ContainSubstring("pushToCurrent: true"))
+		})
+		It("Should return the commands delta-kusto would run", func() {
+			deltaKusto(".create-merge table T (a:string)\n", "0")
+			script, err := kustoutils.NewKustoCluster(uri, nil).DeltaScript(context.Background(), "db1", ".create-merge table T (a:string)")
+			Expect(err).NotTo(HaveOccurred())
+			Expect(script).To(Equal(".create-merge table T (a:string)"))
+		})
+		It("Should return an empty script for an up to date database", func() {
+			deltaKusto("", "0")
+			script, err := kustoutils.NewKustoCluster(uri, nil).DeltaScript(context.Background(), "db1", ".create-merge table T (a:string)")
+			Expect(err).NotTo(HaveOccurred())
+			Expect(script).To(BeEmpty())
+		})
+		It("Should fail when delta-kusto fails", func() {
+			deltaKusto("", "3")
+			_, err := kustoutils.NewKustoCluster(uri, nil).DeltaScript(context.Background(), "db1", ".create-merge table T (a:string)")
+			Expect(err).To(MatchError(ContainSubstring("exit code 3")))
+		})
+	})
 })
@@ -0,0 +1,230 @@
+package kustoutils_test
+
+// Copyright (c) Microsoft Corporation.
+// Licensed under the MIT License.
+import (
+	"context"
+	"os"
+	"path/filepath"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+
+	schemav1alpha1 "github.com/microsoft/azure-schema-operator/apis/dbschema/v1alpha1"
+	"github.com/microsoft/azure-schema-operator/pkg/config"
+	"github.com/microsoft/azure-schema-operator/pkg/kustoutils"
+	"github.com/microsoft/azure-schema-operator/pkg/kustoutils/kustofake"
+	"github.com/microsoft/azure-schema-operator/pkg/kustoutils/types"
+	"github.com/spf13/viper"
+)
+
+var _ = Describe("Fake cluster", Label("fake"), func() {
+	var (
+		ctx  context.Context
+		fake *kustofake.Cluster
+	)
+
+	BeforeEach(func() {
+		ctx = context.Background()
+		fake = kustofake.NewCluster("https://fake.westeurope.kusto.windows.net")
+		fake.AddDatabase("tenant_1", "events")
+		fake.AddDatabase("tenant_2", "events")
+		fake.AddDatabase("shared")
+	})
+
+	It("should list and filter the databases", func() {
+		cluster := &kustoutils.KustoCluster{URI: fake.URI, Client: fake}
+		dbs, err := cluster.ListDatabases(ctx, "^tenant")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(dbs).To(Equal([]string{"tenant_1", "tenant_2"}))
+
+		targets, err := cluster.AquireTargets(ctx, schemav1alpha1.TargetFilter{})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(targets.DBs).To(HaveLen(3))
+	})
+
+	Context("with follower databases", func() {
+		var cluster *kustoutils.KustoCluster
+
+		BeforeEach(func() {
+			fake.AddFollowerDatabase("tenant_3", "events", "my table")
+			cluster = &kustoutils.KustoCluster{URI: fake.URI, Client: fake}
+		})
+
+		// follower executes only the follower overrides of the kql on the skipped follower databases
+		follower := func(kql string, skipped ...schemav1alpha1.SkippedTarget) error {
+			kqlFile, err := kustoutils.StoreKQLSchemaToFile(kql)
+			Expect(err).NotTo(HaveOccurred())
+			DeferCleanup(os.Remove, kqlFile)
+			_, err = cluster.Execute(ctx, schemav1alpha1.ClusterTargets{Skipped: skipped}, schemav1alpha1.ExecutionConfiguration{KQLFile: kqlFile})
+			return err
+		}
+
+		It("should skip the follower databases", func() {
+			targets, err := cluster.AquireTargets(ctx, schemav1alpha1.TargetFilter{DB: "^tenant"})
+			Expect(err).NotTo(HaveOccurred())
+			Expect(targets.DBs).To(Equal([]string{"tenant_1", "tenant_2"}))
+			Expect(targets.Skipped).To(HaveLen(1))
+			Expect(targets.Skipped[0].DB).To(Equal("tenant_3"))
+			Expect(targets.Skipped[0].Reason).To(Equal(kustoutils.SkipReasonFollower))
+		})
+
+		It("should translate the caching policies to follower commands", func() {
+			kql := ".create-merge table events (a:string)\n" +
+				".alter database tenant policy caching hot = 3d\n" +
+				".alter-merge table events policy caching hot = 26h\n" +
+				".alter table ['my table'] policy caching hot = 2d\n" +
+				".alter tables (events, ['my table']) policy caching hot = 4d\n" +
+				".alter materialized-view daily policy caching\n    hot = 5d\n\n" +
+				"// .alter table events policy caching hot = 6d\n"
+			commands, untranslated := kustoutils.FollowerCommands("tenant_3", kql)
+			Expect(commands).To(Equal([]string{
+				".alter follower database ['tenant_3'] policy caching hot = 3d",
+				".alter follower database ['tenant_3'] table events policy caching hot = 26h",
+				".alter follower database ['tenant_3'] table ['my table'] policy caching hot = 2d",
+				".alter follower database ['tenant_3'] tables (events, ['my table']) policy caching hot = 4d",
+				".alter follower database ['tenant_3'] materialized-view daily policy caching hot = 5d",
+			}))
+			Expect(untranslated).To(BeEmpty())
+		})
+
+		It("should report the caching policy commands it can't translate", func() {
+			kql := ".alter table events policy retention softdelete = 10d\n.delete table events policy caching\n"
+			commands, untranslated := kustoutils.FollowerCommands("tenant_3", kql)
+			Expect(commands).To(BeEmpty())
+			Expect(untranslated).To(Equal([]string{".delete table events policy caching"}))
+		})
+
+		It("should apply the caching policy overrides on the follower databases", func() {
+			kql := ".alter database tenant policy caching hot = 3d\n" +
+				".alter-merge table events policy caching hot = 26h\n" +
+				".alter table ['my table'] policy caching hot = 2d\n" +
+				".delete table events policy caching\n"
+			Expect(follower(kql, schemav1alpha1.SkippedTarget{DB: "tenant_3", Reason: kustoutils.SkipReasonFollower})).To(Succeed())
+			Expect(fake.Policy("tenant_3", "", "caching")).To(ContainSubstring("3.00:00:00"))
+			Expect(fake.Policy("tenant_3", "events", "caching")).To(ContainSubstring("1.02:00:00"))
+			Expect(fake.Policy("tenant_3", "my table", "caching")).To(ContainSubstring("2.00:00:00"))
+		})
+
+		It("should apply the overrides of multiple tables", func() {
+			Expect(follower(".alter tables (events, ['my table']) policy caching hot = 4d",
+				schemav1alpha1.SkippedTarget{DB: "tenant_3", Reason: kustoutils.SkipReasonFollower})).To(Succeed())
+			Expect(fake.Policy("tenant_3", "events", "caching")).To(ContainSubstring("4.00:00:00"))
+			Expect(fake.Policy("tenant_3", "my table", "caching")).To(ContainSubstring("4.00:00:00"))
+		})
+
+		It("should not change the schema of the follower databases", func() {
+			_, err := kustoutils.SetTableCachingPolicy(ctx, fake, "tenant_3", "events", "1d")
+			Expect(err).To(HaveOccurred())
+		})
+
+		It("should fail to apply the overrides on a database that isn't a follower", func() {
+			err := follower(".alter database tenant policy caching hot = 3d",
+				schemav1alpha1.SkippedTarget{DB: "tenant_1", Reason: kustoutils.SkipReasonFollower})
+			Expect(err).To(MatchError(ContainSubstring("not a follower database")))
+		})
+	})
+
+	Context("when executing", func() {
+		var cluster *kustoutils.KustoCluster
+
+		// deltaKusto replaces delta-kusto with a script exiting with the code
+		deltaKusto := func(exitCode string) {
+			script := filepath.Join(GinkgoT().TempDir(), "delta-kusto")
+			Expect(os.WriteFile(script, []byte("#!/bin/sh\nexit "+exitCode+"\n"), 0o700)).To(Succeed())
+			DeferCleanup(viper.Set, config.DeltaCMDKey, viper.GetString(config.DeltaCMDKey))
+			viper.Set(config.DeltaCMDKey, script)
+		}
+
+		BeforeEach(func() {
+			cluster = &kustoutils.KustoCluster{URI: fake.URI, Client: fake}
+		})
+
+		It("should return the executed databases", func() {
+			deltaKusto("0")
+			done, err := cluster.Execute(ctx, schemav1alpha1.ClusterTargets{DBs: []string{"tenant_1", "tenant_2"}}, schemav1alpha1.ExecutionConfiguration{})
+			Expect(err).NotTo(HaveOccurred())
+			Expect(done.DBs).To(Equal([]string{"tenant_1", "tenant_2"}))
+		})
+
+		It("should not return any database when delta-kusto failed", func() {
+			deltaKusto("1")
+			done, err := cluster.Execute(ctx, schemav1alpha1.ClusterTargets{DBs: []string{"tenant_1", "tenant_2"}}, schemav1alpha1.ExecutionConfiguration{})
+			Expect(err).To(HaveOccurred())
+			Expect(done.DBs).To(BeEmpty())
+		})
+	})
+
+	It("should fall back to the database policy", func() {
+		policy, err := kustoutils.GetTableRetentionPolicy(ctx, fake, "tenant_1", "events")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(policy.SoftDeletePeriod).To(Equal("36500.00:00:00"))
+
+		Expect(fake.SetPolicy("tenant_1", "events", "retention", `{"SoftDeletePeriod":"7.00:00:00","Recoverability":"Disabled"}`)).To(Succeed())
+		policy, err = kustoutils.GetTableRetentionPolicy(ctx, fake, "tenant_1", "events")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(*policy).To(Equal(types.RetentionPolicy{SoftDeletePeriod: "7.00:00:00", Recoverability: "Disabled"}))
+	})
+
+	It("should fail to get a policy for non existing table", func() {
+		policy, err := kustoutils.GetTableRetentionPolicy(ctx, fake, "tenant_1", "doesnotexist")
+		Expect(err).To(HaveOccurred())
+		Expect(policy).To(BeNil())
+	})
+
+	It("should set a table and a database retention policy", func() {
+		newPolicy := &types.RetentionPolicy{SoftDeletePeriod: "12.00:00:00", Recoverability: "Enabled"}
+		policy, err := kustoutils.SetTableRetentionPolicy(ctx, fake, "tenant_1", "events", newPolicy)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(*policy).To(Equal(*newPolicy))
+		Expect(fake.Policy("tenant_1", "events", "retention")).To(ContainSubstring("12.00:00:00"))
+
+		_, err = kustoutils.SetTableRetentionPolicy(ctx, fake, "shared", "", newPolicy)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(fake.Policy("shared", "", "retention")).To(ContainSubstring("12.00:00:00"))
+		Expect(fake.Policy("tenant_2", "", "retention")).To(ContainSubstring("36500.00:00:00"))
+	})
+
+	It("should get and set a caching policy", func() {
+		policy, err := kustoutils.GetTableCachingPolicy(ctx, fake, "tenant_1", "events")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(policy).To(Equal("36500d"))
+
+		policy, err = kustoutils.SetTableCachingPolicy(ctx, fake, "tenant_1", "events", "26h")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(policy).To(Equal("26h"))
+		policy, err = kustoutils.GetTableCachingPolicy(ctx, fake, "tenant_1", "events")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(policy).To(Equal("26h"))
+	})
+
+	It("should create-or-alter and get a function", func() {
+		function := types.KustoFunction{
+			Name:       "MyTestFunction",
+			Parameters: "(x:int)",
+			Body:       "{ let y = 2; x + y }",
+			DocString:  "adds two",
+			Folder:     "math",
+		}
+		_, err := kustoutils.GetFunction(ctx, fake, "tenant_1", function, false)
+		Expect(err).To(HaveOccurred())
+
+		funcInDB, err := kustoutils.GetFunction(ctx, fake, "tenant_1", function, true)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(function.Equals(funcInDB)).To(BeTrue())
+
+		funcInDB, err = kustoutils.GetFunction(ctx, fake, "tenant_1", function, false)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(function.Equals(funcInDB)).To(BeTrue())
+		_, found := fake.Function("tenant_2", function.Name)
+		Expect(found).To(BeFalse())
+	})
+
+	It("should export the database schema", func() {
+		Expect(fake.SetSchema("shared", ".create-merge table T (a:string) ", ".create-or-alter function F() { T }")).To(Succeed())
+		cluster := &kustoutils.KustoCluster{URI: fake.URI, Client: fake}
+		script, err := cluster.ExportScript(ctx, "shared")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(script).To(Equal(".create-merge table T (a:string)\n\n.create-or-alter function F() { T }\n"))
+	})
+})
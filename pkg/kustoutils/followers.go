@@ -0,0 +1,221 @@
+package kustoutils
+
+// Copyright (c) Microsoft Corporation.
+// Licensed under the MIT License.
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"regexp"
+	"strings"
+
+	"github.com/Azure/azure-kusto-go/kusto"
+	"github.com/Azure/azure-kusto-go/kusto/data/errors"
+	"github.com/Azure/azure-kusto-go/kusto/data/table"
+	"github.com/Azure/azure-kusto-go/kusto/unsafe"
+	schemav1alpha1 "github.com/microsoft/azure-schema-operator/apis/dbschema/v1alpha1"
+	"github.com/rs/zerolog/log"
+)
+
+// Database access modes (see `.show databases details`)
+const (
+	AccessModeReadWrite = "ReadWrite"
+	AccessModeReadOnly  = "ReadOnly"
+	// AccessModeFollowing is the access mode of follower (attached) databases
+	AccessModeFollowing = "ReadOnlyFollowing"
+)
+
+// Reasons of the skipped targets
+const (
+	// SkipReasonFollower - the DB is a follower, only the follower level settings (caching policy overrides) are applied
+	SkipReasonFollower = "Follower"
+	// SkipReasonReadOnly - the DB is read-only
+	SkipReasonReadOnly = "ReadOnly"
+)
+
+var (
+	// cachingPolicyRe matches the database, table(s) and materialized view(s) caching policy commands.
+	// Names are plain, bracketed (['my table']) or a list for the plural entities (tables (a, b)).
+	cachingPolicyRe = regexp.MustCompile(`(?is)^\.alter(?:-merge)?\s+(database|tables?|materialized-views?)\s+(\[(?:'[^']*'|"[^"]*")\]|\([^)]*\)|\S+)\s+policy\s+caching\s+(.+?)\s*$`)
+	// anyCachingPolicyRe matches every command changing a caching policy, to report the ones that can't be translated
+	anyCachingPolicyRe = regexp.MustCompile(`(?is)^\.(?:alter|alter-merge|delete)\b.*\bpolicy\s+caching\b`)
+	whitespaceRe       = regexp.MustCompile(`\s+`)
+)
+
+// DatabaseDetails are the details of a database in the cluster
+type DatabaseDetails struct {
+	DatabaseName       string `kusto:"DatabaseName"`
+	DatabaseAccessMode string `kusto:"DatabaseAccessMode"`
+}
+
+// IsFollower returns true for follower databases - they are read-only copies of a leader cluster database
+func (d DatabaseDetails) IsFollower() bool {
+	return strings.EqualFold(d.DatabaseAccessMode, AccessModeFollowing)
+}
+
+// IsReadOnly returns true if the schema can't be changed on the database
+func (d DatabaseDetails) IsReadOnly() bool {
+	return d.IsFollower() || strings.EqualFold(d.DatabaseAccessMode, AccessModeReadOnly)
+}
+
+// DatabaseDetails returns the details of the databases in the cluster
+func (c *KustoCluster) DatabaseDetails(ctx context.Context) ([]DatabaseDetails, error) {
+	client, release, err := c.client(ctx)
+	if err != nil {
+		log.Error().Err(err).Msg("Failed to get the kusto client")
+		return nil, err
+	}
+	defer release()
+
+	iter, err := client.Mgmt(ctx, "", kusto.NewStmt(".show databases details | project DatabaseName, DatabaseAccessMode"))
+	if err != nil {
+		log.Error().Err(err).Msg("Failed to query mgmt api")
+		return nil, err
+	}
+	defer iter.Stop()
+
+	dbs := make([]DatabaseDetails, 0)
+	err = iter.DoOnRowOrError(
+		func(row *table.Row, inlineError *errors.Error) error {
+			if row == nil {
+				// ignore inline errors - not relevant for this use case
+				log.Error().Msgf("got inline error: %s", inlineError.Error())
+				return nil
+			}
+			details := DatabaseDetails{}
+			if err := row.ToStruct(&details); err != nil {
+				return err
+			}
+			dbs = append(dbs, details)
+			return nil
+		},
+	)
+	if err != nil {
+		log.Error().Err(err).Msg("failed to iterate results")
+		return nil, err
+	}
+	return dbs, nil
+}
+
+// skipReadOnly moves the follower and read-only databases to the skipped targets.
+// DBs that aren't in the cluster are kept as targets.
+func skipReadOnly(dbs []string, details []DatabaseDetails) schemav1alpha1.ClusterTargets {
+	modes := make(map[string]DatabaseDetails, len(details))
+	for _, d := range details {
+		modes[d.DatabaseName] = d
+	}
+	targets := schemav1alpha1.ClusterTargets{}
+	for _, db := range dbs {
+		d := modes[db]
+		switch {
+		case d.IsFollower():
+			targets.Skipped = append(targets.Skipped, schemav1alpha1.SkippedTarget{
+				DB:      db,
+				Reason:  SkipReasonFollower,
+				Message: "follower databases are read-only - only the caching policies are applied as follower overrides",
+			})
+		case d.IsReadOnly():
+			targets.Skipped = append(targets.Skipped, schemav1alpha1.SkippedTarget{
+				DB:      db,
+				Reason:  SkipReasonReadOnly,
+				Message: fmt.Sprintf("the database access mode is %s", d.DatabaseAccessMode),
+			})
+		default:
+			targets.DBs = append(targets.DBs, db)
+		}
+	}
+	return targets
+}
+
+// FollowerCommands returns the commands applying the caching policies of the script on the follower database,
+// along with the caching policy commands of the script that can't be translated to follower commands.
+// Database caching policies become the follower database override and table (or materialized view) caching policies
+// the follower table overrides.
+func FollowerCommands(db, script string) ([]string, []string) {
+	var commands, untranslated []string
+	follower := fmt.Sprintf(".alter follower database ['%s']", strings.ReplaceAll(db, "'", "\\'"))
+	for _, command := range scriptCommands(script) {
+		m := cachingPolicyRe.FindStringSubmatch(command)
+		switch {
+		case m == nil:
+			if anyCachingPolicyRe.MatchString(command) {
+				untranslated = append(untranslated, command)
+			}
+		case strings.EqualFold(m[1], "database"):
+			commands = append(commands, fmt.Sprintf("%s policy caching %s", follower, m[3]))
+		default:
+			commands = append(commands, fmt.Sprintf("%s %s %s policy caching %s", follower, strings.ToLower(m[1]), m[2], m[3]))
+		}
+	}
+	return commands, untranslated
+}
+
+// scriptCommands splits the script into its commands - a command starts on a line starting with `.`
+// and may span the following lines. The whitespace of each command is collapsed to single spaces.
+func scriptCommands(script string) []string {
+	var commands []string
+	var current []string
+	flush := func() {
+		if len(current) > 0 {
+			commands = append(commands, whitespaceRe.ReplaceAllString(strings.TrimSpace(strings.Join(current, " ")), " "))
+			current = nil
+		}
+	}
+	for _, line := range strings.Split(script, "\n") {
+		trimmed := strings.TrimSpace(line)
+		if strings.HasPrefix(trimmed, ".") {
+			flush()
+		}
+		if strings.HasPrefix(trimmed, "//") || (trimmed != "" && len(current) == 0 && !strings.HasPrefix(trimmed, ".")) {
+			continue
+		}
+		current = append(current, trimmed)
+	}
+	flush()
+	return commands
+}
+
+// applyFollowerPolicies applies the caching policies of the kql file on the skipped follower databases.
+// Follower commands run on the follower cluster, in the context of the database.
+func (c *KustoCluster) applyFollowerPolicies(ctx context.Context, skipped []schemav1alpha1.SkippedTarget, kqlFile string, out io.Writer) error {
+	var followers []string
+	for _, target := range skipped {
+		if target.Reason == SkipReasonFollower {
+			followers = append(followers, target.DB)
+		}
+	}
+	if len(followers) == 0 {
+		return nil
+	}
+	kql, err := os.ReadFile(kqlFile)
+	if err != nil {
+		log.Error().Err(err).Msgf("failed to read the kql file %s", kqlFile)
+		return err
+	}
+	client, release, err := c.client(ctx)
+	if err != nil {
+		log.Error().Err(err).Msg("Failed to get the kusto client")
+		return err
+	}
+	defer release()
+
+	for _, db := range followers {
+		commands, untranslated := FollowerCommands(db, string(kql))
+		for _, command := range untranslated {
+			log.Warn().Msgf("the caching policy command can't be applied on the follower database %s: %s", db, command)
+			fmt.Fprintf(out, "%s: skipped - can't be applied as a follower override: %s\n", db, command)
+		}
+		for _, command := range commands {
+			fmt.Fprintf(out, "%s: %s\n", db, command)
+			stmt := kusto.NewStmt("", kusto.UnsafeStmt(unsafe.Stmt{Add: true, SuppressWarning: true})).UnsafeAdd(command)
+			iter, err := client.Mgmt(ctx, db, stmt)
+			if err != nil {
+				log.Error().Err(err).Msgf("failed to apply the follower caching policy on %s", db)
+				return fmt.Errorf("failed to apply the follower caching policy on %s: %w", db, err)
+			}
+			iter.Stop()
+		}
+	}
+	return nil
+}
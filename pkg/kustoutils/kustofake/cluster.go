@@ -0,0 +1,443 @@
+package kustofake
+
+// Copyright (c) Microsoft Corporation.
+// Licensed under the MIT License.
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/Azure/azure-kusto-go/kusto"
+	"github.com/Azure/azure-kusto-go/kusto/data/table"
+	ktypes "github.com/Azure/azure-kusto-go/kusto/data/types"
+	"github.com/Azure/azure-kusto-go/kusto/data/value"
+
+	"github.com/microsoft/azure-schema-operator/pkg/kustoutils/types"
+)
+
+// defaultSpan is the span of the default retention and caching policies of a new database (100 years)
+const defaultSpan = "36500.00:00:00"
+
+var (
+	showDatabasesRe  = regexp.MustCompile(`^\.show databases\b`)
+	showDetailsRe    = regexp.MustCompile(`^\.show databases details\b`)
+	alterFollowerRe  = regexp.MustCompile(`^\.alter follower database \['(.*?)'\](?: tables? (\['.*?'\]|\(.*?\)|\S+))? policy caching (.*)$`)
+	showVersionRe    = regexp.MustCompile(`^\.show version$`)
+	showPolicyRe     = regexp.MustCompile(`^\.show (table|database) (\S+) policy (\w+)$`)
+	alterPolicyRe    = regexp.MustCompile(`(?s)^\.alter (table|database) (\S+) policy (\w+) (.*)$`)
+	showFunctionRe   = regexp.MustCompile(`^\.show function (\S+)$`)
+	createFunctionRe = regexp.MustCompile(`(?s)^\.create-or-alter function (?:with \((.*?)\) )?(\w+) (\(.*?\))  (.*)$`)
+	propertyRe       = regexp.MustCompile(`(\w+) = '(.*?)'`)
+	showSchemaRe     = regexp.MustCompile(`^\.show database \['(.*)'\] schema as csl script$`)
+	cachingHotRe     = regexp.MustCompile(`^hot = (\d+)([dh])$`)
+)
+
+// database is the state of a database of the fake cluster
+type database struct {
+	// tables are the policies of each table by the policy short name
+	tables    map[string]map[string]string
+	policies  map[string]string
+	functions map[string]types.KustoFunction
+	schema    []string
+	// follower databases are read-only, only their caching policy can be overridden
+	follower bool
+}
+
+// Cluster is an in-process kusto cluster implementing `kustoutils.QueryClient`.
+// It understands the control commands the operator runs: `.show databases [details]`, `.show function`,
+// `.create-or-alter function`, `.show ... policy`, `.alter ... policy`, `.alter follower database ... policy caching`
+// and `.show database ... schema as csl script`.
+// The rows are returned with the kusto mock row iterator, so it can only be used by tests.
+type Cluster struct {
+	URI       string
+	mu        sync.Mutex
+	databases map[string]*database
+	commands  []string
+}
+
+// NewCluster returns an empty fake cluster
+func NewCluster(uri string) *Cluster {
+	return &Cluster{URI: uri, databases: make(map[string]*database)}
+}
+
+// AddDatabase adds a database with its tables, the database has the default retention and caching policies.
+func (c *Cluster) AddDatabase(name string, tables ...string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	db := &database{
+		tables: make(map[string]map[string]string),
+		policies: map[string]string{
+			"retention": fmt.Sprintf(`{"SoftDeletePeriod":"%s","Recoverability":"Enabled"}`, defaultSpan),
+			"caching":   cachingPolicy(defaultSpan),
+		},
+		functions: make(map[string]types.KustoFunction),
+	}
+	for _, t := range tables {
+		db.tables[t] = make(map[string]string)
+	}
+	c.databases[name] = db
+}
+
+// AddFollowerDatabase adds a follower database with its tables - its schema and policies can't be changed,
+// other than overriding the caching policy with the follower commands.
+func (c *Cluster) AddFollowerDatabase(name string, tables ...string) {
+	c.AddDatabase(name, tables...)
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.databases[name].follower = true
+}
+
+// SetPolicy sets the policy (json) of the table, or of the database if the table is empty
+func (c *Cluster) SetPolicy(db, tableName, kind, policy string) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	policies, err := c.policies(db, tableName)
+	if err != nil {
+		return err
+	}
+	policies[kind] = policy
+	return nil
+}
+
+// Policy returns the policy (json) set on the table, or on the database if the table is empty
+func (c *Cluster) Policy(db, tableName, kind string) string {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	policies, err := c.policies(db, tableName)
+	if err != nil {
+		return ""
+	}
+	return policies[kind]
+}
+
+// SetFunction creates (or replaces) the function in the database
+func (c *Cluster) SetFunction(db string, function types.KustoFunction) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	d, ok := c.databases[db]
+	if !ok {
+		return fmt.Errorf("database '%s' not found", db)
+	}
+	d.functions[function.Name] = function
+	return nil
+}
+
+// Function returns the function of the database
+func (c *Cluster) Function(db, name string) (types.KustoFunction, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	d, ok := c.databases[db]
+	if !ok {
+		return types.KustoFunction{}, false
+	}
+	function, ok := d.functions[name]
+	return function, ok
+}
+
+// SetSchema sets the commands returned as the csl script of the database schema
+func (c *Cluster) SetSchema(db string, commands ...string) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	d, ok := c.databases[db]
+	if !ok {
+		return fmt.Errorf("database '%s' not found", db)
+	}
+	d.schema = commands
+	return nil
+}
+
+// Commands returns the control commands that were run on the cluster
+func (c *Cluster) Commands() []string {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return append([]string(nil), c.commands...)
+}
+
+// Close implements `io.Closer`
+func (c *Cluster) Close() error {
+	return nil
+}
+
+// Auth returns an empty authorization - the fake cluster isn't authenticated
+func (c *Cluster) Auth() kusto.Authorization {
+	return kusto.Authorization{}
+}
+
+// Endpoint returns the cluster uri
+func (c *Cluster) Endpoint() string {
+	return c.URI
+}
+
+// HttpClient returns a default http client
+func (c *Cluster) HttpClient() *http.Client {
+	return &http.Client{}
+}
+
+// Query isn't supported by the fake cluster
+func (c *Cluster) Query(ctx context.Context, db string, query kusto.Stmt, options ...kusto.QueryOption) (*kusto.RowIterator, error) {
+	return nil, fmt.Errorf("queries are not supported by the fake cluster: %s", query.String())
+}
+
+// Mgmt runs the control command on the cluster state
+func (c *Cluster) Mgmt(ctx context.Context, db string, query kusto.Stmt, options ...kusto.MgmtOption) (*kusto.RowIterator, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	command := strings.TrimSpace(query.String())
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.commands = append(c.commands, command)
+
+	switch {
+	case showDetailsRe.MatchString(command):
+		return c.showDatabasesDetails()
+	case showDatabasesRe.MatchString(command):
+		return c.showDatabases()
+	case showVersionRe.MatchString(command):
+		return rows(table.Columns{{Name: "BuildVersion", Type: ktypes.String}}, []string{"1.0.0.0"})
+	case showPolicyRe.MatchString(command):
+		m := showPolicyRe.FindStringSubmatch(command)
+		return c.showPolicy(db, entityTable(m[1], m[2]), m[3])
+	case alterFollowerRe.MatchString(command):
+		m := alterFollowerRe.FindStringSubmatch(command)
+		if d, ok := c.databases[m[1]]; ok && !d.follower {
+			return nil, fmt.Errorf("database '%s' is not a follower database", m[1])
+		}
+		var iter *kusto.RowIterator
+		for _, tableName := range tableNames(m[2]) {
+			var err error
+			if iter, err = c.alterPolicy(m[1], tableName, "caching", m[3]); err != nil {
+				return nil, err
+			}
+		}
+		return iter, nil
+	case alterPolicyRe.MatchString(command):
+		m := alterPolicyRe.FindStringSubmatch(command)
+		if err := c.writable(db); err != nil {
+			return nil, err
+		}
+		return c.alterPolicy(db, entityTable(m[1], m[2]), m[3], m[4])
+	case showFunctionRe.MatchString(command):
+		return c.showFunction(db, showFunctionRe.FindStringSubmatch(command)[1])
+	case createFunctionRe.MatchString(command):
+		m := createFunctionRe.FindStringSubmatch(command)
+		function := types.KustoFunction{Name: m[2], Parameters: m[3], Body: m[4]}
+		for _, p := range propertyRe.FindAllStringSubmatch(m[1], -1) {
+			switch p[1] {
+			case "docstring":
+				function.DocString = p[2]
+			case "folder":
+				function.Folder = p[2]
+			}
+		}
+		if err := c.writable(db); err != nil {
+			return nil, err
+		}
+		c.databases[db].functions[function.Name] = function
+		return c.showFunction(db, function.Name)
+	case showSchemaRe.MatchString(command):
+		name := showSchemaRe.FindStringSubmatch(command)[1]
+		d, ok := c.databases[name]
+		if !ok {
+			return nil, fmt.Errorf("database '%s' not found", name)
+		}
+		return rows(table.Columns{{Name: "DatabaseSchemaScript", Type: ktypes.String}}, column(d.schema)...)
+	}
+	return nil, fmt.Errorf("unsupported command: %s", command)
+}
+
+func (c *Cluster) showDatabases() (*kusto.RowIterator, error) {
+	names := make([]string, 0, len(c.databases))
+	for name := range c.databases {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return rows(table.Columns{{Name: "DatabaseName", Type: ktypes.String}}, column(names)...)
+}
+
+// showDatabasesDetails returns the name and access mode of the databases
+func (c *Cluster) showDatabasesDetails() (*kusto.RowIterator, error) {
+	names := make([]string, 0, len(c.databases))
+	for name := range c.databases {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	details := make([][]string, 0, len(names))
+	for _, name := range names {
+		mode := "ReadWrite"
+		if c.databases[name].follower {
+			mode = "ReadOnlyFollowing"
+		}
+		details = append(details, []string{name, mode})
+	}
+	return rows(table.Columns{{Name: "DatabaseName", Type: ktypes.String}, {Name: "DatabaseAccessMode", Type: ktypes.String}}, details...)
+}
+
+// writable returns an error if the database is missing or read-only
+func (c *Cluster) writable(db string) error {
+	d, ok := c.databases[db]
+	if !ok {
+		return fmt.Errorf("database '%s' not found", db)
+	}
+	if d.follower {
+		return fmt.Errorf("database '%s' is a read-only follower database", db)
+	}
+	return nil
+}
+
+func (c *Cluster) showPolicy(db, tableName, kind string) (*kusto.RowIterator, error) {
+	policies, err := c.policies(db, tableName)
+	if err != nil {
+		return nil, err
+	}
+	policy, ok := policies[kind]
+	if !ok {
+		policy = "null"
+	}
+	entityName, entityType := fmt.Sprintf("[%s]", db), "Database"
+	if tableName != "" {
+		entityName, entityType = fmt.Sprintf("[%s].[%s]", db, tableName), "Table"
+	}
+	columns := table.Columns{
+		{Name: "PolicyName", Type: ktypes.String},
+		{Name: "EntityName", Type: ktypes.String},
+		{Name: "Policy", Type: ktypes.String},
+		{Name: "ChildEntities", Type: ktypes.String},
+		{Name: "EntityType", Type: ktypes.String},
+	}
+	return rows(columns, []string{policyName(kind), entityName, policy, "[]", entityType})
+}
+
+func (c *Cluster) alterPolicy(db, tableName, kind, args string) (*kusto.RowIterator, error) {
+	policies, err := c.policies(db, tableName)
+	if err != nil {
+		return nil, err
+	}
+	args = strings.TrimSpace(args)
+	switch kind {
+	case "caching":
+		m := cachingHotRe.FindStringSubmatch(args)
+		if m == nil {
+			return nil, fmt.Errorf("invalid caching policy: %s", args)
+		}
+		hours, _ := strconv.Atoi(m[1])
+		if m[2] == "d" {
+			hours *= 24
+		}
+		policies[kind] = cachingPolicy(fmt.Sprintf("%d.%02d:00:00", hours/24, hours%24))
+	default:
+		policy := strings.TrimSpace(strings.Trim(args, "`"))
+		if !json.Valid([]byte(policy)) {
+			return nil, fmt.Errorf("invalid %s policy: %s", kind, args)
+		}
+		policies[kind] = policy
+	}
+	return c.showPolicy(db, tableName, kind)
+}
+
+func (c *Cluster) showFunction(db, name string) (*kusto.RowIterator, error) {
+	d, ok := c.databases[db]
+	if !ok {
+		return nil, fmt.Errorf("database '%s' not found", db)
+	}
+	function, ok := d.functions[name]
+	if !ok {
+		return nil, fmt.Errorf("function '%s' not found", name)
+	}
+	columns := table.Columns{
+		{Name: "Name", Type: ktypes.String},
+		{Name: "Parameters", Type: ktypes.String},
+		{Name: "Body", Type: ktypes.String},
+		{Name: "Folder", Type: ktypes.String},
+		{Name: "DocString", Type: ktypes.String},
+	}
+	return rows(columns, []string{function.Name, function.Parameters, function.Body, function.Folder, function.DocString})
+}
+
+// policies returns the policies of the table, or of the database if the table is empty
+func (c *Cluster) policies(db, tableName string) (map[string]string, error) {
+	d, ok := c.databases[db]
+	if !ok {
+		return nil, fmt.Errorf("database '%s' not found", db)
+	}
+	if tableName == "" {
+		return d.policies, nil
+	}
+	policies, ok := d.tables[tableName]
+	if !ok {
+		return nil, fmt.Errorf("table '%s' not found in database '%s'", tableName, db)
+	}
+	return policies, nil
+}
+
+// entityTable returns the table name of the policy entity, empty for a database
+func entityTable(entityType, name string) string {
+	if entityType == "database" {
+		return ""
+	}
+	return name
+}
+
+// tableNames returns the names of a table (plain or bracketed) or a list of tables, a single empty name for the database
+func tableNames(names string) []string {
+	list := strings.Split(strings.TrimSuffix(strings.TrimPrefix(names, "("), ")"), ",")
+	for i, name := range list {
+		list[i] = strings.TrimSuffix(strings.TrimPrefix(strings.TrimSpace(name), "['"), "']")
+	}
+	return list
+}
+
+// policyName returns the full name of the policy
+func policyName(kind string) string {
+	switch kind {
+	case "retention":
+		return string(types.Retention)
+	case "caching":
+		return string(types.Caching)
+	case "merge":
+		return string(types.ExtentsMerge)
+	}
+	return kind
+}
+
+// cachingPolicy returns the json of a caching policy with the hot span
+func cachingPolicy(span string) string {
+	return fmt.Sprintf(`{"DataHotSpan":{"Value":"%s"},"IndexHotSpan":{"Value":"%s"}}`, span, span)
+}
+
+// rows returns a mock row iterator over the rows of string values
+func rows(columns table.Columns, values ...[]string) (*kusto.RowIterator, error) {
+	mr, err := kusto.NewMockRows(columns)
+	if err != nil {
+		return nil, err
+	}
+	for _, cells := range values {
+		row := make(value.Values, 0, len(cells))
+		for _, cell := range cells {
+			row = append(row, value.String{Valid: true, Value: cell})
+		}
+		if err := mr.Row(row); err != nil {
+			return nil, err
+		}
+	}
+	iter := &kusto.RowIterator{}
+	if err := iter.Mock(mr); err != nil {
+		return nil, err
+	}
+	return iter, nil
+}
+
+// column returns the values as the rows of a single column
+func column(values []string) [][]string {
+	cells := make([][]string, 0, len(values))
+	for _, v := range values {
+		cells = append(cells, []string{v})
+	}
+	return cells
+}
@@ -31,7 +31,7 @@ type dbRetentionRecord struct {
 
 // GetTableCachingPolicy returns the caching policy of a table
 // it furst checks if a policy is defined on the table, if not it checks if a policy is defined on the database.
-func GetTableCachingPolicy(ctx context.Context, client *kusto.Client, database string, tableName string) (string, error) {
+func GetTableCachingPolicy(ctx context.Context, client QueryClient, database string, tableName string) (string, error) {
 	policy := &types.CachingPolicy{}
 	var err error
 	if tableName != "" {
@@ -49,7 +49,7 @@ func GetTableCachingPolicy(ctx context.Context, client *kusto.Client, database s
 
 // GetTableRetentionPolicy returns the retention policy of a table
 // it furst checks if a policy is defined on the table, if not it checks if a policy is defined on the database.
-func GetTableRetentionPolicy(ctx context.Context, client *kusto.Client, database string, tableName string) (*types.RetentionPolicy, error) {
+func GetTableRetentionPolicy(ctx context.Context, client QueryClient, database string, tableName string) (*types.RetentionPolicy, error) {
 	policy := &types.RetentionPolicy{}
 	var err error
 	if tableName != "" {
@@ -66,7 +66,7 @@ func GetTableRetentionPolicy(ctx context.Context, client *kusto.Client, database
 }
 
 // SetTableRetentionPolicy sets the retention policy of a table
-func SetTableRetentionPolicy(ctx context.Context, client *kusto.Client, database string, tableName string, policy *types.RetentionPolicy) (*types.RetentionPolicy, error) {
+func SetTableRetentionPolicy(ctx context.Context, client QueryClient, database string, tableName string, policy *types.RetentionPolicy) (*types.RetentionPolicy, error) {
 	policyStr, err := json.Marshal(policy)
 	if err != nil {
 		log.Error().Err(err).Msg("failed to marshal policy")
@@ -127,7 +127,7 @@ func SetTableRetentionPolicy(ctx context.Context, client *kusto.Client, database
 }
 
 // SetTableCachingPolicy sets the retention policy of a table
-func SetTableCachingPolicy(ctx context.Context, client *kusto.Client, database string, tableName string, policy string) (string, error) {
+func SetTableCachingPolicy(ctx context.Context, client QueryClient, database string, tableName string, policy string) (string, error) {
 	var stmtStr string
 	if tableName != "" {
 		stmtStr = fmt.Sprintf(".alter table %s policy caching hot = %s", tableName, policy)
@@ -185,7 +185,7 @@ func SetTableCachingPolicy(ctx context.Context, client *kusto.Client, database s
 
 // GetTablePolicy returns a requested policy of a table
 // it furst checks if a policy is defined on the table, if not it checks if a policy is defined on the database.
-func GetTablePolicy(ctx context.Context, client *kusto.Client, database string, tableName string, policy types.Policy) error {
+func GetTablePolicy(ctx context.Context, client QueryClient, database string, tableName string, policy types.Policy) error {
 	found := false
 	// check if a policy is defined on the table
 	stmt := kusto.NewStmt("", kusto.UnsafeStmt(unsafe.Stmt{Add: true, SuppressWarning: true})).UnsafeAdd(".show table " + tableName + " policy " + policy.GetShortName())
@@ -241,7 +241,7 @@ func GetTablePolicy(ctx context.Context, client *kusto.Client, database string,
 }
 
 // GetDatabasePolicy returns a requested policy of a table
-func GetDatabasePolicy(ctx context.Context, client *kusto.Client, database string, policy types.Policy) error {
+func GetDatabasePolicy(ctx context.Context, client QueryClient, database string, policy types.Policy) error {
 	dbstmt := kusto.NewStmt("", kusto.UnsafeStmt(unsafe.Stmt{Add: true, SuppressWarning: true})).UnsafeAdd(".show database " + database + " policy " + policy.GetShortName())
 	dbiterator, err := client.Mgmt(ctx, database, dbstmt)
 	if err != nil {
@@ -278,7 +278,7 @@ func GetDatabasePolicy(ctx context.Context, client *kusto.Client, database strin
 }
 
 // GetFunction returns a requested function
-func GetFunction(ctx context.Context, client *kusto.Client, database string, function types.KustoFunction, create bool) (*types.KustoFunction, error) {
+func GetFunction(ctx context.Context, client QueryClient, database string, function types.KustoFunction, create bool) (*types.KustoFunction, error) {
 	dbstmt := kusto.NewStmt("", kusto.UnsafeStmt(unsafe.Stmt{Add: true, SuppressWarning: true}))
 	if create {
 		dbstmt = dbstmt.UnsafeAdd(function.SetFunctionQuery())
@@ -22,6 +22,9 @@ var _ = Describe("Policymanager", Label("Policymanager"), Label("live"), func()
 	)
 
 	BeforeEach(func() {
+		if !liveTest {
+			Skip("requires a live cluster")
+		}
 		GinkgoWriter.Println("connecting to cluster: ", testCluster)
 		kcsb := kusto.NewConnectionStringBuilder(testCluster).WithDefaultAzureCredential()
 		client, err = kusto.New(kcsb)
@@ -84,6 +87,9 @@ var _ = Describe("Function Manager", Label("KustoFunctions"), Label("live"), fun
 	)
 
 	BeforeEach(func() {
+		if !liveTest {
+			Skip("requires a live cluster")
+		}
 		GinkgoWriter.Println("connecting to cluster: ", testCluster)
 		kcsb := kusto.NewConnectionStringBuilder(testCluster).WithDefaultAzureCredential()
 		client, err = kusto.New(kcsb)
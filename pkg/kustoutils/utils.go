@@ -11,11 +11,15 @@ import (
 
 	"io"
 	"net/http"
+	"os"
 
 	"github.com/Azure/azure-kusto-go/kusto"
 	"github.com/Azure/azure-kusto-go/kusto/data/errors"
 	"github.com/Azure/azure-kusto-go/kusto/data/table"
+	"github.com/Azure/azure-kusto-go/kusto/unsafe"
 	schemav1alpha1 "github.com/microsoft/azure-schema-operator/apis/dbschema/v1alpha1"
+	"github.com/microsoft/azure-schema-operator/pkg/clients"
+	"github.com/microsoft/azure-schema-operator/pkg/runlogs"
 	"github.com/rs/zerolog/log"
 	v1 "k8s.io/api/core/v1"
 )
@@ -36,119 +40,150 @@ type QueryClient interface {
 type KustoCluster struct {
 	URI       string
 	Databases []string
-	Client    QueryClient
-	// Client    *kusto.Client
+	// Client is used instead of the cached client when set (e.g. a mock client)
+	Client  QueryClient
 	wrapper *Wrapper
+	clients *clients.Cache
 }
 
-// NewKustoCluster returns a new KustoCluster object with a client initialized
-func NewKustoCluster(uri string) *KustoCluster {
-	cls := &KustoCluster{
+// NewKustoCluster returns a new KustoCluster object using the client cache for its clients
+func NewKustoCluster(uri string, cache *clients.Cache) *KustoCluster {
+	return &KustoCluster{
 		URI:     uri,
 		wrapper: NewDeltaWrapper(),
+		clients: cache,
 	}
+}
 
-	// a, err := auth.NewAuthorizerFromEnvironmentWithResource(uri)
-	// if err != nil {
-	// 	log.Error().Err(err).Msgf("failed to authorize from env to %s", uri)
-	// }
+// pooledClient adds a health check to the kusto client for the client cache
+type pooledClient struct {
+	*kusto.Client
+}
 
-	kcsb := kusto.NewConnectionStringBuilder(uri).WithDefaultAzureCredential()
-	client, err := kusto.New(kcsb)
-	// authorizer := kusto.Authorization{
-	// 	Authorizer: a,
-	// 	// Config: auth.NewClientCredentialsConfig(clientID, clientSecret, tenantID),
-	// }
+// PingContext checks the connectivity to the cluster
+func (p pooledClient) PingContext(ctx context.Context) error {
+	iter, err := p.Mgmt(ctx, "", kusto.NewStmt(".show version"))
+	if err != nil {
+		return err
+	}
+	iter.Stop()
+	return nil
+}
 
-	// client, err := kusto.New(uri, authorizer)
+// GetClient returns a kusto client for the cluster uri from the client cache.
+// The release func must be called once the client is no longer used.
+func GetClient(ctx context.Context, cache *clients.Cache, uri string) (*kusto.Client, func(), error) {
+	client, release, err := cache.Get(ctx, "kusto:"+uri, func(ctx context.Context) (io.Closer, error) {
+		kcsb := kusto.NewConnectionStringBuilder(uri).WithDefaultAzureCredential()
+		client, err := kusto.New(kcsb)
+		if err != nil {
+			log.Error().Err(err).Msgf("failed to connect to %s", uri)
+			return nil, err
+		}
+		return pooledClient{client}, nil
+	})
 	if err != nil {
-		log.Error().Err(err).Msgf("failed to connect to %s", uri)
+		return nil, nil, err
 	}
-	cls.Client = client
-	return cls
+	return client.(pooledClient).Client, release, nil
+}
+
+// ConnectFunc returns the kusto client of the cluster uri and the func releasing it
+type ConnectFunc func(ctx context.Context, uri string) (QueryClient, func(), error)
+
+// CachedConnect returns a `ConnectFunc` taking the clients from the client cache
+func CachedConnect(cache *clients.Cache) ConnectFunc {
+	return func(ctx context.Context, uri string) (QueryClient, func(), error) {
+		return GetClient(ctx, cache, uri)
+	}
+}
+
+// client returns the client to use for the cluster
+func (c *KustoCluster) client(ctx context.Context) (QueryClient, func(), error) {
+	if c.Client != nil {
+		return c.Client, func() {}, nil
+	}
+	return GetClient(ctx, c.clients, c.URI)
 }
 
 // AquireTargets filters the DBs in the cluster and matchs them with the filter to return DBs to execute on.
-func (c *KustoCluster) AquireTargets(filter schemav1alpha1.TargetFilter) (schemav1alpha1.ClusterTargets, error) {
+// Follower and read-only DBs can't be changed - they are returned as skipped targets.
+func (c *KustoCluster) AquireTargets(ctx context.Context, filter schemav1alpha1.TargetFilter) (schemav1alpha1.ClusterTargets, error) {
 	var targets schemav1alpha1.ClusterTargets
 	var dbs []string
-	var err error
 
+	details, err := c.DatabaseDetails(ctx)
+	if err != nil {
+		log.Error().Err(err).Msg("failed retriving list of dbs from cluster")
+		return targets, err
+	}
 	// b.1. get filtered list of dbs to execute on
 	// TODO: Consider extracting this to the Cluster as a filter object
 	if filter.DB != "" {
-		dbs, err = c.ListDatabases(filter.DB)
+		dbs, err = matchDatabases(details, filter.DB)
 	} else if len(filter.DBS) > 0 {
 		// TODO: maybe change this to a filter instead of setting
 		dbs = filter.DBS
 	} else if filter.Webhook != "" {
 		client := NewWebHookClient(nil)
-		dbs, err = client.PerformQuery(filter.Webhook, ClusterNameFromURI(c.URI), filter.Label)
+		dbs, err = client.PerformQuery(ctx, filter.Webhook, ClusterNameFromURI(c.URI), filter.Label)
 	} else {
 		log.Info().Msg("Missing db filter - taking all dbs in the cluster")
-		dbs, err = c.ListDatabases("")
+		dbs, err = matchDatabases(details, "")
 	}
 	if err != nil {
 		log.Error().Err(err).Msg("failed retriving list of dbs from cluster")
 		return targets, err
 	}
-	targets.DBs = dbs
-	return targets, err
+	targets = skipReadOnly(dbs, details)
+	for _, skipped := range targets.Skipped {
+		log.Info().Msgf("skipping %s on %s: %s", skipped.DB, c.URI, skipped.Message)
+	}
+	return targets, nil
 }
 
 // ListDatabases lists kusto databases matching the regexp expression.
-func (c *KustoCluster) ListDatabases(expression string) ([]string, error) {
-
-	ctx := context.Background()
-	nameFilter, err := regexp.Compile(expression)
+func (c *KustoCluster) ListDatabases(ctx context.Context, expression string) ([]string, error) {
+	details, err := c.DatabaseDetails(ctx)
 	if err != nil {
-		log.Error().Err(err).Msgf("parameter proveded is not a valid regexp: %s", expression)
 		return nil, err
 	}
+	return matchDatabases(details, expression)
+}
 
-	dbs := make([]string, 0)
-
-	iter, err := c.Client.Mgmt(ctx, "", kusto.NewStmt(".show databases | project DatabaseName"))
+// matchDatabases returns the names of the databases matching the regexp expression
+func matchDatabases(details []DatabaseDetails, expression string) ([]string, error) {
+	nameFilter, err := regexp.Compile(expression)
 	if err != nil {
-		log.Error().Err(err).Msg("Failed to query mgmt api")
+		log.Error().Err(err).Msgf("parameter proveded is not a valid regexp: %s", expression)
 		return nil, err
 	}
-	defer iter.Stop()
-
-	// .DoOnRowOrError() will call the function for every row in the table.
-	err = iter.DoOnRowOrError(
-		func(row *table.Row, inlineError *errors.Error) error {
-			if row != nil {
-				dbName := row.Values[0].String()
-				if nameFilter.MatchString(dbName) {
-					dbs = append(dbs, dbName)
-					// log.Debug().Msgf("dbname passed filter: %s", dbName)
-				}
-			} else {
-				// ignore inline errors - not relevant for this use case
-				log.Error().Msgf("got inline error: %s", inlineError.Error())
-			}
-			// log.Debug().Msgf("dbname: %s", dbName)
-			return nil
-		},
-	)
-	if err != nil {
-		log.Error().Err(err).Msg("failed to iterate results")
-		return nil, err
+	dbs := make([]string, 0)
+	for _, d := range details {
+		if nameFilter.MatchString(d.DatabaseName) {
+			dbs = append(dbs, d.DatabaseName)
+		}
 	}
 	return dbs, nil
 }
 
-// Execute runs the `ExecutionConfiguration` on the provided targets
-func (c *KustoCluster) Execute(targets schemav1alpha1.ClusterTargets, config schemav1alpha1.ExecutionConfiguration) (schemav1alpha1.ClusterTargets, error) {
+// Execute runs the `ExecutionConfiguration` on the provided targets, returning the executed DBs.
+// delta-kusto runs the DBs in a single job - none is reported as executed if it failed.
+func (c *KustoCluster) Execute(ctx context.Context, targets schemav1alpha1.ClusterTargets, config schemav1alpha1.ExecutionConfiguration) (schemav1alpha1.ClusterTargets, error) {
 	done := schemav1alpha1.ClusterTargets{}
-	err := RunDeltaKusto(config.JobFile)
-
+	if len(targets.DBs) > 0 {
+		err := RunDeltaKusto(ctx, config.JobFile, runlogs.FromContext(ctx).Output(runlogs.ClusterTarget))
+		if err != nil {
+			return done, err
+		}
+		done.DBs = append(done.DBs, targets.DBs...)
+	}
+	err := c.applyFollowerPolicies(ctx, targets.Skipped, config.KQLFile, runlogs.FromContext(ctx).Output(runlogs.ClusterTarget))
 	return done, err
 }
 
 // CreateExecConfiguration creates execution configuration for the given targets and `ConfigMap` configuration.
-func (c *KustoCluster) CreateExecConfiguration(targets schemav1alpha1.ClusterTargets, cfgMap *v1.ConfigMap, failIfDataLoss bool) (schemav1alpha1.ExecutionConfiguration, error) {
+func (c *KustoCluster) CreateExecConfiguration(ctx context.Context, targets schemav1alpha1.ClusterTargets, cfgMap *v1.ConfigMap, failIfDataLoss bool) (schemav1alpha1.ExecutionConfiguration, error) {
 	config := schemav1alpha1.ExecutionConfiguration{}
 	kql, ok := cfgMap.Data["kql"]
 	if !ok {
@@ -209,3 +244,108 @@ func ConvertTimeFormat(input string) string {
 		return fmt.Sprintf("%dh", totalHours)
 	}
 }
+
+type schemaScriptRecord struct {
+	Script string `kusto:"DatabaseSchemaScript"`
+}
+
+// DeltaScript returns the commands delta-kusto would run to bring the database to the kql schema, empty if it is up to date.
+// The delta is computed by delta-kusto (current database vs target kql) without changing the database.
+func (c *KustoCluster) DeltaScript(ctx context.Context, db string, kql string) (string, error) {
+	kqlFile, err := StoreKQLSchemaToFile(kql)
+	if err != nil {
+		return "", err
+	}
+	defer os.Remove(kqlFile)
+	script, err := os.CreateTemp("", "delta-*.kql")
+	if err != nil {
+		return "", err
+	}
+	script.Close()
+	defer os.Remove(script.Name())
+	cfgFile, err := c.wrapper.CreateScriptConfiguration(c.URI, db, kqlFile, script.Name())
+	if err != nil {
+		log.Error().Err(err).Msg("failed generating delta kusto configuration file")
+		return "", err
+	}
+	defer os.Remove(cfgFile)
+	output := &strings.Builder{}
+	if err = RunDeltaKusto(ctx, cfgFile, output); err != nil {
+		return "", fmt.Errorf("%w: %s", err, strings.TrimSpace(output.String()))
+	}
+	content, err := os.ReadFile(script.Name())
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimSpace(string(content)), nil
+}
+
+// ExportScript returns the current schema of the database (tables, functions, mappings and policies)
+// as a canonical KQL script that can be deployed back on the database.
+func (c *KustoCluster) ExportScript(ctx context.Context, db string) (string, error) {
+	commands, err := c.schemaCommands(ctx, db)
+	if err != nil {
+		return "", err
+	}
+	return CanonicalScript(commands), nil
+}
+
+// CanonicalScript formats the commands as a script - trailing spaces are trimmed and the commands are separated by an empty line.
+func CanonicalScript(commands []string) string {
+	script := &strings.Builder{}
+	for _, command := range commands {
+		lines := strings.Split(strings.TrimSpace(command), "\n")
+		for i := range lines {
+			lines[i] = strings.TrimRight(lines[i], " \t\r")
+		}
+		command = strings.Join(lines, "\n")
+		if command == "" {
+			continue
+		}
+		if script.Len() > 0 {
+			script.WriteString("\n")
+		}
+		script.WriteString(command)
+		script.WriteString("\n")
+	}
+	return script.String()
+}
+
+// schemaCommands returns the commands creating the current schema of the database
+func (c *KustoCluster) schemaCommands(ctx context.Context, db string) ([]string, error) {
+	client, release, err := c.client(ctx)
+	if err != nil {
+		log.Error().Err(err).Msg("Failed to get the kusto client")
+		return nil, err
+	}
+	defer release()
+
+	stmtStr := fmt.Sprintf(".show database ['%s'] schema as csl script", strings.ReplaceAll(db, "'", "\\'"))
+	stmt := kusto.NewStmt("", kusto.UnsafeStmt(unsafe.Stmt{Add: true, SuppressWarning: true})).UnsafeAdd(stmtStr)
+	iter, err := client.Mgmt(ctx, db, stmt)
+	if err != nil {
+		log.Error().Err(err).Msgf("failed to get the schema of %s", db)
+		return nil, err
+	}
+	defer iter.Stop()
+
+	var commands []string
+	err = iter.DoOnRowOrError(
+		func(row *table.Row, inlineError *errors.Error) error {
+			if row == nil {
+				return inlineError
+			}
+			rec := schemaScriptRecord{}
+			if err := row.ToStruct(&rec); err != nil {
+				return err
+			}
+			commands = append(commands, rec.Script)
+			return nil
+		},
+	)
+	if err != nil {
+		log.Error().Err(err).Msgf("failed to read the schema of %s", db)
+		return nil, err
+	}
+	return commands, nil
+}
@@ -74,7 +74,7 @@ var _ = Describe("Utils", func() {
 				Client: client,
 			}
 			expression := ".*"
-			dbs, err := mockClient.ListDatabases(expression)
+			dbs, err := mockClient.ListDatabases(context.Background(), expression)
 			Expect(err).NotTo(HaveOccurred())
 			fmt.Fprintf(GinkgoWriter, "List of DBs in Mock Cluster: %+v \n", dbs)
 			Expect(dbs).To(HaveLen(2))
@@ -85,7 +85,7 @@ var _ = Describe("Utils", func() {
 				Client: client,
 			}
 			expression := "tenant_1"
-			dbs, err := mockClient.ListDatabases(expression)
+			dbs, err := mockClient.ListDatabases(context.Background(), expression)
 			Expect(err).NotTo(HaveOccurred())
 			fmt.Fprintf(GinkgoWriter, "List of DBs in Mock Cluster: %+v \n", dbs)
 			Expect(dbs).To(HaveLen(1))
@@ -96,7 +96,7 @@ var _ = Describe("Utils", func() {
 				Client: client,
 			}
 			expression := "db_1"
-			dbs, err := mockClient.ListDatabases(expression)
+			dbs, err := mockClient.ListDatabases(context.Background(), expression)
 			Expect(err).NotTo(HaveOccurred())
 			fmt.Fprintf(GinkgoWriter, "List of DBs in Mock Cluster: %+v \n", dbs)
 			Expect(dbs).To(BeEmpty())
@@ -109,7 +109,7 @@ var _ = Describe("Utils", func() {
 			filter := schemav1alpha1.TargetFilter{
 				DB: "tenant_1",
 			}
-			targets, err := mockClient.AquireTargets(filter)
+			targets, err := mockClient.AquireTargets(context.Background(), filter)
 			Expect(err).NotTo(HaveOccurred())
 
 			Expect(targets.DBs).To(HaveLen(1))
@@ -120,7 +120,7 @@ var _ = Describe("Utils", func() {
 				Client: client,
 			}
 			filter := schemav1alpha1.TargetFilter{}
-			targets, err := mockClient.AquireTargets(filter)
+			targets, err := mockClient.AquireTargets(context.Background(), filter)
 			Expect(err).NotTo(HaveOccurred())
 
 			Expect(targets.DBs).To(HaveLen(2))
@@ -130,12 +130,12 @@ var _ = Describe("Utils", func() {
 	if liveTest {
 		Context("when testing kusto with a live server", func() {
 			ClusterUri := testCluster
-			cluster := kustoutils.NewKustoCluster(ClusterUri)
+			cluster := kustoutils.NewKustoCluster(ClusterUri, nil)
 			filter := schemav1alpha1.TargetFilter{
 				DB: "db1948",
 			}
 			It("Should acquire requested targets and prepare for execution", func() {
-				clusterTargets, err := cluster.AquireTargets(filter)
+				clusterTargets, err := cluster.AquireTargets(context.Background(), filter)
 				Expect(err).NotTo(HaveOccurred())
 				Expect(clusterTargets.DBs).To(HaveLen(1))
 			})
@@ -169,5 +169,17 @@ var _ = Describe("Utils", func() {
 			Expect(convertedTime).To(Equal(expectedTime))
 
 		})
+		It("should format the schema commands as a canonical script", func() {
+			script := kustoutils.CanonicalScript([]string{
+				".create-merge table T (a:string) with (folder = \"\") ",
+				"",
+				".create-or-alter function F() {  \r\n    T | take 10\n}\n",
+				".alter table T policy retention @'{\"SoftDeletePeriod\": \"7.00:00:00\"}'",
+			})
+			Expect(script).To(Equal(".create-merge table T (a:string) with (folder = \"\")\n" +
+				"\n.create-or-alter function F() {\n    T | take 10\n}\n" +
+				"\n.alter table T policy retention @'{\"SoftDeletePeriod\": \"7.00:00:00\"}'\n"))
+			Expect(kustoutils.CanonicalScript(nil)).To(BeEmpty())
+		})
 	})
 })
@@ -4,6 +4,7 @@ package kustoutils
 // Licensed under the MIT License.
 import (
 	"bytes"
+	"context"
 	"encoding/json"
 	"errors"
 	"fmt"
@@ -22,12 +23,15 @@ type WebHookClient struct {
 // Query holds the query parameters for the webhook
 type Query struct {
 	Cluster string
+	DB      string
 	Label   string
 }
 
 // Response is the expected Webhook response
+// `dbs` is used to discover Kusto databases and `schemas` to discover SQL Server schemas.
 type Response struct {
-	DBS []string `json:"dbs"`
+	DBS     []string `json:"dbs"`
+	Schemas []string `json:"schemas,omitempty"`
 }
 
 // NewWebHookClient creates a new `WebHookClient`
@@ -40,32 +44,54 @@ func NewWebHookClient(httpClient *http.Client) *WebHookClient {
 	}
 }
 
-// PerformQuery calls the webhook with the provided parameters
-func (c *WebHookClient) PerformQuery(url, server, label string) ([]string, error) {
-	a := Query{Cluster: server, Label: label}
+// PerformQuery calls the webhook with the provided parameters and returns the DBs
+func (c *WebHookClient) PerformQuery(ctx context.Context, url, server, label string) ([]string, error) {
+	res, err := c.query(ctx, url, Query{Cluster: server, Label: label})
+	return res.DBS, err
+}
+
+// PerformSchemaQuery calls the webhook with the provided parameters and returns the schemas of the DB
+func (c *WebHookClient) PerformSchemaQuery(ctx context.Context, url, server, db, label string) ([]string, error) {
+	res, err := c.query(ctx, url, Query{Cluster: server, DB: db, Label: label})
+	return res.Schemas, err
+}
+
+func (c *WebHookClient) query(ctx context.Context, url string, a Query) (Response, error) {
+	res := Response{}
 	buf := &bytes.Buffer{}
-	fmt.Printf("teamplte to use: %s", url)
-	t := template.Must(template.New("t2").Parse(url))
-	err := t.Execute(buf, a)
+	log.Debug().Msgf("template to use: %s", url)
+	t, err := template.New("t2").Parse(url)
+	if err != nil {
+		log.Error().Err(err).Msg("Failed to parse the url query template - please review the template")
+		return res, err
+	}
+	err = t.Execute(buf, a)
 	if err != nil {
 		log.Error().Err(err).Msg("Failed to execute the url query template - please review the template")
-		return nil, err
+		return res, err
 	}
-	r, err := http.NewRequest(http.MethodGet, buf.String(), nil)
+	r, err := http.NewRequestWithContext(ctx, http.MethodGet, buf.String(), nil)
 	if err != nil {
 		log.Error().Err(err).Msg("Failed to generate http request")
-		return nil, err
+		return res, err
 	}
 	resp, err := c.HttpClient.Do(r)
 	if err != nil {
-		log.Error().Err(err).Msg("Failed to get db list from web-hool")
-		return nil, err
+		log.Error().Err(err).Msg("Failed to get target list from web-hook")
+		return res, err
 	}
+	defer resp.Body.Close()
 	if resp.StatusCode == http.StatusUnauthorized {
-		return nil, errors.New("Unauthorized")
+		return res, errors.New("Unauthorized")
+	}
+	if resp.StatusCode != http.StatusOK {
+		return res, fmt.Errorf("web-hook returned unexpected status: %s", resp.Status)
+	}
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		log.Error().Err(err).Msg("Failed to read the web-hook response")
+		return res, err
 	}
-	body, _ := io.ReadAll(resp.Body)
-	res := Response{}
 	err = json.Unmarshal(body, &res)
-	return res.DBS, err
+	return res, err
 }
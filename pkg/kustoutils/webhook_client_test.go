@@ -3,6 +3,7 @@ package kustoutils_test
 // Copyright (c) Microsoft Corporation.
 // Licensed under the MIT License.
 import (
+	"context"
 	"encoding/json"
 	"fmt"
 	"net/http"
@@ -14,7 +15,8 @@ import (
 )
 
 type Filtered struct {
-	DBS []string `json:"dbs"`
+	DBS     []string `json:"dbs"`
+	Schemas []string `json:"schemas,omitempty"`
 }
 
 var _ = Describe("Server-side Request handling", func() {
@@ -47,6 +49,9 @@ var _ = Describe("Server-side Request handling", func() {
 			} else {
 				ret.DBS = []string{"db1938", "db2020"}
 			}
+			if db, ok := query["db"]; ok {
+				ret.Schemas = []string{db[0] + "_tenant1"}
+			}
 
 			w.WriteHeader(200)
 			w.Header().Set("Content-Type", "application/json")
@@ -67,11 +72,23 @@ var _ = Describe("Server-side Request handling", func() {
 
 	It("Checks the resource path", func() {
 		url := srv.URL + "/dbs?cluster={{.Cluster}}&label={{.Label}}"
-		dbs, err := c.PerformQuery(url, "test-cluster", "delux")
+		dbs, err := c.PerformQuery(context.Background(), url, "test-cluster", "delux")
 		Expect(err).ToNot(HaveOccurred())
 		Expect(dbs).To(HaveLen(2))
 	})
 
+	It("Queries the schemas of a DB", func() {
+		url := srv.URL + "/schemas?cluster={{.Cluster}}&db={{.DB}}&label={{.Label}}"
+		schemas, err := c.PerformSchemaQuery(context.Background(), url, "test-cluster", "db1", "delux")
+		Expect(err).ToNot(HaveOccurred())
+		Expect(schemas).To(Equal([]string{"db1_tenant1"}))
+	})
+
+	It("Fails on an invalid url template", func() {
+		_, err := c.PerformQuery(context.Background(), srv.URL+"/dbs?cluster={{.Cluster", "test-cluster", "delux")
+		Expect(err).To(HaveOccurred())
+	})
+
 	// Context("Use a different handler", func() {
 	// 	BeforeEach(func() {
 	// 		handler = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
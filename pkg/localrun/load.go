@@ -0,0 +1,141 @@
+package localrun
+
+// Copyright (c) Microsoft Corporation.
+// Licensed under the MIT License.
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/serializer"
+	"k8s.io/apimachinery/pkg/types"
+	utilyaml "k8s.io/apimachinery/pkg/util/yaml"
+	clientgoscheme "k8s.io/client-go/kubernetes/scheme"
+
+	schemav1alpha1 "github.com/microsoft/azure-schema-operator/apis/dbschema/v1alpha1"
+	"github.com/microsoft/azure-schema-operator/pkg/schemafiles"
+)
+
+// Scheme is the scheme of the objects read from disk
+var Scheme = runtime.NewScheme()
+
+func init() {
+	_ = clientgoscheme.AddToScheme(Scheme)
+	_ = schemav1alpha1.AddToScheme(Scheme)
+}
+
+// Deployment is a schema deployment with its source `ConfigMap`
+type Deployment struct {
+	Template *schemav1alpha1.SchemaDeployment
+	Source   *v1.ConfigMap
+}
+
+// Manifests are the schema deployments and `ConfigMaps` read from disk
+type Manifests struct {
+	Deployments []*schemav1alpha1.SchemaDeployment
+	ConfigMaps  []*v1.ConfigMap
+}
+
+// LoadFiles reads the schema deployments and `ConfigMaps` of the YAML (or JSON) manifest files, other kinds are ignored.
+// Objects without a namespace are set to `namespace`.
+func LoadFiles(paths []string, namespace string) (*Manifests, error) {
+	manifests := &Manifests{}
+	for _, path := range paths {
+		f, err := os.Open(path)
+		if err != nil {
+			return nil, err
+		}
+		err = manifests.read(f, namespace)
+		f.Close()
+		if err != nil {
+			return nil, fmt.Errorf("unable to read %s: %w", path, err)
+		}
+	}
+	return manifests, nil
+}
+
+// read adds the objects of the (multi document) manifest
+func (m *Manifests) read(r io.Reader, namespace string) error {
+	decoder := serializer.NewCodecFactory(Scheme).UniversalDeserializer()
+	reader := utilyaml.NewYAMLReader(bufio.NewReader(r))
+	for {
+		doc, err := reader.Read()
+		if errors.Is(err, io.EOF) {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		if len(bytes.TrimSpace(doc)) == 0 {
+			continue
+		}
+		obj, _, err := decoder.Decode(doc, nil, nil)
+		if runtime.IsNotRegisteredError(err) {
+			continue
+		}
+		if err != nil {
+			return err
+		}
+		switch o := obj.(type) {
+		case *schemav1alpha1.SchemaDeployment:
+			if o.Namespace == "" {
+				o.Namespace = namespace
+			}
+			m.Deployments = append(m.Deployments, o)
+		case *v1.ConfigMap:
+			if o.Namespace == "" {
+				o.Namespace = namespace
+			}
+			m.ConfigMaps = append(m.ConfigMaps, o)
+		}
+	}
+}
+
+// ConfigMap returns the `ConfigMap` by name
+func (m *Manifests) ConfigMap(name types.NamespacedName) *v1.ConfigMap {
+	for _, cfgMap := range m.ConfigMaps {
+		if cfgMap.Name == name.Name && cfgMap.Namespace == name.Namespace {
+			return cfgMap
+		}
+	}
+	return nil
+}
+
+// Resolve returns the deployments with their sources.
+// The schema file (or directory of KQL files), if set, is written into the source of the single deployment.
+func (m *Manifests) Resolve(schemaFile string) ([]Deployment, error) {
+	if len(m.Deployments) == 0 {
+		return nil, errors.New("no schema deployments found")
+	}
+	if schemaFile != "" && len(m.Deployments) > 1 {
+		return nil, errors.New("a schema file can only be used with a single schema deployment")
+	}
+	deployments := make([]Deployment, 0, len(m.Deployments))
+	for _, template := range m.Deployments {
+		sourceName := types.NamespacedName(template.Spec.Source)
+		if sourceName.Namespace == "" {
+			sourceName.Namespace = template.Namespace
+		}
+		source := m.ConfigMap(sourceName)
+		if schemaFile != "" {
+			if source == nil {
+				source = &v1.ConfigMap{}
+				source.Name, source.Namespace = sourceName.Name, sourceName.Namespace
+				m.ConfigMaps = append(m.ConfigMaps, source)
+			}
+			if err := schemafiles.Apply(source, schemaFile, template.Spec.Type); err != nil {
+				return nil, err
+			}
+		}
+		if source == nil {
+			return nil, fmt.Errorf("the source %s of %s wasn't found - add its manifest or a schema file", sourceName, template.Name)
+		}
+		deployments = append(deployments, Deployment{Template: template, Source: source})
+	}
+	return deployments, nil
+}
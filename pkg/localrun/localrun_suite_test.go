@@ -0,0 +1,15 @@
+package localrun_test
+
+// Copyright (c) Microsoft Corporation.
+// Licensed under the MIT License.
+import (
+	"testing"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+func TestLocalrun(t *testing.T) {
+	RegisterFailHandler(Fail)
+	RunSpecs(t, "Localrun Suite")
+}
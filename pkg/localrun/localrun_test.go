@@ -0,0 +1,196 @@
+package localrun_test
+
+// Copyright (c) Microsoft Corporation.
+// Licensed under the MIT License.
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"time"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	v1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	schemav1alpha1 "github.com/microsoft/azure-schema-operator/apis/dbschema/v1alpha1"
+	"github.com/microsoft/azure-schema-operator/pkg/cluster"
+	"github.com/microsoft/azure-schema-operator/pkg/localrun"
+	"github.com/microsoft/azure-schema-operator/pkg/runlogs"
+	"github.com/microsoft/azure-schema-operator/pkg/schemafiles"
+)
+
+const manifest = `
+apiVersion: dbschema.microsoft.com/v1alpha1
+kind: SchemaDeployment
+metadata:
+  name: tenants
+spec:
+  type: kusto
+  applyTo:
+    clusterUris:
+      - https://cluster1.westeurope.kusto.windows.net
+      - https://cluster2.westeurope.kusto.windows.net
+    db: "^tenant"
+  source:
+    name: tenants-source
+  failIfDataLoss: true
+---
+apiVersion: v1
+kind: ConfigMap
+metadata:
+  name: tenants-source
+data:
+  kql: ".create-merge table T (a:string)"
+---
+apiVersion: v1
+kind: Secret
+metadata:
+  name: ignored
+`
+
+// fakeCluster matches the DBs and records the executions
+type fakeCluster struct {
+	uri      string
+	dbs      []string
+	err      error
+	executed *[]string
+}
+
+func (f *fakeCluster) AquireTargets(ctx context.Context, filter schemav1alpha1.TargetFilter) (schemav1alpha1.ClusterTargets, error) {
+	Expect(filter.ClusterUris).To(Equal([]string{f.uri}))
+	return schemav1alpha1.ClusterTargets{DBs: f.dbs}, nil
+}
+
+func (f *fakeCluster) CreateExecConfiguration(ctx context.Context, targets schemav1alpha1.ClusterTargets, cfgMap *v1.ConfigMap, failIfDataLoss bool) (schemav1alpha1.ExecutionConfiguration, error) {
+	return schemav1alpha1.ExecutionConfiguration{KQLFile: cfgMap.Data[schemafiles.KQLKey]}, nil
+}
+
+func (f *fakeCluster) Execute(ctx context.Context, targets schemav1alpha1.ClusterTargets, config schemav1alpha1.ExecutionConfiguration) (schemav1alpha1.ClusterTargets, error) {
+	for _, db := range targets.DBs {
+		_, _ = runlogs.FromContext(ctx).Output(db).Write([]byte(config.KQLFile))
+	}
+	*f.executed = append(*f.executed, f.uri)
+	if f.err != nil {
+		return schemav1alpha1.ClusterTargets{}, f.err
+	}
+	return targets, nil
+}
+
+var _ = Describe("Localrun", func() {
+	var dir string
+	var executed []string
+
+	BeforeEach(func() {
+		dir = GinkgoT().TempDir()
+		executed = nil
+	})
+
+	newRunner := func(failOn string) *localrun.Runner {
+		return &localrun.Runner{
+			NewCluster: func(dbType schemav1alpha1.DBTypeEnum, uri string) (cluster.Cluster, error) {
+				Expect(dbType).To(Equal(schemav1alpha1.DBTypeKusto))
+				f := &fakeCluster{uri: uri, dbs: []string{"tenant1", "tenant2"}, executed: &executed}
+				if uri == failOn {
+					f.err = errors.New("execution failed")
+				}
+				return f, nil
+			},
+		}
+	}
+
+	load := func(schemaFile string) []localrun.Deployment {
+		path := filepath.Join(dir, "deploy.yaml")
+		Expect(os.WriteFile(path, []byte(manifest), 0o600)).To(Succeed())
+		manifests, err := localrun.LoadFiles([]string{path}, "apps")
+		Expect(err).NotTo(HaveOccurred())
+		deployments, err := manifests.Resolve(schemaFile)
+		Expect(err).NotTo(HaveOccurred())
+		return deployments
+	}
+
+	It("loads the deployments with their sources", func() {
+		deployments := load("")
+		Expect(deployments).To(HaveLen(1))
+		Expect(deployments[0].Template.Namespace).To(Equal("apps"))
+		Expect(deployments[0].Source.Namespace).To(Equal("apps"))
+		Expect(deployments[0].Source.Data[schemafiles.KQLKey]).To(ContainSubstring("create-merge"))
+	})
+
+	It("writes the schema file into the source", func() {
+		schemaFile := filepath.Join(dir, "schema.kql")
+		Expect(os.WriteFile(schemaFile, []byte(".create-merge table U (b:int)"), 0o600)).To(Succeed())
+		deployments := load(schemaFile)
+		Expect(deployments[0].Source.Data[schemafiles.KQLKey]).To(ContainSubstring("table U"))
+	})
+
+	It("fails without a source", func() {
+		manifests := &localrun.Manifests{Deployments: []*schemav1alpha1.SchemaDeployment{load("")[0].Template}}
+		_, err := manifests.Resolve("")
+		Expect(err).To(HaveOccurred())
+	})
+
+	It("serves the configMaps of the manifests read-only", func() {
+		path := filepath.Join(dir, "deploy.yaml")
+		Expect(os.WriteFile(path, []byte(manifest), 0o600)).To(Succeed())
+		manifests, err := localrun.LoadFiles([]string{path}, "apps")
+		Expect(err).NotTo(HaveOccurred())
+		reader := manifests.Reader()
+
+		cfgMap := &v1.ConfigMap{}
+		Expect(reader.Get(context.Background(), types.NamespacedName{Namespace: "apps", Name: "tenants-source"}, cfgMap)).To(Succeed())
+		Expect(cfgMap.Data[schemafiles.KQLKey]).To(ContainSubstring("create-merge"))
+		cfgMap.Data[schemafiles.KQLKey] = "changed"
+		Expect(manifests.ConfigMaps[0].Data[schemafiles.KQLKey]).To(ContainSubstring("create-merge"))
+
+		err = reader.Get(context.Background(), types.NamespacedName{Namespace: "default", Name: "tenants-source"}, cfgMap)
+		Expect(apierrors.IsNotFound(err)).To(BeTrue())
+		Expect(reader.Get(context.Background(), types.NamespacedName{Namespace: "apps", Name: "tenants"}, &schemav1alpha1.SchemaDeployment{})).NotTo(Succeed())
+
+		list := &v1.ConfigMapList{}
+		Expect(reader.List(context.Background(), list, client.InNamespace("apps"))).To(Succeed())
+		Expect(list.Items).To(HaveLen(1))
+		Expect(reader.List(context.Background(), list, client.InNamespace("default"))).To(Succeed())
+		Expect(list.Items).To(BeEmpty())
+	})
+
+	It("runs the deployment on each cluster", func() {
+		runner := newRunner("https://cluster2.westeurope.kusto.windows.net")
+		runner.Logs = runlogs.NewFileStore(filepath.Join(dir, "logs"))
+		results := runner.Run(context.Background(), load("")[0])
+		Expect(executed).To(HaveLen(2))
+		Expect(results).To(HaveLen(2))
+		Expect(results[0].Err).NotTo(HaveOccurred())
+		Expect(results[0].Done.DBs).To(ConsistOf("tenant1", "tenant2"))
+		Expect(results[0].Logs).NotTo(BeEmpty())
+		Expect(results[1].Err).To(MatchError("execution failed"))
+
+		logs, err := runner.Logs.Get(context.Background(), runlogs.Key("apps", "tenants-cluster1", "tenant1"))
+		Expect(err).NotTo(HaveOccurred())
+		Expect(string(logs)).To(ContainSubstring("create-merge"))
+	})
+
+	It("stops at the deadline of the caller without an execution timeout", func() {
+		runner := newRunner("")
+		ctx, cancel := context.WithDeadline(context.Background(), time.Now().Add(-time.Second))
+		defer cancel()
+		results := runner.Run(ctx, load("")[0])
+		Expect(results).To(HaveLen(2))
+		Expect(errors.Is(results[0].Err, context.DeadlineExceeded)).To(BeTrue())
+		Expect(results[0].Err).To(MatchError(ContainSubstring("execution stopped")))
+	})
+
+	It("only prepares the execution on dry runs", func() {
+		runner := newRunner("")
+		runner.DryRun = true
+		runner.Clusters = []string{"https://test.westeurope.kusto.windows.net"}
+		results := runner.Run(context.Background(), load("")[0])
+		Expect(executed).To(BeEmpty())
+		Expect(results).To(HaveLen(1))
+		Expect(results[0].Cluster).To(Equal("https://test.westeurope.kusto.windows.net"))
+		Expect(results[0].Targets.DBs).To(HaveLen(2))
+	})
+})
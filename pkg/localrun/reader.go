@@ -0,0 +1,58 @@
+package localrun
+
+// Copyright (c) Microsoft Corporation.
+// Licensed under the MIT License.
+import (
+	"context"
+	"fmt"
+
+	v1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/labels"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+// manifestReader is a read-only `client.Reader` serving the `ConfigMaps` of the manifests
+type manifestReader struct {
+	manifests *Manifests
+}
+
+// Reader returns a read-only client serving the `ConfigMaps` of the manifests, e.g. the external dacpacs referenced by the sources
+func (m *Manifests) Reader() client.Reader {
+	return &manifestReader{manifests: m}
+}
+
+// Get returns the `ConfigMap` by its key, other kinds aren't served
+func (r *manifestReader) Get(ctx context.Context, key client.ObjectKey, obj client.Object, opts ...client.GetOption) error {
+	cfgMap, ok := obj.(*v1.ConfigMap)
+	if !ok {
+		return fmt.Errorf("only configMaps are read from the manifests, got %T", obj)
+	}
+	found := r.manifests.ConfigMap(key)
+	if found == nil {
+		return apierrors.NewNotFound(v1.Resource("configmaps"), key.Name)
+	}
+	found.DeepCopyInto(cfgMap)
+	return nil
+}
+
+// List returns the `ConfigMaps` of the namespace (or of all namespaces), other kinds aren't served
+func (r *manifestReader) List(ctx context.Context, list client.ObjectList, opts ...client.ListOption) error {
+	cfgMaps, ok := list.(*v1.ConfigMapList)
+	if !ok {
+		return fmt.Errorf("only configMaps are read from the manifests, got %T", list)
+	}
+	options := &client.ListOptions{}
+	options.ApplyOptions(opts)
+	cfgMaps.Items = nil
+	for _, cfgMap := range r.manifests.ConfigMaps {
+		if options.Namespace != "" && cfgMap.Namespace != options.Namespace {
+			continue
+		}
+		if options.LabelSelector != nil && !options.LabelSelector.Matches(labels.Set(cfgMap.Labels)) {
+			continue
+		}
+		cfgMaps.Items = append(cfgMaps.Items, *cfgMap.DeepCopy())
+	}
+	return nil
+}
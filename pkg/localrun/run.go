@@ -0,0 +1,119 @@
+package localrun
+
+// Copyright (c) Microsoft Corporation.
+// Licensed under the MIT License.
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/rs/zerolog/log"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	schemav1alpha1 "github.com/microsoft/azure-schema-operator/apis/dbschema/v1alpha1"
+	"github.com/microsoft/azure-schema-operator/pkg/clients"
+	"github.com/microsoft/azure-schema-operator/pkg/cluster"
+	"github.com/microsoft/azure-schema-operator/pkg/runlogs"
+)
+
+// NewClusterFunc returns the `Cluster` implementation of the type
+type NewClusterFunc func(dbType schemav1alpha1.DBTypeEnum, uri string) (cluster.Cluster, error)
+
+// Result is the result of a schema deployment on a cluster
+type Result struct {
+	Deployment string
+	Cluster    string
+	// Targets are the targets the filter matched
+	Targets schemav1alpha1.ClusterTargets
+	// Done are the targets that were executed
+	Done schemav1alpha1.ClusterTargets
+	Err  error
+	// Logs is where the execution output is stored
+	Logs string
+}
+
+// Runner runs schema deployments directly with the `Cluster` implementations - the same execution the operator does,
+// without a Kubernetes cluster.
+type Runner struct {
+	NewCluster NewClusterFunc
+	// Clusters replace the clusters of the deployments, e.g. to validate on a test cluster or an emulator
+	Clusters []string
+	// DryRun only matches the targets and prepares the execution configuration
+	DryRun bool
+	// Logs stores the execution output per target, the output is discarded if not set
+	Logs runlogs.Store
+}
+
+// NewRunner returns a `Runner` with the operator `Cluster` implementations.
+// The client serves the `ConfigMaps` referenced by the sources (e.g. external dacpacs).
+func NewRunner(c client.Reader, cache *clients.Cache) *Runner {
+	return &Runner{
+		NewCluster: func(dbType schemav1alpha1.DBTypeEnum, uri string) (cluster.Cluster, error) {
+			return cluster.NewCluster(dbType, uri, c, cache, nil)
+		},
+	}
+}
+
+// Run runs the deployment on each of its clusters, one after the other.
+func (r *Runner) Run(ctx context.Context, d Deployment) []Result {
+	uris := d.Template.Spec.ApplyTo.ClusterUris
+	if len(r.Clusters) > 0 {
+		uris = r.Clusters
+	}
+	results := make([]Result, 0, len(uris))
+	for _, uri := range uris {
+		results = append(results, r.runCluster(ctx, d, uri))
+	}
+	return results
+}
+
+func (r *Runner) runCluster(ctx context.Context, d Deployment, uri string) Result {
+	spec := d.Template.Spec
+	result := Result{Deployment: d.Template.Name, Cluster: uri}
+	target, err := r.NewCluster(spec.Type, uri)
+	if err != nil {
+		result.Err = err
+		return result
+	}
+	if spec.ExecutionTimeout != nil && spec.ExecutionTimeout.Duration > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, spec.ExecutionTimeout.Duration)
+		defer cancel()
+	}
+
+	filter := spec.ApplyTo
+	filter.ClusterUris = []string{uri}
+	result.Targets, result.Err = target.AquireTargets(ctx, filter)
+	if result.Err != nil {
+		log.Error().Err(result.Err).Msgf("failed to acquire the targets of %s on %s", d.Template.Name, uri)
+		return result
+	}
+	config, err := target.CreateExecConfiguration(ctx, result.Targets, d.Source, spec.FailIfDataLoss)
+	if err != nil {
+		log.Error().Err(err).Msgf("failed to create the execution configuration of %s", d.Template.Name)
+		result.Err = err
+		return result
+	}
+	if r.DryRun {
+		return result
+	}
+
+	var recorder *runlogs.Recorder
+	if r.Logs != nil {
+		recorder = runlogs.NewRecorder(r.Logs, d.Template.Namespace, d.Template.Name+"-"+cluster.ClusterNameFromURI(uri), runlogs.MaxBytes())
+		result.Logs = recorder.Location()
+	}
+	result.Done, result.Err = target.Execute(runlogs.WithRecorder(ctx, recorder), result.Targets, config)
+	if errors.Is(ctx.Err(), context.DeadlineExceeded) {
+		// the deadline is either the execution timeout or the one of the caller
+		if spec.ExecutionTimeout != nil {
+			result.Err = fmt.Errorf("execution stopped after %s: %w", spec.ExecutionTimeout.Duration, result.Err)
+		} else {
+			result.Err = fmt.Errorf("execution stopped: %w", ctx.Err())
+		}
+	}
+	if err := recorder.Flush(context.Background()); err != nil {
+		log.Error().Err(err).Msgf("failed to store the logs of %s", d.Template.Name)
+	}
+	return result
+}
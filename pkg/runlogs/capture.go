@@ -0,0 +1,63 @@
+package runlogs
+
+// Copyright (c) Microsoft Corporation.
+// Licensed under the MIT License.
+import (
+	"fmt"
+	"sync"
+)
+
+// Capture is an `io.Writer` keeping the last `max` bytes written to it -
+// the end of the output is where the errors usually are.
+type Capture struct {
+	mu        sync.Mutex
+	max       int
+	buf       []byte
+	truncated int
+}
+
+// NewCapture returns a `Capture` of up to `max` bytes
+func NewCapture(max int) *Capture {
+	return &Capture{max: max}
+}
+
+// Write appends p to the capture, dropping the start of the output once it passes the limit.
+func (c *Capture) Write(p []byte) (int, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.buf = append(c.buf, p...)
+	// trim lazily so not every write moves the buffer
+	if len(c.buf) > 2*c.max {
+		c.trim()
+	}
+	return len(p), nil
+}
+
+func (c *Capture) trim() {
+	if over := len(c.buf) - c.max; over > 0 {
+		c.truncated += over
+		c.buf = append(c.buf[:0], c.buf[over:]...)
+	}
+}
+
+// Bytes returns the captured output, prefixed with a note if its start was dropped.
+func (c *Capture) Bytes() []byte {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.trim()
+	if c.truncated == 0 {
+		return append([]byte(nil), c.buf...)
+	}
+	note := fmt.Sprintf("[... %d bytes truncated ...]\n", c.truncated)
+	return append([]byte(note), c.buf...)
+}
+
+// Tail returns up to the last n bytes of the captured output
+func (c *Capture) Tail(n int) string {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if len(c.buf) <= n {
+		return string(c.buf)
+	}
+	return string(c.buf[len(c.buf)-n:])
+}
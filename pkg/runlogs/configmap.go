@@ -0,0 +1,190 @@
+package runlogs
+
+// Copyright (c) Microsoft Corporation.
+// Licensed under the MIT License.
+import (
+	"context"
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+	"unicode/utf8"
+
+	schemav1alpha1 "github.com/microsoft/azure-schema-operator/apis/dbschema/v1alpha1"
+	"github.com/rs/zerolog/log"
+	v1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/util/retry"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+// DefaultConfigMapMaxBytes caps the logs kept in a single `ConfigMap`, below the 1MiB object size limit
+const DefaultConfigMapMaxBytes = 900 * 1024
+
+var invalidKeyChars = regexp.MustCompile(`[^-._a-zA-Z0-9]`)
+
+// ConfigMapStore stores the logs of each executer in a `<executer>-logs` `ConfigMap`, owned by the executer.
+// A `ConfigMap` of that name the executer doesn't own isn't overwritten. The logs of every target are kept under their own key, the total size is capped by `MaxBytes`
+// by dropping the start of the logs being stored.
+type ConfigMapStore struct {
+	Client   client.Client
+	MaxBytes int
+}
+
+// NewConfigMapStore returns a `ConfigMapStore` using the client
+func NewConfigMapStore(c client.Client) *ConfigMapStore {
+	return &ConfigMapStore{Client: c, MaxBytes: DefaultConfigMapMaxBytes}
+}
+
+// ConfigMapName returns the name of the logs `ConfigMap` of the executer
+func ConfigMapName(executer string) string {
+	return executer + "-logs"
+}
+
+// dataKey returns the `ConfigMap` key of the target
+func dataKey(target string) string {
+	return invalidKeyChars.ReplaceAllString(target, "_")
+}
+
+// Put stores the target logs in the executer `ConfigMap`
+func (s *ConfigMapStore) Put(ctx context.Context, key string, data []byte) error {
+	namespace, executer, target, err := ParseKey(key)
+	if err != nil {
+		return err
+	}
+	return s.PutAll(ctx, namespace, executer, map[string][]byte{target: data})
+}
+
+// PutAll stores the logs of the targets in the executer `ConfigMap` with a single update.
+// When the `ConfigMap` passes `MaxBytes`, every target is trimmed to an equal share of it.
+func (s *ConfigMapStore) PutAll(ctx context.Context, namespace, executer string, logs map[string][]byte) error {
+	name := types.NamespacedName{Namespace: namespace, Name: ConfigMapName(executer)}
+	return retry.RetryOnConflict(retry.DefaultRetry, func() error {
+		cfgMap := &v1.ConfigMap{}
+		err := s.Client.Get(ctx, name, cfgMap)
+		create := apierrors.IsNotFound(err)
+		if err != nil && !create {
+			return err
+		}
+		if !create && !ownedBy(cfgMap, executer) {
+			return fmt.Errorf("configmap %s isn't owned by the executer %s - refusing to overwrite it", name, executer)
+		}
+		if cfgMap.Data == nil {
+			cfgMap.Data = make(map[string]string)
+		}
+		for target, data := range logs {
+			cfgMap.Data[dataKey(target)] = string(data)
+		}
+		s.fit(cfgMap.Data)
+		if !create {
+			return s.Client.Update(ctx, cfgMap)
+		}
+		cfgMap.ObjectMeta = metav1.ObjectMeta{Namespace: namespace, Name: name.Name}
+		if err = s.setOwner(ctx, cfgMap, executer); err != nil {
+			return err
+		}
+		return s.Client.Create(ctx, cfgMap)
+	})
+}
+
+// ownedBy returns true if the `ConfigMap` is owned by the executer
+func ownedBy(cfgMap *v1.ConfigMap, executer string) bool {
+	for _, ref := range cfgMap.OwnerReferences {
+		if ref.Kind == "ClusterExecuter" && ref.Name == executer && strings.HasPrefix(ref.APIVersion, schemav1alpha1.GroupVersion.Group+"/") {
+			return true
+		}
+	}
+	return false
+}
+
+// fit trims the logs to an equal share of `MaxBytes` if they don't fit, dropping their start.
+func (s *ConfigMapStore) fit(data map[string]string) {
+	total := 0
+	for k, v := range data {
+		total += len(k) + len(v)
+	}
+	if total <= s.MaxBytes {
+		return
+	}
+	share := s.MaxBytes / len(data)
+	for k, v := range data {
+		left := share - len(k)
+		if len(v) <= left {
+			continue
+		}
+		note := fmt.Sprintf("[... %d bytes dropped - the logs configmap is full ...]\n", len(v)-left)
+		if left <= len(note) {
+			data[k] = note
+			continue
+		}
+		// cut on a rune boundary, so multi-byte characters aren't split
+		cut := len(v) - left + len(note)
+		for cut < len(v) && !utf8.RuneStart(v[cut]) {
+			cut++
+		}
+		data[k] = note + v[cut:]
+	}
+}
+
+// setOwner sets the executer as the owner of the logs `ConfigMap`, so they are removed along with it
+func (s *ConfigMapStore) setOwner(ctx context.Context, cfgMap *v1.ConfigMap, executer string) error {
+	owner := &schemav1alpha1.ClusterExecuter{}
+	err := s.Client.Get(ctx, types.NamespacedName{Namespace: cfgMap.Namespace, Name: executer}, owner)
+	if err != nil {
+		log.Error().Err(err).Msgf("failed to get the executer %s owning the logs configmap", executer)
+		return fmt.Errorf("failed to get the owner of the logs configmap: %w", err)
+	}
+	cfgMap.OwnerReferences = []metav1.OwnerReference{{
+		APIVersion: schemav1alpha1.GroupVersion.String(),
+		Kind:       "ClusterExecuter",
+		Name:       owner.Name,
+		UID:        owner.UID,
+	}}
+	return nil
+}
+
+// Get returns the target logs from the executer `ConfigMap`
+func (s *ConfigMapStore) Get(ctx context.Context, key string) ([]byte, error) {
+	namespace, executer, target, err := ParseKey(key)
+	if err != nil {
+		return nil, err
+	}
+	cfgMap := &v1.ConfigMap{}
+	err = s.Client.Get(ctx, types.NamespacedName{Namespace: namespace, Name: ConfigMapName(executer)}, cfgMap)
+	if apierrors.IsNotFound(err) {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	data, ok := cfgMap.Data[dataKey(target)]
+	if !ok {
+		return nil, ErrNotFound
+	}
+	return []byte(data), nil
+}
+
+// List returns the keys of the target logs in the executer `ConfigMap`
+func (s *ConfigMapStore) List(ctx context.Context, namespace, executer string) ([]string, error) {
+	cfgMap := &v1.ConfigMap{}
+	err := s.Client.Get(ctx, types.NamespacedName{Namespace: namespace, Name: ConfigMapName(executer)}, cfgMap)
+	if apierrors.IsNotFound(err) {
+		return []string{}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	keys := make([]string, 0, len(cfgMap.Data))
+	for target := range cfgMap.Data {
+		keys = append(keys, Key(namespace, executer, target))
+	}
+	sort.Strings(keys)
+	return keys, nil
+}
+
+// Location returns the logs `ConfigMap` of the executer
+func (s *ConfigMapStore) Location(namespace, executer string) string {
+	return "configmap/" + ConfigMapName(executer)
+}
@@ -0,0 +1,114 @@
+package runlogs
+
+// Copyright (c) Microsoft Corporation.
+// Licensed under the MIT License.
+import (
+	"context"
+	"io"
+	"sort"
+	"sync"
+
+	"github.com/hashicorp/go-multierror"
+	"github.com/rs/zerolog/log"
+)
+
+type recorderKey struct{}
+
+// Recorder captures the execution output of each target of an executer and stores it once the execution is done.
+// A nil `*Recorder` discards the output.
+type Recorder struct {
+	store     Store
+	namespace string
+	executer  string
+	maxBytes  int
+
+	mu      sync.Mutex
+	outputs map[string]*Capture
+}
+
+// NewRecorder returns a `Recorder` for the executer, capturing up to `maxBytes` per target
+func NewRecorder(store Store, namespace, executer string, maxBytes int) *Recorder {
+	if maxBytes <= 0 {
+		maxBytes = DefaultMaxBytes
+	}
+	return &Recorder{
+		store:     store,
+		namespace: namespace,
+		executer:  executer,
+		maxBytes:  maxBytes,
+		outputs:   make(map[string]*Capture),
+	}
+}
+
+// WithRecorder returns a context carrying the recorder, the executions write their output to it
+func WithRecorder(ctx context.Context, r *Recorder) context.Context {
+	return context.WithValue(ctx, recorderKey{}, r)
+}
+
+// FromContext returns the recorder of the context, or nil if there is none
+func FromContext(ctx context.Context) *Recorder {
+	r, _ := ctx.Value(recorderKey{}).(*Recorder)
+	return r
+}
+
+// Output returns the capture of the target output - `db`, `db.schema` or `ClusterTarget`.
+func (r *Recorder) Output(target string) io.Writer {
+	if r == nil {
+		return io.Discard
+	}
+	return r.capture(target)
+}
+
+func (r *Recorder) capture(target string) *Capture {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	c, ok := r.outputs[target]
+	if !ok {
+		c = NewCapture(r.maxBytes)
+		r.outputs[target] = c
+	}
+	return c
+}
+
+// Location describes where the logs are stored
+func (r *Recorder) Location() string {
+	if r == nil {
+		return ""
+	}
+	return r.store.Location(r.namespace, r.executer)
+}
+
+// Flush stores the captured outputs, replacing the logs of the previous runs of the same targets.
+func (r *Recorder) Flush(ctx context.Context) error {
+	if r == nil {
+		return nil
+	}
+	r.mu.Lock()
+	targets := make([]string, 0, len(r.outputs))
+	for target := range r.outputs {
+		targets = append(targets, target)
+	}
+	r.mu.Unlock()
+	sort.Strings(targets)
+
+	if batch, ok := r.store.(BatchStore); ok {
+		logs := make(map[string][]byte, len(targets))
+		for _, target := range targets {
+			logs[target] = r.capture(target).Bytes()
+		}
+		err := batch.PutAll(ctx, r.namespace, r.executer, logs)
+		if err != nil {
+			log.Error().Err(err).Msgf("failed to store the logs of %s", r.executer)
+		}
+		return err
+	}
+	var result *multierror.Error
+	for _, target := range targets {
+		err := r.store.Put(ctx, Key(r.namespace, r.executer, target), r.capture(target).Bytes())
+		if err != nil {
+			log.Error().Err(err).Msgf("failed to store the logs of %s", target)
+			result = multierror.Append(result, err)
+		}
+	}
+	return result.ErrorOrNil()
+}
@@ -0,0 +1,15 @@
+package runlogs_test
+
+// Copyright (c) Microsoft Corporation.
+// Licensed under the MIT License.
+import (
+	"testing"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+func TestRunlogs(t *testing.T) {
+	RegisterFailHandler(Fail)
+	RunSpecs(t, "Runlogs Suite")
+}
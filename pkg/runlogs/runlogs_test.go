@@ -0,0 +1,165 @@
+package runlogs_test
+
+// Copyright (c) Microsoft Corporation.
+// Licensed under the MIT License.
+import (
+	"context"
+	"fmt"
+	"strings"
+	"unicode/utf8"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	clientgoscheme "k8s.io/client-go/kubernetes/scheme"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+
+	schemav1alpha1 "github.com/microsoft/azure-schema-operator/apis/dbschema/v1alpha1"
+	"github.com/microsoft/azure-schema-operator/pkg/runlogs"
+)
+
+var _ = Describe("Runlogs", func() {
+	ctx := context.Background()
+
+	It("Should keep the end of the output", func() {
+		capture := runlogs.NewCapture(10)
+		for i := 0; i < 10; i++ {
+			fmt.Fprintf(capture, "line %d\n", i)
+		}
+		Expect(capture.Tail(7)).To(Equal("line 9\n"))
+		out := string(capture.Bytes())
+		Expect(out).To(HavePrefix("[... 60 bytes truncated ...]\n"))
+		Expect(out).To(HaveSuffix("8\nline 9\n"))
+
+		small := runlogs.NewCapture(100)
+		fmt.Fprint(small, "done")
+		Expect(string(small.Bytes())).To(Equal("done"))
+	})
+
+	It("Should store the logs as files", func() {
+		store := runlogs.NewFileStore(GinkgoT().TempDir())
+		Expect(store.Put(ctx, runlogs.Key("default", "sales-0-cluster1", "db1"), []byte("db1 output"))).To(Succeed())
+		Expect(store.Put(ctx, runlogs.Key("default", "sales-0-cluster1", "db1.tenant1"), []byte("tenant1 output"))).To(Succeed())
+
+		keys, err := store.List(ctx, "default", "sales-0-cluster1")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(keys).To(Equal([]string{"default/sales-0-cluster1/db1", "default/sales-0-cluster1/db1.tenant1"}))
+		data, err := store.Get(ctx, keys[1])
+		Expect(err).NotTo(HaveOccurred())
+		Expect(string(data)).To(Equal("tenant1 output"))
+
+		_, err = store.Get(ctx, runlogs.Key("default", "sales-0-cluster1", "db2"))
+		Expect(err).To(MatchError(runlogs.ErrNotFound))
+		Expect(store.Put(ctx, runlogs.Key("default", "..", "db1"), nil)).NotTo(Succeed())
+		keys, err = store.List(ctx, "default", "other")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(keys).To(BeEmpty())
+	})
+
+	Context("ConfigMap store", func() {
+		var c client.Client
+		var executer *schemav1alpha1.ClusterExecuter
+
+		BeforeEach(func() {
+			scheme := runtime.NewScheme()
+			Expect(clientgoscheme.AddToScheme(scheme)).To(Succeed())
+			Expect(schemav1alpha1.AddToScheme(scheme)).To(Succeed())
+			executer = &schemav1alpha1.ClusterExecuter{
+				ObjectMeta: metav1.ObjectMeta{Name: "sales-0-cluster1", Namespace: "default", UID: "executer-uid"},
+			}
+			c = fake.NewClientBuilder().WithScheme(scheme).WithObjects(executer).Build()
+		})
+
+		It("Should store the logs of an execution in a configmap owned by the executer", func() {
+			store := runlogs.NewConfigMapStore(c)
+			recorder := runlogs.NewRecorder(store, "default", executer.Name, 0)
+			recCtx := runlogs.WithRecorder(ctx, recorder)
+			fmt.Fprint(runlogs.FromContext(recCtx).Output("db1"), "db1 output")
+			fmt.Fprint(runlogs.FromContext(recCtx).Output("db1.tenant1"), "tenant1 output")
+			Expect(recorder.Flush(ctx)).To(Succeed())
+			Expect(recorder.Location()).To(Equal("configmap/sales-0-cluster1-logs"))
+
+			cfgMap := &v1.ConfigMap{}
+			Expect(c.Get(ctx, types.NamespacedName{Namespace: "default", Name: "sales-0-cluster1-logs"}, cfgMap)).To(Succeed())
+			Expect(cfgMap.OwnerReferences).To(HaveLen(1))
+			Expect(cfgMap.OwnerReferences[0].UID).To(Equal(executer.UID))
+			Expect(cfgMap.Data).To(HaveKeyWithValue("db1.tenant1", "tenant1 output"))
+
+			// a later run replaces the logs of its targets only
+			Expect(store.Put(ctx, runlogs.Key("default", executer.Name, "db1"), []byte("retry output"))).To(Succeed())
+			keys, err := store.List(ctx, "default", executer.Name)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(keys).To(HaveLen(2))
+			data, err := store.Get(ctx, runlogs.Key("default", executer.Name, "db1"))
+			Expect(err).NotTo(HaveOccurred())
+			Expect(string(data)).To(Equal("retry output"))
+		})
+
+		It("Should cap the size of the logs configmap", func() {
+			store := runlogs.NewConfigMapStore(c)
+			store.MaxBytes = 1000
+			logs := map[string][]byte{}
+			for i := 0; i < 4; i++ {
+				logs[fmt.Sprintf("db%d", i)] = []byte(strings.Repeat("x", 500) + fmt.Sprintf("end of db%d", i))
+			}
+			Expect(store.PutAll(ctx, "default", executer.Name, logs)).To(Succeed())
+
+			cfgMap := &v1.ConfigMap{}
+			Expect(c.Get(ctx, types.NamespacedName{Namespace: "default", Name: "sales-0-cluster1-logs"}, cfgMap)).To(Succeed())
+			total := 0
+			for k, v := range cfgMap.Data {
+				total += len(k) + len(v)
+				Expect(v).To(HaveSuffix("end of " + k))
+				Expect(v).To(HavePrefix("[..."))
+			}
+			Expect(total).To(BeNumerically("<=", 1000))
+		})
+
+		It("Should not overwrite a configmap the executer doesn't own", func() {
+			store := runlogs.NewConfigMapStore(c)
+			foreign := &v1.ConfigMap{
+				ObjectMeta: metav1.ObjectMeta{Name: "sales-0-cluster1-logs", Namespace: "default"},
+				Data:       map[string]string{"settings": "keep"},
+			}
+			Expect(c.Create(ctx, foreign)).To(Succeed())
+
+			err := store.Put(ctx, runlogs.Key("default", executer.Name, "db1"), []byte("db1 output"))
+			Expect(err).To(MatchError(ContainSubstring("isn't owned by the executer")))
+			cfgMap := &v1.ConfigMap{}
+			Expect(c.Get(ctx, types.NamespacedName{Namespace: "default", Name: "sales-0-cluster1-logs"}, cfgMap)).To(Succeed())
+			Expect(cfgMap.Data).To(Equal(map[string]string{"settings": "keep"}))
+		})
+
+		It("Should not create the logs configmap of a missing executer", func() {
+			store := runlogs.NewConfigMapStore(c)
+			err := store.Put(ctx, runlogs.Key("default", "missing", "db1"), []byte("db1 output"))
+			Expect(err).To(HaveOccurred())
+			Expect(c.Get(ctx, types.NamespacedName{Namespace: "default", Name: "missing-logs"}, &v1.ConfigMap{})).NotTo(Succeed())
+		})
+
+		It("Should trim the logs on a rune boundary", func() {
+			store := runlogs.NewConfigMapStore(c)
+			store.MaxBytes = 300
+			logs := map[string][]byte{"db1": []byte(strings.Repeat("אב€", 100))}
+			Expect(store.PutAll(ctx, "default", executer.Name, logs)).To(Succeed())
+
+			cfgMap := &v1.ConfigMap{}
+			Expect(c.Get(ctx, types.NamespacedName{Namespace: "default", Name: "sales-0-cluster1-logs"}, cfgMap)).To(Succeed())
+			Expect(utf8.ValidString(cfgMap.Data["db1"])).To(BeTrue())
+			Expect(cfgMap.Data["db1"]).To(HavePrefix("[..."))
+			Expect(len("db1") + len(cfgMap.Data["db1"])).To(BeNumerically("<=", 300))
+		})
+
+		It("Should discard the output without a recorder", func() {
+			Expect(runlogs.FromContext(ctx)).To(BeNil())
+			n, err := runlogs.FromContext(ctx).Output("db1").Write([]byte("lost"))
+			Expect(err).NotTo(HaveOccurred())
+			Expect(n).To(Equal(4))
+			Expect(runlogs.FromContext(ctx).Flush(ctx)).To(Succeed())
+		})
+	})
+})
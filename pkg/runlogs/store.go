@@ -0,0 +1,163 @@
+package runlogs
+
+// Copyright (c) Microsoft Corporation.
+// Licensed under the MIT License.
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/microsoft/azure-schema-operator/pkg/config"
+	"github.com/spf13/viper"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+const (
+	// ClusterTarget is the target of outputs covering the entire cluster (e.g. a delta-kusto run on all the DBs)
+	ClusterTarget = "_cluster"
+	// DefaultMaxBytes is the default size cap of the captured output per target
+	DefaultMaxBytes = 64 * 1024
+	// StoreConfigMap stores the logs in a `ConfigMap` per executer
+	StoreConfigMap = "configmap"
+	// StoreFile stores the logs on the local filesystem
+	StoreFile = "file"
+)
+
+// DefaultLogDir is the default root directory of the `file` logs store
+const DefaultLogDir = "/tmp/schemaop-logs"
+
+// ErrNotFound is returned when no logs were stored under the key
+var ErrNotFound = errors.New("logs not found")
+
+// Store persists the captured execution logs.
+// Logs are objects keyed by `<namespace>/<executer>/<target>` so a store can be backed by an object store.
+type Store interface {
+	// Put stores the logs under the key, replacing the previous ones
+	Put(ctx context.Context, key string, data []byte) error
+	// Get returns the logs stored under the key or `ErrNotFound`
+	Get(ctx context.Context, key string) ([]byte, error)
+	// List returns the keys of the logs stored under the `<namespace>/<executer>/` prefix
+	List(ctx context.Context, namespace, executer string) ([]string, error)
+	// Location describes where the logs of the executer are stored
+	Location(namespace, executer string) string
+}
+
+// BatchStore is implemented by stores that can store the logs of several targets of an executer at once
+type BatchStore interface {
+	PutAll(ctx context.Context, namespace, executer string, logs map[string][]byte) error
+}
+
+// Key returns the store key of the target logs of the executer
+func Key(namespace, executer, target string) string {
+	return namespace + "/" + executer + "/" + target
+}
+
+// ParseKey splits a store key to its namespace, executer and target
+func ParseKey(key string) (namespace, executer, target string, err error) {
+	parts := strings.SplitN(key, "/", 3)
+	if len(parts) != 3 || parts[0] == "" || parts[1] == "" || parts[2] == "" {
+		return "", "", "", fmt.Errorf("invalid logs key %q", key)
+	}
+	return parts[0], parts[1], parts[2], nil
+}
+
+// FileStore stores the logs as files under `Root` - `<root>/<namespace>/<executer>/<target>.log`
+type FileStore struct {
+	Root string
+}
+
+// NewFileStore returns a `FileStore` writing under root
+func NewFileStore(root string) *FileStore {
+	return &FileStore{Root: root}
+}
+
+func (s *FileStore) path(key string) (string, error) {
+	namespace, executer, target, err := ParseKey(key)
+	if err != nil {
+		return "", err
+	}
+	for _, part := range []string{namespace, executer, target} {
+		if part == "." || part == ".." || strings.ContainsAny(part, `/\`) {
+			return "", fmt.Errorf("invalid logs key %q", key)
+		}
+	}
+	return filepath.Join(s.Root, namespace, executer, target+".log"), nil
+}
+
+// Put writes the logs file of the key
+func (s *FileStore) Put(ctx context.Context, key string, data []byte) error {
+	path, err := s.path(key)
+	if err != nil {
+		return err
+	}
+	if err = os.MkdirAll(filepath.Dir(path), 0o750); err != nil {
+		return err
+	}
+	return os.WriteFile(path, data, 0o640)
+}
+
+// Get reads the logs file of the key
+func (s *FileStore) Get(ctx context.Context, key string) ([]byte, error) {
+	path, err := s.path(key)
+	if err != nil {
+		return nil, err
+	}
+	data, err := os.ReadFile(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, ErrNotFound
+	}
+	return data, err
+}
+
+// List returns the keys of the logs files of the executer
+func (s *FileStore) List(ctx context.Context, namespace, executer string) ([]string, error) {
+	entries, err := os.ReadDir(filepath.Join(s.Root, namespace, executer))
+	if errors.Is(err, fs.ErrNotExist) {
+		return []string{}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	keys := make([]string, 0, len(entries))
+	for _, entry := range entries {
+		if !entry.IsDir() && strings.HasSuffix(entry.Name(), ".log") {
+			keys = append(keys, Key(namespace, executer, strings.TrimSuffix(entry.Name(), ".log")))
+		}
+	}
+	sort.Strings(keys)
+	return keys, nil
+}
+
+// Location returns the directory of the executer logs
+func (s *FileStore) Location(namespace, executer string) string {
+	return "file://" + filepath.Join(s.Root, namespace, executer)
+}
+
+// NewStore returns the logs store configured for the operator (`config.LogStore`)
+func NewStore(c client.Client) (Store, error) {
+	switch kind := viper.GetString(config.LogStore); kind {
+	case "", StoreConfigMap:
+		return NewConfigMapStore(c), nil
+	case StoreFile:
+		dir := viper.GetString(config.LogDir)
+		if dir == "" {
+			dir = DefaultLogDir
+		}
+		return NewFileStore(dir), nil
+	default:
+		return nil, fmt.Errorf("unknown logs store %q", kind)
+	}
+}
+
+// MaxBytes returns the configured size cap of the logs kept per target
+func MaxBytes() int {
+	if max := viper.GetInt(config.LogMaxBytes); max > 0 {
+		return max
+	}
+	return DefaultMaxBytes
+}
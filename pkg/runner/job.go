@@ -0,0 +1,295 @@
+package runner
+
+// Copyright (c) Microsoft Corporation.
+// Licensed under the MIT License.
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"hash/fnv"
+	"os"
+	"strconv"
+	"strings"
+
+	schemav1alpha1 "github.com/microsoft/azure-schema-operator/apis/dbschema/v1alpha1"
+	"github.com/microsoft/azure-schema-operator/pkg/cluster"
+	"github.com/microsoft/azure-schema-operator/pkg/config"
+	"github.com/microsoft/azure-schema-operator/pkg/runlogs"
+	"github.com/microsoft/azure-schema-operator/pkg/utils/schemaversions"
+	"github.com/rs/zerolog/log"
+	"github.com/spf13/viper"
+	batchv1 "k8s.io/api/batch/v1"
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+const (
+	// ExecuterLabel labels the execution jobs with their executer
+	ExecuterLabel = "dbschema.microsoft.com/executer"
+	// workloadIdentityLabel opts the job pods in to azure workload identity
+	workloadIdentityLabel = "azure.workload.identity/use"
+	// resultKey is the key of the execution result in the job result `ConfigMap`
+	resultKey = "result"
+	// DefaultHistoryLimit is the default number of finished jobs kept per executer
+	DefaultHistoryLimit = 3
+	// maxJobName is the max job name length, as it is used as a label value of the job pods
+	maxJobName = 63
+)
+
+// forwardedSettings are the operator settings passed on to the execution jobs.
+// Credentials are not forwarded - jobs authenticate with their own service account (or `env`).
+var forwardedSettings = []string{
+	config.AzureUseMSIKey,
+	config.DeltaCMDKey,
+	config.SQLPackageCMDKey,
+	config.ParallelWorkers,
+	config.AllowLocalDacPac,
+	config.LogMaxBytes,
+	config.ExecutionTimeout,
+}
+
+// JobResult is the result of an execution job, published in a `ConfigMap` named after the job.
+type JobResult struct {
+	Done  schemav1alpha1.ClusterTargets `json:"done"`
+	Error string                        `json:"error,omitempty"`
+	// TimedOut is set if the execution was stopped by the execution timeout
+	TimedOut bool `json:"timedOut,omitempty"`
+}
+
+// IsJobMode checks if the executions of the executer run as Kubernetes jobs
+func IsJobMode(spec schemav1alpha1.ClusterExecuterSpec) bool {
+	return spec.Runner != nil && spec.Runner.Mode == schemav1alpha1.RunnerModeJob
+}
+
+// HistoryLimit returns the number of finished jobs kept for the executer
+func HistoryLimit(spec schemav1alpha1.ClusterExecuterSpec) int {
+	if spec.Runner != nil && spec.Runner.HistoryLimit != nil {
+		return int(*spec.Runner.HistoryLimit)
+	}
+	return DefaultHistoryLimit
+}
+
+// JobName returns the name of the `run` job of the executer.
+func JobName(executer *schemav1alpha1.ClusterExecuter, run int32) string {
+	suffix := "-run-" + strconv.Itoa(int(run))
+	return shortName(executer.Name, maxJobName-len(suffix)) + suffix
+}
+
+// shortName truncates names longer than `max`, suffixed with a hash of the name to keep them unique.
+func shortName(name string, max int) string {
+	if len(name) <= max {
+		return name
+	}
+	h := fnv.New32a()
+	h.Write([]byte(name))
+	hash := fmt.Sprintf("-%08x", h.Sum32())
+	return strings.TrimRight(name[:max-len(hash)], "-.") + hash
+}
+
+// allowed checks if the value is in the comma separated allow-list of the operator setting
+func allowed(key, value string) bool {
+	for _, item := range strings.Split(viper.GetString(key), ",") {
+		if strings.TrimSpace(item) == value {
+			return true
+		}
+	}
+	return false
+}
+
+// NewJob returns the execution job of the executer.
+// The job runs the operator binary in execute mode (`--execute`) on the executer.
+// The image and service account of the runner spec must be allowed by the operator settings.
+func NewJob(executer *schemav1alpha1.ClusterExecuter, name string) (*batchv1.Job, error) {
+	spec := schemav1alpha1.RunnerSpec{}
+	if executer.Spec.Runner != nil {
+		spec = *executer.Spec.Runner
+	}
+	image := viper.GetString(config.JobImage)
+	if spec.Image != "" {
+		if !allowed(config.JobImages, spec.Image) {
+			return nil, fmt.Errorf("the job image %s is not allowed by the operator (%s)", spec.Image, strings.ToUpper(config.JobImages))
+		}
+		image = spec.Image
+	}
+	if image == "" {
+		return nil, errors.New("no image configured for the execution jobs")
+	}
+	if spec.ServiceAccountName != "" &&
+		!allowed(config.JobServiceAccounts, spec.ServiceAccountName) &&
+		!allowed(config.JobServiceAccounts, executer.Namespace+"/"+spec.ServiceAccountName) {
+		return nil, fmt.Errorf("the job service account %s/%s is not allowed by the operator (%s)", executer.Namespace, spec.ServiceAccountName, strings.ToUpper(config.JobServiceAccounts))
+	}
+
+	labels := map[string]string{ExecuterLabel: shortName(executer.Name, maxJobName)}
+	podLabels := map[string]string{ExecuterLabel: labels[ExecuterLabel]}
+	if spec.ServiceAccountName != "" {
+		podLabels[workloadIdentityLabel] = "true"
+	}
+
+	env := make([]v1.EnvVar, 0, len(forwardedSettings)+len(spec.Env))
+	for _, key := range forwardedSettings {
+		if value, ok := os.LookupEnv(strings.ToUpper(key)); ok {
+			env = append(env, v1.EnvVar{Name: strings.ToUpper(key), Value: value})
+		}
+	}
+	env = append(env, spec.Env...)
+
+	backoffLimit := int32(0)
+	job := &batchv1.Job{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      name,
+			Namespace: executer.Namespace,
+			Labels:    labels,
+		},
+		Spec: batchv1.JobSpec{
+			// retries are managed by the executer
+			BackoffLimit: &backoffLimit,
+			Template: v1.PodTemplateSpec{
+				ObjectMeta: metav1.ObjectMeta{Labels: podLabels},
+				Spec: v1.PodSpec{
+					RestartPolicy:      v1.RestartPolicyNever,
+					ServiceAccountName: spec.ServiceAccountName,
+					NodeSelector:       spec.NodeSelector,
+					Tolerations:        spec.Tolerations,
+					Containers: []v1.Container{{
+						Name:      "execute",
+						Image:     image,
+						Command:   []string{"/manager"},
+						Args:      []string{"--execute=" + executer.Namespace + "/" + executer.Name, "--job=" + name},
+						Env:       env,
+						Resources: spec.Resources,
+					}},
+				},
+			},
+		},
+	}
+	if timeout := ExecutionTimeout(executer.Spec); timeout > 0 {
+		// the job is stopped shortly after the execution timeout, if the execution didn't stop by itself
+		deadline := int64(timeout.Seconds()) + 60
+		job.Spec.ActiveDeadlineSeconds = &deadline
+	}
+	return job, nil
+}
+
+// RunJob executes the executer - it is the entry point of the execution jobs.
+// The job must be the one recorded in the executer status, the targets of the status that weren't done yet are executed and the result is published in a `ConfigMap` named after the job.
+func RunJob(ctx context.Context, c client.Client, key types.NamespacedName, jobName string) error {
+	executer := &schemav1alpha1.ClusterExecuter{}
+	err := c.Get(ctx, key, executer)
+	if err != nil {
+		log.Error().Err(err).Msgf("failed to get the executer %s", key)
+		return err
+	}
+	cfgMap := &v1.ConfigMap{}
+	err = c.Get(ctx, types.NamespacedName(executer.Spec.ConfigMapName), cfgMap)
+	if err != nil {
+		log.Error().Err(err).Msgf("failed to get the configmap %s", executer.Spec.ConfigMapName.Name)
+		return err
+	}
+
+	execCtx, cancel := ExecutionContext(ctx, executer.Spec)
+	defer cancel()
+	// the job pod filesystem is gone with the pod - the logs are kept in the executer logs configmap
+	recorder := runlogs.NewRecorder(runlogs.NewConfigMapStore(c), key.Namespace, key.Name, runlogs.MaxBytes())
+	execCtx = runlogs.WithRecorder(execCtx, recorder)
+	targetsToRun := cluster.Difference(executer.Status.Targets, executer.Status.DoneTargets)
+	targetsToRun.Skipped = executer.Status.Targets.Skipped
+	var done schemav1alpha1.ClusterTargets
+	var execConfiguration schemav1alpha1.ExecutionConfiguration
+	var target cluster.Cluster
+	// the targets are those of the stored status - it is written before the job is created
+	if executer.Status.Job != jobName {
+		err = fmt.Errorf("the status of the executer %s is of job %q, not of this job %s", key, executer.Status.Job, jobName)
+	}
+	if err == nil {
+		target, err = cluster.NewCluster(executer.Spec.Type, executer.Spec.ClusterUri, c, nil, nil)
+	}
+	if err == nil {
+		execConfiguration, err = target.CreateExecConfiguration(execCtx, targetsToRun, cfgMap, executer.Spec.FailIfDataLoss)
+	}
+	if err == nil {
+		log.Info().Msgf("executing %s on %d dbs and %d schemas", key, len(targetsToRun.DBs), len(targetsToRun.Schemas))
+		done, err = target.Execute(execCtx, targetsToRun, execConfiguration)
+	}
+	if err == nil && executer.Spec.OutputConfigMap != nil {
+		err = schemaversions.PublishOutputs(execCtx, c, executer, *executer.Spec.OutputConfigMap, done.Outputs)
+	}
+
+	_ = recorder.Flush(ctx)
+	result := JobResult{Done: done}
+	if err != nil {
+		log.Error().Err(err).Msgf("execution of %s failed", key)
+		result.Error = err.Error()
+		result.TimedOut = errors.Is(execCtx.Err(), context.DeadlineExceeded)
+	}
+	if publishErr := publishJobResult(ctx, c, key.Namespace, jobName, result); publishErr != nil {
+		return publishErr
+	}
+	return err
+}
+
+// publishJobResult publishes the job result in a `ConfigMap` owned by the job, so it is removed with it.
+func publishJobResult(ctx context.Context, c client.Client, namespace, jobName string, result JobResult) error {
+	job := &batchv1.Job{}
+	err := c.Get(ctx, types.NamespacedName{Namespace: namespace, Name: jobName}, job)
+	if err != nil {
+		log.Error().Err(err).Msgf("failed to get the job %s", jobName)
+		return err
+	}
+	data, err := json.Marshal(result)
+	if err != nil {
+		return err
+	}
+	cfgMap := &v1.ConfigMap{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      jobName,
+			Namespace: namespace,
+			Labels:    job.Labels,
+			OwnerReferences: []metav1.OwnerReference{
+				*metav1.NewControllerRef(job, batchv1.SchemeGroupVersion.WithKind("Job")),
+			},
+		},
+		Data: map[string]string{resultKey: string(data)},
+	}
+	err = c.Create(ctx, cfgMap)
+	if err != nil {
+		log.Error().Err(err).Msgf("failed to publish the result of %s", jobName)
+	}
+	return err
+}
+
+// GetJobResult returns the result published by the job, or false if the job didn't publish one.
+func GetJobResult(ctx context.Context, c client.Client, namespace, jobName string) (JobResult, bool, error) {
+	result := JobResult{}
+	cfgMap := &v1.ConfigMap{}
+	err := c.Get(ctx, types.NamespacedName{Namespace: namespace, Name: jobName}, cfgMap)
+	if err != nil {
+		return result, false, client.IgnoreNotFound(err)
+	}
+	data, ok := cfgMap.Data[resultKey]
+	if !ok {
+		return result, false, nil
+	}
+	err = json.Unmarshal([]byte(data), &result)
+	return result, err == nil, err
+}
+
+// JobFinished checks if the job finished, and if it succeeded.
+// The reason and message of a failed job are returned.
+func JobFinished(job *batchv1.Job) (finished bool, succeeded bool, reason string, message string) {
+	for _, cond := range job.Status.Conditions {
+		if cond.Status != v1.ConditionTrue {
+			continue
+		}
+		switch cond.Type {
+		case batchv1.JobComplete:
+			return true, true, "", ""
+		case batchv1.JobFailed:
+			return true, false, cond.Reason, cond.Message
+		}
+	}
+	return false, false, "", ""
+}
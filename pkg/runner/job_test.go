@@ -0,0 +1,194 @@
+package runner_test
+
+// Copyright (c) Microsoft Corporation.
+// Licensed under the MIT License.
+import (
+	"context"
+	"strings"
+	"time"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	"github.com/spf13/viper"
+	batchv1 "k8s.io/api/batch/v1"
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	clientgoscheme "k8s.io/client-go/kubernetes/scheme"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+
+	schemav1alpha1 "github.com/microsoft/azure-schema-operator/apis/dbschema/v1alpha1"
+	"github.com/microsoft/azure-schema-operator/pkg/config"
+	"github.com/microsoft/azure-schema-operator/pkg/runner"
+)
+
+var _ = Describe("Jobs", func() {
+	var executer *schemav1alpha1.ClusterExecuter
+
+	AfterEach(func() {
+		viper.Set(config.JobImages, "")
+		viper.Set(config.JobServiceAccounts, "")
+	})
+
+	BeforeEach(func() {
+		viper.Set(config.JobImages, "schemaop:test, schemaop:debug")
+		viper.Set(config.JobServiceAccounts, "default/sales-executer")
+		executer = &schemav1alpha1.ClusterExecuter{
+			ObjectMeta: metav1.ObjectMeta{Name: "sales-0-cluster1", Namespace: "default"},
+			Spec: schemav1alpha1.ClusterExecuterSpec{
+				ClusterUri:    "https://cluster1.westeurope.kusto.windows.net",
+				Type:          schemav1alpha1.DBTypeKusto,
+				ConfigMapName: schemav1alpha1.NamespacedName{Namespace: "default", Name: "sales-0"},
+				Runner: &schemav1alpha1.RunnerSpec{
+					Mode:               schemav1alpha1.RunnerModeJob,
+					Image:              "schemaop:test",
+					ServiceAccountName: "sales-executer",
+					NodeSelector:       map[string]string{"pool": "jobs"},
+					Resources: v1.ResourceRequirements{
+						Limits: v1.ResourceList{v1.ResourceMemory: resource.MustParse("2Gi")},
+					},
+				},
+				ExecutionTimeout: &metav1.Duration{Duration: 10 * time.Minute},
+			},
+		}
+	})
+
+	It("Should name the jobs by run and keep the names short", func() {
+		Expect(runner.JobName(executer, 2)).To(Equal("sales-0-cluster1-run-2"))
+
+		executer.Name = strings.Repeat("a-very-long-deployment-name-", 3) + "cluster1"
+		name := runner.JobName(executer, 12)
+		Expect(len(name)).To(BeNumerically("<=", 63))
+		Expect(name).To(HaveSuffix("-run-12"))
+		other := executer.DeepCopy()
+		other.Name = strings.Repeat("a-very-long-deployment-name-", 3) + "cluster2"
+		Expect(runner.JobName(other, 12)).NotTo(Equal(name))
+	})
+
+	It("Should create the job from the runner spec", func() {
+		job, err := runner.NewJob(executer, "sales-0-cluster1-run-1")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(*job.Spec.BackoffLimit).To(BeZero())
+		Expect(*job.Spec.ActiveDeadlineSeconds).To(BeNumerically(">", 600))
+		pod := job.Spec.Template.Spec
+		Expect(pod.ServiceAccountName).To(Equal("sales-executer"))
+		Expect(pod.NodeSelector).To(HaveKeyWithValue("pool", "jobs"))
+		Expect(pod.RestartPolicy).To(Equal(v1.RestartPolicyNever))
+		Expect(job.Spec.Template.Labels).To(HaveKeyWithValue("azure.workload.identity/use", "true"))
+		Expect(job.Labels).To(HaveKeyWithValue(runner.ExecuterLabel, "sales-0-cluster1"))
+		Expect(pod.Containers).To(HaveLen(1))
+		Expect(pod.Containers[0].Image).To(Equal("schemaop:test"))
+		Expect(pod.Containers[0].Args).To(ConsistOf("--execute=default/sales-0-cluster1", "--job=sales-0-cluster1-run-1"))
+		Expect(pod.Containers[0].Resources.Limits.Memory().String()).To(Equal("2Gi"))
+	})
+
+	It("Should default to the configured image", func() {
+		executer.Spec.Runner.Image = ""
+		_, err := runner.NewJob(executer, "sales-0-cluster1-run-1")
+		Expect(err).To(HaveOccurred())
+
+		viper.Set(config.JobImage, "schemaop:default")
+		defer viper.Set(config.JobImage, "")
+		job, err := runner.NewJob(executer, "sales-0-cluster1-run-1")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(job.Spec.Template.Spec.Containers[0].Image).To(Equal("schemaop:default"))
+	})
+
+	It("Should refuse images and service accounts not allowed by the operator", func() {
+		viper.Set(config.JobImage, "schemaop:default")
+		defer viper.Set(config.JobImage, "")
+
+		executer.Spec.Runner.Image = "attacker/image:latest"
+		_, err := runner.NewJob(executer, "sales-0-cluster1-run-1")
+		Expect(err).To(MatchError(ContainSubstring("attacker/image:latest")))
+
+		executer.Spec.Runner.Image = ""
+		executer.Spec.Runner.ServiceAccountName = "operator-admin"
+		_, err = runner.NewJob(executer, "sales-0-cluster1-run-1")
+		Expect(err).To(MatchError(ContainSubstring("default/operator-admin")))
+
+		// allowed by name in any namespace
+		viper.Set(config.JobServiceAccounts, "operator-admin")
+		job, err := runner.NewJob(executer, "sales-0-cluster1-run-1")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(job.Spec.Template.Spec.ServiceAccountName).To(Equal("operator-admin"))
+		Expect(job.Spec.Template.Spec.Containers[0].Image).To(Equal("schemaop:default"))
+	})
+
+	It("Should forward the operator settings to the job", func() {
+		GinkgoT().Setenv("SCHEMAOP_EXECUTION_TIMEOUT", "45m")
+		GinkgoT().Setenv("SCHEMAOP_PARALLEL_WORKERS", "4")
+		job, err := runner.NewJob(executer, "sales-0-cluster1-run-1")
+		Expect(err).NotTo(HaveOccurred())
+		env := job.Spec.Template.Spec.Containers[0].Env
+		Expect(env).To(ContainElement(v1.EnvVar{Name: "SCHEMAOP_EXECUTION_TIMEOUT", Value: "45m"}))
+		Expect(env).To(ContainElement(v1.EnvVar{Name: "SCHEMAOP_PARALLEL_WORKERS", Value: "4"}))
+	})
+
+	It("Should report the job state", func() {
+		job := &batchv1.Job{}
+		finished, _, _, _ := runner.JobFinished(job)
+		Expect(finished).To(BeFalse())
+
+		job.Status.Conditions = []batchv1.JobCondition{{Type: batchv1.JobFailed, Status: v1.ConditionTrue, Reason: "DeadlineExceeded", Message: "Job was active longer than specified deadline"}}
+		finished, succeeded, reason, _ := runner.JobFinished(job)
+		Expect(finished).To(BeTrue())
+		Expect(succeeded).To(BeFalse())
+		Expect(reason).To(Equal("DeadlineExceeded"))
+
+		job.Status.Conditions = []batchv1.JobCondition{{Type: batchv1.JobComplete, Status: v1.ConditionTrue}}
+		finished, succeeded, _, _ = runner.JobFinished(job)
+		Expect(finished).To(BeTrue())
+		Expect(succeeded).To(BeTrue())
+	})
+
+	It("Should publish the execution result from the job", func() {
+		scheme := runtime.NewScheme()
+		Expect(clientgoscheme.AddToScheme(scheme)).To(Succeed())
+		Expect(schemav1alpha1.AddToScheme(scheme)).To(Succeed())
+		job, err := runner.NewJob(executer, "sales-0-cluster1-run-1")
+		Expect(err).NotTo(HaveOccurred())
+		executer.Status.Job = job.Name
+		// the configmap has no kql - so the execution fails before running delta-kusto
+		cfgMap := &v1.ConfigMap{ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: "sales-0"}}
+		c := fake.NewClientBuilder().WithScheme(scheme).WithObjects(executer, cfgMap, job).Build()
+		ctx := context.Background()
+
+		err = runner.RunJob(ctx, c, types.NamespacedName{Namespace: "default", Name: executer.Name}, job.Name)
+		Expect(err).To(HaveOccurred())
+
+		result, published, err := runner.GetJobResult(ctx, c, "default", job.Name)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(published).To(BeTrue())
+		Expect(result.Error).To(ContainSubstring("no kql found"))
+		Expect(result.TimedOut).To(BeFalse())
+
+		_, published, err = runner.GetJobResult(ctx, c, "default", "sales-0-cluster1-run-2")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(published).To(BeFalse())
+	})
+
+	It("Should not execute the targets of another job", func() {
+		scheme := runtime.NewScheme()
+		Expect(clientgoscheme.AddToScheme(scheme)).To(Succeed())
+		Expect(schemav1alpha1.AddToScheme(scheme)).To(Succeed())
+		job, err := runner.NewJob(executer, "sales-0-cluster1-run-2")
+		Expect(err).NotTo(HaveOccurred())
+		// the status wasn't updated for the job - its targets may be stale
+		executer.Status.Job = "sales-0-cluster1-run-1"
+		executer.Status.Targets = schemav1alpha1.ClusterTargets{DBs: []string{"db1"}}
+		cfgMap := &v1.ConfigMap{ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: "sales-0"}, Data: map[string]string{"kql": ".create table T (a:string)"}}
+		c := fake.NewClientBuilder().WithScheme(scheme).WithObjects(executer, cfgMap, job).Build()
+		ctx := context.Background()
+
+		err = runner.RunJob(ctx, c, types.NamespacedName{Namespace: "default", Name: executer.Name}, job.Name)
+		Expect(err).To(MatchError(ContainSubstring("not of this job")))
+		result, published, err := runner.GetJobResult(ctx, c, "default", job.Name)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(published).To(BeTrue())
+		Expect(result.Done.DBs).To(BeEmpty())
+		Expect(result.Error).To(ContainSubstring("not of this job"))
+	})
+})
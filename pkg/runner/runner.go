@@ -0,0 +1,166 @@
+package runner
+
+// Copyright (c) Microsoft Corporation.
+// Licensed under the MIT License.
+import (
+	"context"
+	"sync"
+	"time"
+
+	schemav1alpha1 "github.com/microsoft/azure-schema-operator/apis/dbschema/v1alpha1"
+	"github.com/microsoft/azure-schema-operator/pkg/config"
+	"github.com/rs/zerolog/log"
+	"github.com/spf13/viper"
+)
+
+// ExecuteFunc runs an execution in the background.
+// The context is cancelled when the manager stops.
+// `progress` reports the completed percentage of the execution.
+type ExecuteFunc func(ctx context.Context, progress func(pct int)) (schemav1alpha1.ClusterTargets, error)
+
+// Run is the state of a background execution
+type Run struct {
+	// Key identifies the run, e.g. the executer namespaced name
+	Key     string
+	Started time.Time
+	// Finished is set once the execution returned
+	Finished bool
+	// CompletedPCT is the last reported progress of the execution
+	CompletedPCT int
+	// Done contains the executed targets
+	Done schemav1alpha1.ClusterTargets
+	Err  error
+
+	// cancel stops the execution, forgotten runs are dropped once they return
+	cancel    context.CancelFunc
+	forgotten bool
+}
+
+// Runner runs executions in the background so the reconcile workers are not blocked by long schema runs.
+// The reconcilers submit executions and poll their state until they finish.
+// Runs are tracked in memory: a `Running` executer without a run in the runner was interrupted (e.g. by a restart).
+type Runner struct {
+	mu     sync.Mutex
+	runs   map[string]*Run
+	wg     sync.WaitGroup
+	ctx    context.Context
+	cancel context.CancelFunc
+}
+
+// NewRunner returns a new execution `Runner`
+func NewRunner() *Runner {
+	ctx, cancel := context.WithCancel(context.Background())
+	return &Runner{
+		runs:   make(map[string]*Run),
+		ctx:    ctx,
+		cancel: cancel,
+	}
+}
+
+// Submit starts `execute` in the background under `key`.
+// It returns false if a run with the same key is already tracked.
+func (r *Runner) Submit(key string, execute ExecuteFunc) bool {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if _, ok := r.runs[key]; ok {
+		log.Info().Msgf("execution %s is already tracked", key)
+		return false
+	}
+	ctx, cancel := context.WithCancel(r.ctx)
+	run := &Run{Key: key, Started: time.Now(), cancel: cancel}
+	r.runs[key] = run
+	r.wg.Add(1)
+	go func() {
+		defer r.wg.Done()
+		defer cancel()
+		log.Info().Msgf("execution %s started", key)
+		done, err := execute(ctx, func(pct int) {
+			r.mu.Lock()
+			defer r.mu.Unlock()
+			run.CompletedPCT = pct
+		})
+		r.mu.Lock()
+		defer r.mu.Unlock()
+		run.Done = done
+		run.Err = err
+		run.Finished = true
+		if run.forgotten && r.runs[key] == run {
+			delete(r.runs, key)
+		}
+		log.Info().Err(err).Msgf("execution %s finished after %s", key, time.Since(run.Started))
+	}()
+	return true
+}
+
+// Get returns a copy of the run tracked under `key`
+func (r *Runner) Get(key string) (Run, bool) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	run, ok := r.runs[key]
+	if !ok {
+		return Run{}, false
+	}
+	copied := *run
+	copied.cancel = nil
+	return copied, true
+}
+
+// Forget stops tracking a finished run, once its result was recorded.
+func (r *Runner) Forget(key string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if run, ok := r.runs[key]; ok && run.Finished {
+		delete(r.runs, key)
+	}
+}
+
+// Cancel stops the run tracked under `key` and stops tracking it, e.g. when its executer was deleted.
+// A running execution is dropped once it returns, its result is not recorded.
+func (r *Runner) Cancel(key string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	run, ok := r.runs[key]
+	if !ok {
+		return
+	}
+	log.Info().Msgf("cancelling execution %s", key)
+	run.cancel()
+	if run.Finished {
+		delete(r.runs, key)
+		return
+	}
+	run.forgotten = true
+}
+
+// Start waits until the manager stops, then cancels the running executions and waits for them to return.
+// It implements the controller-runtime `manager.Runnable` interface.
+func (r *Runner) Start(ctx context.Context) error {
+	<-ctx.Done()
+	log.Info().Msg("stopping the running executions")
+	r.cancel()
+	r.wg.Wait()
+	return nil
+}
+
+// NeedLeaderElection returns false - the runner only runs what the (leading) reconcilers submit.
+func (r *Runner) NeedLeaderElection() bool {
+	return false
+}
+
+// ExecutionTimeout returns the execution timeout of the executer - the one set on the deployment or the configured default.
+// Zero means no timeout.
+func ExecutionTimeout(spec schemav1alpha1.ClusterExecuterSpec) time.Duration {
+	if spec.ExecutionTimeout != nil {
+		return spec.ExecutionTimeout.Duration
+	}
+	return viper.GetDuration(config.ExecutionTimeout)
+}
+
+// ExecutionContext returns the context for the execution, bounded by the execution timeout.
+func ExecutionContext(ctx context.Context, spec schemav1alpha1.ClusterExecuterSpec) (context.Context, context.CancelFunc) {
+	timeout := ExecutionTimeout(spec)
+	if timeout <= 0 {
+		return context.WithCancel(ctx)
+	}
+	return context.WithTimeout(ctx, timeout)
+}
@@ -0,0 +1,113 @@
+package runner_test
+
+// Copyright (c) Microsoft Corporation.
+// Licensed under the MIT License.
+import (
+	"context"
+	"errors"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+
+	schemav1alpha1 "github.com/microsoft/azure-schema-operator/apis/dbschema/v1alpha1"
+	"github.com/microsoft/azure-schema-operator/pkg/runner"
+)
+
+var _ = Describe("Runner", func() {
+	const key = "default/executer-cluster1"
+
+	It("Should track the run until it is forgotten", func() {
+		r := runner.NewRunner()
+		release := make(chan struct{})
+		submitted := r.Submit(key, func(ctx context.Context, progress func(pct int)) (schemav1alpha1.ClusterTargets, error) {
+			progress(50)
+			<-release
+			return schemav1alpha1.ClusterTargets{DBs: []string{"db1"}}, nil
+		})
+		Expect(submitted).To(BeTrue())
+		Eventually(func() int {
+			run, _ := r.Get(key)
+			return run.CompletedPCT
+		}).Should(Equal(50))
+		run, ok := r.Get(key)
+		Expect(ok).To(BeTrue())
+		Expect(run.Finished).To(BeFalse())
+
+		By("ignoring a second submit of a tracked run")
+		Expect(r.Submit(key, nil)).To(BeFalse())
+
+		By("keeping a running run when forgotten")
+		r.Forget(key)
+		_, ok = r.Get(key)
+		Expect(ok).To(BeTrue())
+
+		close(release)
+		Eventually(func() bool {
+			run, _ := r.Get(key)
+			return run.Finished
+		}).Should(BeTrue())
+		run, _ = r.Get(key)
+		Expect(run.Err).NotTo(HaveOccurred())
+		Expect(run.Done.DBs).To(ConsistOf("db1"))
+
+		r.Forget(key)
+		_, ok = r.Get(key)
+		Expect(ok).To(BeFalse())
+	})
+
+	It("Should report the execution error", func() {
+		r := runner.NewRunner()
+		r.Submit(key, func(ctx context.Context, progress func(pct int)) (schemav1alpha1.ClusterTargets, error) {
+			return schemav1alpha1.ClusterTargets{}, errors.New("sqlpackage failed")
+		})
+		Eventually(func() bool {
+			run, _ := r.Get(key)
+			return run.Finished
+		}).Should(BeTrue())
+		run, _ := r.Get(key)
+		Expect(run.Err).To(MatchError("sqlpackage failed"))
+	})
+
+	It("Should cancel the running executions when the manager stops", func() {
+		r := runner.NewRunner()
+		r.Submit(key, func(ctx context.Context, progress func(pct int)) (schemav1alpha1.ClusterTargets, error) {
+			<-ctx.Done()
+			return schemav1alpha1.ClusterTargets{}, ctx.Err()
+		})
+		mgrCtx, stop := context.WithCancel(context.Background())
+		stopped := make(chan error)
+		go func() {
+			stopped <- r.Start(mgrCtx)
+		}()
+		stop()
+		Eventually(stopped).Should(Receive(BeNil()))
+		run, _ := r.Get(key)
+		Expect(run.Finished).To(BeTrue())
+		Expect(run.Err).To(MatchError(context.Canceled))
+	})
+
+	It("Should cancel and drop the run of a deleted executer", func() {
+		r := runner.NewRunner()
+		r.Submit(key, func(ctx context.Context, progress func(pct int)) (schemav1alpha1.ClusterTargets, error) {
+			<-ctx.Done()
+			return schemav1alpha1.ClusterTargets{}, ctx.Err()
+		})
+		r.Cancel(key)
+		Eventually(func() bool {
+			_, ok := r.Get(key)
+			return ok
+		}).Should(BeFalse())
+
+		By("dropping a finished run")
+		r.Submit(key, func(ctx context.Context, progress func(pct int)) (schemav1alpha1.ClusterTargets, error) {
+			return schemav1alpha1.ClusterTargets{}, nil
+		})
+		Eventually(func() bool {
+			run, _ := r.Get(key)
+			return run.Finished
+		}).Should(BeTrue())
+		r.Cancel(key)
+		_, ok := r.Get(key)
+		Expect(ok).To(BeFalse())
+	})
+})
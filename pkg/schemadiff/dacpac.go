@@ -0,0 +1,142 @@
+package schemadiff
+
+// Copyright (c) Microsoft Corporation.
+// Licensed under the MIT License.
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+)
+
+const (
+	dacpacModelPart = "model.xml"
+	// maxModelSize bounds the size of the dacpac model we are willing to load into memory
+	maxModelSize = 256 << 20
+)
+
+// IsDacPac checks if the data is a dacpac - a zip archive with a model part
+func IsDacPac(data []byte) bool {
+	_, err := modelFile(data)
+	return err == nil
+}
+
+func modelFile(data []byte) (*zip.File, error) {
+	archive, err := zip.NewReader(bytes.NewReader(data), int64(len(data)))
+	if err != nil {
+		return nil, err
+	}
+	for _, f := range archive.File {
+		if strings.EqualFold(f.Name, dacpacModelPart) {
+			return f, nil
+		}
+	}
+	return nil, errors.New("no model found in the dacpac")
+}
+
+// ModelElements returns the top level elements of the dacpac model keyed by `<Type> <Name>`, e.g. `SqlTable [dbo].[Orders]`.
+// The values are the element XML.
+func ModelElements(dacpac []byte) (map[string]string, error) {
+	elements := make(map[string]string)
+	if len(dacpac) == 0 {
+		return elements, nil
+	}
+	f, err := modelFile(dacpac)
+	if err != nil {
+		return nil, err
+	}
+	rc, err := f.Open()
+	if err != nil {
+		return nil, err
+	}
+	defer rc.Close()
+	model, err := io.ReadAll(io.LimitReader(rc, maxModelSize))
+	if err != nil {
+		return nil, err
+	}
+
+	// DataSchemaModel > Model > Element
+	decoder := xml.NewDecoder(bytes.NewReader(model))
+	depth := 0
+	unnamed := make(map[string]int)
+	for {
+		offset := decoder.InputOffset()
+		token, err := decoder.Token()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("invalid dacpac model: %w", err)
+		}
+		switch t := token.(type) {
+		case xml.StartElement:
+			depth++
+			if depth != 3 || t.Name.Local != "Element" {
+				continue
+			}
+			if err = decoder.Skip(); err != nil {
+				return nil, fmt.Errorf("invalid dacpac model: %w", err)
+			}
+			depth--
+			elementType, name := attr(t, "Type"), attr(t, "Name")
+			if name == "" {
+				// e.g. the database options
+				unnamed[elementType]++
+				name = fmt.Sprintf("#%d", unnamed[elementType])
+			}
+			elements[elementType+" "+name] = string(model[offset:decoder.InputOffset()]) + "\n"
+		case xml.EndElement:
+			depth--
+		}
+	}
+	return elements, nil
+}
+
+func attr(element xml.StartElement, name string) string {
+	for _, a := range element.Attr {
+		if a.Name.Local == name {
+			return a.Value
+		}
+	}
+	return ""
+}
+
+// DacPacs returns the differences between the models of two dacpacs:
+// the added (+), removed (-) and changed (~) elements, followed by the diff of each changed element.
+func DacPacs(fromName, toName string, from, to []byte) (string, error) {
+	fromElements, err := ModelElements(from)
+	if err != nil {
+		return "", fmt.Errorf("%s: %w", fromName, err)
+	}
+	toElements, err := ModelElements(to)
+	if err != nil {
+		return "", fmt.Errorf("%s: %w", toName, err)
+	}
+	summary := &strings.Builder{}
+	details := &strings.Builder{}
+	for _, key := range keys(fromElements, toElements) {
+		a, inFrom := fromElements[key]
+		b, inTo := toElements[key]
+		switch {
+		case !inFrom:
+			fmt.Fprintf(summary, "+ %s\n", key)
+		case !inTo:
+			fmt.Fprintf(summary, "- %s\n", key)
+		case a != b:
+			fmt.Fprintf(summary, "~ %s\n", key)
+			diff, err := Text(fromName+": "+key, toName+": "+key, a, b)
+			if err != nil {
+				return "", err
+			}
+			details.WriteString(diff)
+		}
+	}
+	if summary.Len() == 0 {
+		// only non model parts (e.g. deploy scripts or metadata) changed
+		return fmt.Sprintf("--- %s\n+++ %s\ndacpac changed, the model is the same\n", fromName, toName), nil
+	}
+	return fmt.Sprintf("--- %s\n+++ %s\n%s%s", fromName, toName, summary.String(), details.String()), nil
+}
@@ -0,0 +1,115 @@
+package schemadiff
+
+// Copyright (c) Microsoft Corporation.
+// Licensed under the MIT License.
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/pmezard/go-difflib/difflib"
+	v1 "k8s.io/api/core/v1"
+)
+
+// contextLines is the number of unchanged lines shown around the changes
+const contextLines = 3
+
+// Text returns the unified diff of two texts, empty if they are equal
+func Text(fromName, toName, from, to string) (string, error) {
+	if from == to {
+		return "", nil
+	}
+	return difflib.GetUnifiedDiffString(difflib.UnifiedDiff{
+		A:        difflib.SplitLines(from),
+		B:        difflib.SplitLines(to),
+		FromFile: fromName,
+		ToFile:   toName,
+		Context:  contextLines,
+	})
+}
+
+// ConfigMaps returns the differences between two versions of a schema `ConfigMap`, key by key.
+// KQL and scripts are compared as text, Avro schemas (`schema`) as formatted JSON and dacpacs by their model elements.
+// A nil `ConfigMap` is handled as an empty one.
+func ConfigMaps(from, to *v1.ConfigMap, fromLabel, toLabel string) (string, error) {
+	if from == nil {
+		from = &v1.ConfigMap{}
+	}
+	if to == nil {
+		to = &v1.ConfigMap{}
+	}
+	out := &strings.Builder{}
+	for _, key := range keys(from.Data, to.Data) {
+		a, b := from.Data[key], to.Data[key]
+		if a == b {
+			continue
+		}
+		if key == "schema" {
+			a, b = formatJSON(a), formatJSON(b)
+		}
+		diff, err := Text(fromLabel+"/"+key, toLabel+"/"+key, a, b)
+		if err != nil {
+			return "", err
+		}
+		out.WriteString(diff)
+	}
+	for _, key := range keys(from.BinaryData, to.BinaryData) {
+		a, b := from.BinaryData[key], to.BinaryData[key]
+		if bytes.Equal(a, b) {
+			continue
+		}
+		diff, err := binary(fromLabel+"/"+key, toLabel+"/"+key, a, b)
+		if err != nil {
+			return "", err
+		}
+		out.WriteString(diff)
+	}
+	return out.String(), nil
+}
+
+// binary compares dacpacs by their model, and other binary data by checksum
+func binary(fromName, toName string, from, to []byte) (string, error) {
+	if (len(from) == 0 || IsDacPac(from)) && (len(to) == 0 || IsDacPac(to)) {
+		return DacPacs(fromName, toName, from, to)
+	}
+	return fmt.Sprintf("--- %s\n+++ %s\nbinary data changed: %s -> %s\n", fromName, toName, checksum(from), checksum(to)), nil
+}
+
+func checksum(data []byte) string {
+	if len(data) == 0 {
+		return "(none)"
+	}
+	hash := sha256.Sum256(data)
+	return "sha256:" + hex.EncodeToString(hash[:8])
+}
+
+// formatJSON indents the JSON so it is compared line by line, invalid JSON is returned as is
+func formatJSON(data string) string {
+	if strings.TrimSpace(data) == "" {
+		return data
+	}
+	formatted := &bytes.Buffer{}
+	if err := json.Indent(formatted, []byte(data), "", "  "); err != nil {
+		return data
+	}
+	formatted.WriteString("\n")
+	return formatted.String()
+}
+
+func keys[T any](a, b map[string]T) []string {
+	all := make([]string, 0, len(a)+len(b))
+	for key := range a {
+		all = append(all, key)
+	}
+	for key := range b {
+		if _, ok := a[key]; !ok {
+			all = append(all, key)
+		}
+	}
+	sort.Strings(all)
+	return all
+}
@@ -0,0 +1,105 @@
+package schemadiff_test
+
+// Copyright (c) Microsoft Corporation.
+// Licensed under the MIT License.
+import (
+	"archive/zip"
+	"bytes"
+	"fmt"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	v1 "k8s.io/api/core/v1"
+
+	"github.com/microsoft/azure-schema-operator/pkg/schemadiff"
+)
+
+const modelTemplate = `<?xml version="1.0" encoding="utf-8"?>
+<DataSchemaModel FileFormatVersion="1.2" SchemaVersion="2.9" xmlns="http://schemas.microsoft.com/sqlserver/dac/Serialization/2012/02">
+	<Model>
+		<Element Type="SqlDatabaseOptions">
+			<Property Name="Collation" Value="SQL_Latin1_General_CP1_CI_AS" />
+		</Element>
+		<Element Type="SqlTable" Name="[dbo].[Customers]">
+			<Relationship Name="Columns">
+				<Entry>
+					<Element Type="SqlSimpleColumn" Name="[dbo].[Customers].[Id]" />
+				</Entry>%s
+			</Relationship>
+		</Element>%s
+	</Model>
+</DataSchemaModel>
+`
+
+func dacpac(column, element string) []byte {
+	buf := &bytes.Buffer{}
+	w := zip.NewWriter(buf)
+	f, err := w.Create("model.xml")
+	Expect(err).NotTo(HaveOccurred())
+	_, err = f.Write([]byte(fmt.Sprintf(modelTemplate, column, element)))
+	Expect(err).NotTo(HaveOccurred())
+	Expect(w.Close()).To(Succeed())
+	return buf.Bytes()
+}
+
+var _ = Describe("Schemadiff", func() {
+	It("Should diff the text keys", func() {
+		from := &v1.ConfigMap{Data: map[string]string{"kql": ".create table T (a:string)\n", "templateName": "tenant"}}
+		to := &v1.ConfigMap{Data: map[string]string{"kql": ".create table T (a:string, b:int)\n", "templateName": "tenant"}}
+		diff, err := schemadiff.ConfigMaps(from, to, "revision-1", "revision-2")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(diff).To(ContainSubstring("--- revision-1/kql\n+++ revision-2/kql\n"))
+		Expect(diff).To(ContainSubstring("-.create table T (a:string)\n+.create table T (a:string, b:int)\n"))
+		Expect(diff).NotTo(ContainSubstring("templateName"))
+
+		diff, err = schemadiff.ConfigMaps(to, to, "revision-2", "revision-2")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(diff).To(BeEmpty())
+	})
+
+	It("Should diff avro schemas as formatted json", func() {
+		from := &v1.ConfigMap{Data: map[string]string{"schema": `{"type":"record","name":"Order","fields":[{"name":"id","type":"string"}]}`}}
+		to := &v1.ConfigMap{Data: map[string]string{"schema": `{"type":"record","name":"Order","fields":[{"name":"id","type":"string"},{"name":"total","type":"double"}]}`}}
+		diff, err := schemadiff.ConfigMaps(from, to, "revision-1", "revision-2")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(diff).To(ContainSubstring(`+      "name": "total",`))
+		Expect(diff).NotTo(ContainSubstring(`-    {`))
+	})
+
+	It("Should diff dacpacs by their model elements", func() {
+		from := dacpac("", `
+		<Element Type="SqlView" Name="[dbo].[Old]" />`)
+		to := dacpac(`
+				<Entry>
+					<Element Type="SqlSimpleColumn" Name="[dbo].[Customers].[Name]" />
+				</Entry>`, `
+		<Element Type="SqlTable" Name="[dbo].[Orders]" />`)
+		Expect(schemadiff.IsDacPac(from)).To(BeTrue())
+
+		elements, err := schemadiff.ModelElements(to)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(elements).To(HaveKey("SqlDatabaseOptions #1"))
+		Expect(elements).To(HaveKey("SqlTable [dbo].[Orders]"))
+		Expect(elements).NotTo(HaveKey("SqlSimpleColumn [dbo].[Customers].[Name]"))
+
+		diff, err := schemadiff.ConfigMaps(
+			&v1.ConfigMap{BinaryData: map[string][]byte{"dacpac": from}},
+			&v1.ConfigMap{BinaryData: map[string][]byte{"dacpac": to}},
+			"revision-1", "revision-2")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(diff).To(ContainSubstring("- SqlView [dbo].[Old]\n"))
+		Expect(diff).To(ContainSubstring("+ SqlTable [dbo].[Orders]\n"))
+		Expect(diff).To(ContainSubstring("~ SqlTable [dbo].[Customers]\n"))
+		Expect(diff).To(ContainSubstring(`+					<Element Type="SqlSimpleColumn" Name="[dbo].[Customers].[Name]" />`))
+		Expect(diff).NotTo(ContainSubstring("SqlDatabaseOptions"))
+	})
+
+	It("Should compare other binary data by checksum", func() {
+		diff, err := schemadiff.ConfigMaps(
+			&v1.ConfigMap{BinaryData: map[string][]byte{"blob": []byte("a")}},
+			&v1.ConfigMap{BinaryData: map[string][]byte{"blob": []byte("b")}},
+			"revision-1", "revision-2")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(diff).To(ContainSubstring("binary data changed: sha256:"))
+	})
+})
@@ -0,0 +1,15 @@
+package schemadiff_test
+
+// Copyright (c) Microsoft Corporation.
+// Licensed under the MIT License.
+import (
+	"testing"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+func TestSchemadiff(t *testing.T) {
+	RegisterFailHandler(Fail)
+	RunSpecs(t, "Schemadiff Suite")
+}
@@ -0,0 +1,258 @@
+package schemafiles
+
+// Copyright (c) Microsoft Corporation.
+// Licensed under the MIT License.
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+
+	v1 "k8s.io/api/core/v1"
+
+	schemav1alpha1 "github.com/microsoft/azure-schema-operator/apis/dbschema/v1alpha1"
+	"github.com/microsoft/azure-schema-operator/pkg/cosmos"
+	"github.com/microsoft/azure-schema-operator/pkg/eventhubs/azure/schemaregistry"
+	"github.com/microsoft/azure-schema-operator/pkg/schemadiff"
+	"github.com/microsoft/azure-schema-operator/pkg/sqlutils"
+)
+
+const (
+	// KQLKey is the source `ConfigMap` key of the kusto schema
+	KQLKey = "kql"
+	// DacPacKey is the source `ConfigMap` binary key of the SQL Server dacpac
+	DacPacKey = "dacpac"
+	// SchemaKey is the source `ConfigMap` key of the event hubs avro schema
+	SchemaKey = "schema"
+)
+
+// kqlExtensions are the extensions of the KQL files bundled from directories
+var kqlExtensions = []string{".kql", ".csl"}
+
+// DetectType returns the DB type of the schema file by its extension - directories are bundled KQL files.
+func DetectType(path string) (schemav1alpha1.DBTypeEnum, error) {
+	info, err := os.Stat(path)
+	if err != nil {
+		return "", err
+	}
+	if info.IsDir() {
+		return schemav1alpha1.DBTypeKusto, nil
+	}
+	switch ext := strings.ToLower(filepath.Ext(path)); {
+	case ext == ".dacpac":
+		return schemav1alpha1.DBTypeSQLServer, nil
+	case ext == ".avsc" || ext == ".json":
+		return schemav1alpha1.DBTypeEventhub, nil
+	case isKQLFile(path):
+		return schemav1alpha1.DBTypeKusto, nil
+	default:
+		return "", fmt.Errorf("unable to detect the schema type of %s", path)
+	}
+}
+
+func isKQLFile(path string) bool {
+	ext := strings.ToLower(filepath.Ext(path))
+	for _, kqlExt := range kqlExtensions {
+		if ext == kqlExt {
+			return true
+		}
+	}
+	return false
+}
+
+// Apply validates the schema file (or directory of KQL files) of the type and writes it into the source `ConfigMap`.
+func Apply(cfgMap *v1.ConfigMap, path string, dbType schemav1alpha1.DBTypeEnum) error {
+	switch dbType {
+	case schemav1alpha1.DBTypeKusto:
+		kql, err := ReadKQL(path)
+		if err != nil {
+			return err
+		}
+		if cfgMap.Data == nil {
+			cfgMap.Data = make(map[string]string)
+		}
+		cfgMap.Data[KQLKey] = kql
+	case schemav1alpha1.DBTypeSQLServer:
+		dacpac, err := os.ReadFile(path)
+		if err != nil {
+			return err
+		}
+		if err := ValidateDacPac(dacpac); err != nil {
+			return fmt.Errorf("invalid dacpac %s: %w", path, err)
+		}
+		if cfgMap.BinaryData == nil {
+			cfgMap.BinaryData = make(map[string][]byte)
+		}
+		cfgMap.BinaryData[DacPacKey] = dacpac
+	case schemav1alpha1.DBTypeEventhub:
+		schema, err := os.ReadFile(path)
+		if err != nil {
+			return err
+		}
+		if err := ValidateAvro(schema); err != nil {
+			return fmt.Errorf("invalid avro schema %s: %w", path, err)
+		}
+		if cfgMap.Data == nil {
+			cfgMap.Data = make(map[string]string)
+		}
+		cfgMap.Data[SchemaKey] = string(schema)
+	case schemav1alpha1.DBTypeCosmos:
+		containers, err := os.ReadFile(path)
+		if err != nil {
+			return err
+		}
+		if _, err := cosmos.ParseContainers(string(containers)); err != nil {
+			return fmt.Errorf("invalid container definitions %s: %w", path, err)
+		}
+		if cfgMap.Data == nil {
+			cfgMap.Data = make(map[string]string)
+		}
+		cfgMap.Data[cosmos.ContainersKey] = string(containers)
+	case schemav1alpha1.DBTypePostgres:
+		migrations, err := ReadMigrations(path)
+		if err != nil {
+			return err
+		}
+		if cfgMap.Data == nil {
+			cfgMap.Data = make(map[string]string)
+		}
+		for key, script := range migrations {
+			cfgMap.Data[key] = script
+		}
+	default:
+		return fmt.Errorf("unknown schema type %q", dbType)
+	}
+	return nil
+}
+
+// ReadKQL reads a KQL file, or bundles the KQL files of a directory (recursively, in lexical order).
+func ReadKQL(path string) (string, error) {
+	info, err := os.Stat(path)
+	if err != nil {
+		return "", err
+	}
+	if !info.IsDir() {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return "", err
+		}
+		if err := ValidateKQL(string(data)); err != nil {
+			return "", fmt.Errorf("invalid kql %s: %w", path, err)
+		}
+		return string(data), nil
+	}
+
+	var bundle strings.Builder
+	err = filepath.WalkDir(path, func(file string, entry fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if entry.IsDir() || !isKQLFile(file) {
+			return nil
+		}
+		data, err := os.ReadFile(file)
+		if err != nil {
+			return err
+		}
+		rel, err := filepath.Rel(path, file)
+		if err != nil {
+			return err
+		}
+		if err := ValidateKQL(string(data)); err != nil {
+			return fmt.Errorf("invalid kql %s: %w", rel, err)
+		}
+		if bundle.Len() > 0 {
+			bundle.WriteString("\n")
+		}
+		fmt.Fprintf(&bundle, "// %s\n%s", filepath.ToSlash(rel), strings.TrimRight(string(data), "\n"))
+		bundle.WriteString("\n")
+		return nil
+	})
+	if err != nil {
+		return "", err
+	}
+	if bundle.Len() == 0 {
+		return "", fmt.Errorf("no kql files found in %s", path)
+	}
+	return bundle.String(), nil
+}
+
+// ReadMigrations reads a versioned migration script (`V<version>__<description>.sql`),
+// or the migration scripts of a directory, keyed by their file name.
+func ReadMigrations(path string) (map[string]string, error) {
+	info, err := os.Stat(path)
+	if err != nil {
+		return nil, err
+	}
+	files := []string{path}
+	if info.IsDir() {
+		files, err = filepath.Glob(filepath.Join(path, "V*.sql"))
+		if err != nil {
+			return nil, err
+		}
+	}
+	migrations := make(map[string]string)
+	for _, file := range files {
+		data, err := os.ReadFile(file)
+		if err != nil {
+			return nil, err
+		}
+		migrations[filepath.Base(file)] = string(data)
+	}
+	parsed, err := sqlutils.ParseMigrations(migrations)
+	if err != nil {
+		return nil, err
+	}
+	if len(parsed) == 0 || len(parsed) != len(migrations) {
+		return nil, fmt.Errorf("expected migration scripts named V<version>__<description>.sql in %s", path)
+	}
+	return migrations, nil
+}
+
+// ValidateKQL checks the KQL script starts with a control command, as delta-kusto expects
+func ValidateKQL(kql string) error {
+	scanner := bufio.NewScanner(strings.NewReader(kql))
+	scanner.Buffer(make([]byte, 0, 64*1024), len(kql)+1)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "//") {
+			continue
+		}
+		if !strings.HasPrefix(line, ".") {
+			return fmt.Errorf("expected a control command, found %q", line)
+		}
+		return nil
+	}
+	if err := scanner.Err(); err != nil {
+		return err
+	}
+	return errors.New("no commands found")
+}
+
+// ValidateDacPac checks the data is a dacpac with a readable model
+func ValidateDacPac(data []byte) error {
+	if !schemadiff.IsDacPac(data) {
+		return errors.New("not a dacpac archive")
+	}
+	_, err := schemadiff.ModelElements(data)
+	return err
+}
+
+// ValidateAvro checks the data is an avro schema as registered in the schema registry
+func ValidateAvro(data []byte) error {
+	schema := schemaregistry.Schema{}
+	if err := json.Unmarshal(data, &schema); err != nil {
+		return err
+	}
+	if schema.Type == "" {
+		return errors.New("the schema type is missing")
+	}
+	if schema.Type == "record" && schema.Name == "" {
+		return errors.New("the record name is missing")
+	}
+	return nil
+}
@@ -0,0 +1,131 @@
+package schemafiles_test
+
+// Copyright (c) Microsoft Corporation.
+// Licensed under the MIT License.
+import (
+	"archive/zip"
+	"bytes"
+	"os"
+	"path/filepath"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	v1 "k8s.io/api/core/v1"
+
+	schemav1alpha1 "github.com/microsoft/azure-schema-operator/apis/dbschema/v1alpha1"
+	"github.com/microsoft/azure-schema-operator/pkg/schemafiles"
+)
+
+const model = `<?xml version="1.0" encoding="utf-8"?>
+<DataSchemaModel xmlns="http://schemas.microsoft.com/sqlserver/dac/Serialization/2012/02">
+	<Model>
+		<Element Type="SqlTable" Name="[dbo].[Customers]" />
+	</Model>
+</DataSchemaModel>
+`
+
+const avro = `{"type": "record", "name": "Order", "namespace": "com.contoso", "fields": [{"name": "id", "type": "string"}]}`
+
+func writeFile(dir, name string, data []byte) string {
+	path := filepath.Join(dir, name)
+	Expect(os.MkdirAll(filepath.Dir(path), 0o755)).To(Succeed())
+	Expect(os.WriteFile(path, data, 0o600)).To(Succeed())
+	return path
+}
+
+func dacpac() []byte {
+	buf := &bytes.Buffer{}
+	w := zip.NewWriter(buf)
+	f, err := w.Create("model.xml")
+	Expect(err).NotTo(HaveOccurred())
+	_, err = f.Write([]byte(model))
+	Expect(err).NotTo(HaveOccurred())
+	Expect(w.Close()).To(Succeed())
+	return buf.Bytes()
+}
+
+var _ = Describe("Schemafiles", func() {
+	var dir string
+
+	BeforeEach(func() {
+		dir = GinkgoT().TempDir()
+	})
+
+	It("Should detect the type by the file extension", func() {
+		for name, dbType := range map[string]schemav1alpha1.DBTypeEnum{
+			"schema.kql":     schemav1alpha1.DBTypeKusto,
+			"schema.csl":     schemav1alpha1.DBTypeKusto,
+			"db.dacpac":      schemav1alpha1.DBTypeSQLServer,
+			"order.avsc":     schemav1alpha1.DBTypeEventhub,
+			"order.json":     schemav1alpha1.DBTypeEventhub,
+			"kql/tables.kql": schemav1alpha1.DBTypeKusto,
+		} {
+			path := writeFile(dir, name, []byte("x"))
+			Expect(schemafiles.DetectType(path)).To(Equal(dbType), name)
+		}
+		Expect(schemafiles.DetectType(filepath.Join(dir, "kql"))).To(Equal(schemav1alpha1.DBTypeKusto))
+
+		_, err := schemafiles.DetectType(writeFile(dir, "schema.txt", []byte("x")))
+		Expect(err).To(HaveOccurred())
+	})
+
+	It("Should write each type into its key", func() {
+		cfgMap := &v1.ConfigMap{}
+		Expect(schemafiles.Apply(cfgMap, writeFile(dir, "schema.kql", []byte(".create table T (a:string)\n")), schemav1alpha1.DBTypeKusto)).To(Succeed())
+		Expect(cfgMap.Data).To(HaveKeyWithValue("kql", ".create table T (a:string)\n"))
+
+		Expect(schemafiles.Apply(cfgMap, writeFile(dir, "db.dacpac", dacpac()), schemav1alpha1.DBTypeSQLServer)).To(Succeed())
+		Expect(cfgMap.BinaryData).To(HaveKeyWithValue("dacpac", dacpac()))
+
+		Expect(schemafiles.Apply(cfgMap, writeFile(dir, "order.avsc", []byte(avro)), schemav1alpha1.DBTypeEventhub)).To(Succeed())
+		Expect(cfgMap.Data).To(HaveKeyWithValue("schema", avro))
+
+		containers := "- id: events\n  partitionKey:\n    paths: [/tenantId]\n"
+		Expect(schemafiles.Apply(cfgMap, writeFile(dir, "containers.yaml", []byte(containers)), schemav1alpha1.DBTypeCosmos)).To(Succeed())
+		Expect(cfgMap.Data).To(HaveKeyWithValue("containers", containers))
+	})
+
+	It("Should reject invalid files", func() {
+		cfgMap := &v1.ConfigMap{}
+		Expect(schemafiles.Apply(cfgMap, writeFile(dir, "schema.kql", []byte("// tables\nT | take 10\n")), schemav1alpha1.DBTypeKusto)).NotTo(Succeed())
+		Expect(schemafiles.Apply(cfgMap, writeFile(dir, "empty.kql", []byte("// nothing\n")), schemav1alpha1.DBTypeKusto)).NotTo(Succeed())
+		Expect(schemafiles.Apply(cfgMap, writeFile(dir, "db.dacpac", []byte("not a zip")), schemav1alpha1.DBTypeSQLServer)).NotTo(Succeed())
+		Expect(schemafiles.Apply(cfgMap, writeFile(dir, "order.avsc", []byte(`{"type": "record"}`)), schemav1alpha1.DBTypeEventhub)).NotTo(Succeed())
+		Expect(schemafiles.Apply(cfgMap, writeFile(dir, "broken.avsc", []byte(`{"type": `)), schemav1alpha1.DBTypeEventhub)).NotTo(Succeed())
+		Expect(schemafiles.Apply(cfgMap, writeFile(dir, "containers.yaml", []byte("- id: events\n")), schemav1alpha1.DBTypeCosmos)).NotTo(Succeed())
+		Expect(cfgMap.Data).To(BeEmpty())
+		Expect(cfgMap.BinaryData).To(BeEmpty())
+	})
+
+	It("Should bundle directories of kql files", func() {
+		writeFile(dir, "tables/b.kql", []byte(".create table B (a:string)\n"))
+		writeFile(dir, "tables/a.kql", []byte(".create table A (a:string)\n"))
+		writeFile(dir, "functions.csl", []byte("// functions\n.create function F() { A }"))
+		writeFile(dir, "README.md", []byte("# not kql"))
+
+		kql, err := schemafiles.ReadKQL(dir)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(kql).To(Equal("// functions.csl\n// functions\n.create function F() { A }\n" +
+			"\n// tables/a.kql\n.create table A (a:string)\n" +
+			"\n// tables/b.kql\n.create table B (a:string)\n"))
+
+		_, err = schemafiles.ReadKQL(GinkgoT().TempDir())
+		Expect(err).To(HaveOccurred())
+	})
+
+	It("Should write the migration scripts of a directory into their keys", func() {
+		writeFile(dir, "migrations/V1__create_orders.sql", []byte("CREATE TABLE tenant_.orders (id INT);"))
+		writeFile(dir, "migrations/V2__add_status.sql", []byte("ALTER TABLE tenant_.orders ADD COLUMN status TEXT;"))
+		writeFile(dir, "migrations/README.md", []byte("# not a migration"))
+
+		cfgMap := &v1.ConfigMap{}
+		Expect(schemafiles.Apply(cfgMap, filepath.Join(dir, "migrations"), schemav1alpha1.DBTypePostgres)).To(Succeed())
+		Expect(cfgMap.Data).To(Equal(map[string]string{
+			"V1__create_orders.sql": "CREATE TABLE tenant_.orders (id INT);",
+			"V2__add_status.sql":    "ALTER TABLE tenant_.orders ADD COLUMN status TEXT;",
+		}))
+
+		Expect(schemafiles.Apply(cfgMap, writeFile(dir, "orders.sql", []byte("SELECT 1")), schemav1alpha1.DBTypePostgres)).NotTo(Succeed())
+		Expect(schemafiles.Apply(cfgMap, GinkgoT().TempDir(), schemav1alpha1.DBTypePostgres)).NotTo(Succeed())
+	})
+})
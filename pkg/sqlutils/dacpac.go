@@ -5,14 +5,15 @@ package sqlutils
 import (
 	"context"
 	"encoding/json"
+	"fmt"
 	"io"
 	"net/http"
 	"os"
-	"sync"
+	"path/filepath"
 
 	schemav1alpha1 "github.com/microsoft/azure-schema-operator/apis/dbschema/v1alpha1"
 	"github.com/microsoft/azure-schema-operator/pkg/config"
-	"github.com/microsoft/azure-schema-operator/pkg/utils"
+	"github.com/microsoft/azure-schema-operator/pkg/runlogs"
 	"github.com/rs/zerolog/log"
 	"github.com/spf13/viper"
 	v1 "k8s.io/api/core/v1"
@@ -20,101 +21,49 @@ import (
 	"sigs.k8s.io/controller-runtime/pkg/client"
 )
 
-type dacpacJob struct {
-	id           int
-	clusterUri   string
-	dbName       string
-	options      string
-	dacpac       string
-	templateName string
-	targetSchema string
-}
-
-type dacpacResult struct {
-	job      dacpacJob
-	executed bool
-	err      error
-}
-
 // TargetDacpacExecution runs dacpac on the target cluster for a specific schema
 // the template schema in the DacPac will be replaced by the target schema.
-func TargetDacpacExecution(clusterUri, dbName, options, dacpac, templateName, targetSchema string) (bool, error) {
+// The tenant dacpac is written next to the source dacpac, where sqlpackage finds the external dacpacs it references,
+// under a name of its own so parallel executions don't collide.
+func TargetDacpacExecution(ctx context.Context, clusterUri, dbName, options, dacpac, templateName, targetSchema string, renameMode SchemaRenameMode) (bool, error) {
 	log.Info().Msgf("will run the DacPac on %s schema", targetSchema)
-	dstDacPac := "/tmp/" + targetSchema + ".dacpac"
+	f, err := os.CreateTemp(filepath.Dir(dacpac), "tenant-*.dacpac")
+	if err != nil {
+		log.Error().Err(err).Msgf("Failed to create the dacpac file for %s schema - returning", targetSchema)
+		return false, err
+	}
+	f.Close()
+	dstDacPac := f.Name()
+	defer func() {
+		if err := os.Remove(dstDacPac); err != nil {
+			log.Error().Err(err).Msgf("Failed to remove the tenant dacpac %s", dstDacPac)
+		}
+	}()
 
-	err := updateDacPac(dstDacPac, dacpac, templateName, targetSchema)
+	output := runlogs.FromContext(ctx).Output(dbName + "." + targetSchema)
+	err = RewriteDacPac(dstDacPac, dacpac, templateName, targetSchema, renameMode)
 	if err != nil {
 		log.Error().Err(err).Msgf("Failed to create tenant dacpac for %s schema - returning", targetSchema)
+		fmt.Fprintf(output, "failed to create the dacpac for %s: %s\n", targetSchema, err)
 		return false, err
 	}
 	log.Info().Msgf("updated dacpac with target schema - created: %s", dstDacPac)
-	err = RunDacPac(dstDacPac, clusterUri, dbName, options)
+	err = RunDacPac(ctx, dstDacPac, clusterUri, dbName, options, output)
 	if err != nil {
 		log.Error().Err(err).Msgf("Failed to run dacpac on %s schema - returning", targetSchema)
 		return false, err
 	}
-	err = utils.CleanupFile(dstDacPac)
-	return true, err
-}
-func worker(wg *sync.WaitGroup, jobs chan dacpacJob, results chan dacpacResult) {
-	for job := range jobs {
-		executed, err := TargetDacpacExecution(job.clusterUri, job.dbName, job.options, job.dacpac, job.templateName, job.targetSchema)
-		output := dacpacResult{job, executed, err}
-		results <- output
-	}
-	wg.Done()
-}
-func createWorkerPool(noOfWorkers int, jobs chan dacpacJob, results chan dacpacResult) {
-	var wg sync.WaitGroup
-	for i := 0; i < noOfWorkers; i++ {
-		wg.Add(1)
-		go worker(&wg, jobs, results)
-	}
-	wg.Wait()
-	close(results)
+	return true, nil
 }
 
-func allocate(clusterUri, dbName, options, dacpac, templateName string, targetsSchemas []string, jobs chan dacpacJob) {
-	for i, targetSchema := range targetsSchemas {
-		job := dacpacJob{
-			id:           i,
-			clusterUri:   clusterUri,
-			dbName:       dbName,
-			options:      options,
-			dacpac:       dacpac,
-			templateName: templateName,
-			targetSchema: targetSchema,
-		}
-		jobs <- job
-	}
-	close(jobs)
-}
-func result(notifier utils.NotifyProgressFunc, total int, done chan bool, results chan dacpacResult, executed *schemav1alpha1.ClusterTargets, err *error) {
-	soFar := 0
-	tenPCT := total / 10
-	doneSchemas := make([]string, 0)
-	for result := range results {
-		soFar = soFar + 1
-		if result.executed {
-			doneSchemas = append(doneSchemas, result.job.targetSchema)
-		} else {
-			// we just want to make sure we catch some error - we don't care which (consider replacing with multi-error impl.)
-			// *err = result.err
-			log.Error().Err(result.err).Msgf("Failed to run dacpac on %s", result.job.targetSchema)
-		}
-		if soFar%tenPCT == 0 {
-			notifier(soFar / tenPCT * 10)
-		}
-	}
-	done <- true
-	executed.Schemas = doneSchemas
-}
-
-func downloadDacfromCfg(cfgMap *v1.ConfigMap) (string, error) {
-	return downloadNamedDacfromCfg(cfgMap, "*")
+// downloadDacfromCfg writes the dacpac of the `ConfigMap` into the working dir
+func downloadDacfromCfg(cfgMap *v1.ConfigMap, workDir string) (string, error) {
+	return downloadNamedDacfromCfg(cfgMap, workDir, "*")
 }
 
-func downloadDependencies(c client.Client, externalDacPacs string) ([]string, error) {
+// downloadDependencies writes the external dacpacs into the working dir of the dacpac referencing them -
+// sqlpackage looks for them next to it.
+func downloadDependencies(ctx context.Context, c client.Reader, workDir, externalDacPacs string) ([]string, error) {
 	externals := make(map[string]schemav1alpha1.NamespacedName)
 	downloadedFiles := []string{}
 	err := json.Unmarshal([]byte(externalDacPacs), &externals)
@@ -125,13 +74,16 @@ func downloadDependencies(c client.Client, externalDacPacs string) ([]string, er
 
 	log.Debug().Msgf("Downlowding %d external dependencies", len(externals))
 	for fileName, cfgName := range externals {
+		if fileName == "" || fileName == "*" || filepath.Base(fileName) != fileName {
+			return downloadedFiles, fmt.Errorf("invalid external dacpac name %q", fileName)
+		}
 		externalConfigMap := &v1.ConfigMap{}
-		err := c.Get(context.Background(), types.NamespacedName(cfgName), externalConfigMap)
+		err := c.Get(ctx, types.NamespacedName(cfgName), externalConfigMap)
 		if err != nil {
 			log.Error().Err(err).Msg("failed to get external dacpack ConfigMap.")
 			return downloadedFiles, err
 		}
-		downloadedDep, err := downloadNamedDacfromCfg(externalConfigMap, fileName)
+		downloadedDep, err := downloadNamedDacfromCfg(externalConfigMap, workDir, fileName)
 		if err != nil {
 			log.Error().Err(err).Msg("failed to download dacpack ConfigMap.")
 			return downloadedFiles, err
@@ -143,7 +95,7 @@ func downloadDependencies(c client.Client, externalDacPacs string) ([]string, er
 
 }
 
-func downloadNamedDacfromCfg(cfgMap *v1.ConfigMap, dacpacName string) (string, error) {
+func downloadNamedDacfromCfg(cfgMap *v1.ConfigMap, workDir, dacpacName string) (string, error) {
 
 	var f *os.File
 	var err error
@@ -151,11 +103,10 @@ func downloadNamedDacfromCfg(cfgMap *v1.ConfigMap, dacpacName string) (string, e
 
 	log.Debug().Msgf("dacpac length: %d", len(dacPacBytes))
 
-	jobPath := "/tmp/"
 	if dacpacName == "*" {
-		f, err = os.CreateTemp(jobPath, "schema-*.dacpac")
+		f, err = os.CreateTemp(workDir, "schema-*.dacpac")
 	} else {
-		f, err = os.Create(jobPath + dacpacName + ".dacpac")
+		f, err = os.Create(filepath.Join(workDir, dacpacName+".dacpac"))
 	}
 
 	if err != nil {
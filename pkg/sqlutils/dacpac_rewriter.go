@@ -0,0 +1,227 @@
+package sqlutils
+
+// Copyright (c) Microsoft Corporation.
+// Licensed under the MIT License.
+import (
+	"archive/zip"
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"hash"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/rs/zerolog/log"
+)
+
+const (
+	dacpacModelPart    = "model.xml"
+	dacpacRefactorPart = "refactor.xml"
+	dacpacOriginPart   = "Origin.xml"
+	dacpacPreDeploy    = "predeploy.sql"
+	dacpacPostDeploy   = "postdeploy.sql"
+	// maxOriginSize bounds the size of the Origin.xml part we are willing to load into memory.
+	maxOriginSize = 10 << 20
+)
+
+// contentRewriter rewrites a dacpac part while streaming it from `src` to `dst`.
+type contentRewriter func(dst io.Writer, src io.Reader, sourceSchema, tenantSchema string) error
+
+// RewriteDacPac creates a duplicate dacpac with the source schema replaced with a destenation schema.
+// this is used to support multi-tenant solutions with schema per tenant.
+// The model, refactor log and deploy scripts are rewritten, the model checksum in Origin.xml is updated
+// and all other parts are copied as is.
+// The `mode` selects between renaming schema qualified names only (xml) and a plain substring replace.
+func RewriteDacPac(dstDacPac string, srcDacPac string, sourceSchema, tenantSchema string, mode SchemaRenameMode) (err error) {
+	modelRewriter, scriptRewriter := contentRewriter(rewriteModelXML), contentRewriter(rewriteScript)
+	if mode == SchemaRenameSubstring {
+		log.Info().Msg("using substring replacement to rename the schema")
+		modelRewriter, scriptRewriter = replaceSchema, replaceSchema
+	}
+
+	archive, err := zip.OpenReader(srcDacPac)
+	if err != nil {
+		log.Error().Err(err).Msgf("Failed to open source dacpac at %s", srcDacPac)
+		return fmt.Errorf("failed to open source dacpac %s: %w", srcDacPac, err)
+	}
+	defer archive.Close()
+
+	darchive, err := os.Create(dstDacPac)
+	if err != nil {
+		log.Error().Err(err).Msgf("failed to create destination file at %s", dstDacPac)
+		return err
+	}
+	defer func() {
+		closeErr := darchive.Close()
+		if err == nil {
+			err = closeErr
+		}
+		if err != nil {
+			os.Remove(dstDacPac)
+		}
+	}()
+
+	zipWriter := zip.NewWriter(darchive)
+	var originFile *zip.File
+	srcChecksum := ""
+	dstChecksum := ""
+	for _, f := range archive.File {
+		switch strings.ToLower(f.Name) {
+		case strings.ToLower(dacpacModelPart):
+			log.Info().Msg("handeling model file - replace schema")
+			dstChecksum, srcChecksum, err = rewritePart(zipWriter, f, modelRewriter, sourceSchema, tenantSchema)
+		case strings.ToLower(dacpacRefactorPart):
+			log.Info().Msgf("handeling %s - replace schema", f.Name)
+			_, _, err = rewritePart(zipWriter, f, modelRewriter, sourceSchema, tenantSchema)
+		case dacpacPreDeploy, dacpacPostDeploy:
+			log.Info().Msgf("handeling %s - replace schema", f.Name)
+			_, _, err = rewritePart(zipWriter, f, scriptRewriter, sourceSchema, tenantSchema)
+		case strings.ToLower(dacpacOriginPart):
+			// origin is written last as it holds the checksum of the rewritten model
+			originFile = f
+		default:
+			log.Debug().Msgf("copying %s as is", f.Name)
+			err = zipWriter.Copy(f)
+		}
+		if err != nil {
+			log.Error().Err(err).Msgf("failed to rewrite dacpac part %s", f.Name)
+			return fmt.Errorf("failed to rewrite dacpac part %s: %w", f.Name, err)
+		}
+	}
+
+	if originFile != nil {
+		log.Info().Msg("updating origin file with new checksum")
+		err = updateOriginXML(zipWriter, originFile, srcChecksum, dstChecksum)
+		if err != nil {
+			log.Error().Err(err).Msg("failed to update the origin file")
+			return fmt.Errorf("failed to update %s: %w", dacpacOriginPart, err)
+		}
+	}
+
+	log.Debug().Msg("closing zip archive...")
+	return zipWriter.Close()
+}
+
+// rewritePart streams a dacpac part through the rewriter into the new archive
+// and returns the checksums of the rewritten and original content.
+func rewritePart(zipWriter *zip.Writer, f *zip.File, rewrite contentRewriter, sourceSchema string, tenantSchema string) (string, string, error) {
+	header := f.FileHeader
+	dstFile, err := zipWriter.CreateHeader(&zip.FileHeader{
+		Name:     header.Name,
+		Comment:  header.Comment,
+		Method:   header.Method,
+		Modified: header.Modified,
+	})
+	if err != nil {
+		return "", "", err
+	}
+	fileInArchive, err := f.Open()
+	if err != nil {
+		return "", "", err
+	}
+	defer fileInArchive.Close()
+
+	srcHasher := sha256.New()
+	dstHasher := sha256.New()
+	err = rewrite(io.MultiWriter(dstFile, dstHasher), io.TeeReader(fileInArchive, srcHasher), sourceSchema, tenantSchema)
+	if err != nil {
+		return "", "", err
+	}
+	dstChecksum := checksum(dstHasher)
+	srcChecksum := checksum(srcHasher)
+	log.Debug().Msgf("source check sum: %s", srcChecksum)
+	log.Debug().Msgf("new checksum: %s", dstChecksum)
+	return dstChecksum, srcChecksum, nil
+}
+
+func checksum(h hash.Hash) string {
+	return strings.ToUpper(hex.EncodeToString(h.Sum(nil)))
+}
+
+// replaceSchema is a contentRewriter replacing every occurrence of the source schema (substring mode).
+func replaceSchema(dst io.Writer, src io.Reader, sourceSchema, tenantSchema string) error {
+	w := newReplaceWriter(dst, sourceSchema, tenantSchema)
+	if _, err := io.Copy(w, src); err != nil {
+		return err
+	}
+	return w.Flush()
+}
+
+func updateOriginXML(zipWriter *zip.Writer, f *zip.File, srcChecksum, dstChecksum string) error {
+	fileInArchive, err := f.Open()
+	if err != nil {
+		return err
+	}
+	defer fileInArchive.Close()
+	originContent, err := io.ReadAll(io.LimitReader(fileInArchive, maxOriginSize+1))
+	if err != nil {
+		return err
+	}
+	if len(originContent) > maxOriginSize {
+		return fmt.Errorf("%s exceeds %d bytes", dacpacOriginPart, maxOriginSize)
+	}
+	if srcChecksum != "" {
+		originContent = bytes.ReplaceAll(originContent, []byte(srcChecksum), []byte(dstChecksum))
+	}
+
+	dstOriginFile, err := zipWriter.Create(f.Name)
+	if err != nil {
+		return err
+	}
+	n, err := dstOriginFile.Write(originContent)
+	if err != nil {
+		return err
+	}
+	log.Info().Msgf("write n: %d bytes into %s", n, f.Name)
+	return nil
+}
+
+// replaceWriter replaces all occurrences of `old` with `new` in a stream.
+// It holds back the last len(old)-1 bytes of every write so matches spanning
+// write boundaries are replaced as well.
+type replaceWriter struct {
+	w   io.Writer
+	old []byte
+	new []byte
+	buf []byte
+}
+
+func newReplaceWriter(w io.Writer, old, new string) *replaceWriter {
+	return &replaceWriter{w: w, old: []byte(old), new: []byte(new)}
+}
+
+func (r *replaceWriter) Write(p []byte) (int, error) {
+	if len(r.old) == 0 {
+		return r.w.Write(p)
+	}
+	r.buf = append(r.buf, p...)
+	for {
+		i := bytes.Index(r.buf, r.old)
+		if i < 0 {
+			break
+		}
+		if _, err := r.w.Write(r.buf[:i]); err != nil {
+			return 0, err
+		}
+		if _, err := r.w.Write(r.new); err != nil {
+			return 0, err
+		}
+		r.buf = r.buf[i+len(r.old):]
+	}
+	if keep := len(r.old) - 1; len(r.buf) > keep {
+		if _, err := r.w.Write(r.buf[:len(r.buf)-keep]); err != nil {
+			return 0, err
+		}
+		r.buf = append(r.buf[:0], r.buf[len(r.buf)-keep:]...)
+	}
+	return len(p), nil
+}
+
+// Flush writes the held back bytes.
+func (r *replaceWriter) Flush() error {
+	_, err := r.w.Write(r.buf)
+	r.buf = r.buf[:0]
+	return err
+}
@@ -0,0 +1,166 @@
+package sqlutils_test
+
+// Copyright (c) Microsoft Corporation.
+// Licensed under the MIT License.
+import (
+	"archive/zip"
+	"crypto/sha256"
+	"encoding/hex"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+
+	"github.com/microsoft/azure-schema-operator/pkg/sqlutils"
+)
+
+const (
+	fixtureDacPac        = "../../docs/site/static/samples/sqlserver/test.dacpac"
+	tenantTemplateDacPac = "testdata/tenant_template.dacpac"
+)
+
+func readDacPacParts(dacpac string) map[string]string {
+	archive, err := zip.OpenReader(dacpac)
+	Expect(err).NotTo(HaveOccurred())
+	defer archive.Close()
+	parts := make(map[string]string)
+	for _, f := range archive.File {
+		r, err := f.Open()
+		Expect(err).NotTo(HaveOccurred())
+		content, err := io.ReadAll(r)
+		Expect(err).NotTo(HaveOccurred())
+		r.Close()
+		parts[f.Name] = string(content)
+	}
+	return parts
+}
+
+func writeDacPac(dacpac string, parts map[string]string) {
+	f, err := os.Create(dacpac)
+	Expect(err).NotTo(HaveOccurred())
+	defer f.Close()
+	w := zip.NewWriter(f)
+	for name, content := range parts {
+		dst, err := w.Create(name)
+		Expect(err).NotTo(HaveOccurred())
+		_, err = dst.Write([]byte(content))
+		Expect(err).NotTo(HaveOccurred())
+	}
+	Expect(w.Close()).To(Succeed())
+}
+
+func sha256Upper(content string) string {
+	sum := sha256.Sum256([]byte(content))
+	return strings.ToUpper(hex.EncodeToString(sum[:]))
+}
+
+var _ = Describe("DacpacRewriter", func() {
+	var workDir string
+
+	BeforeEach(func() {
+		var err error
+		workDir, err = os.MkdirTemp("", "dacpac-test-*")
+		Expect(err).NotTo(HaveOccurred())
+	})
+	AfterEach(func() {
+		os.RemoveAll(workDir)
+	})
+
+	It("Should rewrite the model and update the origin checksum", func() {
+		dst := filepath.Join(workDir, "tenant.dacpac")
+		err := sqlutils.RewriteDacPac(dst, fixtureDacPac, "SalesLT", "tenant_1", sqlutils.SchemaRenameXML)
+		Expect(err).NotTo(HaveOccurred())
+
+		src := readDacPacParts(fixtureDacPac)
+		parts := readDacPacParts(dst)
+		Expect(parts).To(HaveLen(len(src)))
+		Expect(parts["model.xml"]).NotTo(ContainSubstring("[SalesLT]"))
+		Expect(parts["model.xml"]).To(ContainSubstring("[tenant_1].[Customer]"))
+		Expect(parts["Origin.xml"]).To(ContainSubstring(sha256Upper(parts["model.xml"])))
+		Expect(parts["Origin.xml"]).NotTo(ContainSubstring(sha256Upper(src["model.xml"])))
+		Expect(parts["DacMetadata.xml"]).To(Equal(src["DacMetadata.xml"]))
+	})
+
+	It("Should rewrite the refactor log and deploy scripts of large dacpacs", func() {
+		src := filepath.Join(workDir, "src.dacpac")
+		// large enough to span multiple copy buffers so matches cross write boundaries
+		model := strings.Repeat("<References Name=\"[tenant].[Table]\" />\n", 10000)
+		writeDacPac(src, map[string]string{
+			"model.xml":      model,
+			"refactor.xml":   "<Operation Name=\"[tenant].[Old]\" />",
+			"predeploy.sql":  "PRINT 'pre [tenant]'",
+			"postdeploy.sql": "PRINT 'post [tenant]'",
+			"Origin.xml":     "<Checksum Uri=\"/model.xml\">" + sha256Upper(model) + "</Checksum>",
+		})
+		dst := filepath.Join(workDir, "dst.dacpac")
+		err := sqlutils.RewriteDacPac(dst, src, "tenant", "customer42", sqlutils.SchemaRenameSubstring)
+		Expect(err).NotTo(HaveOccurred())
+
+		parts := readDacPacParts(dst)
+		expectedModel := strings.ReplaceAll(model, "tenant", "customer42")
+		Expect(parts["model.xml"]).To(Equal(expectedModel))
+		Expect(parts["refactor.xml"]).To(Equal("<Operation Name=\"[customer42].[Old]\" />"))
+		Expect(parts["predeploy.sql"]).To(Equal("PRINT 'pre [customer42]'"))
+		Expect(parts["postdeploy.sql"]).To(Equal("PRINT 'post [customer42]'"))
+		Expect(parts["Origin.xml"]).To(ContainSubstring(sha256Upper(expectedModel)))
+	})
+
+	It("Should return an error instead of panicking on an invalid dacpac", func() {
+		src := filepath.Join(workDir, "invalid.dacpac")
+		Expect(os.WriteFile(src, []byte("not really a dacpac"), 0o600)).To(Succeed())
+		dst := filepath.Join(workDir, "dst.dacpac")
+		err := sqlutils.RewriteDacPac(dst, src, "tenant", "customer42", sqlutils.SchemaRenameSubstring)
+		Expect(err).To(HaveOccurred())
+		_, err = os.Stat(dst)
+		Expect(os.IsNotExist(err)).To(BeTrue())
+	})
+
+	Context("when renaming the schema of a tenant template", func() {
+		It("Should only rename schema qualified names and references", func() {
+			dst := filepath.Join(workDir, "tenant.dacpac")
+			err := sqlutils.RewriteDacPac(dst, tenantTemplateDacPac, "tenant_", "customer42", sqlutils.SchemaRenameXML)
+			Expect(err).NotTo(HaveOccurred())
+
+			parts := readDacPacParts(dst)
+			model := parts["model.xml"]
+			Expect(model).To(ContainSubstring(`<Element Type="SqlSchema" Name="[customer42]">`))
+			Expect(model).To(ContainSubstring(`Name="[customer42].[Orders].[tenant_id]"`))
+			Expect(model).To(ContainSubstring(`<References Name="[customer42]" />`))
+			Expect(model).To(ContainSubstring(`Name="[dbo].[tenant_settings]"`))
+			Expect(model).To(ContainSubstring(`<![CDATA[('tenant_')]]>`))
+			Expect(model).To(ContainSubstring(`SELECT o.tenant_id FROM [customer42].[Orders] o JOIN [customer42].Orders x ON x.tenant_id = o.tenant_id WHERE o.source <> 'tenant_'`))
+			Expect(model).NotTo(ContainSubstring("[tenant_]"))
+			Expect(parts["Origin.xml"]).To(ContainSubstring(sha256Upper(model)))
+
+			Expect(parts["refactor.xml"]).To(ContainSubstring(`Value="[customer42].[Orders].[tenant_key]"`))
+			Expect(parts["refactor.xml"]).To(ContainSubstring(`Value="tenant_id"`))
+			Expect(parts["predeploy.sql"]).To(Equal("PRINT 'deploying tenant_'\nALTER AUTHORIZATION ON SCHEMA::[customer42] TO dbo\n"))
+			Expect(parts["postdeploy.sql"]).To(Equal("INSERT INTO [customer42].[Orders] (tenant_id, source) VALUES (1, 'tenant_')\nUPDATE [customer42].Orders SET source = 'seed'\n"))
+		})
+
+		It("Should keep the untouched xml byte for byte", func() {
+			dst := filepath.Join(workDir, "same.dacpac")
+			err := sqlutils.RewriteDacPac(dst, tenantTemplateDacPac, "not_a_schema", "customer42", sqlutils.SchemaRenameXML)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(readDacPacParts(dst)).To(Equal(readDacPacParts(tenantTemplateDacPac)))
+		})
+
+		It("Should replace every occurrence when the substring mode is opted in", func() {
+			dst := filepath.Join(workDir, "substring.dacpac")
+			err := sqlutils.RewriteDacPac(dst, tenantTemplateDacPac, "tenant_", "customer42", sqlutils.SchemaRenameSubstring)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(readDacPacParts(dst)["model.xml"]).To(ContainSubstring(`Name="[customer42].[Orders].[customer42id]"`))
+		})
+
+		It("Should reject unknown rename modes", func() {
+			_, err := sqlutils.ParseSchemaRenameMode("regex")
+			Expect(err).To(HaveOccurred())
+			mode, err := sqlutils.ParseSchemaRenameMode("")
+			Expect(err).NotTo(HaveOccurred())
+			Expect(mode).To(Equal(sqlutils.SchemaRenameXML))
+		})
+	})
+})
@@ -0,0 +1,156 @@
+package sqlutils
+
+// Copyright (c) Microsoft Corporation.
+// Licensed under the MIT License.
+import (
+	"context"
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/hashicorp/go-multierror"
+	schemav1alpha1 "github.com/microsoft/azure-schema-operator/apis/dbschema/v1alpha1"
+	"github.com/rs/zerolog/log"
+)
+
+// masterDB is used to enumerate the databases on the server
+const masterDB = "master"
+
+// dbRunFunc executes the change on a single DB - on the given schemas or on the entire DB if none are given.
+type dbRunFunc func(ctx context.Context, db string, schemas []string) (schemav1alpha1.ClusterTargets, error)
+
+// aquireDatabases returns the DBs to run on:
+// the explicit `dbs` list, the DBs on the server matching the `db` regexp (if `regexp` is set) or the single `db`.
+func aquireDatabases(ctx context.Context, lister targetLister, filter schemav1alpha1.TargetFilter) ([]string, error) {
+	if len(filter.DBS) > 0 {
+		return filter.DBS, nil
+	}
+	if !filter.Regexp {
+		return []string{filter.DB}, nil
+	}
+	return lister.listDatabases(ctx, filter.DB)
+}
+
+// listDatabases lists the user databases on the server matching the regexp expression.
+func (c *SQLCluster) listDatabases(ctx context.Context, expression string) ([]string, error) {
+	dbs := []string{}
+	nameFilter, err := regexp.Compile(expression)
+	if err != nil {
+		log.Error().Err(err).Msgf("parameter proveded is not a valid regexp: %s", expression)
+		return dbs, err
+	}
+	db, release, err := c.db(ctx, masterDB)
+	if err != nil {
+		return dbs, err
+	}
+	defer release()
+
+	rows, err := db.QueryContext(ctx, `select d.name from sys.databases d where d.name not in ('master', 'tempdb', 'model', 'msdb') order by d.name;`)
+	if err != nil {
+		log.Error().Err(err).Msgf("Failed to query databases from server")
+		return dbs, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var dbName string
+		if err = rows.Scan(&dbName); err != nil {
+			log.Error().Err(err).Msgf("Failed scanning the database name")
+			return dbs, err
+		}
+		if nameFilter.MatchString(dbName) {
+			dbs = append(dbs, dbName)
+			log.Debug().Msgf("db passed filter: %s", dbName)
+		}
+	}
+	return dbs, rows.Err()
+}
+
+// targetsMultipleDBs reports whether the filter can match more than one DB - several `DBS` or a `Regexp` of DBs.
+func targetsMultipleDBs(filter schemav1alpha1.TargetFilter) bool {
+	if len(filter.DBS) > 0 {
+		return len(filter.DBS) > 1
+	}
+	return filter.Regexp
+}
+
+// qualifySchema returns the schema target name - schemas are qualified as `db.schema` when running on multiple DBs.
+func qualifySchema(multiDB bool, db, schema string) string {
+	if !multiDB {
+		return schema
+	}
+	return db + "." + schema
+}
+
+// schemasPerDB groups the schema targets by DB, returning the schemas of each DB and the target name of each DB schema.
+// Schemas missing from `SchemaTargets` apply to every DB.
+func schemasPerDB(targets schemav1alpha1.ClusterTargets) (map[string][]string, map[schemav1alpha1.SchemaTarget]string) {
+	perDB := make(map[string][]string, len(targets.DBs))
+	names := make(map[schemav1alpha1.SchemaTarget]string, len(targets.Schemas))
+	for _, name := range targets.Schemas {
+		target, found := targets.SchemaTargets[name]
+		if found {
+			if contains(targets.DBs, target.DB) {
+				perDB[target.DB] = append(perDB[target.DB], target.Schema)
+				names[target] = name
+			}
+			continue
+		}
+		for _, db := range targets.DBs {
+			perDB[db] = append(perDB[db], name)
+			names[schemav1alpha1.SchemaTarget{DB: db, Schema: name}] = name
+		}
+	}
+	return perDB, names
+}
+
+func contains(list []string, s string) bool {
+	for _, x := range list {
+		if x == s {
+			return true
+		}
+	}
+	return false
+}
+
+// runPerDB runs `run` on every target DB, a failure on one DB doesn't stop the execution on the others.
+// The executed targets are returned along with the result per DB and a multi-error of the DBs that failed.
+func runPerDB(ctx context.Context, targets schemav1alpha1.ClusterTargets, run dbRunFunc) (schemav1alpha1.ClusterTargets, error) {
+	executed := schemav1alpha1.ClusterTargets{}
+	perDB, names := schemasPerDB(targets)
+	failedDBs := make([]string, 0)
+	var executionErr *multierror.Error
+	for _, db := range targets.DBs {
+		schemas := perDB[db]
+		if len(targets.Schemas) > 0 && len(schemas) == 0 {
+			log.Debug().Msgf("no schemas to run on %s - skipping", db)
+			continue
+		}
+		if ctx.Err() != nil {
+			log.Info().Msgf("execution stopped before running on %s", db)
+			failedDBs = append(failedDBs, db)
+			executionErr = multierror.Append(executionErr, fmt.Errorf("db %s: %w", db, ctx.Err()))
+			continue
+		}
+		done, err := run(ctx, db, schemas)
+		for _, schema := range done.Schemas {
+			executed.Schemas = append(executed.Schemas, names[schemav1alpha1.SchemaTarget{DB: db, Schema: schema}])
+		}
+		result := schemav1alpha1.DBResult{DB: db, Schemas: len(done.Schemas)}
+		if err != nil {
+			log.Error().Err(err).Msgf("Failed to execute on %s", db)
+			result.Error = err.Error()
+			failedDBs = append(failedDBs, db)
+			executionErr = multierror.Append(executionErr, fmt.Errorf("db %s: %w", db, err))
+		} else {
+			result.Executed = true
+			executed.DBs = append(executed.DBs, db)
+		}
+		executed.Results = append(executed.Results, result)
+	}
+	if executionErr != nil {
+		sort.Strings(failedDBs)
+		return executed, fmt.Errorf("failed to execute on %d/%d dbs [%s]: %w", len(failedDBs), len(targets.DBs), strings.Join(failedDBs, ","), executionErr.ErrorOrNil())
+	}
+	return executed, nil
+}
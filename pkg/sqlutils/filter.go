@@ -0,0 +1,96 @@
+package sqlutils
+
+// Copyright (c) Microsoft Corporation.
+// Licensed under the MIT License.
+import (
+	"fmt"
+	"regexp"
+
+	schemav1alpha1 "github.com/microsoft/azure-schema-operator/apis/dbschema/v1alpha1"
+)
+
+// SchemaFilter selects schemas using include and exclude regexps.
+// A schema is selected if it matches any of the include regexps (or there are none)
+// and doesn't match any of the exclude regexps.
+type SchemaFilter struct {
+	include []*regexp.Regexp
+	exclude []*regexp.Regexp
+}
+
+// HasSchemaTargeting returns true if the filter targets schemas rather than the entire DB.
+func HasSchemaTargeting(filter schemav1alpha1.TargetFilter) bool {
+	return filter.Schema != "" || len(filter.IncludeSchemas) > 0 || len(filter.Schemas) > 0 || filter.Webhook != ""
+}
+
+// NewSchemaFilter compiles the schema include (`schema` & `includeSchemas`) and exclude (`excludeSchemas`) regexps.
+func NewSchemaFilter(filter schemav1alpha1.TargetFilter) (*SchemaFilter, error) {
+	includes := filter.IncludeSchemas
+	if filter.Schema != "" {
+		includes = append([]string{filter.Schema}, includes...)
+	}
+	include, err := compileAll(includes)
+	if err != nil {
+		return nil, err
+	}
+	exclude, err := compileAll(filter.ExcludeSchemas)
+	if err != nil {
+		return nil, err
+	}
+	return &SchemaFilter{include: include, exclude: exclude}, nil
+}
+
+func compileAll(expressions []string) ([]*regexp.Regexp, error) {
+	compiled := make([]*regexp.Regexp, 0, len(expressions))
+	for _, expression := range expressions {
+		re, err := regexp.Compile(expression)
+		if err != nil {
+			return nil, fmt.Errorf("invalid schema filter %q: %w", expression, err)
+		}
+		compiled = append(compiled, re)
+	}
+	return compiled, nil
+}
+
+// Match returns true if the schema passes the filter.
+func (f *SchemaFilter) Match(schema string) bool {
+	for _, re := range f.exclude {
+		if re.MatchString(schema) {
+			return false
+		}
+	}
+	if len(f.include) == 0 {
+		return true
+	}
+	for _, re := range f.include {
+		if re.MatchString(schema) {
+			return true
+		}
+	}
+	return false
+}
+
+// Filter returns the schemas passing the filter (keeping their order).
+func (f *SchemaFilter) Filter(schemas []string) []string {
+	filtered := []string{}
+	for _, schema := range schemas {
+		if f.Match(schema) {
+			filtered = append(filtered, schema)
+		}
+	}
+	return filtered
+}
+
+// intersect returns the elements of `a` found in `b` (keeping the order of `a`).
+func intersect(a, b []string) []string {
+	mb := make(map[string]struct{}, len(b))
+	for _, x := range b {
+		mb[x] = struct{}{}
+	}
+	res := []string{}
+	for _, x := range a {
+		if _, found := mb[x]; found {
+			res = append(res, x)
+		}
+	}
+	return res
+}
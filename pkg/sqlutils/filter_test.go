@@ -0,0 +1,139 @@
+package sqlutils_test
+
+// Copyright (c) Microsoft Corporation.
+// Licensed under the MIT License.
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+
+	schemav1alpha1 "github.com/microsoft/azure-schema-operator/apis/dbschema/v1alpha1"
+	"github.com/microsoft/azure-schema-operator/pkg/sqlutils"
+	"github.com/microsoft/azure-schema-operator/pkg/utils"
+)
+
+var _ = Describe("SchemaFilter", func() {
+	var cluster *sqlutils.SQLCluster
+
+	BeforeEach(func() {
+		fakeSQL.reset()
+		fakeSQL.schemas = []string{"dbo", "tenant_a", "tenant_b", "tenant_test", "sys"}
+		cluster = sqlutils.NewSQLCluster("fakecluster.database.windows.net", nil, nil, nil)
+		cluster.Open = openFake
+	})
+
+	It("Should include and exclude schemas by regexp", func() {
+		filter, err := sqlutils.NewSchemaFilter(schemav1alpha1.TargetFilter{
+			Schema:         "^tenant_",
+			IncludeSchemas: []string{"^dbo$"},
+			ExcludeSchemas: []string{"_test$"},
+		})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(filter.Filter(fakeSQL.schemas)).To(Equal([]string{"dbo", "tenant_a", "tenant_b"}))
+	})
+
+	It("Should reject invalid regexps", func() {
+		_, err := sqlutils.NewSchemaFilter(schemav1alpha1.TargetFilter{ExcludeSchemas: []string{"("}})
+		Expect(err).To(HaveOccurred())
+	})
+
+	It("Should target the entire DB without schema targeting", func() {
+		targets, err := cluster.AquireTargets(context.Background(), schemav1alpha1.TargetFilter{DB: "db1"})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(targets.DBs).To(Equal([]string{"db1"}))
+		Expect(targets.Schemas).To(BeEmpty())
+	})
+
+	It("Should discover the matching schemas in the DB", func() {
+		targets, err := cluster.AquireTargets(context.Background(), schemav1alpha1.TargetFilter{
+			DB:             "db1",
+			Schema:         "^tenant_",
+			ExcludeSchemas: []string{"_test$"},
+		})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(targets.Schemas).To(Equal([]string{"tenant_a", "tenant_b"}))
+	})
+
+	It("Should report no match instead of creating a schema named after the regexp", func() {
+		_, err := cluster.AquireTargets(context.Background(), schemav1alpha1.TargetFilter{DB: "db1", Schema: "^customer_.*"})
+		Expect(errors.Is(err, utils.ErrNoMatchingTargets)).To(BeTrue())
+	})
+
+	It("Should only create explicitly listed schemas when requested", func() {
+		filter := schemav1alpha1.TargetFilter{DB: "db1", Schemas: []string{"tenant_a", "tenant_new"}}
+		targets, err := cluster.AquireTargets(context.Background(), filter)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(targets.Schemas).To(Equal([]string{"tenant_a"}))
+
+		filter.Create = true
+		targets, err = cluster.AquireTargets(context.Background(), filter)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(targets.Schemas).To(Equal([]string{"tenant_a", "tenant_new"}))
+	})
+
+	It("Should target the DBs matching the regexp", func() {
+		fakeSQL.databases = []string{"tenants_1", "tenants_2", "reporting"}
+		targets, err := cluster.AquireTargets(context.Background(), schemav1alpha1.TargetFilter{DB: "^tenants_", Regexp: true})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(targets.DBs).To(Equal([]string{"tenants_1", "tenants_2"}))
+
+		_, err = cluster.AquireTargets(context.Background(), schemav1alpha1.TargetFilter{DB: "^archive_", Regexp: true})
+		Expect(errors.Is(err, utils.ErrNoMatchingTargets)).To(BeTrue())
+	})
+
+	It("Should qualify the schemas by DB when targeting multiple DBs", func() {
+		fakeSQL.dbSchemas = map[string][]string{
+			"tenants_1": {"dbo", "tenant_a"},
+			"tenants_2": {"dbo", "tenant_b", "tenant_c"},
+			"tenants_3": {"dbo"},
+		}
+		targets, err := cluster.AquireTargets(context.Background(), schemav1alpha1.TargetFilter{
+			DBS:    []string{"tenants_1", "tenants_2", "tenants_3"},
+			Schema: "^tenant_",
+		})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(targets.DBs).To(Equal([]string{"tenants_1", "tenants_2"}))
+		Expect(targets.Schemas).To(Equal([]string{"tenants_1.tenant_a", "tenants_2.tenant_b", "tenants_2.tenant_c"}))
+	})
+
+	It("Should qualify the schemas when a single DB of the candidates matched", func() {
+		fakeSQL.dbSchemas = map[string][]string{
+			"tenants_1": {"dbo", "tenant_a"},
+			"tenants_2": {"dbo"},
+			"tenants_3": {"dbo"},
+		}
+		targets, err := cluster.AquireTargets(context.Background(), schemav1alpha1.TargetFilter{
+			DBS:    []string{"tenants_1", "tenants_2", "tenants_3"},
+			Schema: "^tenant_",
+		})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(targets.DBs).To(Equal([]string{"tenants_1"}))
+		Expect(targets.Schemas).To(Equal([]string{"tenants_1.tenant_a"}))
+		Expect(targets.SchemaTargets).To(Equal(map[string]schemav1alpha1.SchemaTarget{"tenants_1.tenant_a": {DB: "tenants_1", Schema: "tenant_a"}}))
+	})
+
+	It("Should discover the schemas using the webhook", func() {
+		srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			Expect(r.URL.Query().Get("db")).To(Equal("db1"))
+			Expect(r.URL.Query().Get("cluster")).To(Equal("fakecluster"))
+			b, _ := json.Marshal(map[string][]string{"schemas": {"tenant_a", "tenant_test", "tenant_new"}})
+			_, _ = w.Write(b)
+		}))
+		defer srv.Close()
+
+		targets, err := cluster.AquireTargets(context.Background(), schemav1alpha1.TargetFilter{
+			DB:             "db1",
+			Webhook:        srv.URL + "/schemas?cluster={{.Cluster}}&db={{.DB}}&label={{.Label}}",
+			Label:          "gold",
+			ExcludeSchemas: []string{"_test$"},
+			Create:         true,
+		})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(targets.Schemas).To(Equal([]string{"tenant_a", "tenant_new"}))
+	})
+})
@@ -0,0 +1,343 @@
+package sqlutils
+
+// Copyright (c) Microsoft Corporation.
+// Licensed under the MIT License.
+import (
+	"context"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+
+	schemav1alpha1 "github.com/microsoft/azure-schema-operator/apis/dbschema/v1alpha1"
+	"github.com/microsoft/azure-schema-operator/pkg/clients"
+	"github.com/microsoft/azure-schema-operator/pkg/runlogs"
+	"github.com/microsoft/azure-schema-operator/pkg/utils"
+	"github.com/rs/zerolog/log"
+	v1 "k8s.io/api/core/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+const (
+	// ExecutorSQLPackage runs dacpacs using sqlpackage (default)
+	ExecutorSQLPackage = "sqlpackage"
+	// ExecutorMigrations applies versioned migration scripts natively
+	ExecutorMigrations = "migrations"
+	// HistoryTable is the name of the per schema table tracking the applied migrations
+	HistoryTable = "__schemaop_history"
+	// defaultMigrationSchema is used for the history table when the migrations run on the entire DB
+	defaultMigrationSchema = "dbo"
+)
+
+var (
+	// migrationKeyPattern matches versioned migration keys in the ConfigMap, e.g. V1__create_orders.sql
+	migrationKeyPattern = regexp.MustCompile(`^V(\d+)__(.+)\.sql$`)
+	batchSeparator      = regexp.MustCompile(`(?im)^[ \t]*GO[ \t]*;?[ \t]*\r?$`)
+)
+
+// Migration is a single versioned migration script
+type Migration struct {
+	Version     int
+	Description string
+	Script      string
+	Checksum    string
+}
+
+// Batches splits the migration script on the `GO` batch separator.
+func (m Migration) Batches() []string {
+	batches := []string{}
+	for _, batch := range batchSeparator.Split(m.Script, -1) {
+		if strings.TrimSpace(batch) != "" {
+			batches = append(batches, batch)
+		}
+	}
+	return batches
+}
+
+// ParseMigrations extracts the versioned migration scripts from the data (i.e. `ConfigMap` data) ordered by version.
+func ParseMigrations(data map[string]string) ([]Migration, error) {
+	migrations := []Migration{}
+	versions := make(map[int]string)
+	for key, script := range data {
+		match := migrationKeyPattern.FindStringSubmatch(key)
+		if match == nil {
+			continue
+		}
+		version, err := strconv.Atoi(match[1])
+		if err != nil {
+			return nil, fmt.Errorf("invalid migration version in %s: %w", key, err)
+		}
+		if other, ok := versions[version]; ok {
+			return nil, fmt.Errorf("duplicate migration version %d: %s and %s", version, other, key)
+		}
+		versions[version] = key
+		hash := sha256.Sum256([]byte(script))
+		migrations = append(migrations, Migration{
+			Version:     version,
+			Description: strings.ReplaceAll(match[2], "_", " "),
+			Script:      script,
+			Checksum:    strings.ToUpper(hex.EncodeToString(hash[:])),
+		})
+	}
+	sort.Slice(migrations, func(i, j int) bool { return migrations[i].Version < migrations[j].Version })
+	return migrations, nil
+}
+
+// LoadMigrations loads the versioned migration scripts stored in a directory.
+func LoadMigrations(dir string) ([]Migration, error) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+	data := make(map[string]string)
+	for _, entry := range entries {
+		if entry.IsDir() || !migrationKeyPattern.MatchString(entry.Name()) {
+			continue
+		}
+		content, err := os.ReadFile(filepath.Join(dir, entry.Name()))
+		if err != nil {
+			return nil, err
+		}
+		data[entry.Name()] = string(content)
+	}
+	return ParseMigrations(data)
+}
+
+// ApplyMigrations applies the migrations not yet recorded in the history table of the schema.
+// Each migration runs in its own transaction together with its history record.
+// The scripts are written for `templateName` schema which is renamed to the target `schema`.
+// It returns the number of migrations applied.
+func ApplyMigrations(ctx context.Context, db *sql.DB, schema, templateName string, migrations []Migration) (int, error) {
+	if err := ensureHistoryTable(ctx, db, schema); err != nil {
+		log.Error().Err(err).Msgf("failed to create the migration history table in %s", schema)
+		return 0, err
+	}
+	applied, err := appliedMigrations(ctx, db, schema)
+	if err != nil {
+		log.Error().Err(err).Msgf("failed to read the migration history of %s", schema)
+		return 0, err
+	}
+	var renamer *schemaRenamer
+	if templateName != "" && templateName != schema {
+		renamer = newSchemaRenamer(templateName, schema)
+	}
+
+	count := 0
+	for _, migration := range migrations {
+		if checksum, ok := applied[migration.Version]; ok {
+			if checksum != migration.Checksum {
+				return count, fmt.Errorf("migration V%d in %s was changed after it was applied", migration.Version, schema)
+			}
+			continue
+		}
+		log.Info().Msgf("applying migration V%d (%s) on %s", migration.Version, migration.Description, schema)
+		err = applyMigration(ctx, db, schema, migration, renamer)
+		if err != nil {
+			log.Error().Err(err).Msgf("failed to apply migration V%d on %s", migration.Version, schema)
+			return count, fmt.Errorf("migration V%d: %w", migration.Version, err)
+		}
+		count = count + 1
+	}
+	return count, nil
+}
+
+func applyMigration(ctx context.Context, db *sql.DB, schema string, migration Migration, renamer *schemaRenamer) error {
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		// no-op if the transaction was committed
+		_ = tx.Rollback()
+	}()
+	// serialize concurrent migrations of the same schema
+	_, err = tx.ExecContext(ctx, `EXEC sp_getapplock @Resource = @p1, @LockMode = 'Exclusive', @LockOwner = 'Transaction'`, "schemaop:"+schema)
+	if err != nil {
+		return err
+	}
+	for _, batch := range migration.Batches() {
+		if renamer != nil {
+			batch = string(renamer.renameScript([]byte(batch)))
+		}
+		if _, err = tx.ExecContext(ctx, batch); err != nil {
+			return err
+		}
+	}
+	_, err = tx.ExecContext(ctx,
+		fmt.Sprintf(`INSERT INTO %s.%s (version, description, checksum) VALUES (@p1, @p2, @p3)`, quoteIdentifier(schema), quoteIdentifier(HistoryTable)),
+		migration.Version, migration.Description, migration.Checksum)
+	if err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+func ensureHistoryTable(ctx context.Context, db *sql.DB, schema string) error {
+	_, err := db.ExecContext(ctx, `IF SCHEMA_ID(@p1) IS NULL EXEC('CREATE SCHEMA ' + QUOTENAME(@p1))`, schema)
+	if err != nil {
+		return err
+	}
+	table := quoteIdentifier(schema) + "." + quoteIdentifier(HistoryTable)
+	_, err = db.ExecContext(ctx, fmt.Sprintf(`IF OBJECT_ID(@p1, 'U') IS NULL CREATE TABLE %s (
+	version INT NOT NULL PRIMARY KEY,
+	description NVARCHAR(256) NOT NULL,
+	checksum CHAR(64) NOT NULL,
+	applied_on DATETIME2 NOT NULL DEFAULT SYSUTCDATETIME()
+)`, table), table)
+	return err
+}
+
+func appliedMigrations(ctx context.Context, db *sql.DB, schema string) (map[int]string, error) {
+	applied := make(map[int]string)
+	rows, err := db.QueryContext(ctx, fmt.Sprintf(`SELECT version, checksum FROM %s.%s`, quoteIdentifier(schema), quoteIdentifier(HistoryTable)))
+	if err != nil {
+		return applied, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var version int
+		var checksum string
+		if err = rows.Scan(&version, &checksum); err != nil {
+			return applied, err
+		}
+		applied[version] = strings.TrimSpace(checksum)
+	}
+	return applied, rows.Err()
+}
+
+// quoteIdentifier quotes a SQL Server identifier (i.e. QUOTENAME)
+func quoteIdentifier(name string) string {
+	return "[" + strings.ReplaceAll(name, "]", "]]") + "]"
+}
+
+// MigrationCluster represents a SQL Server Database on which versioned migration scripts are applied natively
+// (without sqlpackage).
+type MigrationCluster struct {
+	*SQLCluster
+}
+
+// NewMigrationCluster returns a new `MigrationCluster`
+func NewMigrationCluster(uri string, c client.Reader, cache *clients.Cache, notifier utils.NotifyProgressFunc) *MigrationCluster {
+	return &MigrationCluster{
+		SQLCluster: NewSQLCluster(uri, c, cache, notifier),
+	}
+}
+
+// Execute applies the migrations on the targets - on each target DB, per target schema or on the entire DB.
+func (c *MigrationCluster) Execute(ctx context.Context, targets schemav1alpha1.ClusterTargets, config schemav1alpha1.ExecutionConfiguration) (schemav1alpha1.ClusterTargets, error) {
+	return executeMigrations(ctx, targets, config, c.db, ApplyMigrations, defaultMigrationSchema, c.notifyProgress)
+}
+
+// CreateExecConfiguration stores the versioned migration scripts in the `ConfigMap` for the execution
+func (c *MigrationCluster) CreateExecConfiguration(ctx context.Context, targets schemav1alpha1.ClusterTargets, cfgMap *v1.ConfigMap, failIfDataLoss bool) (schemav1alpha1.ExecutionConfiguration, error) {
+	return migrationsExecConfiguration(cfgMap)
+}
+
+// dbFunc returns the connection pool of the DB, the release func must be called once it is no longer used.
+type dbFunc func(ctx context.Context, databaseName string) (*sql.DB, func(), error)
+
+// applyMigrationsFunc applies the pending migrations on a schema of the DB (see `ApplyMigrations`).
+type applyMigrationsFunc func(ctx context.Context, db *sql.DB, schema, templateName string, migrations []Migration) (int, error)
+
+// executeMigrations applies the migrations of the configuration on the targets with `apply`.
+// Without target schemas the migrations run on the entire DB and are recorded in `defaultSchema`.
+func executeMigrations(ctx context.Context, targets schemav1alpha1.ClusterTargets, config schemav1alpha1.ExecutionConfiguration, getDB dbFunc, apply applyMigrationsFunc, defaultSchema string, notifier utils.NotifyProgressFunc) (schemav1alpha1.ClusterTargets, error) {
+	executed := schemav1alpha1.ClusterTargets{}
+	// the scripts dir is created for a single execution by `CreateExecConfiguration` - they are kept in memory once loaded
+	defer os.RemoveAll(config.Properties[ExecutorMigrations])
+	migrations, err := LoadMigrations(config.Properties[ExecutorMigrations])
+	if err != nil {
+		log.Error().Err(err).Msg("failed to load the migration scripts")
+		return executed, err
+	}
+	if len(targets.Schemas) > 0 && config.TemplateName == "" {
+		log.Error().Msg("the template name is required to run the migrations per schema")
+		return executed, fmt.Errorf("the template name is required to run the migrations per schema")
+	}
+
+	executed, err = runPerDB(ctx, targets, func(ctx context.Context, dbName string, schemas []string) (schemav1alpha1.ClusterTargets, error) {
+		done := schemav1alpha1.ClusterTargets{}
+		db, release, err := getDB(ctx, dbName)
+		if err != nil {
+			return done, err
+		}
+		defer release()
+
+		if len(schemas) == 0 {
+			log.Info().Msgf("will apply the migrations on the entire %s DB", dbName)
+			output := runlogs.FromContext(ctx).Output(dbName)
+			n, err := apply(ctx, db, defaultSchema, "", migrations)
+			if err != nil {
+				fmt.Fprintf(output, "failed to apply the migrations: %s\n", err)
+				return done, err
+			}
+			fmt.Fprintf(output, "applied %d migrations\n", n)
+			log.Info().Msgf("applied %d migrations on %s", n, dbName)
+			return done, nil
+		}
+		log.Info().Msgf("will apply the migrations on each schema in %s: %d schemas to run", dbName, len(schemas))
+		return runPerSchema(ctx, workersFromConfig(config), schemas, notifier, func(ctx context.Context, targetSchema string) (bool, error) {
+			output := runlogs.FromContext(ctx).Output(dbName + "." + targetSchema)
+			n, err := apply(ctx, db, targetSchema, config.TemplateName, migrations)
+			if err != nil {
+				fmt.Fprintf(output, "failed to apply the migrations: %s\n", err)
+				return false, err
+			}
+			fmt.Fprintf(output, "applied %d migrations\n", n)
+			log.Info().Msgf("applied %d migrations on %s", n, targetSchema)
+			return true, nil
+		})
+	})
+	if err != nil {
+		log.Error().Err(err).Msgf("Failed to apply migrations on some targets - returning the executed ones")
+		return executed, err
+	}
+	log.Info().Msgf("Done with migrations execution on %+v", executed)
+	return executed, nil
+}
+
+// migrationsExecConfiguration stores the versioned migration scripts of the `ConfigMap` in a temporary directory for the execution.
+// The directory is removed by the execution (see `executeMigrations`).
+func migrationsExecConfiguration(cfgMap *v1.ConfigMap) (schemav1alpha1.ExecutionConfiguration, error) {
+	ec := schemav1alpha1.ExecutionConfiguration{}
+	ec.Properties = make(map[string]string)
+	migrations, err := ParseMigrations(cfgMap.Data)
+	if err != nil {
+		log.Error().Err(err).Msg("invalid migration scripts")
+		return ec, err
+	}
+	if len(migrations) == 0 {
+		return ec, fmt.Errorf("no migration scripts (V<version>__<description>.sql) found in configmap")
+	}
+	dir, err := os.MkdirTemp("", "migrations-*")
+	if err != nil {
+		log.Error().Err(err).Msg("failed to create the migrations dir")
+		return ec, err
+	}
+	for key, script := range cfgMap.Data {
+		if !migrationKeyPattern.MatchString(key) {
+			continue
+		}
+		err = os.WriteFile(filepath.Join(dir, key), []byte(script), 0o600)
+		if err != nil {
+			log.Error().Err(err).Msg("failed to store migration script")
+			os.RemoveAll(dir)
+			return ec, err
+		}
+	}
+	if templateName, ok := cfgMap.Data["templateName"]; ok {
+		ec.TemplateName = templateName
+	}
+	if parallelWorkers, ok := cfgMap.Data["parallelWorkers"]; ok {
+		ec.Properties["parallelWorkers"] = parallelWorkers
+	}
+	ec.Properties["executor"] = ExecutorMigrations
+	ec.Properties[ExecutorMigrations] = dir
+	return ec, nil
+}
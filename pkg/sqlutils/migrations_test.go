@@ -0,0 +1,359 @@
+package sqlutils_test
+
+// Copyright (c) Microsoft Corporation.
+// Licensed under the MIT License.
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"sync"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	v1 "k8s.io/api/core/v1"
+
+	schemav1alpha1 "github.com/microsoft/azure-schema-operator/apis/dbschema/v1alpha1"
+	"github.com/microsoft/azure-schema-operator/pkg/sqlutils"
+)
+
+// fakeSQLState is an in-memory stand-in for SQL server recording the executed statements
+// and the migration history tables.
+type fakeSQLState struct {
+	sync.Mutex
+	history    map[string]map[int]string
+	schemas    []string
+	dbSchemas  map[string][]string
+	databases  []string
+	statements []string
+	failOn     string
+}
+
+var fakeSQL = &fakeSQLState{}
+
+func (s *fakeSQLState) reset() {
+	s.Lock()
+	defer s.Unlock()
+	s.history = make(map[string]map[int]string)
+	s.schemas = nil
+	s.dbSchemas = nil
+	s.databases = nil
+	s.statements = nil
+	s.failOn = ""
+}
+
+type fakeDriver struct{}
+
+func (fakeDriver) Open(name string) (driver.Conn, error) {
+	return &fakeConn{db: name[strings.LastIndex(name, "/")+1:]}, nil
+}
+
+type fakeConn struct {
+	db      string
+	pending [][]driver.NamedValue
+	inTx    bool
+}
+
+func (c *fakeConn) Prepare(query string) (driver.Stmt, error) {
+	return nil, fmt.Errorf("prepare not supported")
+}
+func (c *fakeConn) Close() error { return nil }
+func (c *fakeConn) Begin() (driver.Tx, error) {
+	c.inTx = true
+	return c, nil
+}
+
+func (c *fakeConn) Commit() error {
+	fakeSQL.Lock()
+	defer fakeSQL.Unlock()
+	for _, args := range c.pending {
+		schema := args[0].Value.(string)
+		if fakeSQL.history[schema] == nil {
+			fakeSQL.history[schema] = make(map[int]string)
+		}
+		fakeSQL.history[schema][int(args[1].Value.(int64))] = args[3].Value.(string)
+	}
+	c.pending = nil
+	c.inTx = false
+	return nil
+}
+
+func (c *fakeConn) Rollback() error {
+	c.pending = nil
+	c.inTx = false
+	return nil
+}
+
+// schemaOf returns the first quoted identifier of the query - [schema] on SQL Server and "schema" on PostgreSQL
+func schemaOf(query string) string {
+	start := strings.IndexAny(query, `["`)
+	closing := "]"
+	if query[start] == '"' {
+		closing = `"`
+	}
+	end := strings.Index(query[start+1:], closing)
+	return query[start+1 : start+1+end]
+}
+
+func (c *fakeConn) ExecContext(ctx context.Context, query string, args []driver.NamedValue) (driver.Result, error) {
+	fakeSQL.Lock()
+	defer fakeSQL.Unlock()
+	fakeSQL.statements = append(fakeSQL.statements, query)
+	if fakeSQL.failOn != "" && strings.Contains(query, fakeSQL.failOn) {
+		return nil, fmt.Errorf("failed executing %s", query)
+	}
+	if strings.HasPrefix(query, "INSERT INTO") && strings.Contains(query, sqlutils.HistoryTable) {
+		record := append([]driver.NamedValue{{Value: schemaOf(query)}}, args...)
+		c.pending = append(c.pending, record)
+	}
+	return driver.RowsAffected(1), nil
+}
+
+func (c *fakeConn) QueryContext(ctx context.Context, query string, args []driver.NamedValue) (driver.Rows, error) {
+	fakeSQL.Lock()
+	defer fakeSQL.Unlock()
+	if strings.Contains(query, "sys.databases") || strings.Contains(query, "pg_database") {
+		rows := &fakeRows{columns: []string{"name"}}
+		for _, db := range fakeSQL.databases {
+			rows.values = append(rows.values, []driver.Value{db})
+		}
+		return rows, nil
+	}
+	if strings.Contains(query, "sys.schemas") || strings.Contains(query, "information_schema.schemata") {
+		schemas := fakeSQL.schemas
+		if dbSchemas, ok := fakeSQL.dbSchemas[c.db]; ok {
+			schemas = dbSchemas
+		}
+		rows := &fakeRows{columns: []string{"schema_name"}}
+		for _, schema := range schemas {
+			rows.values = append(rows.values, []driver.Value{schema})
+		}
+		return rows, nil
+	}
+	rows := &fakeRows{columns: []string{"version", "checksum"}}
+	for version, checksum := range fakeSQL.history[schemaOf(query)] {
+		rows.values = append(rows.values, []driver.Value{int64(version), checksum})
+	}
+	return rows, nil
+}
+
+type fakeRows struct {
+	columns []string
+	values  [][]driver.Value
+}
+
+func (r *fakeRows) Columns() []string { return r.columns }
+func (r *fakeRows) Close() error      { return nil }
+func (r *fakeRows) Next(dest []driver.Value) error {
+	if len(r.values) == 0 {
+		return io.EOF
+	}
+	copy(dest, r.values[0])
+	r.values = r.values[1:]
+	return nil
+}
+
+func init() {
+	sql.Register("schemaop-fake", fakeDriver{})
+}
+
+func openFake(server, databaseName string) (*sql.DB, error) {
+	return sql.Open("schemaop-fake", server+"/"+databaseName)
+}
+
+var _ = Describe("Migrations", func() {
+	data := map[string]string{
+		"templateName":             "tenant_",
+		"V2__add_index.sql":        "CREATE INDEX IX_Orders ON [tenant_].[Orders] (tenant_id)",
+		"V10__seed.sql":            "INSERT INTO tenant_.Orders (tenant_id) VALUES (1)\nGO\nPRINT 'done'",
+		"V1__create_orders.sql":    "CREATE TABLE [tenant_].[Orders] (tenant_id INT)",
+		"README.md":                "not a migration",
+		"V3_missing_separator.sql": "SELECT 1",
+	}
+
+	BeforeEach(func() {
+		fakeSQL.reset()
+	})
+
+	It("Should parse the migrations ordered by version", func() {
+		migrations, err := sqlutils.ParseMigrations(data)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(migrations).To(HaveLen(3))
+		Expect(migrations[0].Version).To(Equal(1))
+		Expect(migrations[0].Description).To(Equal("create orders"))
+		Expect(migrations[1].Version).To(Equal(2))
+		Expect(migrations[2].Version).To(Equal(10))
+		Expect(migrations[2].Batches()).To(HaveLen(2))
+	})
+
+	It("Should reject duplicate versions", func() {
+		_, err := sqlutils.ParseMigrations(map[string]string{
+			"V1__a.sql":  "SELECT 1",
+			"V01__b.sql": "SELECT 2",
+		})
+		Expect(err).To(HaveOccurred())
+	})
+
+	It("Should apply pending migrations once per schema in order", func() {
+		migrations, err := sqlutils.ParseMigrations(data)
+		Expect(err).NotTo(HaveOccurred())
+		db, err := openFake("server", "db1")
+		Expect(err).NotTo(HaveOccurred())
+		defer db.Close()
+
+		n, err := sqlutils.ApplyMigrations(context.Background(), db, "customer1", "tenant_", migrations)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(n).To(Equal(3))
+		Expect(fakeSQL.history["customer1"]).To(HaveLen(3))
+		Expect(fakeSQL.statements).To(ContainElement("CREATE TABLE [customer1].[Orders] (tenant_id INT)"))
+		Expect(fakeSQL.statements).To(ContainElement("INSERT INTO [customer1].Orders (tenant_id) VALUES (1)\n"))
+
+		n, err = sqlutils.ApplyMigrations(context.Background(), db, "customer1", "tenant_", migrations)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(n).To(Equal(0))
+	})
+
+	It("Should not record a failed migration", func() {
+		migrations, err := sqlutils.ParseMigrations(data)
+		Expect(err).NotTo(HaveOccurred())
+		db, err := openFake("server", "db1")
+		Expect(err).NotTo(HaveOccurred())
+		defer db.Close()
+
+		fakeSQL.failOn = "CREATE INDEX"
+		n, err := sqlutils.ApplyMigrations(context.Background(), db, "customer2", "tenant_", migrations)
+		Expect(err).To(HaveOccurred())
+		Expect(n).To(Equal(1))
+		Expect(fakeSQL.history["customer2"]).To(HaveLen(1))
+		Expect(fakeSQL.history["customer2"]).To(HaveKey(1))
+	})
+
+	It("Should detect migrations changed after they were applied", func() {
+		migrations, err := sqlutils.ParseMigrations(data)
+		Expect(err).NotTo(HaveOccurred())
+		db, err := openFake("server", "db1")
+		Expect(err).NotTo(HaveOccurred())
+		defer db.Close()
+
+		fakeSQL.history["customer3"] = map[int]string{1: "OTHER"}
+		_, err = sqlutils.ApplyMigrations(context.Background(), db, "customer3", "tenant_", migrations)
+		Expect(err).To(MatchError(ContainSubstring("changed after it was applied")))
+	})
+
+	It("Should run the migrations executor through the cluster interface", func() {
+		cluster := sqlutils.NewSQLCluster("fakecluster.database.windows.net", nil, nil, nil)
+		cfgMap := &v1.ConfigMap{Data: map[string]string{"executor": sqlutils.ExecutorMigrations}}
+		for k, v := range data {
+			cfgMap.Data[k] = v
+		}
+		targets := schemav1alpha1.ClusterTargets{
+			DBs:     []string{"db1"},
+			Schemas: []string{"customer4", "customer5"},
+		}
+		config, err := cluster.CreateExecConfiguration(context.Background(), targets, cfgMap, true)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(config.Properties["executor"]).To(Equal(sqlutils.ExecutorMigrations))
+		Expect(config.TemplateName).To(Equal("tenant_"))
+
+		migrationCluster := sqlutils.NewMigrationCluster("fakecluster.database.windows.net", nil, nil, nil)
+		migrationCluster.Open = openFake
+		done, err := migrationCluster.Execute(context.Background(), targets, config)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(done.DBs).To(Equal([]string{"db1"}))
+		Expect(done.Schemas).To(ConsistOf("customer4", "customer5"))
+		Expect(fakeSQL.history).To(HaveKey("customer4"))
+		Expect(fakeSQL.history).To(HaveKey("customer5"))
+		_, err = os.Stat(config.Properties[sqlutils.ExecutorMigrations])
+		Expect(os.IsNotExist(err)).To(BeTrue())
+	})
+
+	It("Should stop the execution when the context is cancelled", func() {
+		cluster := sqlutils.NewMigrationCluster("fakecluster.database.windows.net", nil, nil, nil)
+		cluster.Open = openFake
+		config, err := cluster.CreateExecConfiguration(context.Background(), schemav1alpha1.ClusterTargets{}, &v1.ConfigMap{Data: data}, true)
+		Expect(err).NotTo(HaveOccurred())
+
+		ctx, cancel := context.WithCancel(context.Background())
+		cancel()
+		targets := schemav1alpha1.ClusterTargets{DBs: []string{"db1"}, Schemas: []string{"customer9"}}
+		done, err := cluster.Execute(ctx, targets, config)
+		Expect(err).To(MatchError(context.Canceled))
+		Expect(done.DBs).To(BeEmpty())
+		Expect(fakeSQL.history).NotTo(HaveKey("customer9"))
+	})
+
+	It("Should run on the schema of the single matching DB of the candidates", func() {
+		cluster := sqlutils.NewMigrationCluster("fakecluster.database.windows.net", nil, nil, nil)
+		cluster.Open = openFake
+		fakeSQL.dbSchemas = map[string][]string{
+			"tenants_1": {"dbo", "customer10"},
+			"tenants_2": {"dbo"},
+		}
+		targets, err := cluster.AquireTargets(context.Background(), schemav1alpha1.TargetFilter{
+			DBS:    []string{"tenants_1", "tenants_2"},
+			Schema: "^customer",
+		})
+		Expect(err).NotTo(HaveOccurred())
+		config, err := cluster.CreateExecConfiguration(context.Background(), targets, &v1.ConfigMap{Data: data}, true)
+		Expect(err).NotTo(HaveOccurred())
+
+		done, err := cluster.Execute(context.Background(), targets, config)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(done.Schemas).To(Equal([]string{"tenants_1.customer10"}))
+		Expect(fakeSQL.history).To(HaveKey("customer10"))
+		Expect(fakeSQL.history).NotTo(HaveKey("tenants_1.customer10"))
+	})
+
+	It("Should run on the schemas of DBs with dots in their names", func() {
+		cluster := sqlutils.NewMigrationCluster("fakecluster.database.windows.net", nil, nil, nil)
+		cluster.Open = openFake
+		fakeSQL.dbSchemas = map[string][]string{
+			"app.v1": {"customer11"},
+			"app.v2": {"customer12"},
+		}
+		targets, err := cluster.AquireTargets(context.Background(), schemav1alpha1.TargetFilter{
+			DBS:    []string{"app.v1", "app.v2"},
+			Schema: "^customer",
+		})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(targets.Schemas).To(Equal([]string{"app.v1.customer11", "app.v2.customer12"}))
+		config, err := cluster.CreateExecConfiguration(context.Background(), targets, &v1.ConfigMap{Data: data}, true)
+		Expect(err).NotTo(HaveOccurred())
+
+		done, err := cluster.Execute(context.Background(), targets, config)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(done.Schemas).To(Equal([]string{"app.v1.customer11", "app.v2.customer12"}))
+		Expect(fakeSQL.history).To(HaveKey("customer11"))
+		Expect(fakeSQL.history).To(HaveKey("customer12"))
+	})
+
+	It("Should apply the migrations on every DB and report the results per DB", func() {
+		cluster := sqlutils.NewMigrationCluster("fakecluster.database.windows.net", nil, nil, nil)
+		cluster.Open = openFake
+		config, err := cluster.CreateExecConfiguration(context.Background(), schemav1alpha1.ClusterTargets{}, &v1.ConfigMap{Data: data}, true)
+		Expect(err).NotTo(HaveOccurred())
+
+		fakeSQL.failOn = "[customer7].[Orders] (tenant_id INT)"
+		targets := schemav1alpha1.ClusterTargets{
+			DBs:     []string{"db1", "db2"},
+			Schemas: []string{"db1.customer6", "db2.customer7", "db2.customer8"},
+			SchemaTargets: map[string]schemav1alpha1.SchemaTarget{
+				"db1.customer6": {DB: "db1", Schema: "customer6"},
+				"db2.customer7": {DB: "db2", Schema: "customer7"},
+				"db2.customer8": {DB: "db2", Schema: "customer8"},
+			},
+		}
+		done, err := cluster.Execute(context.Background(), targets, config)
+		Expect(err).To(MatchError(ContainSubstring("failed to execute on 1/2 dbs [db2]")))
+		Expect(done.DBs).To(Equal([]string{"db1"}))
+		Expect(done.Schemas).To(ConsistOf("db1.customer6", "db2.customer8"))
+		Expect(done.Results).To(HaveLen(2))
+		Expect(done.Results[0]).To(Equal(schemav1alpha1.DBResult{DB: "db1", Executed: true, Schemas: 1}))
+		Expect(done.Results[1].Executed).To(BeFalse())
+		Expect(done.Results[1].Schemas).To(Equal(1))
+		Expect(done.Results[1].Error).To(ContainSubstring("customer7"))
+	})
+})
@@ -0,0 +1,236 @@
+package sqlutils
+
+// Copyright (c) Microsoft Corporation.
+// Licensed under the MIT License.
+import (
+	"bufio"
+	"bytes"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"regexp"
+	"strings"
+)
+
+// SchemaRenameMode controls how the template schema is renamed when rewriting a dacpac.
+type SchemaRenameMode string
+
+const (
+	// SchemaRenameXML renames only schema qualified names in the DacFx model and scripts (default).
+	SchemaRenameXML SchemaRenameMode = "xml"
+	// SchemaRenameSubstring replaces every occurrence of the template name (legacy behaviour, opt-in).
+	SchemaRenameSubstring SchemaRenameMode = "substring"
+)
+
+var (
+	utf8BOM          = []byte{0xEF, 0xBB, 0xBF}
+	nameAttrPattern  = regexp.MustCompile(`(\sName\s*=\s*)("[^"]*"|'[^']*')`)
+	valueAttrPattern = regexp.MustCompile(`(\sValue\s*=\s*)("[^"]*"|'[^']*')`)
+	regularIdPattern = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_@#$]*$`)
+)
+
+// ParseSchemaRenameMode parses the rename mode configuration (empty means the default xml mode).
+func ParseSchemaRenameMode(mode string) (SchemaRenameMode, error) {
+	switch SchemaRenameMode(strings.ToLower(strings.TrimSpace(mode))) {
+	case "", SchemaRenameXML:
+		return SchemaRenameXML, nil
+	case SchemaRenameSubstring:
+		return SchemaRenameSubstring, nil
+	}
+	return "", fmt.Errorf("unknown schema rename mode %q", mode)
+}
+
+// schemaRenamer renames references to a source schema in identifiers and sql scripts.
+type schemaRenamer struct {
+	sourceSchema string
+	tenantSchema string
+	// scriptRefs matches schema qualified references in sql scripts, e.g. [tenant_].[Table] or tenant_.Table
+	scriptRefs []*regexp.Regexp
+}
+
+func newSchemaRenamer(sourceSchema, tenantSchema string) *schemaRenamer {
+	bracketed := regexp.QuoteMeta("[" + strings.ReplaceAll(sourceSchema, "]", "]]") + "]")
+	r := &schemaRenamer{
+		sourceSchema: sourceSchema,
+		tenantSchema: tenantSchema,
+		scriptRefs: []*regexp.Regexp{
+			regexp.MustCompile(`(?i)()` + bracketed + `(\s*\.)`),
+			regexp.MustCompile(`(?i)(\bSCHEMA\s*(?:::)?\s*)` + bracketed + `()`),
+		},
+	}
+	if regularIdPattern.MatchString(sourceSchema) {
+		bare := regexp.QuoteMeta(sourceSchema)
+		r.scriptRefs = append(r.scriptRefs,
+			regexp.MustCompile(`(?i)(^|[^A-Za-z0-9_@#$.\[\]"])`+bare+`(\s*\.)`),
+			regexp.MustCompile(`(?i)(\bSCHEMA\s*(?:::)?\s*)`+bare+`()\b`),
+		)
+	}
+	return r
+}
+
+// renameScript renames the schema qualified references in a sql script fragment.
+func (r *schemaRenamer) renameScript(script []byte) []byte {
+	replacement := []byte("${1}" + strings.ReplaceAll(r.quotedTenant(), "$", "$$") + "${2}")
+	for _, ref := range r.scriptRefs {
+		script = ref.ReplaceAll(script, replacement)
+	}
+	return script
+}
+
+// renameIdentifier renames the schema part of a multi part identifier like [schema].[table].[column].
+func (r *schemaRenamer) renameIdentifier(identifier string) string {
+	if !strings.HasPrefix(identifier, "[") {
+		return identifier
+	}
+	// find the end of the first bracketed part - `]]` is an escaped bracket.
+	end := -1
+	for i := 1; i < len(identifier); i++ {
+		if identifier[i] != ']' {
+			continue
+		}
+		if i+1 < len(identifier) && identifier[i+1] == ']' {
+			i++
+			continue
+		}
+		end = i
+		break
+	}
+	if end < 0 {
+		return identifier
+	}
+	schema := strings.ReplaceAll(identifier[1:end], "]]", "]")
+	rest := identifier[end+1:]
+	if !strings.EqualFold(schema, r.sourceSchema) || (rest != "" && !strings.HasPrefix(rest, ".")) {
+		return identifier
+	}
+	return r.quotedTenant() + rest
+}
+
+func (r *schemaRenamer) quotedTenant() string {
+	return "[" + strings.ReplaceAll(r.tenantSchema, "]", "]]") + "]"
+}
+
+// renameStartElement renames the schema in the Name attribute of model elements and references,
+// and in the scripts held in Value attributes.
+func (r *schemaRenamer) renameStartElement(raw []byte, element xml.StartElement) []byte {
+	switch element.Name.Local {
+	case "Element", "References":
+		raw = replaceAttr(raw, nameAttrPattern, func(value string) string {
+			return xmlEscape(r.renameIdentifier(xmlUnescape(value)))
+		})
+	}
+	return replaceAttr(raw, valueAttrPattern, func(value string) string {
+		return string(r.renameScript([]byte(value)))
+	})
+}
+
+// replaceAttr applies `rename` on the (quoted) attribute values matching the pattern.
+func replaceAttr(raw []byte, pattern *regexp.Regexp, rename func(string) string) []byte {
+	return pattern.ReplaceAllFunc(raw, func(attr []byte) []byte {
+		m := pattern.FindSubmatch(attr)
+		quoted := m[2]
+		quote := quoted[0]
+		value := rename(string(quoted[1 : len(quoted)-1]))
+		out := make([]byte, 0, len(m[1])+len(value)+2)
+		out = append(out, m[1]...)
+		out = append(out, quote)
+		out = append(out, value...)
+		return append(out, quote)
+	})
+}
+
+func xmlEscape(s string) string {
+	var b strings.Builder
+	_ = xml.EscapeText(&b, []byte(s))
+	return b.String()
+}
+
+func xmlUnescape(s string) string {
+	var v string
+	if err := xml.Unmarshal([]byte("<v>"+s+"</v>"), &v); err != nil {
+		return s
+	}
+	return v
+}
+
+// recordingReader keeps the bytes read by the xml decoder so tokens can be copied as is.
+type recordingReader struct {
+	r    io.Reader
+	buf  []byte
+	base int64
+}
+
+func (rr *recordingReader) Read(p []byte) (int, error) {
+	n, err := rr.r.Read(p)
+	rr.buf = append(rr.buf, p[:n]...)
+	return n, err
+}
+
+// take returns the raw bytes up to the absolute offset and drops them from the buffer.
+func (rr *recordingReader) take(offset int64) []byte {
+	n := int(offset - rr.base)
+	raw := append([]byte(nil), rr.buf[:n]...)
+	rr.buf = append(rr.buf[:0], rr.buf[n:]...)
+	rr.base = offset
+	return raw
+}
+
+// rewriteModelXML is a contentRewriter for the DacFx model (and refactor log).
+// It streams the xml tokens and renames only schema qualified names and references,
+// all other content is copied byte for byte.
+func rewriteModelXML(dst io.Writer, src io.Reader, sourceSchema, tenantSchema string) error {
+	renamer := newSchemaRenamer(sourceSchema, tenantSchema)
+	br := bufio.NewReader(src)
+	if bom, err := br.Peek(len(utf8BOM)); err == nil && bytes.Equal(bom, utf8BOM) {
+		if _, err := br.Discard(len(utf8BOM)); err != nil {
+			return err
+		}
+		if _, err := dst.Write(utf8BOM); err != nil {
+			return err
+		}
+	}
+	rec := &recordingReader{r: br}
+	decoder := xml.NewDecoder(rec)
+	for {
+		token, err := decoder.RawToken()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return fmt.Errorf("failed parsing model xml: %w", err)
+		}
+		raw := rec.take(decoder.InputOffset())
+		switch t := token.(type) {
+		case xml.StartElement:
+			raw = renamer.renameStartElement(raw, t)
+		case xml.CharData:
+			raw = renamer.renameScript(raw)
+		}
+		if _, err := dst.Write(raw); err != nil {
+			return err
+		}
+	}
+	_, err := dst.Write(rec.take(rec.base + int64(len(rec.buf))))
+	return err
+}
+
+// rewriteScript is a contentRewriter for the sql deploy scripts, renaming schema qualified references line by line.
+func rewriteScript(dst io.Writer, src io.Reader, sourceSchema, tenantSchema string) error {
+	renamer := newSchemaRenamer(sourceSchema, tenantSchema)
+	br := bufio.NewReader(src)
+	for {
+		line, err := br.ReadBytes('\n')
+		if len(line) > 0 {
+			if _, werr := dst.Write(renamer.renameScript(line)); werr != nil {
+				return werr
+			}
+		}
+		if errors.Is(err, io.EOF) {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+	}
+}
@@ -0,0 +1,211 @@
+package sqlutils
+
+// Copyright (c) Microsoft Corporation.
+// Licensed under the MIT License.
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"io"
+	"net/url"
+	"regexp"
+	"strings"
+
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore/policy"
+	"github.com/Azure/azure-sdk-for-go/sdk/azidentity"
+	"github.com/lib/pq"
+	"github.com/microsoft/azure-schema-operator/pkg/clients"
+	"github.com/microsoft/azure-schema-operator/pkg/config"
+	"github.com/microsoft/azure-schema-operator/pkg/utils"
+	"github.com/rs/zerolog/log"
+	"github.com/spf13/viper"
+
+	schemav1alpha1 "github.com/microsoft/azure-schema-operator/apis/dbschema/v1alpha1"
+	v1 "k8s.io/api/core/v1"
+)
+
+const (
+	// postgresDB is used to enumerate the databases on the server
+	postgresDB = "postgres"
+	// defaultPostgresSchema is used for the history table when the migrations run on the entire DB
+	defaultPostgresSchema = "public"
+	// postgresAADScope is the scope of the AAD tokens of Azure Database for PostgreSQL
+	postgresAADScope = "https://ossrdbms-aad.database.windows.net/.default"
+)
+
+var (
+	postgresUser    string
+	postgresPass    string
+	postgresSSLMode string
+)
+
+func init() {
+	viper.AutomaticEnv()
+	viper.SetDefault(config.PostgresSSLMode, "require")
+	postgresUser = strings.TrimSpace(viper.GetString(config.PostgresUser))
+	postgresPass = strings.TrimSpace(viper.GetString(config.PostgresPass))
+	postgresSSLMode = strings.TrimSpace(viper.GetString(config.PostgresSSLMode))
+}
+
+// PostgresCluster represents a PostgreSQL server on which versioned migration scripts are applied
+// on each target DB or per target schema.
+type PostgresCluster struct {
+	URI            string
+	clients        *clients.Cache
+	notifyProgress utils.NotifyProgressFunc
+	// Open opens the connection pool to the database - defaults to the lib/pq driver.
+	Open func(server, databaseName string) (*sql.DB, error)
+}
+
+// NewPostgresCluster returns a new `PostgresCluster` using the client cache for its connection pools
+func NewPostgresCluster(uri string, cache *clients.Cache, notifier utils.NotifyProgressFunc) *PostgresCluster {
+	return &PostgresCluster{
+		URI:            uri,
+		clients:        cache,
+		notifyProgress: notifier,
+		Open:           openPostgres,
+	}
+}
+
+// AquireTargets returns the target DBs (see `TargetFilter.DBS` & `TargetFilter.Regexp`)
+// or, if schema targeting is defined, the matching schemas listed in `information_schema.schemata`.
+// When the filter targets multiple DBs the schemas are qualified by their DB (`db.schema`).
+func (c *PostgresCluster) AquireTargets(ctx context.Context, filter schemav1alpha1.TargetFilter) (schemav1alpha1.ClusterTargets, error) {
+	return aquireTargets(ctx, c.URI, c, filter)
+}
+
+// Execute applies the migrations on the targets - on each target DB, per target schema or on the entire DB.
+func (c *PostgresCluster) Execute(ctx context.Context, targets schemav1alpha1.ClusterTargets, config schemav1alpha1.ExecutionConfiguration) (schemav1alpha1.ClusterTargets, error) {
+	return executeMigrations(ctx, targets, config, c.db, ApplyPostgresMigrations, defaultPostgresSchema, c.notifyProgress)
+}
+
+// CreateExecConfiguration stores the versioned migration scripts in the `ConfigMap` for the execution
+func (c *PostgresCluster) CreateExecConfiguration(ctx context.Context, targets schemav1alpha1.ClusterTargets, cfgMap *v1.ConfigMap, failIfDataLoss bool) (schemav1alpha1.ExecutionConfiguration, error) {
+	return migrationsExecConfiguration(cfgMap)
+}
+
+// db returns the connection pool of the database from the client cache.
+// The release func must be called once the connection pool is no longer used.
+func (c *PostgresCluster) db(ctx context.Context, databaseName string) (*sql.DB, func(), error) {
+	pool, release, err := c.clients.Get(ctx, "postgres:"+c.URI+"/"+databaseName, func(ctx context.Context) (io.Closer, error) {
+		db, err := c.Open(c.URI, databaseName)
+		if err != nil {
+			return nil, err
+		}
+		return db, nil
+	})
+	if err != nil {
+		return nil, nil, err
+	}
+	return pool.(*sql.DB), release, nil
+}
+
+// listDatabases lists the user databases on the server matching the regexp expression.
+func (c *PostgresCluster) listDatabases(ctx context.Context, expression string) ([]string, error) {
+	nameFilter, err := regexp.Compile(expression)
+	if err != nil {
+		log.Error().Err(err).Msgf("parameter proveded is not a valid regexp: %s", expression)
+		return []string{}, err
+	}
+	dbs, err := c.query(ctx, postgresDB, `SELECT datname FROM pg_database WHERE NOT datistemplate AND datallowconn AND datname <> 'postgres' ORDER BY datname`)
+	if err != nil {
+		log.Error().Err(err).Msgf("Failed to query databases from server")
+		return []string{}, err
+	}
+	matching := []string{}
+	for _, db := range dbs {
+		if nameFilter.MatchString(db) {
+			matching = append(matching, db)
+			log.Debug().Msgf("db passed filter: %s", db)
+		}
+	}
+	return matching, nil
+}
+
+// listSchemas lists the user schemas of the database - the system (`pg_*`) and `information_schema` schemas are left out.
+func (c *PostgresCluster) listSchemas(ctx context.Context, databaseName string) ([]string, error) {
+	schemas, err := c.query(ctx, databaseName, `SELECT schema_name FROM information_schema.schemata WHERE schema_name <> 'information_schema' AND schema_name NOT LIKE 'pg\_%' ORDER BY schema_name`)
+	if err != nil {
+		log.Error().Err(err).Msgf("Failed to query schemas from db")
+		return []string{}, err
+	}
+	return schemas, nil
+}
+
+// query returns the single column rows of the query on the database
+func (c *PostgresCluster) query(ctx context.Context, databaseName, query string) ([]string, error) {
+	values := []string{}
+	db, release, err := c.db(ctx, databaseName)
+	if err != nil {
+		return values, err
+	}
+	defer release()
+
+	rows, err := db.QueryContext(ctx, query)
+	if err != nil {
+		return values, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var value string
+		if err = rows.Scan(&value); err != nil {
+			return values, err
+		}
+		values = append(values, value)
+	}
+	return values, rows.Err()
+}
+
+// postgresDSN returns the connection URL of the database, `server` is a host with an optional port.
+func postgresDSN(server, databaseName, password string) string {
+	dsn := url.URL{
+		Scheme:   "postgres",
+		User:     url.UserPassword(postgresUser, password),
+		Host:     server,
+		Path:     "/" + databaseName,
+		RawQuery: url.Values{"sslmode": []string{postgresSSLMode}}.Encode(),
+	}
+	return dsn.String()
+}
+
+func openPostgres(server, databaseName string) (*sql.DB, error) {
+	if !useMSI {
+		connector, err := pq.NewConnector(postgresDSN(server, databaseName, postgresPass))
+		if err != nil {
+			log.Error().Err(err).Msgf("Failed to open connection to %s", server)
+			return nil, err
+		}
+		return sql.OpenDB(connector), nil
+	}
+	cred, err := azidentity.NewDefaultAzureCredential(nil)
+	if err != nil {
+		log.Error().Err(err).Msg("failed to obtain a credential")
+		return nil, err
+	}
+	return sql.OpenDB(&aadConnector{server: server, databaseName: databaseName, cred: cred}), nil
+}
+
+// aadConnector connects with an AAD access token as the password - a new token is taken for every connection
+// as the tokens expire while the connection pool lives on.
+type aadConnector struct {
+	server       string
+	databaseName string
+	cred         *azidentity.DefaultAzureCredential
+}
+
+func (c *aadConnector) Connect(ctx context.Context) (driver.Conn, error) {
+	token, err := c.cred.GetToken(ctx, policy.TokenRequestOptions{Scopes: []string{postgresAADScope}})
+	if err != nil {
+		log.Error().Err(err).Msgf("failed to get a token for %s", c.server)
+		return nil, err
+	}
+	connector, err := pq.NewConnector(postgresDSN(c.server, c.databaseName, token.Token))
+	if err != nil {
+		return nil, err
+	}
+	return connector.Connect(ctx)
+}
+
+func (c *aadConnector) Driver() driver.Driver {
+	return &pq.Driver{}
+}
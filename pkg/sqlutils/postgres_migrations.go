@@ -0,0 +1,258 @@
+package sqlutils
+
+// Copyright (c) Microsoft Corporation.
+// Licensed under the MIT License.
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"regexp"
+	"strings"
+
+	"github.com/lib/pq"
+	"github.com/rs/zerolog/log"
+)
+
+// ApplyPostgresMigrations applies the migrations not yet recorded in the history table of the PostgreSQL schema.
+// Each migration script runs whole in its own transaction together with its history record,
+// concurrent migrations of the same schema are serialized with an advisory lock.
+// The scripts are written for `templateName` schema which is renamed to the target `schema`,
+// unqualified objects are created in the target schema (it is set as the `search_path` of the transaction).
+// It returns the number of migrations applied.
+func ApplyPostgresMigrations(ctx context.Context, db *sql.DB, schema, templateName string, migrations []Migration) (int, error) {
+	if err := ensurePostgresHistoryTable(ctx, db, schema); err != nil {
+		log.Error().Err(err).Msgf("failed to create the migration history table in %s", schema)
+		return 0, err
+	}
+	applied, err := appliedPostgresMigrations(ctx, db, schema)
+	if err != nil {
+		log.Error().Err(err).Msgf("failed to read the migration history of %s", schema)
+		return 0, err
+	}
+	var renamer *pgSchemaRenamer
+	if templateName != "" && templateName != schema {
+		renamer = newPGSchemaRenamer(templateName, schema)
+	}
+
+	count := 0
+	for _, migration := range migrations {
+		if checksum, ok := applied[migration.Version]; ok {
+			if checksum != migration.Checksum {
+				return count, fmt.Errorf("migration V%d in %s was changed after it was applied", migration.Version, schema)
+			}
+			continue
+		}
+		log.Info().Msgf("applying migration V%d (%s) on %s", migration.Version, migration.Description, schema)
+		err = applyPostgresMigration(ctx, db, schema, templateName != "", migration, renamer)
+		if err != nil {
+			log.Error().Err(err).Msgf("failed to apply migration V%d on %s", migration.Version, schema)
+			return count, fmt.Errorf("migration V%d: %w", migration.Version, err)
+		}
+		count = count + 1
+	}
+	return count, nil
+}
+
+func applyPostgresMigration(ctx context.Context, db *sql.DB, schema string, setSearchPath bool, migration Migration, renamer *pgSchemaRenamer) error {
+	tx, err := lockedPostgresTx(ctx, db, schema)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		// no-op if the transaction was committed
+		_ = tx.Rollback()
+	}()
+	if setSearchPath {
+		if _, err = tx.ExecContext(ctx, "SET LOCAL search_path TO "+pq.QuoteIdentifier(schema)); err != nil {
+			return err
+		}
+	}
+	script := migration.Script
+	if renamer != nil {
+		script = renamer.renameScript(script)
+	}
+	if _, err = tx.ExecContext(ctx, script); err != nil {
+		return err
+	}
+	_, err = tx.ExecContext(ctx,
+		fmt.Sprintf(`INSERT INTO %s.%s (version, description, checksum) VALUES ($1, $2, $3)`, pq.QuoteIdentifier(schema), pq.QuoteIdentifier(HistoryTable)),
+		migration.Version, migration.Description, migration.Checksum)
+	if err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// lockedPostgresTx begins a transaction holding the advisory lock of the schema
+func lockedPostgresTx(ctx context.Context, db *sql.DB, schema string) (*sql.Tx, error) {
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	_, err = tx.ExecContext(ctx, `SELECT pg_advisory_xact_lock(hashtext($1))`, "schemaop:"+schema)
+	if err != nil {
+		_ = tx.Rollback()
+		return nil, err
+	}
+	return tx, nil
+}
+
+func ensurePostgresHistoryTable(ctx context.Context, db *sql.DB, schema string) error {
+	// under the lock - concurrent `IF NOT EXISTS` creations may conflict
+	tx, err := lockedPostgresTx(ctx, db, schema)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		_ = tx.Rollback()
+	}()
+	if _, err = tx.ExecContext(ctx, `CREATE SCHEMA IF NOT EXISTS `+pq.QuoteIdentifier(schema)); err != nil {
+		return err
+	}
+	_, err = tx.ExecContext(ctx, fmt.Sprintf(`CREATE TABLE IF NOT EXISTS %s.%s (
+	version INTEGER NOT NULL PRIMARY KEY,
+	description VARCHAR(256) NOT NULL,
+	checksum CHAR(64) NOT NULL,
+	applied_on TIMESTAMPTZ NOT NULL DEFAULT now()
+)`, pq.QuoteIdentifier(schema), pq.QuoteIdentifier(HistoryTable)))
+	if err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+func appliedPostgresMigrations(ctx context.Context, db *sql.DB, schema string) (map[int]string, error) {
+	applied := make(map[int]string)
+	rows, err := db.QueryContext(ctx, fmt.Sprintf(`SELECT version, checksum FROM %s.%s`, pq.QuoteIdentifier(schema), pq.QuoteIdentifier(HistoryTable)))
+	if err != nil {
+		return applied, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var version int
+		var checksum string
+		if err = rows.Scan(&version, &checksum); err != nil {
+			return applied, err
+		}
+		applied[version] = strings.TrimSpace(checksum)
+	}
+	return applied, rows.Err()
+}
+
+// pgSchemaRenamer renames the template schema references of a PostgreSQL script:
+// quoted ("template") and unquoted qualified names (template.orders) and the schema statements (CREATE SCHEMA template).
+// String literals, comments and dollar quoted bodies (e.g. functions) are kept as is - objects referenced there
+// should be unqualified and resolved by the `search_path`.
+type pgSchemaRenamer struct {
+	quoted    *regexp.Regexp
+	qualified *regexp.Regexp
+	statement *regexp.Regexp
+	target    string
+}
+
+func newPGSchemaRenamer(templateName, schema string) *pgSchemaRenamer {
+	name := regexp.QuoteMeta(templateName)
+	return &pgSchemaRenamer{
+		quoted:    regexp.MustCompile(`"` + name + `"`),
+		qualified: regexp.MustCompile(`(^|[^\w."$])` + name + `(\s*\.)`),
+		statement: regexp.MustCompile(`(?i)(\bSCHEMA\s+(?:IF\s+(?:NOT\s+)?EXISTS\s+)?)` + name + `\b`),
+		target:    pq.QuoteIdentifier(schema),
+	}
+}
+
+func (r *pgSchemaRenamer) renameScript(script string) string {
+	var renamed strings.Builder
+	start := 0
+	for start < len(script) {
+		code, end := pgCodeEnd(script, start)
+		renamed.WriteString(r.renameCode(script[start:code]))
+		renamed.WriteString(script[code:end])
+		start = end
+	}
+	return renamed.String()
+}
+
+func (r *pgSchemaRenamer) renameCode(code string) string {
+	target := strings.ReplaceAll(r.target, "$", "$$")
+	code = r.quoted.ReplaceAllLiteralString(code, r.target)
+	code = r.qualified.ReplaceAllString(code, "${1}"+target+"${2}")
+	return r.statement.ReplaceAllString(code, "${1}"+target)
+}
+
+var pgDollarTag = regexp.MustCompile(`^\$(?:[A-Za-z_][A-Za-z_0-9]*)?\$`)
+
+// pgCodeEnd scans the script from `start` returning where the code ends and where the following
+// string literal, comment or dollar quoted body (up to which the script isn't renamed) ends.
+func pgCodeEnd(script string, start int) (int, int) {
+	for i := start; i < len(script); i++ {
+		switch c := script[i]; {
+		case c == '"':
+			// quoted identifiers are code, skipped so their content isn't taken for a literal or a comment
+			if end := strings.IndexByte(script[i+1:], '"'); end >= 0 {
+				i = i + 1 + end
+			} else {
+				return len(script), len(script)
+			}
+		case c == '\'':
+			escapes := i > 0 && (script[i-1] == 'E' || script[i-1] == 'e') && (i < 2 || !isPGIdentifierChar(script[i-2]))
+			return i, pgLiteralEnd(script, i+1, escapes)
+		case c == '-' && strings.HasPrefix(script[i:], "--"):
+			if end := strings.IndexByte(script[i:], '\n'); end >= 0 {
+				return i, i + end
+			}
+			return i, len(script)
+		case c == '/' && strings.HasPrefix(script[i:], "/*"):
+			return i, pgCommentEnd(script, i)
+		case c == '$' && (i == 0 || !isPGIdentifierChar(script[i-1])):
+			if tag := pgDollarTag.FindString(script[i:]); tag != "" {
+				if end := strings.Index(script[i+len(tag):], tag); end >= 0 {
+					return i, i + len(tag) + end + len(tag)
+				}
+				return i, len(script)
+			}
+		}
+	}
+	return len(script), len(script)
+}
+
+// pgLiteralEnd returns the end of the string literal starting at `i` (after the opening quote)
+func pgLiteralEnd(script string, i int, escapes bool) int {
+	for ; i < len(script); i++ {
+		switch {
+		case escapes && script[i] == '\\':
+			i++
+		case script[i] == '\'':
+			if i+1 < len(script) && script[i+1] == '\'' {
+				i++
+				continue
+			}
+			return i + 1
+		}
+	}
+	return len(script)
+}
+
+// pgCommentEnd returns the end of the (possibly nested) block comment starting at `i`
+func pgCommentEnd(script string, i int) int {
+	depth := 0
+	for i < len(script) {
+		switch {
+		case strings.HasPrefix(script[i:], "/*"):
+			depth++
+			i += 2
+		case strings.HasPrefix(script[i:], "*/"):
+			depth--
+			i += 2
+			if depth == 0 {
+				return i
+			}
+		default:
+			i++
+		}
+	}
+	return len(script)
+}
+
+func isPGIdentifierChar(c byte) bool {
+	return c == '_' || c == '$' || c >= '0' && c <= '9' || c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= 0x80
+}
@@ -0,0 +1,219 @@
+package sqlutils_test
+
+// Copyright (c) Microsoft Corporation.
+// Licensed under the MIT License.
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"os"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	v1 "k8s.io/api/core/v1"
+
+	schemav1alpha1 "github.com/microsoft/azure-schema-operator/apis/dbschema/v1alpha1"
+	"github.com/microsoft/azure-schema-operator/pkg/sqlutils"
+)
+
+var pgData = map[string]string{
+	"templateName":          "tenant_",
+	"V1__create_orders.sql": "CREATE TABLE \"tenant_\".orders (id SERIAL PRIMARY KEY, total NUMERIC);\nCREATE INDEX orders_total ON tenant_.orders (total);",
+	"V2__add_status.sql":    "ALTER TABLE tenant_.orders ADD COLUMN status TEXT;\nCREATE TABLE line_items (order_id INT REFERENCES orders (id));",
+}
+
+var _ = Describe("Postgres", func() {
+
+	BeforeEach(func() {
+		fakeSQL.reset()
+	})
+
+	It("Should rename the template schema and record the migrations", func() {
+		migrations, err := sqlutils.ParseMigrations(pgData)
+		Expect(err).NotTo(HaveOccurred())
+		db, err := openFake("server", "db1")
+		Expect(err).NotTo(HaveOccurred())
+		defer db.Close()
+
+		n, err := sqlutils.ApplyPostgresMigrations(context.Background(), db, "customer1", "tenant_", migrations)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(n).To(Equal(2))
+		Expect(fakeSQL.history["customer1"]).To(HaveLen(2))
+		Expect(fakeSQL.statements).To(ContainElements(
+			`CREATE SCHEMA IF NOT EXISTS "customer1"`,
+			`SET LOCAL search_path TO "customer1"`,
+			"CREATE TABLE \"customer1\".orders (id SERIAL PRIMARY KEY, total NUMERIC);\nCREATE INDEX orders_total ON \"customer1\".orders (total);",
+			"ALTER TABLE \"customer1\".orders ADD COLUMN status TEXT;\nCREATE TABLE line_items (order_id INT REFERENCES orders (id));",
+		))
+
+		n, err = sqlutils.ApplyPostgresMigrations(context.Background(), db, "customer1", "tenant_", migrations)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(n).To(Equal(0))
+	})
+
+	It("Should not record a failed migration", func() {
+		migrations, err := sqlutils.ParseMigrations(pgData)
+		Expect(err).NotTo(HaveOccurred())
+		db, err := openFake("server", "db1")
+		Expect(err).NotTo(HaveOccurred())
+		defer db.Close()
+
+		fakeSQL.failOn = "ADD COLUMN status"
+		n, err := sqlutils.ApplyPostgresMigrations(context.Background(), db, "customer2", "tenant_", migrations)
+		Expect(err).To(MatchError(ContainSubstring("migration V2")))
+		Expect(n).To(Equal(1))
+		Expect(fakeSQL.history["customer2"]).To(HaveLen(1))
+		Expect(fakeSQL.history["customer2"]).To(HaveKey(1))
+	})
+
+	It("Should discover the target schemas", func() {
+		cluster := sqlutils.NewPostgresCluster("fakeserver.postgres.database.azure.com", nil, nil)
+		cluster.Open = openFake
+		fakeSQL.databases = []string{"tenants1", "tenants2", "other"}
+		fakeSQL.dbSchemas = map[string][]string{
+			"tenants1": {"public", "customer1", "customer2"},
+			"tenants2": {"public", "customer3"},
+		}
+		targets, err := cluster.AquireTargets(context.Background(), schemav1alpha1.TargetFilter{DB: "^tenants", Regexp: true, Schema: "^customer"})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(targets.DBs).To(Equal([]string{"tenants1", "tenants2"}))
+		Expect(targets.Schemas).To(Equal([]string{"tenants1.customer1", "tenants1.customer2", "tenants2.customer3"}))
+	})
+
+	It("Should not rename the template schema in string literals, comments and dollar quoted bodies", func() {
+		script := "-- tenant_.orders is created by V1\n" +
+			"/* tenant_.orders /* nested */ tenant_.orders */\n" +
+			"COMMENT ON TABLE tenant_.orders IS 'moved from tenant_.orders';\n" +
+			"INSERT INTO tenant_.notes VALUES (E'it\\'s tenant_.x', 'it''s tenant_.y');\n" +
+			"CREATE FUNCTION tenant_.total() RETURNS NUMERIC AS $$ SELECT sum(total) FROM tenant_.orders $$ LANGUAGE SQL;\n" +
+			"CREATE FUNCTION tenant_.count() RETURNS BIGINT AS $body$ SELECT count(*) FROM \"tenant_\".orders $body$ LANGUAGE SQL;\n" +
+			"SELECT $1, \"it's\" FROM tenant_.orders;"
+		migrations, err := sqlutils.ParseMigrations(map[string]string{"V1__functions.sql": script})
+		Expect(err).NotTo(HaveOccurred())
+		db, err := openFake("server", "db1")
+		Expect(err).NotTo(HaveOccurred())
+		defer db.Close()
+
+		_, err = sqlutils.ApplyPostgresMigrations(context.Background(), db, "customer4", "tenant_", migrations)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(fakeSQL.statements).To(ContainElement("-- tenant_.orders is created by V1\n" +
+			"/* tenant_.orders /* nested */ tenant_.orders */\n" +
+			"COMMENT ON TABLE \"customer4\".orders IS 'moved from tenant_.orders';\n" +
+			"INSERT INTO \"customer4\".notes VALUES (E'it\\'s tenant_.x', 'it''s tenant_.y');\n" +
+			"CREATE FUNCTION \"customer4\".total() RETURNS NUMERIC AS $$ SELECT sum(total) FROM tenant_.orders $$ LANGUAGE SQL;\n" +
+			"CREATE FUNCTION \"customer4\".count() RETURNS BIGINT AS $body$ SELECT count(*) FROM \"tenant_\".orders $body$ LANGUAGE SQL;\n" +
+			"SELECT $1, \"it's\" FROM \"customer4\".orders;"))
+	})
+
+	It("Should qualify the schemas when a single DB of the candidates matched", func() {
+		cluster := sqlutils.NewPostgresCluster("fakeserver.postgres.database.azure.com", nil, nil)
+		cluster.Open = openFake
+		fakeSQL.databases = []string{"tenants1", "tenants2", "tenants3"}
+		fakeSQL.dbSchemas = map[string][]string{
+			"tenants1": {"public"},
+			"tenants2": {"public", "customer5"},
+			"tenants3": {"public"},
+		}
+		targets, err := cluster.AquireTargets(context.Background(), schemav1alpha1.TargetFilter{DB: "^tenants", Regexp: true, Schema: "^customer"})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(targets.DBs).To(Equal([]string{"tenants2"}))
+		Expect(targets.Schemas).To(Equal([]string{"tenants2.customer5"}))
+		config, err := cluster.CreateExecConfiguration(context.Background(), targets, &v1.ConfigMap{Data: pgData}, true)
+		Expect(err).NotTo(HaveOccurred())
+
+		done, err := cluster.Execute(context.Background(), targets, config)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(done.Schemas).To(Equal([]string{"tenants2.customer5"}))
+		Expect(fakeSQL.history).To(HaveKey("customer5"))
+		Expect(fakeSQL.history).NotTo(HaveKey("tenants2.customer5"))
+	})
+
+	It("Should apply the migrations on the entire DB", func() {
+		cluster := sqlutils.NewPostgresCluster("fakeserver.postgres.database.azure.com", nil, nil)
+		cluster.Open = openFake
+		config, err := cluster.CreateExecConfiguration(context.Background(), schemav1alpha1.ClusterTargets{}, &v1.ConfigMap{Data: pgData}, true)
+		Expect(err).NotTo(HaveOccurred())
+		config.TemplateName = ""
+
+		done, err := cluster.Execute(context.Background(), schemav1alpha1.ClusterTargets{DBs: []string{"db1"}}, config)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(done.DBs).To(Equal([]string{"db1"}))
+		Expect(fakeSQL.history["public"]).To(HaveLen(2))
+		Expect(fakeSQL.statements).NotTo(ContainElement(ContainSubstring("search_path")))
+		_, err = os.Stat(config.Properties[sqlutils.ExecutorMigrations])
+		Expect(os.IsNotExist(err)).To(BeTrue())
+	})
+
+	Context("On a local PostgreSQL container", Label("postgres"), func() {
+		var (
+			cluster *sqlutils.PostgresCluster
+			db      *sql.DB
+			dbName  = "schemaop"
+		)
+
+		BeforeEach(func() {
+			if testPostgresServer == "" {
+				Skip("requires a PostgreSQL server (schemaop_test_postgres_server)")
+			}
+			cluster = sqlutils.NewPostgresCluster(testPostgresServer, nil, nil)
+			var err error
+			db, err = cluster.Open(testPostgresServer, dbName)
+			Expect(err).NotTo(HaveOccurred())
+			for _, schema := range []string{"customer_a", "customer_b"} {
+				_, err = db.Exec(fmt.Sprintf(`DROP SCHEMA IF EXISTS %s CASCADE; CREATE SCHEMA %s`, schema, schema))
+				Expect(err).NotTo(HaveOccurred())
+			}
+		})
+
+		AfterEach(func() {
+			if db != nil {
+				db.Close()
+			}
+		})
+
+		It("Should apply the migrations on each schema", func() {
+			targets, err := cluster.AquireTargets(context.Background(), schemav1alpha1.TargetFilter{DB: dbName, Schema: "^customer_"})
+			Expect(err).NotTo(HaveOccurred())
+			Expect(targets.Schemas).To(Equal([]string{"customer_a", "customer_b"}))
+
+			config, err := cluster.CreateExecConfiguration(context.Background(), targets, &v1.ConfigMap{Data: pgData}, true)
+			Expect(err).NotTo(HaveOccurred())
+			done, err := cluster.Execute(context.Background(), targets, config)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(done.Schemas).To(ConsistOf("customer_a", "customer_b"))
+
+			var tables []string
+			rows, err := db.Query(`SELECT table_schema || '.' || table_name FROM information_schema.tables WHERE table_schema LIKE 'customer\_%' ORDER BY 1`)
+			Expect(err).NotTo(HaveOccurred())
+			defer rows.Close()
+			for rows.Next() {
+				var table string
+				Expect(rows.Scan(&table)).To(Succeed())
+				tables = append(tables, table)
+			}
+			Expect(tables).To(Equal([]string{
+				"customer_a.__schemaop_history", "customer_a.line_items", "customer_a.orders",
+				"customer_b.__schemaop_history", "customer_b.line_items", "customer_b.orders",
+			}))
+
+			migrations, err := sqlutils.ParseMigrations(pgData)
+			Expect(err).NotTo(HaveOccurred())
+			n, err := sqlutils.ApplyPostgresMigrations(context.Background(), db, "customer_a", "tenant_", migrations)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(n).To(Equal(0))
+		})
+
+		It("Should roll back a failed migration", func() {
+			migrations, err := sqlutils.ParseMigrations(map[string]string{
+				"V1__create_orders.sql": "CREATE TABLE tenant_.orders (id INT);\nSELECT 1/0;",
+			})
+			Expect(err).NotTo(HaveOccurred())
+			_, err = sqlutils.ApplyPostgresMigrations(context.Background(), db, "customer_a", "tenant_", migrations)
+			Expect(err).To(MatchError(ContainSubstring("division by zero")))
+
+			var count int
+			Expect(db.QueryRow(`SELECT count(*) FROM information_schema.tables WHERE table_schema = 'customer_a' AND table_name = 'orders'`).Scan(&count)).To(Succeed())
+			Expect(count).To(BeZero())
+		})
+	})
+})
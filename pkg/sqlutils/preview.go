@@ -0,0 +1,143 @@
+package sqlutils
+
+// Copyright (c) Microsoft Corporation.
+// Licensed under the MIT License.
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/rs/zerolog/log"
+	v1 "k8s.io/api/core/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+// DeploymentScript returns the changes the `ConfigMap` would make on the DB (or on the `schema` of the DB) without making them:
+// the sqlpackage deployment script of the dacpac, or the migrations that weren't applied yet.
+// The client is used to get the external dacpacs the dacpac references.
+func DeploymentScript(ctx context.Context, c client.Reader, uri, dbName, schema string, cfgMap *v1.ConfigMap) (string, error) {
+	switch executor := cfgMap.Data["executor"]; executor {
+	case "", ExecutorSQLPackage:
+		return dacpacScript(ctx, c, uri, dbName, schema, cfgMap)
+	case ExecutorMigrations:
+		return pendingMigrationsScript(ctx, uri, dbName, schema, cfgMap)
+	default:
+		return "", fmt.Errorf("unknown sql executor %q", executor)
+	}
+}
+
+func dacpacScript(ctx context.Context, c client.Reader, uri, dbName, schema string, cfgMap *v1.ConfigMap) (string, error) {
+	if len(cfgMap.BinaryData["dacpac"]) == 0 {
+		return "", fmt.Errorf("no dacpac found in configmap")
+	}
+	workDir, err := os.MkdirTemp("", "dacpac-script-*")
+	if err != nil {
+		return "", err
+	}
+	defer os.RemoveAll(workDir)
+	dacpac, err := downloadDacfromCfg(cfgMap, workDir)
+	if err != nil {
+		return "", err
+	}
+	if externalDacpacs, ok := cfgMap.Data["externalDacpacs"]; ok {
+		if _, err = downloadDependencies(ctx, c, workDir, externalDacpacs); err != nil {
+			return "", err
+		}
+	}
+	if templateName := cfgMap.Data["templateName"]; schema != "" && templateName != "" && schema != templateName {
+		mode, err := ParseSchemaRenameMode(cfgMap.Data["schemaRenameMode"])
+		if err != nil {
+			return "", err
+		}
+		tenantDacpac := strings.TrimSuffix(dacpac, ".dacpac") + "-" + schema + ".dacpac"
+		if err = RewriteDacPac(tenantDacpac, dacpac, templateName, schema, mode); err != nil {
+			return "", err
+		}
+		dacpac = tenantDacpac
+	}
+
+	script, err := os.CreateTemp("", "deploy-*.sql")
+	if err != nil {
+		return "", err
+	}
+	script.Close()
+	defer os.Remove(script.Name())
+	err = ScriptDacPac(ctx, dacpac, uri, dbName, cfgMap.Data["sqlpackageOptions"], script.Name(), io.Discard)
+	if err != nil {
+		return "", err
+	}
+	data, err := os.ReadFile(script.Name())
+	return string(data), err
+}
+
+func pendingMigrationsScript(ctx context.Context, uri, dbName, schema string, cfgMap *v1.ConfigMap) (string, error) {
+	migrations, err := ParseMigrations(cfgMap.Data)
+	if err != nil {
+		return "", err
+	}
+	historySchema := defaultMigrationSchema
+	var renamer *schemaRenamer
+	if schema != "" {
+		historySchema = schema
+		if templateName := cfgMap.Data["templateName"]; templateName != "" && templateName != schema {
+			renamer = newSchemaRenamer(templateName, schema)
+		}
+	}
+	db, err := openDB(uri, dbName)
+	if err != nil {
+		return "", err
+	}
+	defer db.Close()
+	pending, err := PendingMigrations(ctx, db, historySchema, migrations)
+	if err != nil {
+		return "", err
+	}
+	script := &strings.Builder{}
+	for _, migration := range pending {
+		fmt.Fprintf(script, "-- V%d %s\n", migration.Version, migration.Description)
+		body := []byte(migration.Script)
+		if renamer != nil {
+			body = renamer.renameScript(body)
+		}
+		script.Write(body)
+		if !strings.HasSuffix(migration.Script, "\n") {
+			script.WriteString("\n")
+		}
+	}
+	return script.String(), nil
+}
+
+// PendingMigrations returns the migrations not recorded in the history table of the schema yet.
+// Like `ApplyMigrations`, it fails if an applied migration was changed.
+func PendingMigrations(ctx context.Context, db *sql.DB, schema string, migrations []Migration) ([]Migration, error) {
+	var historyID sql.NullInt64
+	table := quoteIdentifier(schema) + "." + quoteIdentifier(HistoryTable)
+	err := db.QueryRowContext(ctx, `SELECT OBJECT_ID(@p1, 'U')`, table).Scan(&historyID)
+	if err != nil {
+		log.Error().Err(err).Msgf("failed to look up the migration history table of %s", schema)
+		return nil, err
+	}
+	if !historyID.Valid {
+		return migrations, nil
+	}
+	applied, err := appliedMigrations(ctx, db, schema)
+	if err != nil {
+		log.Error().Err(err).Msgf("failed to read the migration history of %s", schema)
+		return nil, err
+	}
+	pending := []Migration{}
+	for _, migration := range migrations {
+		checksum, ok := applied[migration.Version]
+		if !ok {
+			pending = append(pending, migration)
+			continue
+		}
+		if checksum != migration.Checksum {
+			return nil, fmt.Errorf("migration V%d in %s was changed after it was applied", migration.Version, schema)
+		}
+	}
+	return pending, nil
+}
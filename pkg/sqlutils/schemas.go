@@ -6,9 +6,13 @@ import (
 	"context"
 	"database/sql"
 	"fmt"
-	"regexp"
-	"strconv"
+	"io"
+	"os"
+	"strings"
 
+	"github.com/microsoft/azure-schema-operator/pkg/clients"
+	"github.com/microsoft/azure-schema-operator/pkg/kustoutils"
+	"github.com/microsoft/azure-schema-operator/pkg/runlogs"
 	"github.com/microsoft/azure-schema-operator/pkg/utils"
 	"github.com/microsoft/go-mssqldb/azuread"
 	"github.com/rs/zerolog/log"
@@ -23,91 +27,186 @@ type SQLCluster struct {
 	URI            string
 	Databases      []string
 	Schemas        []string
-	k8sClient      client.Client
+	k8sClient      client.Reader
+	clients        *clients.Cache
 	notifyProgress utils.NotifyProgressFunc
+	// Open opens the connection pool to the database - defaults to the go-mssqldb azuread driver.
+	Open func(server, databaseName string) (*sql.DB, error)
 }
 
-// NewSQLCluster returns a new `SQLCluster`
-func NewSQLCluster(uri string, c client.Client, notifier utils.NotifyProgressFunc) *SQLCluster {
+// NewSQLCluster returns a new `SQLCluster` using the client cache for its connection pools
+func NewSQLCluster(uri string, c client.Reader, cache *clients.Cache, notifier utils.NotifyProgressFunc) *SQLCluster {
 	cls := &SQLCluster{
 		URI:            uri,
 		k8sClient:      c,
+		clients:        cache,
 		notifyProgress: notifier,
+		Open:           openDB,
 	}
 
 	return cls
 }
 
+// migrations returns the native migrations executor for the cluster
+func (c *SQLCluster) migrations() *MigrationCluster {
+	return &MigrationCluster{SQLCluster: c}
+}
+
 // AquireTargets for SQL Server supports 2 modes:
-// 1. return a single DB - to be used as the target DB.
-// 2. if the schema filter is defined we will use it as a regexp to filter schemas - and apply the DacPac per schema.
-func (c *SQLCluster) AquireTargets(filter schemav1alpha1.TargetFilter) (schemav1alpha1.ClusterTargets, error) {
+// 1. return the target DBs (see `TargetFilter.DBS` & `TargetFilter.Regexp`) - to apply the DacPac on each DB.
+// 2. if schema targeting is defined (see `SchemaFilter`) - return the matching schemas to apply the DacPac per schema.
+// The schemas are either discovered from the DB, taken from the explicit list or from the discovery webhook.
+// When the filter targets multiple DBs (several `DBS` or a `Regexp`) the schemas are named after their DB (`db.schema`),
+// even if only one of the DBs has matching schemas. The DB and schema of each target are kept in `SchemaTargets`.
+// An `utils.ErrNoMatchingTargets` error is returned if no DB or schema matched.
+func (c *SQLCluster) AquireTargets(ctx context.Context, filter schemav1alpha1.TargetFilter) (schemav1alpha1.ClusterTargets, error) {
+	return aquireTargets(ctx, c.URI, c, filter)
+}
+
+// targetLister lists the databases and schemas of a server
+type targetLister interface {
+	listDatabases(ctx context.Context, expression string) ([]string, error)
+	listSchemas(ctx context.Context, databaseName string) ([]string, error)
+}
+
+// aquireTargets returns the target DBs, or the target schemas when the filter targets schemas, listed on the server.
+func aquireTargets(ctx context.Context, uri string, lister targetLister, filter schemav1alpha1.TargetFilter) (schemav1alpha1.ClusterTargets, error) {
 	targets := schemav1alpha1.ClusterTargets{}
 
-	targets.DBs = append(targets.DBs, filter.DB)
-	if filter.Schema != "" {
-		schemas, err := filterSchemas(c.URI, filter.DB, filter.Schema)
+	dbs, err := aquireDatabases(ctx, lister, filter)
+	if err != nil {
+		log.Error().Err(err).Msg("failed retriving list of dbs from server")
+		return targets, err
+	}
+	if len(dbs) == 0 {
+		log.Info().Msg("no dbs matched the filter")
+		return targets, fmt.Errorf("%w: no dbs on %s matched the filter", utils.ErrNoMatchingTargets, uri)
+	}
+	if !HasSchemaTargeting(filter) {
+		targets.DBs = dbs
+		log.Info().Msgf("Found the following targets: %+v", targets)
+		return targets, nil
+	}
+	schemaFilter, err := NewSchemaFilter(filter)
+	if err != nil {
+		log.Error().Err(err).Msg("invalid schema filter")
+		return targets, err
+	}
+
+	perDB := make(map[string][]string, len(dbs))
+	for _, db := range dbs {
+		schemas, err := aquireSchemas(ctx, uri, lister, filter, db, schemaFilter)
 		if err != nil {
 			return targets, err
 		}
 		if len(schemas) == 0 {
-			log.Info().Msgf("no existing schemas found - assuming we need to create a new one")
-			schemas = append(schemas, filter.Schema)
+			log.Info().Msgf("no schemas in %s matched the filter", db)
+			continue
+		}
+		targets.DBs = append(targets.DBs, db)
+		perDB[db] = schemas
+	}
+	// the schemas are qualified when the filter can match multiple DBs, keeping the names stable as DBs gain or lose schemas
+	multiDB := targetsMultipleDBs(filter)
+	targets.SchemaTargets = make(map[string]schemav1alpha1.SchemaTarget)
+	for _, db := range targets.DBs {
+		for _, schema := range perDB[db] {
+			name := qualifySchema(multiDB, db, schema)
+			targets.Schemas = append(targets.Schemas, name)
+			targets.SchemaTargets[name] = schemav1alpha1.SchemaTarget{DB: db, Schema: schema}
 		}
-		targets.Schemas = schemas
+	}
+	if len(targets.Schemas) == 0 {
+		return targets, fmt.Errorf("%w: no schemas in %s matched the filter", utils.ErrNoMatchingTargets, strings.Join(dbs, ","))
 	}
 	log.Info().Msgf("Found the following targets: %+v", targets)
 	return targets, nil
 }
 
-// Execute runs the configured dacpacs on the targets defined.
-func (c *SQLCluster) Execute(targets schemav1alpha1.ClusterTargets, config schemav1alpha1.ExecutionConfiguration) (schemav1alpha1.ClusterTargets, error) {
-	executed := schemav1alpha1.ClusterTargets{}
-
-	if len(targets.Schemas) == 0 {
-		log.Info().Msg("will run the DacPac on the entire DB without modifications")
-		err := RunDacPac(config.DacPac, c.URI, targets.DBs[0], config.Properties["sqlpackageOptions"])
+// aquireSchemas returns the schemas of the DB passing the filter.
+func aquireSchemas(ctx context.Context, uri string, lister targetLister, filter schemav1alpha1.TargetFilter, db string, schemaFilter *SchemaFilter) ([]string, error) {
+	var candidates []string
+	var err error
+	if filter.Webhook != "" {
+		client := kustoutils.NewWebHookClient(nil)
+		candidates, err = client.PerformSchemaQuery(ctx, filter.Webhook, serverNameFromURI(uri), db, filter.Label)
 		if err != nil {
-			return executed, err
+			log.Error().Err(err).Msg("failed retriving list of schemas from the webhook")
+			return nil, err
 		}
+	} else if len(filter.Schemas) > 0 {
+		candidates = filter.Schemas
+	}
 
-	} else {
-		total := len(targets.Schemas)
-		log.Info().Msgf("will run the DacPac each schema: %d schemas to run", total)
-
-		//verify we have the required template name configuration
-		if config.TemplateName == "" {
-			log.Error().Msg("the template name is required to run the dacpac per schema")
-			return executed, fmt.Errorf("the template name is required to run the dacpac per schema")
+	if candidates == nil || !filter.Create {
+		existing, err := lister.listSchemas(ctx, db)
+		if err != nil {
+			return nil, err
 		}
-		noOfWorkers := parallelWorkers
-		if workers, ok := config.Properties["parallelWorkers"]; ok {
-			noOfWorkers, _ = strconv.Atoi(workers)
+		if candidates == nil {
+			candidates = existing
+		} else {
+			candidates = intersect(candidates, existing)
 		}
+	}
+	return schemaFilter.Filter(candidates), nil
+}
 
-		var jobs = make(chan dacpacJob, noOfWorkers)
-		var results = make(chan dacpacResult, noOfWorkers)
-		var err error
-		go allocate(c.URI, targets.DBs[0], config.Properties["sqlpackageOptions"], config.DacPac, config.TemplateName, targets.Schemas, jobs)
-		done := make(chan bool)
-		go result(c.notifyProgress, total, done, results, &executed, &err)
-		createWorkerPool(noOfWorkers, jobs, results)
-		<-done
-		if err != nil {
-			log.Error().Err(err).Msgf("Failed to run dacpac on some schemad - returning")
-			return executed, err
+// Execute runs the configured dacpacs on the targets defined - on each target DB.
+func (c *SQLCluster) Execute(ctx context.Context, targets schemav1alpha1.ClusterTargets, config schemav1alpha1.ExecutionConfiguration) (schemav1alpha1.ClusterTargets, error) {
+	if config.Properties["executor"] == ExecutorMigrations {
+		return c.migrations().Execute(ctx, targets, config)
+	}
+	executed := schemav1alpha1.ClusterTargets{}
+
+	//verify we have the required template name configuration
+	if len(targets.Schemas) > 0 && config.TemplateName == "" {
+		log.Error().Msg("the template name is required to run the dacpac per schema")
+		return executed, fmt.Errorf("the template name is required to run the dacpac per schema")
+	}
+	renameMode, err := ParseSchemaRenameMode(config.Properties["schemaRenameMode"])
+	if err != nil {
+		log.Error().Err(err).Msg("invalid schema rename mode")
+		return executed, err
+	}
+
+	executed, err = runPerDB(ctx, targets, func(ctx context.Context, db string, schemas []string) (schemav1alpha1.ClusterTargets, error) {
+		if len(schemas) == 0 {
+			log.Info().Msgf("will run the DacPac on the entire %s DB without modifications", db)
+			return schemav1alpha1.ClusterTargets{}, RunDacPac(ctx, config.DacPac, c.URI, db, config.Properties["sqlpackageOptions"], runlogs.FromContext(ctx).Output(db))
 		}
+		log.Info().Msgf("will run the DacPac each schema in %s: %d schemas to run", db, len(schemas))
+		return runPerSchema(ctx, workersFromConfig(config), schemas, c.notifyProgress, func(ctx context.Context, targetSchema string) (bool, error) {
+			return TargetDacpacExecution(ctx, c.URI, db, config.Properties["sqlpackageOptions"], config.DacPac, config.TemplateName, targetSchema, renameMode)
+		})
+	})
+	if err != nil {
+		log.Error().Err(err).Msgf("Failed to run dacpac on some targets - returning the executed ones")
+		return executed, err
 	}
-	executed.DBs = append(executed.DBs, targets.DBs[0])
 	log.Info().Msgf("Done with Dacpac execution on %+v", executed)
 	return executed, nil
 }
 
 // CreateExecConfiguration creates a configuration for the execution of the dacpac in the ConfigMap on the provided targets
-func (c *SQLCluster) CreateExecConfiguration(targets schemav1alpha1.ClusterTargets, cfgMap *v1.ConfigMap, failIfDataLoss bool) (schemav1alpha1.ExecutionConfiguration, error) {
+// the `executor` key in the ConfigMap selects the native migrations executor instead of sqlpackage.
+func (c *SQLCluster) CreateExecConfiguration(ctx context.Context, targets schemav1alpha1.ClusterTargets, cfgMap *v1.ConfigMap, failIfDataLoss bool) (schemav1alpha1.ExecutionConfiguration, error) {
+	switch executor := cfgMap.Data["executor"]; executor {
+	case "", ExecutorSQLPackage:
+	case ExecutorMigrations:
+		return c.migrations().CreateExecConfiguration(ctx, targets, cfgMap, failIfDataLoss)
+	default:
+		return schemav1alpha1.ExecutionConfiguration{}, fmt.Errorf("unknown sql executor %q", executor)
+	}
 	ec := schemav1alpha1.ExecutionConfiguration{}
 	ec.Properties = make(map[string]string)
-	dacPacFileName, err := downloadDacfromCfg(cfgMap)
+	// the dacpac and the external dacpacs it references are kept together in a working dir of the execution
+	workDir, err := os.MkdirTemp("", "dacpac-exec-*")
+	if err != nil {
+		log.Error().Err(err).Msg("failed to create the dacpac working dir")
+		return ec, err
+	}
+	dacPacFileName, err := downloadDacfromCfg(cfgMap, workDir)
 	if err != nil {
 		log.Error().Err(err).Msg("failed to download the dacpac content")
 		return ec, err
@@ -121,7 +220,7 @@ func (c *SQLCluster) CreateExecConfiguration(targets schemav1alpha1.ClusterTarge
 		ec.Properties["sqlpackageOptions"] = ""
 	}
 	if externalDacpacs, ok := cfgMap.Data["externalDacpacs"]; ok {
-		_, err = downloadDependencies(c.k8sClient, externalDacpacs)
+		_, err = downloadDependencies(ctx, c.k8sClient, workDir, externalDacpacs)
 		if err != nil {
 			log.Error().Err(err).Msg("failed to download the external dacpac content")
 			return ec, err
@@ -130,6 +229,13 @@ func (c *SQLCluster) CreateExecConfiguration(targets schemav1alpha1.ClusterTarge
 	if parallelWorkers, ok := cfgMap.Data["parallelWorkers"]; ok {
 		ec.Properties["parallelWorkers"] = parallelWorkers
 	}
+	if renameMode, ok := cfgMap.Data["schemaRenameMode"]; ok {
+		if _, err = ParseSchemaRenameMode(renameMode); err != nil {
+			log.Error().Err(err).Msg("invalid schema rename mode")
+			return ec, err
+		}
+		ec.Properties["schemaRenameMode"] = renameMode
+	}
 
 	if failIfDataLoss {
 		additionalParams := "/p:BlockOnPossibleDataLoss=true /p:DropObjectsNotInSource=false"
@@ -144,14 +250,9 @@ func (c *SQLCluster) CreateExecConfiguration(targets schemav1alpha1.ClusterTarge
 	return ec, nil
 }
 
-func filterSchemas(server, databaseName, schemaFilter string) ([]string, error) {
-	var db *sql.DB
-
-	schemas := []string{}
+// openDB opens a connection pool to the given database on the server.
+func openDB(server, databaseName string) (*sql.DB, error) {
 	// Build connection string
-	// connString := fmt.Sprintf("server=%s;user id=%s;password=%s;port=%d;database=%s;",
-	// 	server, sqlpackgeUser, sqlpackgePass, port, databaseName)
-	var err error
 	var connString string
 	if useMSI {
 		connString = fmt.Sprintf("sqlserver://%s?database=%s&fedauth=ActiveDirectoryMSI", server, databaseName)
@@ -160,36 +261,64 @@ func filterSchemas(server, databaseName, schemaFilter string) ([]string, error)
 			server, sqlpackgeUser, sqlpackgePass, databaseName)
 	}
 	// Create connection pool
-	db, err = sql.Open(azuread.DriverName, connString)
+	db, err := sql.Open(azuread.DriverName, connString)
 	if err != nil {
 		log.Error().Err(err).Msgf("Failed to open connection to %s", server)
-		return schemas, err
+		return nil, err
+	}
+	return db, nil
+}
+
+// serverNameFromURI extracts the server name from the uri, e.g. `myserver` from `myserver.database.windows.net`
+func serverNameFromURI(uri string) string {
+	if i := strings.Index(uri, "://"); i >= 0 {
+		uri = uri[i+3:]
 	}
-	ctx := context.Background()
+	return strings.Split(uri, ".")[0]
+}
 
-	nameFilter, err := regexp.Compile(schemaFilter)
+// db returns the connection pool to the database from the client cache.
+// The release func must be called once the connection pool is no longer used.
+func (c *SQLCluster) db(ctx context.Context, databaseName string) (*sql.DB, func(), error) {
+	pool, release, err := c.clients.Get(ctx, "sql:"+c.URI+"/"+databaseName, func(ctx context.Context) (io.Closer, error) {
+		db, err := c.Open(c.URI, databaseName)
+		if err != nil {
+			return nil, err
+		}
+		return db, nil
+	})
+	if err != nil {
+		return nil, nil, err
+	}
+	return pool.(*sql.DB), release, nil
+}
+
+// listSchemas lists the schemas of the database ordered by name.
+func (c *SQLCluster) listSchemas(ctx context.Context, databaseName string) ([]string, error) {
+	schemas := []string{}
+	db, release, err := c.db(ctx, databaseName)
 	if err != nil {
-		log.Error().Err(err).Msgf("Failed to compile schema filter regexp")
 		return schemas, err
 	}
+	defer release()
+
 	rows, err := db.QueryContext(ctx, `select s.name as schema_name from sys.schemas s order by s.name;`)
 	if err != nil {
 		log.Error().Err(err).Msgf("Failed to query schemas from db")
 		return schemas, err
 	}
+	defer rows.Close()
 	for rows.Next() {
 		var schemaName string
 
 		err = rows.Scan(&schemaName)
 		if err != nil {
 			log.Error().Err(err).Msgf("Failed scanning the schema name")
+			return schemas, err
 		}
-		if nameFilter.MatchString(schemaName) {
-			schemas = append(schemas, schemaName)
-			log.Debug().Msgf("schema passed filter: %s", schemaName)
-		}
+		schemas = append(schemas, schemaName)
 	}
-	return schemas, nil
+	return schemas, rows.Err()
 }
 
 // func ConnectWithMSI() (*sql.DB, error) {
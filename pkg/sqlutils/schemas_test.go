@@ -3,17 +3,26 @@ package sqlutils_test
 // Copyright (c) Microsoft Corporation.
 // Licensed under the MIT License.
 import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+
 	. "github.com/onsi/ginkgo/v2"
 	. "github.com/onsi/gomega"
+	"github.com/spf13/viper"
 
 	schemav1alpha1 "github.com/microsoft/azure-schema-operator/apis/dbschema/v1alpha1"
+	"github.com/microsoft/azure-schema-operator/pkg/config"
 	"github.com/microsoft/azure-schema-operator/pkg/sqlutils"
 	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
 )
 
 var _ = Describe("Schemas", func() {
 	Context("When Processing a cluster", func() {
-		cluster := sqlutils.NewSQLCluster("fakecluster.database.windows.net", nil, nil)
+		cluster := sqlutils.NewSQLCluster("fakecluster.database.windows.net", nil, nil, nil)
 		filter := schemav1alpha1.TargetFilter{
 			DB: "DB1",
 		}
@@ -27,24 +36,99 @@ var _ = Describe("Schemas", func() {
 			},
 		}
 		It("Should acquire requested targets and prepare for execution", func() {
-			clusterTargets, err := cluster.AquireTargets(filter)
+			clusterTargets, err := cluster.AquireTargets(context.Background(), filter)
 			Expect(err).NotTo(HaveOccurred())
-			executionConfiguration, err := cluster.CreateExecConfiguration(clusterTargets, cfgMap, true)
+			executionConfiguration, err := cluster.CreateExecConfiguration(context.Background(), clusterTargets, cfgMap, true)
 			Expect(err).NotTo(HaveOccurred())
 			Expect(executionConfiguration.DacPac).To(ContainSubstring("/tmp/"))
 			Expect(executionConfiguration.Properties["sqlpackageOptions"]).To(ContainSubstring("/p:BlockOnPossibleDataLoss=true"))
 		})
 
+		It("Should aggregate the per schema failures", func() {
+			targets := schemav1alpha1.ClusterTargets{
+				DBs:     []string{"DB1"},
+				Schemas: []string{"tenant_a", "tenant_b"},
+			}
+			executionConfiguration := schemav1alpha1.ExecutionConfiguration{
+				DacPac:       "../../docs/site/static/samples/sqlserver/test.dacpac",
+				TemplateName: "tenant_",
+				Properties: map[string]string{
+					"parallelWorkers": "2",
+				},
+			}
+			// sqlpackage is replaced by a script recording its runs and failing
+			dir := GinkgoT().TempDir()
+			runs := filepath.Join(dir, "runs")
+			script := filepath.Join(dir, "sqlpackage")
+			Expect(os.WriteFile(script, []byte("#!/bin/sh\necho run >> "+runs+"\necho 'deployment failed'\nexit 1\n"), 0o700)).To(Succeed())
+			DeferCleanup(viper.Set, config.SQLPackageCMDKey, viper.GetString(config.SQLPackageCMDKey))
+			viper.Set(config.SQLPackageCMDKey, script)
+
+			executed, err := cluster.Execute(context.Background(), targets, executionConfiguration)
+			Expect(err).To(HaveOccurred())
+			Expect(err.Error()).To(ContainSubstring("2/2 schemas [tenant_a,tenant_b]"))
+			Expect(err.Error()).To(ContainSubstring("exit code 1"))
+			Expect(executed.Schemas).To(BeEmpty())
+			content, err := os.ReadFile(runs)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(strings.Count(string(content), "run")).To(Equal(2))
+		})
+	})
+	Context("When the dacpac references external dacpacs", func() {
+		It("Should run the tenant dacpacs next to the external dacpacs", func() {
+			external := &v1.ConfigMap{
+				ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: "shared-dacpac"},
+				BinaryData: map[string][]byte{"dacpac": []byte("shared")},
+			}
+			c := fake.NewClientBuilder().WithObjects(external).Build()
+			cluster := sqlutils.NewSQLCluster("fakecluster.database.windows.net", c, nil, nil)
+			dacpac, err := os.ReadFile("../../docs/site/static/samples/sqlserver/test.dacpac")
+			Expect(err).NotTo(HaveOccurred())
+			cfgMap := &v1.ConfigMap{
+				Data: map[string]string{
+					"templateName":    "tenant_",
+					"externalDacpacs": `{"shared":{"namespace":"default","name":"shared-dacpac"}}`,
+				},
+				BinaryData: map[string][]byte{"dacpac": dacpac},
+			}
+			targets := schemav1alpha1.ClusterTargets{DBs: []string{"DB1"}, Schemas: []string{"tenant_a", "tenant_b"}}
+			executionConfiguration, err := cluster.CreateExecConfiguration(context.Background(), targets, cfgMap, false)
+			Expect(err).NotTo(HaveOccurred())
+			workDir := filepath.Dir(executionConfiguration.DacPac)
+			DeferCleanup(os.RemoveAll, workDir)
+			Expect(filepath.Join(workDir, "shared.dacpac")).To(BeARegularFile())
+
+			// sqlpackage is replaced by a script listing the dacpacs next to its source file
+			dir := GinkgoT().TempDir()
+			runs := filepath.Join(dir, "runs")
+			script := filepath.Join(dir, "sqlpackage")
+			Expect(os.WriteFile(script, []byte("#!/bin/sh\nsource=${1#/SourceFile:}\nls \"$(dirname \"$source\")\" >> "+runs+"\n"), 0o700)).To(Succeed())
+			DeferCleanup(viper.Set, config.SQLPackageCMDKey, viper.GetString(config.SQLPackageCMDKey))
+			viper.Set(config.SQLPackageCMDKey, script)
+
+			executed, err := cluster.Execute(context.Background(), targets, executionConfiguration)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(executed.Schemas).To(ConsistOf("tenant_a", "tenant_b"))
+			content, err := os.ReadFile(runs)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(strings.Count(string(content), "shared.dacpac")).To(Equal(2))
+			Expect(strings.Count(string(content), "tenant-")).To(BeNumerically(">=", 2))
+
+			// the tenant dacpacs are removed once executed
+			entries, err := os.ReadDir(workDir)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(entries).To(HaveLen(2))
+		})
 	})
 	if liveTest {
 		Context("when testing sqlpackage with a live server", Label("live"), func() {
-			cluster := sqlutils.NewSQLCluster(testCluster+".database.windows.net", nil, nil)
+			cluster := sqlutils.NewSQLCluster(testCluster+".database.windows.net", nil, nil, nil)
 			filter := schemav1alpha1.TargetFilter{
 				DB:     "DB1",
 				Schema: "db1111",
 			}
 			It("Should acquire requested targets and prepare for execution", func() {
-				clusterTargets, err := cluster.AquireTargets(filter)
+				clusterTargets, err := cluster.AquireTargets(context.Background(), filter)
 				Expect(err).NotTo(HaveOccurred())
 				Expect(clusterTargets.Schemas).To(HaveLen(1))
 			})
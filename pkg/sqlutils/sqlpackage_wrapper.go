@@ -3,9 +3,7 @@ package sqlutils
 // Copyright (c) Microsoft Corporation.
 // Licensed under the MIT License.
 import (
-	"archive/zip"
-	"crypto/sha256"
-	"encoding/hex"
+	"context"
 	"fmt"
 	"io"
 	"os"
@@ -13,16 +11,20 @@ import (
 	"strings"
 
 	"github.com/microsoft/azure-schema-operator/pkg/config"
+	"github.com/microsoft/azure-schema-operator/pkg/runlogs"
+	"github.com/microsoft/azure-schema-operator/pkg/utils"
 	"github.com/rs/zerolog"
 	"github.com/rs/zerolog/log"
 	"github.com/spf13/viper"
 )
 
+// errorTailBytes is the size of the output tail logged on failures
+const errorTailBytes = 2048
+
 var (
 	useMSI          bool
 	sqlpackgeUser   string
 	sqlpackgePass   string
-	sqlpackgeCmd    string
 	parallelWorkers int
 )
 
@@ -34,144 +36,46 @@ func init() {
 	useMSI = viper.GetBool(config.AzureUseMSIKey)
 	sqlpackgeUser = strings.TrimSpace(viper.GetString(config.SQLPackageUser))
 	sqlpackgePass = strings.TrimSpace(viper.GetString(config.SQLPackagePass))
-	sqlpackgeCmd = strings.TrimSpace(viper.GetString(config.SQLPackageCMDKey))
 	parallelWorkers = viper.GetInt(config.ParallelWorkers)
 }
 
-// updateDacPac creates a duplicate dacpac with the source schema replaced with a destenation schema.
-// this is used to support multi-tenant solutions with schema per tenant.
-func updateDacPac(dstDacPac string, srcDacPac string, sourceSchema, tenantSchema string) error {
-
-	srcChecksum := ""
-	dstChecksum := ""
-	var originContent []byte
-
-	darchive, err := os.Create(dstDacPac)
-	if err != nil {
-		log.Error().Err(err).Msgf("failed to create destination file at %s", dstDacPac)
-		return err
-	}
-	defer darchive.Close()
-	zipWriter := zip.NewWriter(darchive)
-
-	archive, err := zip.OpenReader(srcDacPac)
-	if err != nil {
-		log.Error().Err(err).Msgf("Failed to open source dacpac at %s", srcDacPac)
-		panic(err)
-	}
-	defer archive.Close()
-
-	for _, f := range archive.File {
-		switch f.Name {
-		case "model.xml":
-			dstChecksum, srcChecksum = replaceContent(zipWriter, f, sourceSchema, tenantSchema)
-		case "refactor.xml":
-			replaceContent(zipWriter, f, sourceSchema, tenantSchema)
-		case "postdeploy.sql":
-			replaceContent(zipWriter, f, sourceSchema, tenantSchema)
-		case "predeploy.sql":
-			replaceContent(zipWriter, f, sourceSchema, tenantSchema)
-		case "Origin.xml":
-			log.Info().Msg("handeling origin file - getting content")
-			fileInArchive, err := f.Open()
-			if err != nil {
-				panic(err)
-			}
-
-			originContent, err = io.ReadAll(fileInArchive)
-			if err != nil {
-				panic(err)
-			}
-		default:
-			log.Info().Msg("other files - just copy")
-			dstFile, err := zipWriter.Create(f.Name)
-			if err != nil {
-				panic(err)
-			}
-			fileInArchive, err := f.Open()
-			if err != nil {
-				panic(err)
-			}
-			if _, err := io.Copy(dstFile, fileInArchive); err != nil {
-				panic(err)
-			}
-			fileInArchive.Close()
-		}
-	}
-
-	log.Info().Msg("updating origin file with new checksum")
-	err = updateOriginXML(zipWriter, originContent, srcChecksum, dstChecksum)
-	if err != nil {
-		panic(err)
-	}
-
-	log.Debug().Msg("closing zip archive...")
-	zipWriter.Close()
-	return nil
+// sqlPackageCommand returns the path of the sqlpackage binary, it is read on each run so it can be replaced (e.g. by tests)
+func sqlPackageCommand() string {
+	return strings.TrimSpace(viper.GetString(config.SQLPackageCMDKey))
 }
 
-func replaceContent(zipWriter *zip.Writer, f *zip.File, sourceSchema string, tenantSchema string) (string, string) {
-	log.Info().Msg("handeling model file - replace schema")
-	dstFile, err := zipWriter.Create(f.Name)
-	if err != nil {
-		panic(err)
-	}
-	fileInArchive, err := f.Open()
-	if err != nil {
-		panic(err)
-	}
-
-	read, err := io.ReadAll(fileInArchive)
-	if err != nil {
-		panic(err)
-	}
-
-	newContents := strings.Replace(string(read), sourceSchema, tenantSchema, -1)
-
-	n, err := dstFile.Write([]byte(newContents))
-	if err != nil {
-		panic(err)
-	}
-	log.Debug().Msgf("write n: %d bytes\n", n)
-
-	log.Debug().Msg("compute new models checksum")
-	fileInArchive.Close()
-	hasher := sha256.New()
-	hasher.Write([]byte(newContents))
-	dstChecksum := strings.ToUpper(hex.EncodeToString(hasher.Sum(nil)))
-
-	hasher.Reset()
-	hasher.Write(read)
-	srcChecksum := strings.ToUpper(hex.EncodeToString(hasher.Sum(nil)))
-
-	log.Debug().Msgf("source check sum: %s \n", srcChecksum)
-	log.Debug().Msgf("new checksum: %s \n", dstChecksum)
-	return dstChecksum, srcChecksum
+// RunDacPac runs DacPac on a target DB by using sqlpackage, its output is written to `output` as well as the log.
+// The process and its children are killed if the context is done.
+func RunDacPac(ctx context.Context, dacPacFile string, targetServer string, targetDB string, sqlpackageOptions string, output io.Writer) error {
+	return runSQLPackage(ctx, []string{"/Action:Publish"}, dacPacFile, targetServer, targetDB, sqlpackageOptions, output)
 }
 
-func updateOriginXML(zipWriter *zip.Writer, originContent []byte, srcChecksum, dstChecksum string) error {
-
-	dstOriginFile, err := zipWriter.Create("Origin.xml")
-	if err != nil {
-		// panic(err)
-		return err
-	}
-	newContents := strings.Replace(string(originContent), srcChecksum, dstChecksum, -1)
+// ScriptDacPac creates the deployment script of the dacpac on the target DB with sqlpackage, without applying it.
+// The script is written to `scriptFile`.
+func ScriptDacPac(ctx context.Context, dacPacFile string, targetServer string, targetDB string, sqlpackageOptions string, scriptFile string, output io.Writer) error {
+	return runSQLPackage(ctx, []string{"/Action:Script", "/OutputPath:" + scriptFile}, dacPacFile, targetServer, targetDB, sqlpackageOptions, output)
+}
 
-	n, err := dstOriginFile.Write([]byte(newContents))
-	if err != nil {
-		// panic(err)
-		return err
+// ExtractDacPac extracts the schema of the source DB into a dacpac with sqlpackage.
+// The dacpac is written to `dacPacFile`.
+func ExtractDacPac(ctx context.Context, sourceServer string, sourceDB string, dacPacFile string, output io.Writer) error {
+	log.Debug().Str("sourceServer", sourceServer).Str("sourceDB", sourceDB).Msgf("about to extract with sqlpackage to: %s", dacPacFile)
+	args := []string{"/Action:Extract", "/TargetFile:" + dacPacFile, "/OverwriteFiles:true"}
+	if useMSI {
+		log.Debug().Msg("Using MSI - no auth info needed")
+		connString := fmt.Sprintf("Server=%s;database=%s;Authentication=ActiveDirectoryMSI", sourceServer, sourceDB)
+		args = append(args, "/scs:"+connString)
+	} else {
+		args = append(args, "/ssn:"+sourceServer, "/SourceDatabaseName:"+sourceDB)
+		args = append(args, "/su:"+sqlpackgeUser, "/sp:"+sqlpackgePass)
 	}
-	log.Info().Msgf("write n: %d bytes into Origin.xml", n)
-
-	return nil
+	return execSQLPackage(ctx, args, dacPacFile, output)
 }
 
-// RunDacPac runs DacPac on a target DB by using sqlpackage.
-func RunDacPac(dacPacFile string, targetServer string, targetDB string, sqlpackageOptions string) error {
+// runSQLPackage runs a sqlpackage action on the dacpac and target DB
+func runSQLPackage(ctx context.Context, action []string, dacPacFile string, targetServer string, targetDB string, sqlpackageOptions string, output io.Writer) error {
 	log.Debug().Str("targetServer", targetServer).Str("targetDB", targetDB).Msgf("about to run sqlpackage on: %s", dacPacFile)
-	args := []string{"/SourceFile:" + dacPacFile, "/Action:Publish"}
+	args := append([]string{"/SourceFile:" + dacPacFile}, action...)
 
 	if sqlpackageOptions != "" {
 		optionsArray := strings.Split(sqlpackageOptions, " ")
@@ -186,20 +90,27 @@ func RunDacPac(dacPacFile string, targetServer string, targetDB string, sqlpacka
 		args = append(args, "/tsn:"+targetServer, "/TargetDatabaseName:"+targetDB)
 		args = append(args, "/tu:"+sqlpackgeUser, "/tp:"+sqlpackgePass)
 	}
-	cmd := exec.Command(sqlpackgeCmd, args...)
+	return execSQLPackage(ctx, args, dacPacFile, output)
+}
+
+// execSQLPackage runs sqlpackage with the arguments, the output is logged with the dacpac file name
+func execSQLPackage(ctx context.Context, args []string, dacPacFile string, output io.Writer) error {
+	cmd := exec.Command(sqlPackageCommand(), args...)
 	cmd.Env = append(os.Environ(),
 		"PATH=/bin/",
 	)
-	cmd.Stdout = log.Level(zerolog.InfoLevel).With().Str("sqlpackage", dacPacFile).Logger()
-	cmd.Stderr = log.Level(zerolog.ErrorLevel).With().Str("sqlpackage", dacPacFile).Logger()
-	err := cmd.Run()
+	tail := runlogs.NewCapture(errorTailBytes)
+	cmd.Stdout = io.MultiWriter(log.Level(zerolog.InfoLevel).With().Str("sqlpackage", dacPacFile).Logger(), output, tail)
+	cmd.Stderr = io.MultiWriter(log.Level(zerolog.ErrorLevel).With().Str("sqlpackage", dacPacFile).Logger(), output, tail)
+	err := utils.RunCommand(ctx, cmd)
 	if err != nil {
+		fmt.Fprintf(output, "sqlpackage failed: %s\n", err)
 		eerr, ok := err.(*exec.ExitError)
 		if ok {
-			log.Error().Err(eerr).Msgf("cmd.Run() failed with exit code: %d, error: %s ", eerr.ExitCode(), string(eerr.Stderr))
-			return err
+			log.Error().Err(eerr).Msgf("sqlpackage failed with exit code: %d, output: %s", eerr.ExitCode(), tail.Tail(errorTailBytes))
+			return fmt.Errorf("sqlpackage failed with exit code %d: %w", eerr.ExitCode(), err)
 		}
-		log.Error().Err(err).Msg("cmd.Run() failed ")
+		log.Error().Err(err).Msg("sqlpackage failed")
 		return err
 	}
 	log.Info().Msgf("Execution of %s done", dacPacFile)
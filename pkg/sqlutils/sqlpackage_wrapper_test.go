@@ -3,12 +3,17 @@ package sqlutils_test
 // Copyright (c) Microsoft Corporation.
 // Licensed under the MIT License.
 import (
+	"context"
+	"io"
+	"os"
+	"path/filepath"
 	"strings"
 
 	. "github.com/onsi/ginkgo/v2"
 	. "github.com/onsi/gomega"
 	"github.com/spf13/viper"
 
+	"github.com/microsoft/azure-schema-operator/pkg/schemadiff"
 	"github.com/microsoft/azure-schema-operator/pkg/sqlutils"
 )
 
@@ -24,16 +29,24 @@ var _ = Describe("SqlpackageWrapper", func() {
 				Expect(err).NotTo(HaveOccurred())
 
 				It("should execute the original dacpac without errors", func() {
-					err := sqlutils.RunDacPac(dacpac, clusterUri, dbName, "")
+					err := sqlutils.RunDacPac(context.Background(), dacpac, clusterUri, dbName, "", io.Discard)
 					Expect(err).To(Not(HaveOccurred()))
 				})
 				It("Should modify the dacpac and run it", func() {
-					success, err := sqlutils.TargetDacpacExecution(clusterUri, dbName, "", dacpac, "TestTenant", "schema1")
+					success, err := sqlutils.TargetDacpacExecution(context.Background(), clusterUri, dbName, "", dacpac, "TestTenant", "schema1", sqlutils.SchemaRenameXML)
 					Expect(err).To(Not(HaveOccurred()))
 					Expect(success).To(BeTrue())
 				})
 			}
 
+			It("should extract the DB into a dacpac", func() {
+				dacpac := filepath.Join(GinkgoT().TempDir(), "extracted.dacpac")
+				err := sqlutils.ExtractDacPac(context.Background(), clusterUri, dbName, dacpac, io.Discard)
+				Expect(err).To(Not(HaveOccurred()))
+				data, err := os.ReadFile(dacpac)
+				Expect(err).To(Not(HaveOccurred()))
+				Expect(schemadiff.IsDacPac(data)).To(BeTrue())
+			})
 		})
 	}
 })
@@ -14,6 +14,8 @@ import (
 var (
 	liveTest    bool
 	testCluster = strings.TrimSpace(viper.GetString("schemaop_test_sqlserver_cluster_name"))
+	// testPostgresServer is the host[:port] of the local PostgreSQL container, see `task pkg:test-postgres`
+	testPostgresServer = strings.TrimSpace(viper.GetString("schemaop_test_postgres_server"))
 )
 
 func TestSqlutils(t *testing.T) {
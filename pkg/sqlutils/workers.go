@@ -0,0 +1,109 @@
+package sqlutils
+
+// Copyright (c) Microsoft Corporation.
+// Licensed under the MIT License.
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/hashicorp/go-multierror"
+	schemav1alpha1 "github.com/microsoft/azure-schema-operator/apis/dbschema/v1alpha1"
+	"github.com/microsoft/azure-schema-operator/pkg/utils"
+	"github.com/rs/zerolog/log"
+)
+
+// schemaRunFunc executes the change on a single target schema.
+type schemaRunFunc func(ctx context.Context, targetSchema string) (bool, error)
+
+type schemaResult struct {
+	schema   string
+	executed bool
+	err      error
+}
+
+// workersFromConfig returns the number of parallel workers configured for the execution.
+func workersFromConfig(config schemav1alpha1.ExecutionConfiguration) int {
+	noOfWorkers := parallelWorkers
+	if workers, ok := config.Properties["parallelWorkers"]; ok {
+		configured, err := strconv.Atoi(workers)
+		if err != nil || configured < 1 {
+			log.Warn().Msgf("invalid parallelWorkers value %q - using %d workers", workers, noOfWorkers)
+		} else {
+			noOfWorkers = configured
+		}
+	}
+	return noOfWorkers
+}
+
+// runPerSchema runs `run` on every schema with a pool of `noOfWorkers` workers.
+// The executed schemas are returned along with a multi-error of the schemas that failed.
+// No new schemas are started once the context is done.
+func runPerSchema(ctx context.Context, noOfWorkers int, schemas []string, notifier utils.NotifyProgressFunc, run schemaRunFunc) (schemav1alpha1.ClusterTargets, error) {
+	jobs := make(chan string, noOfWorkers)
+	results := make(chan schemaResult, noOfWorkers)
+	go func() {
+		defer close(jobs)
+		for _, schema := range schemas {
+			select {
+			case jobs <- schema:
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+	var wg sync.WaitGroup
+	for i := 0; i < noOfWorkers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for schema := range jobs {
+				executed, err := run(ctx, schema)
+				results <- schemaResult{schema, executed, err}
+			}
+		}()
+	}
+	go func() {
+		wg.Wait()
+		close(results)
+	}()
+	executed, err := collectResults(notifier, len(schemas), results)
+	if err == nil && ctx.Err() != nil {
+		err = fmt.Errorf("execution stopped after %d/%d schemas: %w", len(executed.Schemas), len(schemas), ctx.Err())
+	}
+	return executed, err
+}
+
+func collectResults(notifier utils.NotifyProgressFunc, total int, results chan schemaResult) (schemav1alpha1.ClusterTargets, error) {
+	executed := schemav1alpha1.ClusterTargets{}
+	soFar := 0
+	lastPCT := 0
+	doneSchemas := make([]string, 0)
+	failedSchemas := make([]string, 0)
+	var executionErr *multierror.Error
+	for result := range results {
+		soFar = soFar + 1
+		if result.executed {
+			doneSchemas = append(doneSchemas, result.schema)
+		} else {
+			log.Error().Err(result.err).Msgf("Failed to execute on %s", result.schema)
+			failedSchemas = append(failedSchemas, result.schema)
+			executionErr = multierror.Append(executionErr, fmt.Errorf("schema %s: %w", result.schema, result.err))
+		}
+		// notify on every 10 percent of progress
+		pct := soFar * 100 / total / 10 * 10
+		if pct > lastPCT && notifier != nil {
+			lastPCT = pct
+			notifier(pct)
+		}
+	}
+	executed.Schemas = doneSchemas
+	if executionErr != nil {
+		sort.Strings(failedSchemas)
+		return executed, fmt.Errorf("failed to execute on %d/%d schemas [%s]: %w", len(failedSchemas), total, strings.Join(failedSchemas, ","), executionErr.ErrorOrNil())
+	}
+	return executed, nil
+}
@@ -0,0 +1,36 @@
+package utils
+
+// Copyright (c) Microsoft Corporation.
+// Licensed under the MIT License.
+import (
+	"context"
+	"fmt"
+	"os/exec"
+
+	"github.com/rs/zerolog/log"
+)
+
+// RunCommand runs the command in its own process group.
+// When the context is done the whole group is killed - so processes spawned by the command
+// (e.g. the dotnet children of sqlpackage) don't keep running - and the context error is returned.
+func RunCommand(ctx context.Context, cmd *exec.Cmd) error {
+	setProcessGroup(cmd)
+	if err := cmd.Start(); err != nil {
+		return err
+	}
+	waitDone := make(chan error, 1)
+	go func() {
+		waitDone <- cmd.Wait()
+	}()
+	select {
+	case err := <-waitDone:
+		return err
+	case <-ctx.Done():
+		log.Info().Msgf("stopping %s (pid %d): %s", cmd.Path, cmd.Process.Pid, ctx.Err())
+		if err := killProcessGroup(cmd); err != nil {
+			log.Error().Err(err).Msgf("failed to kill the process group of %s", cmd.Path)
+		}
+		err := <-waitDone
+		return fmt.Errorf("%s stopped (%v): %w", cmd.Path, err, ctx.Err())
+	}
+}
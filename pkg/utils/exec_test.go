@@ -0,0 +1,51 @@
+//go:build linux
+
+package utils_test
+
+// Copyright (c) Microsoft Corporation.
+// Licensed under the MIT License.
+import (
+	"context"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/microsoft/azure-schema-operator/pkg/utils"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("RunCommand", func() {
+	It("Should run the command to completion", func() {
+		err := utils.RunCommand(context.Background(), exec.Command("sh", "-c", "exit 0"))
+		Expect(err).NotTo(HaveOccurred())
+		err = utils.RunCommand(context.Background(), exec.Command("sh", "-c", "exit 3"))
+		Expect(err).To(HaveOccurred())
+		Expect(err).NotTo(MatchError(context.DeadlineExceeded))
+	})
+
+	It("Should kill the whole process group on timeout", func() {
+		pidFile := filepath.Join(GinkgoT().TempDir(), "child.pid")
+		cmd := exec.Command("sh", "-c", "sleep 30 & echo $! > "+pidFile+"; wait")
+		ctx, cancel := context.WithTimeout(context.Background(), 500*time.Millisecond)
+		defer cancel()
+
+		start := time.Now()
+		err := utils.RunCommand(ctx, cmd)
+		Expect(err).To(MatchError(context.DeadlineExceeded))
+		Expect(time.Since(start)).To(BeNumerically("<", 10*time.Second))
+
+		content, err := os.ReadFile(pidFile)
+		Expect(err).NotTo(HaveOccurred())
+		pid, err := strconv.Atoi(strings.TrimSpace(string(content)))
+		Expect(err).NotTo(HaveOccurred())
+		// the orphaned child is either gone or a zombie waiting to be reaped
+		Eventually(func() bool {
+			stat, err := os.ReadFile("/proc/" + strconv.Itoa(pid) + "/stat")
+			return err != nil || strings.Contains(string(stat), ") Z ")
+		}).Should(BeTrue())
+	})
+})
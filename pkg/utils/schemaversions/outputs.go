@@ -0,0 +1,121 @@
+package schemaversions
+
+// Copyright (c) Microsoft Corporation.
+// Licensed under the MIT License.
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	schemav1alpha1 "github.com/microsoft/azure-schema-operator/apis/dbschema/v1alpha1"
+	"github.com/rs/zerolog/log"
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/apimachinery/pkg/util/validation"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+// OutputVersionSuffix is the suffix of the output key holding the version of a published value
+const OutputVersionSuffix = ".version"
+
+// PublishOutputs merges the execution `outputs` into the target `ConfigMap`.
+// The target must be in the namespace of the owning executer. The `ConfigMap` is created
+// (owned by the executer) if it doesn't exist, existing keys are overridden so consumers
+// mounting the map observe the change. `ConfigMaps` not owned by an executer are never modified.
+func PublishOutputs(ctx context.Context, c client.Client, owner *schemav1alpha1.ClusterExecuter, target schemav1alpha1.NamespacedName, outputs map[string]string) error {
+	if len(outputs) == 0 {
+		return nil
+	}
+	if target.Namespace == "" {
+		target.Namespace = owner.Namespace
+	}
+	if target.Namespace != owner.Namespace {
+		return fmt.Errorf("output configMap %s/%s must be in the deployment namespace %s", target.Namespace, target.Name, owner.Namespace)
+	}
+	for key := range outputs {
+		if errs := validation.IsConfigMapKey(key); len(errs) > 0 {
+			return fmt.Errorf("invalid output key %q: %s", key, strings.Join(errs, ", "))
+		}
+	}
+	ownerRef := ownerReference(owner)
+
+	cfgMap := &v1.ConfigMap{}
+	err := c.Get(ctx, types.NamespacedName(target), cfgMap)
+	if err != nil && errors.IsNotFound(err) {
+		log.Info().Msgf("creating output configMap %s/%s", target.Namespace, target.Name)
+		cfgMap = &v1.ConfigMap{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:            target.Name,
+				Namespace:       target.Namespace,
+				OwnerReferences: []metav1.OwnerReference{ownerRef},
+			},
+			Data: outputs,
+		}
+		err = c.Create(ctx, cfgMap)
+		if err != nil {
+			log.Error().Err(err).Msg("Failed to create output configMap")
+		}
+		return err
+	} else if err != nil {
+		log.Error().Err(err).Msg("Failed to get output configMap")
+		return err
+	}
+
+	if !ownedByExecuter(cfgMap) {
+		return fmt.Errorf("output configMap %s/%s is not owned by a schema deployment", target.Namespace, target.Name)
+	}
+	changed := addOwnerReference(cfgMap, ownerRef)
+	if cfgMap.Data == nil {
+		cfgMap.Data = make(map[string]string)
+	}
+	for key, val := range outputs {
+		if cfgMap.Data[key] != val {
+			cfgMap.Data[key] = val
+			changed = true
+		}
+	}
+	if !changed {
+		log.Debug().Msg("output configMap already up to date")
+		return nil
+	}
+	err = c.Update(ctx, cfgMap)
+	if err != nil {
+		log.Error().Err(err).Msg("Failed to update output configMap")
+	}
+	return err
+}
+
+// ownerReference references the executer as a (non controlling) owner,
+// the map is kept as long as one of the executers publishing to it exists.
+func ownerReference(owner *schemav1alpha1.ClusterExecuter) metav1.OwnerReference {
+	gvk := schemav1alpha1.GroupVersion.WithKind("ClusterExecuter")
+	return metav1.OwnerReference{
+		APIVersion: gvk.GroupVersion().String(),
+		Kind:       gvk.Kind,
+		Name:       owner.Name,
+		UID:        owner.UID,
+	}
+}
+
+// ownedByExecuter returns true if the `ConfigMap` was created by an executer
+func ownedByExecuter(cfgMap *v1.ConfigMap) bool {
+	for _, ref := range cfgMap.OwnerReferences {
+		if ref.Kind == "ClusterExecuter" && strings.HasPrefix(ref.APIVersion, schemav1alpha1.GroupVersion.Group+"/") {
+			return true
+		}
+	}
+	return false
+}
+
+// addOwnerReference adds the reference unless already present, returns true if added
+func addOwnerReference(cfgMap *v1.ConfigMap, ref metav1.OwnerReference) bool {
+	for _, existing := range cfgMap.OwnerReferences {
+		if existing.UID == ref.UID {
+			return false
+		}
+	}
+	cfgMap.OwnerReferences = append(cfgMap.OwnerReferences, ref)
+	return true
+}
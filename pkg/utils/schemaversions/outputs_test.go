@@ -0,0 +1,105 @@
+package schemaversions_test
+
+// Copyright (c) Microsoft Corporation.
+// Licensed under the MIT License.
+import (
+	"context"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+
+	schemav1alpha1 "github.com/microsoft/azure-schema-operator/apis/dbschema/v1alpha1"
+	"github.com/microsoft/azure-schema-operator/pkg/utils/schemaversions"
+)
+
+var _ = Describe("Outputs", func() {
+	target := schemav1alpha1.NamespacedName{Namespace: "default", Name: "schema-ids"}
+	owner := &schemav1alpha1.ClusterExecuter{
+		ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: "events-1-schematest", UID: "exec-uid"},
+	}
+	ownedBy := func(uid types.UID) []metav1.OwnerReference {
+		return []metav1.OwnerReference{{
+			APIVersion: schemav1alpha1.GroupVersion.String(),
+			Kind:       "ClusterExecuter",
+			Name:       "events-0-schematest",
+			UID:        uid,
+		}}
+	}
+	ctx := context.Background()
+
+	It("Should create the output configMap when missing", func() {
+		c := fake.NewClientBuilder().Build()
+		err := schemaversions.PublishOutputs(ctx, c, owner, target, map[string]string{"orders": "id-1", "orders.version": "1"})
+		Expect(err).NotTo(HaveOccurred())
+		cfgMap := &v1.ConfigMap{}
+		Expect(c.Get(ctx, types.NamespacedName(target), cfgMap)).To(Succeed())
+		Expect(cfgMap.Data).To(HaveKeyWithValue("orders", "id-1"))
+		Expect(cfgMap.Data).To(HaveKeyWithValue("orders.version", "1"))
+		Expect(cfgMap.OwnerReferences).To(HaveLen(1))
+		Expect(cfgMap.OwnerReferences[0].UID).To(Equal(owner.UID))
+		Expect(cfgMap.OwnerReferences[0].Kind).To(Equal("ClusterExecuter"))
+	})
+
+	It("Should merge outputs into an existing configMap", func() {
+		existing := &v1.ConfigMap{
+			ObjectMeta: metav1.ObjectMeta{Namespace: target.Namespace, Name: target.Name, OwnerReferences: ownedBy("prev-uid")},
+			Data:       map[string]string{"payments": "id-7", "orders": "id-1"},
+		}
+		c := fake.NewClientBuilder().WithObjects(existing).Build()
+		err := schemaversions.PublishOutputs(ctx, c, owner, target, map[string]string{"orders": "id-2"})
+		Expect(err).NotTo(HaveOccurred())
+		cfgMap := &v1.ConfigMap{}
+		Expect(c.Get(ctx, types.NamespacedName(target), cfgMap)).To(Succeed())
+		Expect(cfgMap.Data).To(Equal(map[string]string{"payments": "id-7", "orders": "id-2"}))
+		Expect(cfgMap.OwnerReferences).To(HaveLen(2))
+	})
+
+	It("Should refuse configMaps not created by an executer", func() {
+		existing := &v1.ConfigMap{
+			ObjectMeta: metav1.ObjectMeta{Namespace: target.Namespace, Name: target.Name},
+			Data:       map[string]string{"orders": "id-1"},
+		}
+		c := fake.NewClientBuilder().WithObjects(existing).Build()
+		err := schemaversions.PublishOutputs(ctx, c, owner, target, map[string]string{"orders": "id-2"})
+		Expect(err).To(HaveOccurred())
+		cfgMap := &v1.ConfigMap{}
+		Expect(c.Get(ctx, types.NamespacedName(target), cfgMap)).To(Succeed())
+		Expect(cfgMap.Data).To(Equal(map[string]string{"orders": "id-1"}))
+	})
+
+	It("Should refuse targets outside the deployment namespace", func() {
+		c := fake.NewClientBuilder().Build()
+		other := schemav1alpha1.NamespacedName{Namespace: "kube-system", Name: "schema-ids"}
+		err := schemaversions.PublishOutputs(ctx, c, owner, other, map[string]string{"orders": "id-1"})
+		Expect(err).To(HaveOccurred())
+		cfgMap := &v1.ConfigMap{}
+		Expect(c.Get(ctx, types.NamespacedName(other), cfgMap)).NotTo(Succeed())
+	})
+
+	It("Should default the target namespace to the deployment namespace", func() {
+		c := fake.NewClientBuilder().Build()
+		err := schemaversions.PublishOutputs(ctx, c, owner, schemav1alpha1.NamespacedName{Name: target.Name}, map[string]string{"orders": "id-1"})
+		Expect(err).NotTo(HaveOccurred())
+		cfgMap := &v1.ConfigMap{}
+		Expect(c.Get(ctx, types.NamespacedName(target), cfgMap)).To(Succeed())
+	})
+
+	It("Should refuse invalid output keys", func() {
+		c := fake.NewClientBuilder().Build()
+		err := schemaversions.PublishOutputs(ctx, c, owner, target, map[string]string{"orders/v1": "id-1"})
+		Expect(err).To(HaveOccurred())
+		cfgMap := &v1.ConfigMap{}
+		Expect(c.Get(ctx, types.NamespacedName(target), cfgMap)).NotTo(Succeed())
+	})
+
+	It("Should do nothing without outputs", func() {
+		c := fake.NewClientBuilder().Build()
+		Expect(schemaversions.PublishOutputs(ctx, c, owner, target, nil)).To(Succeed())
+		cfgMap := &v1.ConfigMap{}
+		Expect(c.Get(ctx, types.NamespacedName(target), cfgMap)).NotTo(Succeed())
+	})
+})
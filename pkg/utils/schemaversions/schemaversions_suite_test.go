@@ -0,0 +1,15 @@
+package schemaversions_test
+
+// Copyright (c) Microsoft Corporation.
+// Licensed under the MIT License.
+import (
+	"testing"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+func TestSchemaversions(t *testing.T) {
+	RegisterFailHandler(Fail)
+	RunSpecs(t, "Schemaversions Suite")
+}
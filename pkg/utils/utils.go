@@ -4,6 +4,7 @@
 package utils
 
 import (
+	"errors"
 	"os"
 
 	"github.com/rs/zerolog/log"
@@ -24,3 +25,6 @@ func CleanupFile(filename string) error {
 
 // NotifyProgressFunc Type representing a progress notification type
 type NotifyProgressFunc func(int)
+
+// ErrNoMatchingTargets is returned when the target filter didn't match any target on the cluster
+var ErrNoMatchingTargets = errors.New("no targets matched the filter")